@@ -0,0 +1,387 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"needle/internal/needle"
+	"needle/internal/needle/evaluator"
+	"needle/internal/needle/lsp"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Exit codes of the needle command.
+const (
+	ExitOK      = 0
+	ExitRuntime = 1 // uncaught exception or other failure
+	ExitUsage   = 2 // bad command line
+	ExitCompile = 3 // syntax or resolution error
+)
+
+type command struct {
+	name  string
+	args  string
+	about string
+	run   func(args []string) error
+}
+
+func commands() []*command {
+	return []*command{
+		{"run", "[run flags] <file> [args...]", "run a script", runCommand},
+		{"repl", "", "start the interactive shell", replCommand},
+		{"test", "[test flags] [paths...]", "run the *_test.ndl suites under paths", testCommand},
+		{"check", "[--types] <files...>", "parse and resolve scripts without running them", checkCommand},
+		{"fmt", "[-w] [--check] <files...>", "print scripts in canonical form", fmtCommand},
+		{"lint", "[lint flags] <files...>", "report likely bugs in scripts", lintCommand},
+		{"doc", "[doc flags] [files...]", "write the documentation of scripts and builtins", docCommand},
+		{"highlight", "[--html] <file>", "print a script with syntax highlighting", highlightCommand},
+		{"tokens", "<file>", "print the tokens of a script", tokensCommand},
+		{"ast", "<file>", "print the syntax tree of a script", astCommand},
+		{"debug", "[--dap] <file> [args...]", "run a script in the debugger", debugCommand},
+		{"lsp", "", "start the language server on stdin and stdout", lspCommand},
+	}
+}
+
+type usageError struct {
+	message string
+}
+
+func (err *usageError) Error() string {
+	return err.message
+}
+
+func usagef(format string, a ...any) error {
+	return &usageError{message: fmt.Sprintf(format, a...)}
+}
+
+// Main runs the needle command with args, without the program name, and
+// returns the exit code.
+func Main(args []string) int {
+	err := dispatch(args)
+	if err == nil {
+		return ExitOK
+	}
+	var usageErr *usageError
+	var compileErr *needle.CompileError
+	var exit *evaluator.Exit
+	switch {
+	case errors.As(err, &exit):
+		return exit.Code
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(os.Stderr, "needle: %s\nRun 'needle --help' for usage.\n", err)
+		return ExitUsage
+	case errors.As(err, &compileErr):
+		printError(os.Stderr, err)
+		return ExitCompile
+	default:
+		printError(os.Stderr, err)
+		return ExitRuntime
+	}
+}
+
+func dispatch(args []string) error {
+	flags := flag.NewFlagSet("needle", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	var help, version bool
+	var code string
+	flags.BoolVar(&help, "h", false, "")
+	flags.BoolVar(&help, "help", false, "")
+	flags.BoolVar(&version, "v", false, "")
+	flags.BoolVar(&version, "version", false, "")
+	flags.StringVar(&code, "e", "", "")
+	if err := flags.Parse(args); err != nil {
+		return usagef("%s", err)
+	}
+	switch {
+	case help:
+		printUsage(os.Stdout)
+		return nil
+	case version:
+		fmt.Println("needle", needle.Version)
+		return nil
+	case isFlagSet(flags, "e"):
+		return RunCode(code, flags.Args())
+	}
+	rest := flags.Args()
+	if len(rest) == 0 {
+		return RunRepl()
+	}
+	for _, c := range commands() {
+		if c.name == rest[0] {
+			return c.run(rest[1:])
+		}
+	}
+	if strings.HasSuffix(rest[0], ".ndl") {
+		return runCommand(rest)
+	}
+	return usagef("unknown command '%s'", rest[0])
+}
+
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: needle [flags] [command] [arguments]")
+	fmt.Fprintln(w)
+	// the first column is as wide as the longest command synopsis
+	width := 0
+	for _, c := range commands() {
+		width = max(width, len(strings.TrimSpace(c.name+" "+c.args)))
+	}
+	row := func(name, about string) {
+		fmt.Fprintf(w, "  %-*s  %s\n", width, name, about)
+	}
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands() {
+		row(strings.TrimSpace(c.name+" "+c.args), c.about)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Without a command needle starts the interactive shell,")
+	fmt.Fprintln(w, "'needle <file>.ndl' is short for 'needle run <file>.ndl'.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags:")
+	row("-e <code>", "run code given on the command line")
+	row("-h, --help", "print this help")
+	row("-v, --version", "print the version")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run flags:")
+	row("--profile", "print the time spent in each function")
+	row("--pprof <file>", "write the profile for 'go tool pprof'")
+	row("--folded <file>", "write the profile as folded stacks")
+	row("--stats", "print node, allocation and call depth counts")
+	row("--check-types", "check values against type annotations")
+	row("--sandbox <dirs>", "confine files to dirs, separated by ':', and disable 'process'")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Test flags:")
+	row("--cover", "print the coverage of the tested scripts")
+	row("--lcov <file>", "write the coverage as an LCOV tracefile")
+	row("--html <file>", "write the coverage as annotated sources")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Check flags:")
+	row("--types", "check the types of values against annotations")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Lint flags:")
+	row("--json", "print the problems as JSON")
+	row("--enable <rules>", "run only these rules, by ID or name")
+	row("--disable <rules>", "don't run these rules")
+	row("--rules", "list the rules")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Doc flags:")
+	row("--out <dir>", "write the pages to dir, required")
+	row("--md", "write Markdown instead of HTML")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Highlight flags:")
+	row("--html", "print an HTML page instead of terminal colors")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Exit codes:")
+	row(strconv.Itoa(ExitOK), "success")
+	row(strconv.Itoa(ExitRuntime), "runtime error")
+	row(strconv.Itoa(ExitUsage), "usage error")
+	row(strconv.Itoa(ExitCompile), "compile error")
+}
+
+func runCommand(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	var opts RunOptions
+	flags.BoolVar(&opts.Profile, "profile", false, "")
+	flags.StringVar(&opts.Pprof, "pprof", "", "")
+	flags.StringVar(&opts.Folded, "folded", "", "")
+	flags.BoolVar(&opts.Stats, "stats", false, "")
+	flags.BoolVar(&opts.CheckTypes, "check-types", false, "")
+	flags.StringVar(&opts.Sandbox, "sandbox", "", "")
+	if err := flags.Parse(args); err != nil {
+		return usagef("run: %s", err)
+	}
+	if flags.NArg() == 0 {
+		return usagef("run: missing script file")
+	}
+	if opts == (RunOptions{}) {
+		return RunFile(flags.Arg(0), flags.Args()[1:])
+	}
+	return RunFileWith(flags.Arg(0), flags.Args()[1:], opts)
+}
+
+func replCommand(args []string) error {
+	if len(args) != 0 {
+		return usagef("repl: unexpected arguments")
+	}
+	return RunRepl()
+}
+
+func testCommand(args []string) error {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	var opts CoverOptions
+	flags.BoolVar(&opts.Cover, "cover", false, "")
+	flags.StringVar(&opts.LCOV, "lcov", "", "")
+	flags.StringVar(&opts.HTML, "html", "", "")
+	if err := flags.Parse(args); err != nil {
+		return usagef("test: %s", err)
+	}
+	return RunTests(flags.Args(), opts)
+}
+
+func checkCommand(args []string) error {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	var types bool
+	flags.BoolVar(&types, "types", false, "")
+	if err := flags.Parse(args); err != nil {
+		return usagef("check: %s", err)
+	}
+	if flags.NArg() == 0 {
+		return usagef("check: missing script file")
+	}
+	errs := []error{}
+	for _, path := range flags.Args() {
+		if err := CheckFile(path, types); err != nil {
+			var compileErr *needle.CompileError
+			if !errors.As(err, &compileErr) {
+				return err
+			}
+			for _, e := range compileErr.Errors {
+				errs = append(errs, &fileError{path, e})
+			}
+		}
+	}
+	if len(errs) != 0 {
+		return &needle.CompileError{Errors: errs}
+	}
+	return nil
+}
+
+func fmtCommand(args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	var write, check bool
+	flags.BoolVar(&write, "w", false, "")
+	flags.BoolVar(&check, "check", false, "")
+	if err := flags.Parse(args); err != nil {
+		return usagef("fmt: %s", err)
+	}
+	if flags.NArg() == 0 {
+		return usagef("fmt: missing script file")
+	}
+	if write && check {
+		return usagef("fmt: -w and --check can't be used together")
+	}
+	unformatted := 0
+	for _, path := range flags.Args() {
+		changed, err := FormatFile(path, write || check, write)
+		if err != nil {
+			return err
+		}
+		if check && changed {
+			fmt.Println(path)
+			unformatted++
+		}
+	}
+	if unformatted != 0 {
+		return fmt.Errorf("fmt: %d file(s) not formatted", unformatted)
+	}
+	return nil
+}
+
+func lintCommand(args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	var opts LintOptions
+	var rules bool
+	flags.BoolVar(&opts.JSON, "json", false, "")
+	flags.StringVar(&opts.Enable, "enable", "", "")
+	flags.StringVar(&opts.Disable, "disable", "", "")
+	flags.BoolVar(&rules, "rules", false, "")
+	if err := flags.Parse(args); err != nil {
+		return usagef("lint: %s", err)
+	}
+	if rules {
+		PrintRules()
+		return nil
+	}
+	if flags.NArg() == 0 {
+		return usagef("lint: missing script file")
+	}
+	return LintFiles(flags.Args(), opts)
+}
+
+func docCommand(args []string) error {
+	flags := flag.NewFlagSet("doc", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	var opts DocOptions
+	flags.StringVar(&opts.Out, "out", "", "")
+	flags.BoolVar(&opts.Markdown, "md", false, "")
+	if err := flags.Parse(args); err != nil {
+		return usagef("doc: %s", err)
+	}
+	// no default, the pages would overwrite whatever is in the directory
+	if opts.Out == "" {
+		return usagef("doc: expected --out <dir>")
+	}
+	return DocFiles(flags.Args(), opts)
+}
+
+func highlightCommand(args []string) error {
+	flags := flag.NewFlagSet("highlight", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	var html bool
+	flags.BoolVar(&html, "html", false, "")
+	if err := flags.Parse(args); err != nil {
+		return usagef("highlight: %s", err)
+	}
+	if flags.NArg() != 1 {
+		return usagef("highlight: expected one script file")
+	}
+	return HighlightFile(flags.Arg(0), html)
+}
+
+func tokensCommand(args []string) error {
+	if len(args) != 1 {
+		return usagef("tokens: expected one script file")
+	}
+	return PrintTokens(args[0])
+}
+
+func astCommand(args []string) error {
+	if len(args) != 1 {
+		return usagef("ast: expected one script file")
+	}
+	return PrintAst(args[0])
+}
+
+func lspCommand(args []string) error {
+	if len(args) != 0 {
+		return usagef("lsp: unexpected arguments")
+	}
+	return lsp.NewServer(os.Stdin, os.Stdout).Run()
+}
+
+func debugCommand(args []string) error {
+	flags := flag.NewFlagSet("debug", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	var dap bool
+	flags.BoolVar(&dap, "dap", false, "")
+	if err := flags.Parse(args); err != nil {
+		return usagef("debug: %s", err)
+	}
+	if dap {
+		if flags.NArg() != 0 {
+			return usagef("debug: --dap takes the script from the 'launch' request")
+		}
+		return RunDap()
+	}
+	if flags.NArg() == 0 {
+		return usagef("debug: missing script file")
+	}
+	return RunDebug(flags.Arg(0), flags.Args()[1:])
+}
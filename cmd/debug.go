@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"needle/internal/needle/dap"
+	"needle/internal/needle/debugger"
+	"needle/internal/needle/evaluator"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+const debugPrompt = "(debug) "
+
+// RunDap serves the Debug Adapter Protocol on stdin and stdout, the
+// script to debug comes with the 'launch' request.
+func RunDap() error {
+	return dap.NewServer(os.Stdin, os.Stdout).Run()
+}
+
+// debugSession is 'needle debug': the script stops before its first
+// statement and commands read from stdin drive it.
+type debugSession struct {
+	session     *debugger.Session
+	in          *bufio.Scanner
+	out         io.Writer
+	breakpoints map[string][]int // by absolute path
+	sources     map[string][]string
+	stop        *debugger.Stop
+	last        string // command repeated by an empty line
+}
+
+// RunDebug debugs the script at path, args are forwarded to it as
+// 'os.args'. It returns what the script ended with.
+func RunDebug(path string, args []string) error {
+	d := &debugSession{
+		session:     debugger.New(),
+		in:          bufio.NewScanner(os.Stdin),
+		out:         os.Stdout,
+		breakpoints: map[string][]int{},
+		sources:     map[string][]string{},
+	}
+	d.session.StopOnEntry()
+	d.session.Start(path, args, os.Stdout)
+	fmt.Fprintln(d.out, "type 'help' for the commands")
+	for event := range d.session.Events() {
+		if event.Stop == nil {
+			return event.Err
+		}
+		d.stop = event.Stop
+		d.printStop()
+		d.prompt()
+	}
+	return nil
+}
+
+// prompt runs commands until one resumes the script.
+func (d *debugSession) prompt() {
+	for {
+		fmt.Fprint(d.out, debugPrompt)
+		if !d.in.Scan() {
+			fmt.Fprintln(d.out)
+			d.session.Terminate()
+			return
+		}
+		line := strings.TrimSpace(d.in.Text())
+		if line == "" {
+			line = d.last
+		}
+		d.last = line
+		if d.command(line) {
+			return
+		}
+	}
+}
+
+// command runs one command line and reports whether it resumed the
+// script.
+func (d *debugSession) command(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "":
+	case "c", "continue":
+		d.session.Continue()
+		return true
+	case "s", "step":
+		d.session.StepIn()
+		return true
+	case "n", "next":
+		d.session.StepOver()
+		return true
+	case "o", "out":
+		d.session.StepOut()
+		return true
+	case "q", "quit":
+		d.session.Terminate()
+		return true
+	case "b", "break":
+		d.setBreakpoint(arg, true)
+	case "clear":
+		d.setBreakpoint(arg, false)
+	case "bt", "where":
+		d.printFrames()
+	case "vars":
+		d.printVars(arg)
+	case "p", "print":
+		d.print(arg)
+	case "l", "list":
+		d.printSource(d.stop.File, d.stop.Line, 5)
+	case "h", "help":
+		d.printHelp()
+	default:
+		fmt.Fprintf(d.out, "unknown command '%s', type 'help' for the commands\n", name)
+	}
+	return false
+}
+
+func (d *debugSession) printHelp() {
+	help := [][2]string{
+		{"c, continue", "run to the next breakpoint"},
+		{"s, step", "run to the next statement, into calls"},
+		{"n, next", "run to the next line, over calls"},
+		{"o, out", "run until the current function returns"},
+		{"b, break [file:]line", "stop before the statements of a line"},
+		{"clear [file:]line", "remove a breakpoint"},
+		{"bt, where", "print the call stack"},
+		{"vars [frame]", "print the variables of a frame, 0 by default"},
+		{"p, print <expr>", "evaluate an expression in the current frame"},
+		{"l, list", "print the source around the current line"},
+		{"q, quit", "end the script"},
+	}
+	for _, h := range help {
+		fmt.Fprintf(d.out, "  %-22s %s\n", h[0], h[1])
+	}
+	fmt.Fprintln(d.out, "An empty line repeats the last command.")
+}
+
+func (d *debugSession) printStop() {
+	fmt.Fprintf(d.out, "%s %s:%d (%s)\n",
+		color.YellowString("stopped at"), d.stop.File, d.stop.Line, d.stop.Reason)
+	d.printSource(d.stop.File, d.stop.Line, 0)
+}
+
+// printSource prints the lines within around of line.
+func (d *debugSession) printSource(file string, line, around int) {
+	lines, ok := d.sources[file]
+	if !ok {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return
+		}
+		lines = strings.Split(string(b), "\n")
+		d.sources[file] = lines
+	}
+	for n := max(line-around, 1); n <= min(line+around, len(lines)); n++ {
+		marker := " "
+		if n == line {
+			marker = ">"
+		}
+		fmt.Fprintf(d.out, "%s %4d  %s\n", marker, n, lines[n-1])
+	}
+}
+
+func (d *debugSession) setBreakpoint(arg string, set bool) {
+	file, lineArg := d.stop.File, arg
+	if i := strings.LastIndex(arg, ":"); i >= 0 {
+		file, lineArg = arg[:i], arg[i+1:]
+	}
+	line, err := strconv.Atoi(lineArg)
+	if err != nil {
+		fmt.Fprintln(d.out, "usage: break [file:]line")
+		return
+	}
+	file, _ = filepath.Abs(file)
+	lines := []int{}
+	for _, l := range d.breakpoints[file] {
+		if l != line {
+			lines = append(lines, l)
+		}
+	}
+	if set {
+		lines = append(lines, line)
+	}
+	actual, err := d.session.SetBreakpoints(file, lines)
+	if err != nil {
+		fmt.Fprintln(d.out, err)
+		return
+	}
+	// keep the lines the breakpoints moved to
+	d.breakpoints[file] = []int{}
+	for _, l := range actual {
+		if l != 0 {
+			d.breakpoints[file] = append(d.breakpoints[file], l)
+		}
+	}
+	if set {
+		if moved := actual[len(actual)-1]; moved == 0 {
+			fmt.Fprintf(d.out, "no statement on or after line %d\n", line)
+		} else {
+			fmt.Fprintf(d.out, "breakpoint at %s:%d\n", file, moved)
+		}
+	}
+}
+
+func (d *debugSession) printFrames() {
+	frames, err := d.session.Frames()
+	if err != nil {
+		fmt.Fprintln(d.out, err)
+		return
+	}
+	for i, frame := range frames {
+		fmt.Fprintf(d.out, "#%d  %s at %s:%d\n", i, frame.Name, frame.File, frame.Line)
+	}
+}
+
+func (d *debugSession) printVars(arg string) {
+	index := 0
+	if arg != "" {
+		var err error
+		if index, err = strconv.Atoi(arg); err != nil {
+			fmt.Fprintln(d.out, "usage: vars [frame]")
+			return
+		}
+	}
+	err := d.session.Inspect(func(e *evaluator.Evaluator) {
+		frames := e.Frames()
+		if index < 0 || index >= len(frames) {
+			fmt.Fprintf(d.out, "no frame %d\n", index)
+			return
+		}
+		for _, scope := range debugger.Scopes(frames[index]) {
+			fmt.Fprintln(d.out, color.CyanString(scope.Name))
+			for _, v := range debugger.Vars(scope.Env) {
+				fmt.Fprintf(d.out, "  %s = %s\n", v.Name, v.Value.Say())
+			}
+		}
+	})
+	if err != nil {
+		fmt.Fprintln(d.out, err)
+	}
+}
+
+func (d *debugSession) print(expr string) {
+	if expr == "" {
+		fmt.Fprintln(d.out, "usage: print <expr>")
+		return
+	}
+	value, err := d.session.Evaluate(0, expr)
+	var exit *evaluator.Exit
+	switch {
+	case errors.As(err, &exit):
+		fmt.Fprintln(d.out, "the expression called os.exit")
+	case err != nil:
+		fmt.Fprintln(d.out, err)
+	default:
+		fmt.Fprintln(d.out, value.Say())
+		d.session.Inspect(func(*evaluator.Evaluator) {
+			for _, child := range debugger.Children(value) {
+				fmt.Fprintf(d.out, "  %s = %s\n", child.Name, child.Value.Say())
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"needle/internal/needle"
+	"needle/internal/needle/docgen"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DocOptions are the flags of 'needle doc'.
+type DocOptions struct {
+	Out      string // directory of the pages
+	Markdown bool   // write Markdown instead of HTML
+}
+
+// DocFiles writes a page for each script at paths, one for the builtins
+// and an index of them to opts.Out.
+func DocFiles(paths []string, opts DocOptions) error {
+	pages := []*docgen.Page{}
+	compileErrs := []error{}
+	for _, path := range paths {
+		source, err := needle.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		script, err := needle.Parse(source)
+		var compileErr *needle.CompileError
+		if errors.As(err, &compileErr) {
+			for _, e := range compileErr.Errors {
+				compileErrs = append(compileErrs, &fileError{path, e})
+			}
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		pages = append(pages, docgen.FromScript(name, script))
+	}
+	if len(compileErrs) != 0 {
+		return &needle.CompileError{Errors: compileErrs}
+	}
+	pages = append(pages, docgen.Builtins())
+
+	if err := os.MkdirAll(opts.Out, 0o755); err != nil {
+		return err
+	}
+	ext, write, index := ".html", docgen.WriteHTML, docgen.WriteHTMLIndex
+	if opts.Markdown {
+		ext, write, index = ".md", docgen.WriteMarkdown, docgen.WriteMarkdownIndex
+	}
+	for _, page := range pages {
+		err := writeDocPage(filepath.Join(opts.Out, page.Name+ext), func(w io.Writer) error {
+			return write(w, page, pages)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return writeDocPage(filepath.Join(opts.Out, "index"+ext), func(w io.Writer) error {
+		return index(w, pages)
+	})
+}
+
+func writeDocPage(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -1,15 +1,191 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"needle/internal/needle"
+	"needle/internal/needle/ast"
+	"needle/internal/needle/evaluator"
+	"needle/internal/needle/profile"
+	"needle/internal/needle/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
 )
 
-func RunFile(filePath string) error {
+// RunFile runs a script, args are forwarded to it as 'os.args'.
+func RunFile(filePath string, args []string) error {
 	state := needle.New()
+	defer state.Close()
+	state.SetArgs(args)
 	return state.RunFile(filePath)
 }
 
-func RunFile_debug(filePath string) error {
+// RunOptions asks 'needle run' to profile the script or count what it
+// does, the reports go to stderr and the exports to their files.
+type RunOptions struct {
+	Profile    bool   // print the functions by time
+	Pprof      string // pprof protobuf file
+	Folded     string // folded stacks file
+	Stats      bool   // print node, allocation and depth counts
+	CheckTypes bool   // check values against type annotations
+	Sandbox    string // roots the script is confined to, separated by ':'
+}
+
+func (o *RunOptions) profiling() bool {
+	return o.Profile || o.Pprof != "" || o.Folded != ""
+}
+
+// ProfilePeriod is how often a profiled script has its call stack
+// sampled.
+const ProfilePeriod = time.Millisecond
+
+// RunFileWith runs a script like RunFile, profiling it as opts says.
+// Reports are written even if the script fails.
+func RunFileWith(filePath string, args []string, opts RunOptions) error {
+	state := needle.New()
+	defer state.Close()
+	state.SetArgs(args)
+	state.SetTypeChecks(opts.CheckTypes)
+	if opts.Sandbox != "" {
+		state.SetSandbox(filepath.SplitList(opts.Sandbox))
+	}
+	if opts.profiling() {
+		state.StartProfile(ProfilePeriod)
+	}
+	if opts.Stats {
+		state.StartStats()
+	}
+	start := time.Now()
+	err := state.RunFile(filePath)
+	elapsed := time.Since(start)
+	if opts.Stats {
+		printStats(os.Stderr, state.StopStats(), elapsed)
+	}
+	if opts.profiling() {
+		p := state.StopProfile()
+		if opts.Profile {
+			profile.Report(os.Stderr, p)
+		}
+		if opts.Pprof != "" {
+			if e := writeProfile(opts.Pprof, p, profile.WritePprof); e != nil {
+				return errors.Join(err, e)
+			}
+		}
+		if opts.Folded != "" {
+			if e := writeProfile(opts.Folded, p, profile.WriteFolded); e != nil {
+				return errors.Join(err, e)
+			}
+		}
+	}
+	return err
+}
+
+func writeProfile(path string, p *evaluator.Profile, write func(io.Writer, *evaluator.Profile) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f, p); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func printStats(w io.Writer, stats *evaluator.Stats, elapsed time.Duration) {
+	total := 0
+	types := []string{}
+	for t, n := range stats.Nodes {
+		total += n
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		a, b := stats.Nodes[types[i]], stats.Nodes[types[j]]
+		if a != b {
+			return a > b
+		}
+		return types[i] < types[j]
+	})
+	fmt.Fprintf(w, "%-16s %v\n", "time", elapsed.Round(time.Microsecond))
+	fmt.Fprintf(w, "%-16s %d\n", "nodes", total)
+	for _, t := range types {
+		fmt.Fprintf(w, "  %-14s %d\n", t, stats.Nodes[t])
+	}
+	fmt.Fprintf(w, "%-16s %d\n", "numbers", stats.Numbers)
+	fmt.Fprintf(w, "%-16s %d\n", "strings", stats.Strings)
+	fmt.Fprintf(w, "%-16s %d\n", "peak depth", stats.PeakDepth)
+}
+
+// RunCode runs code given on the command line.
+func RunCode(code string, args []string) error {
 	state := needle.New()
-	return state.RunFile_debug(filePath)
+	defer state.Close()
+	state.SetArgs(args)
+	return state.Run([]rune(code))
+}
+
+// CheckFile parses and resolves a script, and checks its types if
+// types is set.
+func CheckFile(filePath string, types bool) error {
+	source, err := needle.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	abs, _ := filepath.Abs(filePath)
+	if types {
+		return needle.CheckTypes(source, filepath.Dir(abs))
+	}
+	return needle.Check(source, filepath.Dir(abs))
+}
+
+// FormatFile formats a script and reports whether that changed it. The
+// result is printed unless quiet, and written back to the file if write.
+func FormatFile(filePath string, quiet, write bool) (bool, error) {
+	source, err := needle.ReadFile(filePath)
+	if err != nil {
+		return false, err
+	}
+	out, err := needle.Format(source)
+	if err != nil {
+		return false, err
+	}
+	changed := out != string(source)
+	if !quiet {
+		fmt.Print(out)
+	}
+	if write && changed {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return false, err
+		}
+		if err := os.WriteFile(filePath, []byte(out), info.Mode()); err != nil {
+			return false, err
+		}
+	}
+	return changed, nil
+}
+
+func PrintTokens(filePath string) error {
+	source, err := needle.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	token.PrintTokens(needle.Tokens(source))
+	return nil
+}
+
+func PrintAst(filePath string) error {
+	source, err := needle.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	script, err := needle.Parse(source)
+	if err != nil {
+		return err
+	}
+	fmt.Print(ast.Dump(script))
+	return nil
 }
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"needle/internal/needle"
+	"needle/internal/needle/evaluator"
+	"needle/internal/needle/highlight"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HighlightFile prints a script with terminal colors, or as an HTML page
+// if html.
+func HighlightFile(filePath string, html bool) error {
+	source, err := needle.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	if html {
+		return highlight.WriteHTML(os.Stdout, filepath.Base(filePath), source)
+	}
+	fmt.Print(highlight.ANSI(source))
+	return nil
+}
+
+// printError prints err and, when it knows its script, the line of the
+// script it comes from.
+func printError(w io.Writer, err error) {
+	var compileErr *needle.CompileError
+	var exception *evaluator.Exception
+	switch {
+	case errors.As(err, &compileErr):
+		for _, e := range compileErr.Errors {
+			fmt.Fprintf(w, "compile error: %s\n", e)
+			file := compileErr.File
+			if fileErr, ok := e.(*fileError); ok {
+				file = fileErr.path
+			}
+			if pos, ok := needle.ErrorPosition(e); ok && file != "" {
+				fmt.Fprint(w, excerpt(file, pos.Line, pos.Column))
+			}
+		}
+	case errors.As(err, &exception) && exception.File != "":
+		head, rest, _ := strings.Cut(err.Error(), "\n")
+		fmt.Fprintln(w, head)
+		fmt.Fprint(w, excerpt(exception.File, exception.Line, 0))
+		fmt.Fprintln(w, rest)
+	default:
+		fmt.Fprintln(w, err)
+	}
+}
+
+// excerpt returns the highlighted line of the script at path, "" if it
+// can't be read.
+func excerpt(path string, line, column int) string {
+	source, err := needle.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return highlight.Excerpt(source, line, column)
+}
+
+// fileError is an error of one of the scripts given to a command, it is
+// prefixed with the path of the script.
+type fileError struct {
+	path string
+	err  error
+}
+
+func (err *fileError) Error() string {
+	return err.path + ": " + err.err.Error()
+}
+
+func (err *fileError) Unwrap() error {
+	return err.err
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"needle/internal/needle"
+	"needle/internal/needle/lint"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LintOptions are the flags of 'needle lint'.
+type LintOptions struct {
+	JSON    bool
+	Enable  string // comma separated rules, the only ones run if set
+	Disable string // comma separated rules
+}
+
+// jsonDiagnostic is a diagnostic as 'needle lint --json' prints it.
+type jsonDiagnostic struct {
+	File     string        `json:"file"`
+	Line     int           `json:"line"`
+	Column   int           `json:"column"`
+	Rule     string        `json:"rule"`
+	Name     string        `json:"name"`
+	Severity lint.Severity `json:"severity"`
+	Message  string        `json:"message"`
+}
+
+// LintFiles lints the scripts at paths and prints what it finds, as a
+// JSON array with opts.JSON. It fails if anything was found.
+func LintFiles(paths []string, opts LintOptions) error {
+	config, err := lintConfig(opts)
+	if err != nil {
+		return err
+	}
+	found := []jsonDiagnostic{}
+	compileErrs := []error{}
+	for _, path := range paths {
+		source, err := needle.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		abs, _ := filepath.Abs(path)
+		diagnostics, err := lint.Lint(source, filepath.Dir(abs), config)
+		var compileErr *needle.CompileError
+		if errors.As(err, &compileErr) {
+			for _, e := range compileErr.Errors {
+				compileErrs = append(compileErrs, &fileError{path, e})
+			}
+			continue
+		}
+		for _, d := range diagnostics {
+			found = append(found, jsonDiagnostic{
+				path, d.Position.Line, d.Position.Column,
+				d.Rule.ID, d.Rule.Name, d.Rule.Severity, d.Message,
+			})
+		}
+	}
+	if opts.JSON {
+		out, _ := json.MarshalIndent(found, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for _, d := range found {
+			fmt.Printf("%s:%d:%d: %s: %s [%s %s]\n",
+				d.File, d.Line, d.Column, d.Severity, d.Message, d.Rule, d.Name)
+		}
+	}
+	if len(compileErrs) != 0 {
+		return &needle.CompileError{Errors: compileErrs}
+	}
+	if len(found) != 0 {
+		return fmt.Errorf("lint: %d problem(s)", len(found))
+	}
+	return nil
+}
+
+func lintConfig(opts LintOptions) (lint.Config, error) {
+	config := lint.Config{Disabled: map[*lint.Rule]bool{}}
+	rules := func(list string) ([]*lint.Rule, error) {
+		rules := []*lint.Rule{}
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			rule := lint.Find(name)
+			if rule == nil {
+				return nil, usagef("lint: unknown rule '%s'", name)
+			}
+			rules = append(rules, rule)
+		}
+		return rules, nil
+	}
+	if opts.Enable != "" {
+		enabled, err := rules(opts.Enable)
+		if err != nil {
+			return config, err
+		}
+		for _, rule := range lint.Rules() {
+			config.Disabled[rule] = true
+		}
+		for _, rule := range enabled {
+			config.Disabled[rule] = false
+		}
+	}
+	disabled, err := rules(opts.Disable)
+	if err != nil {
+		return config, err
+	}
+	for _, rule := range disabled {
+		config.Disabled[rule] = true
+	}
+	return config, nil
+}
+
+// PrintRules lists the rules of the linter.
+func PrintRules() {
+	for _, rule := range lint.Rules() {
+		fmt.Fprintf(os.Stdout, "%s  %-20s %-8s %s\n", rule.ID, rule.Name, rule.Severity, rule.About)
+	}
+}
@@ -1,26 +1,171 @@
 package cmd
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"needle/internal/lineedit"
 	"needle/internal/needle"
+	"needle/internal/needle/ast"
+	"needle/internal/needle/evaluator"
+	"needle/internal/needle/highlight"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/fatih/color"
 )
 
+const (
+	replPrompt     = "> "
+	replMorePrompt = "... "
+)
+
+type repl struct {
+	state   *needle.Needle
+	editor  *lineedit.Editor
+	history string // file the history is saved to, empty if none
+}
+
 func RunRepl() error {
-	state := needle.New()
-	fmt.Println(color.CyanString("Needle"), "[ver0.0.0]")
-	fmt.Println("exit using", color.RedString("ctrl+c"))
+	r := &repl{
+		state:   needle.New(),
+		editor:  lineedit.New(os.Stdin, os.Stdout),
+		history: historyPath(),
+	}
+	r.editor.Complete = func(line []rune, pos int) (int, []string) {
+		return r.state.Complete(line, pos)
+	}
+	r.editor.Highlight = highlight.ANSI
+	if r.history != "" {
+		r.editor.LoadHistory(r.history)
+	}
+	fmt.Println(color.CyanString("Needle"), "[ver"+needle.Version+"]")
+	fmt.Println("type :help for help, exit using", color.RedString("ctrl+d"))
+	defer func() { r.state.Close() }()
+	return r.loop()
+}
+
+// historyPath is $NEEDLE_HISTORY or ~/.needle_history.
+func historyPath() string {
+	if path, ok := os.LookupEnv("NEEDLE_HISTORY"); ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".needle_history")
+}
+
+func (r *repl) loop() error {
+	lines := []string{}
 	for {
-		fmt.Print("> ")
-		r := bufio.NewReader(os.Stdin)
-		str, _ := r.ReadString('\n')
-		source := []rune(str[:len(str)-2])
-		err := state.Run(source)
+		prompt := replPrompt
+		if len(lines) != 0 {
+			prompt = replMorePrompt
+		}
+		line, err := r.editor.ReadLine(prompt)
+		if errors.Is(err, lineedit.ErrInterrupt) {
+			lines = lines[:0]
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		r.editor.AddHistory(line)
+		if r.history != "" {
+			r.editor.SaveHistory(r.history)
+		}
+		if len(lines) == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if quit := r.meta(strings.TrimSpace(line)); quit {
+				return nil
+			}
+			continue
+		}
+		lines = append(lines, line)
+		source := strings.Join(lines, "\n")
+		if strings.TrimSpace(source) == "" {
+			lines = lines[:0]
+			continue
+		}
+		if needle.Incomplete([]rune(source)) {
+			// a bare expression may leave out the semicolon
+			if _, err := needle.Parse([]rune(source + ";")); err != nil {
+				continue
+			}
+			source += ";"
+		}
+		lines = lines[:0]
+		if err := r.eval(source); err != nil {
+			return err
+		}
+	}
+}
+
+// eval runs source and prints the value of a bare expression. Only an
+// exit is returned, other errors are printed.
+func (r *repl) eval(source string) error {
+	value, err := r.state.Eval([]rune(source))
+	var exit *evaluator.Exit
+	if errors.As(err, &exit) {
+		return err
+	}
+	var compileErr *needle.CompileError
+	if errors.As(err, &compileErr) {
+		for _, e := range compileErr.Errors {
+			fmt.Println("compile error:", e)
+			if pos, ok := needle.ErrorPosition(e); ok {
+				fmt.Print(highlight.Excerpt([]rune(source), pos.Line, pos.Column))
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	if value != nil && value.Type() != evaluator.VAL_NULL {
+		fmt.Println(value.Say())
+	}
+	return nil
+}
+
+// meta runs a ':command' and reports whether the REPL should quit.
+func (r *repl) meta(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case ":help":
+		fmt.Println(":load <file>  run a script in this session")
+		fmt.Println(":reset        forget everything declared so far")
+		fmt.Println(":ast <code>   print the syntax tree of code")
+		fmt.Println(":quit         leave the shell")
+	case ":load":
+		if arg == "" {
+			fmt.Println("usage: :load <file>")
+			break
+		}
+		if err := r.state.RunFile(arg); err != nil {
+			fmt.Println(err)
+		}
+	case ":reset":
+		r.state.Close()
+		r.state = needle.New()
+	case ":ast":
+		script, err := needle.Parse([]rune(arg))
 		if err != nil {
 			fmt.Println(err)
+			break
 		}
+		fmt.Print(ast.Dump(script))
+	case ":quit", ":exit":
+		return true
+	default:
+		fmt.Printf("unknown command '%s', type :help for help\n", name)
 	}
+	return false
 }
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"needle/internal/needle/coverage"
+	"needle/internal/needle/evaluator"
+	"needle/internal/needle/tester"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// CoverOptions asks 'needle test' for the coverage of the scripts the
+// tests run, the suites left out.
+type CoverOptions struct {
+	Cover bool   // print the coverage of every file
+	LCOV  string // LCOV tracefile
+	HTML  string // annotated sources
+}
+
+func (o *CoverOptions) covering() bool {
+	return o.Cover || o.LCOV != "" || o.HTML != ""
+}
+
+// RunTests runs the '*_test.ndl' suites found under paths, the current
+// directory by default, and the scripts named directly, checked against
+// their annotations. It prints a diff for every failed script and the
+// outcome and time of every suite case, then the coverage if asked.
+func RunTests(paths []string, opts CoverOptions) error {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files := []string{}
+	for _, path := range paths {
+		found, err := tester.Discover(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, found...)
+	}
+	failed := 0
+	results := tester.Run(files, opts.covering())
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+		if tester.IsSuite(result.Path) {
+			printSuite(result)
+			continue
+		}
+		if result.Err == nil {
+			fmt.Println(result.Path, "->", color.GreenString("ok"))
+			continue
+		}
+		fmt.Println(result.Path, "->", color.RedString("FAIL"))
+		printIndented(result.Err.Error(), "    ")
+	}
+	fmt.Printf("%d passed, %d failed\n", len(files)-failed, failed)
+	if opts.covering() {
+		if err := reportCoverage(tester.MergeCoverage(results), opts); err != nil {
+			return err
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, len(files))
+	}
+	return nil
+}
+
+func reportCoverage(c *evaluator.Coverage, opts CoverOptions) error {
+	if opts.Cover {
+		lines, linesHit, branches, branchesHit := 0, 0, 0, 0
+		for _, s := range coverage.Summarize(c) {
+			fmt.Printf("%-40s lines %6.1f%%  branches %6.1f%%\n", s.Path,
+				coverage.Percent(s.LinesHit, s.Lines), coverage.Percent(s.BranchesHit, s.Branches))
+			lines, linesHit = lines+s.Lines, linesHit+s.LinesHit
+			branches, branchesHit = branches+s.Branches, branchesHit+s.BranchesHit
+		}
+		fmt.Printf("coverage: %.1f%% of lines, %.1f%% of branches\n",
+			coverage.Percent(linesHit, lines), coverage.Percent(branchesHit, branches))
+	}
+	if opts.LCOV != "" {
+		if err := writeCoverage(opts.LCOV, c, coverage.WriteLCOV); err != nil {
+			return err
+		}
+	}
+	if opts.HTML != "" {
+		if err := writeCoverage(opts.HTML, c, coverage.WriteHTML); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCoverage(path string, c *evaluator.Coverage, write func(io.Writer, *evaluator.Coverage) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f, c); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func printSuite(result tester.Result) {
+	if result.Cases == nil {
+		fmt.Println(result.Path, "->", color.RedString("FAIL"))
+		printIndented(result.Err.Error(), "    ")
+		return
+	}
+	fmt.Println(result.Path)
+	for _, c := range result.Cases {
+		took := c.Duration.Round(time.Microsecond)
+		if c.Err == nil {
+			fmt.Printf("    %s %s (%v)\n", color.GreenString("ok  "), c.Name, took)
+			continue
+		}
+		fmt.Printf("    %s %s (%v)\n", color.RedString("FAIL"), c.Name, took)
+		printIndented(c.Err.Error(), "        ")
+	}
+}
+
+func printIndented(text string, indent string) {
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		fmt.Println(indent + line)
+	}
+}
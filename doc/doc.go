@@ -0,0 +1,10 @@
+// Package doc holds the assets of the pages needle generates.
+package doc
+
+import _ "embed"
+
+// Colors is the palette of the pages, as CSS for the classes primary,
+// secondary and content.
+//
+//go:embed colors.css
+var Colors string
@@ -0,0 +1,337 @@
+// Package lineedit reads lines from a terminal with cursor movement,
+// history and tab completion. When the input is not a terminal it falls
+// back to reading plain lines.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInterrupt is returned by ReadLine when the user presses ctrl+c.
+var ErrInterrupt = errors.New("interrupt")
+
+// MaxHistory is the number of entries kept in the history.
+const MaxHistory = 1000
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+var ansi = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+type Editor struct {
+	in      *os.File
+	out     io.Writer
+	reader  *bufio.Reader
+	history []string
+
+	// Complete returns the candidates for the word that ends at pos in
+	// line and the index where that word starts.
+	Complete func(line []rune, pos int) (int, []string)
+
+	// Highlight returns line as it is shown, it may only add ANSI colors.
+	Highlight func(line []rune) string
+}
+
+func New(in *os.File, out io.Writer) *Editor {
+	return &Editor{
+		in:      in,
+		out:     out,
+		reader:  bufio.NewReader(in),
+		history: []string{},
+	}
+}
+
+// AddHistory appends entry to the history, skipping blank lines and
+// repeats of the last entry.
+func (ed *Editor) AddHistory(entry string) {
+	if strings.TrimSpace(entry) == "" {
+		return
+	}
+	if n := len(ed.history); n > 0 && ed.history[n-1] == entry {
+		return
+	}
+	ed.history = append(ed.history, entry)
+	if len(ed.history) > MaxHistory {
+		ed.history = ed.history[len(ed.history)-MaxHistory:]
+	}
+}
+
+// LoadHistory reads the history saved at path, one entry per line.
+// A missing file is not an error.
+func (ed *Editor) LoadHistory(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		ed.AddHistory(line)
+	}
+	return nil
+}
+
+func (ed *Editor) SaveHistory(path string) error {
+	data := strings.Join(ed.history, "\n") + "\n"
+	return os.WriteFile(path, []byte(data), 0o600)
+}
+
+// ReadLine prints prompt and reads one line, without the line break.
+// It returns io.EOF at the end of input or on ctrl+d on an empty line.
+func (ed *Editor) ReadLine(prompt string) (string, error) {
+	fd := int(ed.in.Fd())
+	if !isTerminal(fd) {
+		return ed.readPlain(prompt)
+	}
+	restore, err := makeRaw(fd)
+	if err != nil {
+		return ed.readPlain(prompt)
+	}
+	defer restore()
+	l := &line{ed: ed, prompt: prompt, history: len(ed.history)}
+	l.refresh()
+	return l.edit()
+}
+
+func (ed *Editor) readPlain(prompt string) (string, error) {
+	fmt.Fprint(ed.out, prompt)
+	str, err := ed.reader.ReadString('\n')
+	if err != nil && str == "" {
+		return "", err
+	}
+	return strings.TrimRight(str, "\r\n"), nil
+}
+
+// line is the state of one ReadLine in raw mode.
+type line struct {
+	ed      *Editor
+	prompt  string
+	buf     []rune
+	pos     int
+	history int    // index in the history, len(history) for the new line
+	pending []rune // the new line while browsing the history
+}
+
+func (l *line) edit() (string, error) {
+	for {
+		r, _, err := l.ed.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case keyEnter, '\n':
+			fmt.Fprint(l.ed.out, "\n")
+			return string(l.buf), nil
+		case keyCtrlC:
+			fmt.Fprint(l.ed.out, "^C\n")
+			return "", ErrInterrupt
+		case keyCtrlD:
+			if len(l.buf) == 0 {
+				fmt.Fprint(l.ed.out, "\n")
+				return "", io.EOF
+			}
+			l.deleteForward()
+		case keyBackspace, keyCtrlH:
+			l.deleteBackward()
+		case keyCtrlA:
+			l.pos = 0
+		case keyCtrlE:
+			l.pos = len(l.buf)
+		case keyCtrlB:
+			l.pos = max(l.pos-1, 0)
+		case keyCtrlF:
+			l.pos = min(l.pos+1, len(l.buf))
+		case keyCtrlK:
+			l.buf = l.buf[:l.pos]
+		case keyCtrlU:
+			l.buf = append([]rune{}, l.buf[l.pos:]...)
+			l.pos = 0
+		case keyCtrlW:
+			l.deleteWord()
+		case keyCtrlL:
+			fmt.Fprint(l.ed.out, "\x1b[H\x1b[2J")
+		case keyCtrlP:
+			l.browse(-1)
+		case keyCtrlN:
+			l.browse(1)
+		case keyTab:
+			l.complete()
+		case keyEscape:
+			l.escape()
+		default:
+			if r >= ' ' && r != utf8.RuneError {
+				l.insert(r)
+			}
+		}
+		l.refresh()
+	}
+}
+
+// escape handles the escape sequences sent by arrow and editing keys.
+func (l *line) escape() {
+	r, _, err := l.ed.reader.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return
+	}
+	params := []rune{}
+	for {
+		r, _, err = l.ed.reader.ReadRune()
+		if err != nil {
+			return
+		}
+		if r >= 0x40 && r <= 0x7e {
+			break
+		}
+		params = append(params, r)
+	}
+	switch r {
+	case 'A':
+		l.browse(-1)
+	case 'B':
+		l.browse(1)
+	case 'C':
+		l.pos = min(l.pos+1, len(l.buf))
+	case 'D':
+		l.pos = max(l.pos-1, 0)
+	case 'H':
+		l.pos = 0
+	case 'F':
+		l.pos = len(l.buf)
+	case '~':
+		switch string(params) {
+		case "1", "7":
+			l.pos = 0
+		case "4", "8":
+			l.pos = len(l.buf)
+		case "3":
+			l.deleteForward()
+		}
+	}
+}
+
+func (l *line) insert(r rune) {
+	l.buf = append(l.buf, 0)
+	copy(l.buf[l.pos+1:], l.buf[l.pos:])
+	l.buf[l.pos] = r
+	l.pos++
+}
+
+func (l *line) deleteBackward() {
+	if l.pos == 0 {
+		return
+	}
+	l.buf = append(l.buf[:l.pos-1], l.buf[l.pos:]...)
+	l.pos--
+}
+
+func (l *line) deleteForward() {
+	if l.pos == len(l.buf) {
+		return
+	}
+	l.buf = append(l.buf[:l.pos], l.buf[l.pos+1:]...)
+}
+
+func (l *line) deleteWord() {
+	start := l.pos
+	for start > 0 && l.buf[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && l.buf[start-1] != ' ' {
+		start--
+	}
+	l.buf = append(l.buf[:start], l.buf[l.pos:]...)
+	l.pos = start
+}
+
+// browse moves through the history by step, keeping the new line.
+func (l *line) browse(step int) {
+	history := l.ed.history
+	next := l.history + step
+	if next < 0 || next > len(history) {
+		return
+	}
+	if l.history == len(history) {
+		l.pending = l.buf
+	}
+	l.history = next
+	if next == len(history) {
+		l.buf = l.pending
+	} else {
+		l.buf = []rune(history[next])
+	}
+	l.pos = len(l.buf)
+}
+
+func (l *line) complete() {
+	if l.ed.Complete == nil {
+		return
+	}
+	start, candidates := l.ed.Complete(l.buf, l.pos)
+	if len(candidates) == 0 {
+		fmt.Fprint(l.ed.out, "\a")
+		return
+	}
+	word := string(l.buf[start:l.pos])
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		prefix = commonPrefix(prefix, c)
+	}
+	if len(prefix) > len(word) {
+		l.replace(start, prefix)
+		return
+	}
+	if len(candidates) > 1 {
+		fmt.Fprintf(l.ed.out, "\n%s\n", strings.Join(candidates, "  "))
+	}
+}
+
+func (l *line) replace(start int, text string) {
+	tail := append([]rune(text), l.buf[l.pos:]...)
+	l.buf = append(l.buf[:start], tail...)
+	l.pos = start + utf8.RuneCountInString(text)
+}
+
+func (l *line) refresh() {
+	col := utf8.RuneCountInString(ansi.ReplaceAllString(l.prompt, "")) + l.pos
+	text := string(l.buf)
+	if l.ed.Highlight != nil {
+		text = l.ed.Highlight(l.buf)
+	}
+	fmt.Fprintf(l.ed.out, "\r%s%s\x1b[K\r", l.prompt, text)
+	if col > 0 {
+		fmt.Fprintf(l.ed.out, "\x1b[%dC", col)
+	}
+}
+
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
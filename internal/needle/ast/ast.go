@@ -10,8 +10,16 @@ import (
 type Node interface {
 	fmt.Stringer
 	Node()
+	Pos() token.Position
 }
 
+// Loc is embedded in every node and records where the node starts.
+type Loc struct {
+	Position token.Position
+}
+
+func (l *Loc) Pos() token.Position { return l.Position }
+
 type Decl interface {
 	Node
 	Decl()
@@ -27,8 +35,17 @@ type Expr interface {
 	Expr()
 }
 
+// Pattern is a destructuring target. Declarations accept only identifiers
+// as leaves, assignments also accept property and index expressions.
+type Pattern interface {
+	Node
+	Pattern()
+}
+
 type Script struct {
+	Loc
 	Decls []Decl
+	Doc   string // '///' comments opening the script, apart from any declaration
 }
 
 func (s *Script) Node() {}
@@ -45,13 +62,14 @@ func (s *Script) String() string {
 
 /* == declarations ========================================================== */
 
-type BadDecl struct{}
+type BadDecl struct{ Loc }
 
 func (bd *BadDecl) Node()          {}
 func (bd *BadDecl) Decl()          {}
 func (bd *BadDecl) String() string { return "__bad_decl" }
 
 type StmtDecl struct {
+	Loc
 	Stmt Stmt
 }
 
@@ -62,21 +80,42 @@ func (sd *StmtDecl) String() string {
 }
 
 type VarDecl struct {
+	Loc
 	Name  *Ident
+	Type  *Type // nil without annotation
 	Right Expr
+	Doc   string // '///' comments above the declaration
 }
 
 func (vd *VarDecl) Node() {}
 func (vd *VarDecl) Decl() {}
 func (vd *VarDecl) String() string {
 	return fmt.Sprintf(
-		"var %s = %s;",
+		"var %s%s = %s;",
 		vd.Name,
+		annotation(vd.Type),
 		vd.Right,
 	)
 }
 
+type DestructDecl struct {
+	Loc
+	Pattern Pattern
+	Right   Expr
+}
+
+func (dd *DestructDecl) Node() {}
+func (dd *DestructDecl) Decl() {}
+func (dd *DestructDecl) String() string {
+	return fmt.Sprintf(
+		"var %s = %s;",
+		dd.Pattern,
+		dd.Right,
+	)
+}
+
 type FunDecl struct {
+	Loc
 	Name *Ident
 	Fun  *FunLit
 }
@@ -88,8 +127,10 @@ func (fd *FunDecl) String() string {
 }
 
 type ClassDecl struct {
+	Loc
 	Name  *Ident
 	Class *ClassLit
+	Doc   string // '///' comments above the declaration
 }
 
 func (cd *ClassDecl) Node() {}
@@ -99,6 +140,7 @@ func (cd *ClassDecl) String() string {
 }
 
 type ImportDecl struct {
+	Loc
 	Path   *StringLit
 	Unwrap bool
 	Alias  *Ident
@@ -112,13 +154,14 @@ func (id *ImportDecl) String() string {
 
 /* == statements ============================================================ */
 
-type BadStmt struct{}
+type BadStmt struct{ Loc }
 
 func (bs *BadStmt) Node()          {}
 func (bs *BadStmt) Stmt()          {}
 func (bs *BadStmt) String() string { return "__bad_stmt" }
 
 type Block struct {
+	Loc
 	Decls []Decl
 }
 
@@ -138,6 +181,7 @@ func (b *Block) String() string {
 }
 
 type ExprStmt struct {
+	Loc
 	Expr Expr
 }
 
@@ -151,6 +195,7 @@ func (es *ExprStmt) String() string {
 }
 
 type IfStmt struct {
+	Loc
 	Cond Expr
 	Then Stmt
 	Else Stmt
@@ -168,6 +213,7 @@ func (is *IfStmt) String() string {
 }
 
 type WhileStmt struct {
+	Loc
 	Cond Expr
 	Do   Stmt
 }
@@ -183,6 +229,7 @@ func (ws *WhileStmt) String() string {
 }
 
 type DoStmt struct {
+	Loc
 	Do    Stmt
 	While Expr
 }
@@ -198,6 +245,7 @@ func (ds *DoStmt) String() string {
 }
 
 type ForStmt struct {
+	Loc
 	Repeat Stmt
 	Init   Decl
 	Cond   Expr
@@ -216,7 +264,26 @@ func (fs *ForStmt) String() string {
 	)
 }
 
+type ForInStmt struct {
+	Loc
+	Name   *Ident
+	Iter   Expr
+	Repeat Stmt
+}
+
+func (fs *ForInStmt) Node() {}
+func (fs *ForInStmt) Stmt() {}
+func (fs *ForInStmt) String() string {
+	return fmt.Sprintf(
+		"for (%s in %s) %s",
+		fs.Name,
+		fs.Iter,
+		fs.Repeat,
+	)
+}
+
 type AssignStmt struct {
+	Loc
 	Left  Expr
 	Right Expr
 }
@@ -231,7 +298,24 @@ func (as *AssignStmt) String() string {
 	)
 }
 
+type DestructStmt struct {
+	Loc
+	Pattern Pattern
+	Right   Expr
+}
+
+func (ds *DestructStmt) Node() {}
+func (ds *DestructStmt) Stmt() {}
+func (ds *DestructStmt) String() string {
+	return fmt.Sprintf(
+		"%s = %s;",
+		ds.Pattern,
+		ds.Right,
+	)
+}
+
 type SayStmt struct {
+	Loc
 	Expr Expr
 }
 
@@ -245,6 +329,7 @@ func (ss *SayStmt) String() string {
 }
 
 type ReturnStmt struct {
+	Loc
 	Value Expr
 }
 
@@ -257,7 +342,7 @@ func (rs *ReturnStmt) String() string {
 	)
 }
 
-type BreakStmt struct{}
+type BreakStmt struct{ Loc }
 
 func (bs *BreakStmt) Node() {}
 func (bs *BreakStmt) Stmt() {}
@@ -265,7 +350,7 @@ func (bs *BreakStmt) String() string {
 	return "break;"
 }
 
-type ContinueStmt struct{}
+type ContinueStmt struct{ Loc }
 
 func (cs *ContinueStmt) Node() {}
 func (cs *ContinueStmt) Stmt() {}
@@ -274,6 +359,7 @@ func (cs *ContinueStmt) String() string {
 }
 
 type TryStmt struct {
+	Loc
 	Try     Stmt
 	Catch   Stmt
 	As      *Ident
@@ -293,6 +379,7 @@ func (ts *TryStmt) String() string {
 }
 
 type ThrowStmt struct {
+	Loc
 	Error Expr
 }
 
@@ -308,14 +395,17 @@ func (ts *ThrowStmt) String() string {
 /* == expressions =========================================================== */
 
 type Ident struct {
+	Loc
 	Name string
 }
 
 func (l *Ident) Node()          {}
 func (i *Ident) Expr()          {}
+func (i *Ident) Pattern()       {}
 func (i *Ident) String() string { return i.Name }
 
 type InfixExpr struct {
+	Loc
 	Left  Expr
 	Right Expr
 	Op    *token.Token
@@ -333,6 +423,7 @@ func (ie *InfixExpr) String() string {
 }
 
 type PrefixExpr struct {
+	Loc
 	Right Expr
 	Op    *token.Token
 }
@@ -348,6 +439,7 @@ func (pe *PrefixExpr) String() string {
 }
 
 type CallExpr struct {
+	Loc
 	Left      Expr
 	Arguments []Expr
 }
@@ -369,13 +461,87 @@ func (ce *CallExpr) String() string {
 	)
 }
 
+type YieldExpr struct {
+	Loc
+	Value Expr
+}
+
+func (ye *YieldExpr) Node() {}
+func (ye *YieldExpr) Expr() {}
+func (ye *YieldExpr) String() string {
+	return fmt.Sprintf(
+		"(yield %s)",
+		ye.Value,
+	)
+}
+
+type AwaitExpr struct {
+	Loc
+	Value Expr
+}
+
+func (ae *AwaitExpr) Node() {}
+func (ae *AwaitExpr) Expr() {}
+func (ae *AwaitExpr) String() string {
+	return fmt.Sprintf(
+		"(await %s)",
+		ae.Value,
+	)
+}
+
+type SpawnExpr struct {
+	Loc
+	Call *CallExpr
+}
+
+func (se *SpawnExpr) Node() {}
+func (se *SpawnExpr) Expr() {}
+func (se *SpawnExpr) String() string {
+	return fmt.Sprintf(
+		"(spawn %s)",
+		se.Call,
+	)
+}
+
+type SpreadExpr struct {
+	Loc
+	Value Expr
+}
+
+func (se *SpreadExpr) Node() {}
+func (se *SpreadExpr) Expr() {}
+func (se *SpreadExpr) String() string {
+	return fmt.Sprintf(
+		"...%s",
+		se.Value,
+	)
+}
+
+type NamedArg struct {
+	Loc
+	Name  *Ident
+	Value Expr
+}
+
+func (na *NamedArg) Node() {}
+func (na *NamedArg) Expr() {}
+func (na *NamedArg) String() string {
+	return fmt.Sprintf(
+		"%s: %s",
+		na.Name,
+		na.Value,
+	)
+}
+
 type PropExpr struct {
+	Loc
 	Left Expr
 	Prop *Ident
 }
 
-func (pe *PropExpr) Node() {}
-func (pe *PropExpr) Expr() {}
+func (pe *PropExpr) Node()    {}
+func (pe *PropExpr) Expr()    {}
+func (pe *PropExpr) Pattern() {}
 func (pe *PropExpr) String() string {
 	return fmt.Sprintf(
 		"%s.%s",
@@ -385,12 +551,14 @@ func (pe *PropExpr) String() string {
 }
 
 type IndexExpr struct {
+	Loc
 	Left  Expr
 	Index Expr
 }
 
-func (ie *IndexExpr) Node() {}
-func (ie *IndexExpr) Expr() {}
+func (ie *IndexExpr) Node()    {}
+func (ie *IndexExpr) Expr()    {}
+func (ie *IndexExpr) Pattern() {}
 func (ie *IndexExpr) String() string {
 	return fmt.Sprintf(
 		"%s[%s]",
@@ -400,6 +568,7 @@ func (ie *IndexExpr) String() string {
 }
 
 type SliceExpr struct {
+	Loc
 	Left  Expr
 	Start Expr
 	End   Expr
@@ -418,7 +587,7 @@ func (se *SliceExpr) String() string {
 
 /* == literals ============================================================== */
 
-type NullLit struct{}
+type NullLit struct{ Loc }
 
 func (nl *NullLit) Node() {}
 func (nl *NullLit) Expr() {}
@@ -427,6 +596,7 @@ func (nl *NullLit) String() string {
 }
 
 type BooleanLit struct {
+	Loc
 	Value bool
 }
 
@@ -440,6 +610,7 @@ func (bl *BooleanLit) String() string {
 }
 
 type NumberLit struct {
+	Loc
 	Value float64
 }
 
@@ -450,6 +621,7 @@ func (nl *NumberLit) String() string {
 }
 
 type StringLit struct {
+	Loc
 	Value string
 }
 
@@ -463,8 +635,10 @@ func (sl *StringLit) String() string {
 }
 
 type ClassLit struct {
-	Inits map[*Ident]*FunLit
-	Funs  map[*Ident]*FunLit
+	Loc
+	Inits  map[*Ident]*FunLit
+	Funs   map[*Ident]*FunLit
+	Fields map[*Ident]*Type // declared fields, nil types without annotation
 }
 
 func (cl *ClassLit) Node() {}
@@ -472,6 +646,9 @@ func (cl *ClassLit) Expr() {}
 func (cl *ClassLit) String() string {
 	var str strings.Builder
 	str.WriteString("class{")
+	for ident, t := range cl.Fields {
+		str.WriteString(fmt.Sprintf("var %s%s; ", ident, annotation(t)))
+	}
 	for ident, fun := range cl.Inits {
 		lit := fmt.Sprintf(
 			"init %s %s",
@@ -493,8 +670,14 @@ func (cl *ClassLit) String() string {
 }
 
 type FunLit struct {
-	Body   Stmt
-	Params []*Ident
+	Loc
+	Body      Stmt
+	Params    []*Param
+	Rest      *Ident
+	Return    *Type // nil without annotation
+	Generator bool
+	Async     bool
+	Doc       string // '///' comments above a function or method declaration
 }
 
 func (fl *FunLit) Node() {}
@@ -503,19 +686,51 @@ func (fl *FunLit) String() string {
 	var str strings.Builder
 	for i, param := range fl.Params {
 		str.WriteString(param.String())
-		if i != len(fl.Params)-1 {
+		if i != len(fl.Params)-1 || fl.Rest != nil {
 			str.WriteString(", ")
 		}
 	}
+	if fl.Rest != nil {
+		str.WriteString("..." + fl.Rest.String())
+	}
 	params := str.String()
+	keyword := "fun"
+	if fl.Generator {
+		keyword = "fun*"
+	} else if fl.Async {
+		keyword = "async fun"
+	}
 	return fmt.Sprintf(
-		"fun(%s) %s",
+		"%s(%s)%s %s",
+		keyword,
 		params,
+		annotation(fl.Return),
 		fl.Body,
 	)
 }
 
+type Param struct {
+	Loc
+	Name    *Ident
+	Type    *Type // nil without annotation
+	Default Expr
+}
+
+func (p *Param) Node() {}
+func (p *Param) String() string {
+	if p.Default == nil {
+		return p.Name.String() + annotation(p.Type)
+	}
+	return fmt.Sprintf(
+		"%s%s = %s",
+		p.Name,
+		annotation(p.Type),
+		p.Default,
+	)
+}
+
 type VectorLit struct {
+	Loc
 	Elems []Expr
 }
 
@@ -535,7 +750,9 @@ func (vl *VectorLit) String() string {
 }
 
 type MapLit struct {
+	Loc
 	Pairs map[Expr]Expr
+	Keys  []Expr // the keys of Pairs in source order
 }
 
 func (ml *MapLit) Node() {}
@@ -557,8 +774,104 @@ func (ml *MapLit) String() string {
 	return str.String()
 }
 
-type SelfLit struct{}
+type SelfLit struct{ Loc }
 
 func (sl *SelfLit) Node()          {}
 func (sl *SelfLit) Expr()          {}
 func (sl *SelfLit) String() string { return "self" }
+
+/* == patterns ============================================================== */
+
+type VectorPattern struct {
+	Loc
+	Elems []Pattern
+	Rest  Pattern
+}
+
+func (vp *VectorPattern) Node()    {}
+func (vp *VectorPattern) Pattern() {}
+func (vp *VectorPattern) String() string {
+	var str strings.Builder
+	str.WriteString("vec{")
+	for i, elem := range vp.Elems {
+		str.WriteString(elem.String())
+		if i != len(vp.Elems)-1 || vp.Rest != nil {
+			str.WriteString(", ")
+		}
+	}
+	if vp.Rest != nil {
+		str.WriteString("..." + vp.Rest.String())
+	}
+	str.WriteString("}")
+	return str.String()
+}
+
+type MapPattern struct {
+	Loc
+	Keys   []Expr
+	Values []Pattern
+	Rest   Pattern
+}
+
+func (mp *MapPattern) Node()    {}
+func (mp *MapPattern) Pattern() {}
+func (mp *MapPattern) String() string {
+	var str strings.Builder
+	str.WriteString("map{")
+	for i, key := range mp.Keys {
+		str.WriteString(
+			fmt.Sprintf("%s: %s", key, mp.Values[i]),
+		)
+		if i != len(mp.Keys)-1 || mp.Rest != nil {
+			str.WriteString(", ")
+		}
+	}
+	if mp.Rest != nil {
+		str.WriteString("..." + mp.Rest.String())
+	}
+	str.WriteString("}")
+	return str.String()
+}
+
+type DefaultPattern struct {
+	Loc
+	Target  Pattern
+	Default Expr
+}
+
+func (dp *DefaultPattern) Node()    {}
+func (dp *DefaultPattern) Pattern() {}
+func (dp *DefaultPattern) String() string {
+	return fmt.Sprintf(
+		"%s = %s",
+		dp.Target,
+		dp.Default,
+	)
+}
+
+/* == types ================================================================= */
+
+// Type is a type annotation: the name of a type, followed by '?' when
+// null is accepted too. Annotations are checked by package typecheck and
+// by the evaluator when asked to, they don't change what a script does.
+type Type struct {
+	Loc
+	Name     *Ident
+	Nullable bool
+}
+
+func (t *Type) Node() {}
+func (t *Type) String() string {
+	if t.Nullable {
+		return t.Name.String() + "?"
+	}
+	return t.Name.String()
+}
+
+// annotation returns ': type', or nothing for a nil type.
+func annotation(t *Type) string {
+	if t == nil {
+		return ""
+	}
+	return ": " + t.String()
+}
@@ -0,0 +1,95 @@
+package ast
+
+import (
+	"fmt"
+	"needle/internal/needle/token"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Dump returns an indented tree of node with the position of every node
+// and the value of every field.
+func Dump(node Node) string {
+	var str strings.Builder
+	dump(&str, reflect.ValueOf(node), 0)
+	return str.String()
+}
+
+var locType = reflect.TypeOf(Loc{})
+
+func dump(str *strings.Builder, v reflect.Value, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			str.WriteString("nil\n")
+			return
+		}
+		if node, ok := v.Interface().(Node); ok && v.Kind() == reflect.Pointer {
+			pos := node.Pos()
+			fmt.Fprintf(str, "%s %d:%d\n", v.Elem().Type().Name(), pos.Line, pos.Column)
+			dumpFields(str, v.Elem(), depth+1)
+			return
+		}
+		dump(str, v.Elem(), depth)
+	case reflect.Struct:
+		str.WriteString(v.Type().Name() + "\n")
+		dumpFields(str, v, depth+1)
+	case reflect.Slice:
+		if v.Len() == 0 {
+			str.WriteString("[]\n")
+			return
+		}
+		str.WriteString("\n")
+		for i := 0; i < v.Len(); i++ {
+			fmt.Fprintf(str, "%s  - ", indent)
+			dump(str, v.Index(i), depth+2)
+		}
+	case reflect.Map:
+		if v.Len() == 0 {
+			str.WriteString("{}\n")
+			return
+		}
+		str.WriteString("\n")
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := keys[i].Interface().(Node), keys[j].Interface().(Node)
+			pa, pb := a.Pos(), b.Pos()
+			if pa.Line != pb.Line {
+				return pa.Line < pb.Line
+			}
+			return pa.Column < pb.Column
+		})
+		for _, key := range keys {
+			fmt.Fprintf(str, "%s  - key: ", indent)
+			dump(str, key, depth+2)
+			fmt.Fprintf(str, "%s    value: ", indent)
+			dump(str, v.MapIndex(key), depth+2)
+		}
+	case reflect.String:
+		fmt.Fprintf(str, "%q\n", v.String())
+	default:
+		fmt.Fprintf(str, "%v\n", v.Interface())
+	}
+}
+
+func dumpFields(str *strings.Builder, v reflect.Value, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Type == locType {
+			continue
+		}
+		fmt.Fprintf(str, "%s%s:", indent, field.Name)
+		if k := field.Type.Kind(); (k != reflect.Slice && k != reflect.Map) ||
+			v.Field(i).Len() == 0 {
+			str.WriteByte(' ')
+		}
+		if tk, ok := v.Field(i).Interface().(*token.Token); ok && tk != nil {
+			fmt.Fprintf(str, "%s\n", tk.Type)
+			continue
+		}
+		dump(str, v.Field(i), depth)
+	}
+}
@@ -0,0 +1,56 @@
+package ast
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Inspect calls f for node and, while f returns true, for the nodes
+// below it in depth-first order. Children follow the order of the fields
+// of their parent, map entries are visited by the position of their key.
+func Inspect(node Node, f func(Node) bool) {
+	v := reflect.ValueOf(node)
+	if node == nil || v.Kind() == reflect.Pointer && v.IsNil() {
+		return
+	}
+	if !f(node) {
+		return
+	}
+	inspectChildren(v.Elem(), f)
+}
+
+func inspectChildren(v reflect.Value, f func(Node) bool) {
+	for i := 0; i < v.NumField(); i++ {
+		inspectValue(v.Field(i), f)
+	}
+}
+
+func inspectValue(v reflect.Value, f func(Node) bool) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return
+		}
+		if node, ok := v.Interface().(Node); ok {
+			Inspect(node, f)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			inspectValue(v.Index(i), f)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			a := keys[i].Interface().(Node).Pos()
+			b := keys[j].Interface().(Node).Pos()
+			if a.Line != b.Line {
+				return a.Line < b.Line
+			}
+			return a.Column < b.Column
+		})
+		for _, key := range keys {
+			inspectValue(key, f)
+			inspectValue(v.MapIndex(key), f)
+		}
+	}
+}
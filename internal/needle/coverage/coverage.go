@@ -0,0 +1,135 @@
+// Package coverage reports what the evaluator counted while covering: a
+// summary by file, an LCOV tracefile and an HTML page of annotated
+// sources.
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"needle/internal/needle/evaluator"
+	"needle/internal/needle/token"
+	"sort"
+)
+
+// Summary is how much of a file ran. A line counts when a statement
+// starts on it, a branch is a way of a condition.
+type Summary struct {
+	Path        string
+	Lines       int
+	LinesHit    int
+	Branches    int
+	BranchesHit int
+}
+
+// Percent returns hit out of total in percent, 100 when there is nothing
+// to hit.
+func Percent(hit, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(hit) / float64(total)
+}
+
+// Paths returns the files of c in order, leaving out code run without a
+// file.
+func Paths(c *evaluator.Coverage) []string {
+	paths := []string{}
+	for path := range c.Files {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Summarize returns a summary per file of c, in the order of Paths.
+func Summarize(c *evaluator.Coverage) []Summary {
+	summaries := []Summary{}
+	for _, path := range Paths(c) {
+		f := c.Files[path]
+		s := Summary{Path: path}
+		for _, n := range Lines(f) {
+			s.Lines++
+			if n != 0 {
+				s.LinesHit++
+			}
+		}
+		for _, b := range f.Branches {
+			s.Branches += 2
+			s.BranchesHit += min(b.True, 1) + min(b.False, 1)
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries
+}
+
+// Lines returns the count of every line a statement starts on, the
+// highest of its statements.
+func Lines(f *evaluator.FileCoverage) map[int]int {
+	lines := map[int]int{}
+	for pos, n := range f.Stmts {
+		lines[pos.Line] = max(lines[pos.Line], n)
+	}
+	return lines
+}
+
+// Branches returns the branches of f by line, each line in the order of
+// columns.
+func Branches(f *evaluator.FileCoverage) map[int][]*evaluator.Branch {
+	positions := []token.Position{}
+	for pos := range f.Branches {
+		positions = append(positions, pos)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		a, b := positions[i], positions[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	lines := map[int][]*evaluator.Branch{}
+	for _, pos := range positions {
+		lines[pos.Line] = append(lines[pos.Line], f.Branches[pos])
+	}
+	return lines
+}
+
+// WriteLCOV writes c as an LCOV tracefile, the format genhtml and most
+// coverage services read. Branch 0 of a block is its condition being
+// true, branch 1 false.
+func WriteLCOV(w io.Writer, c *evaluator.Coverage) error {
+	out := bufio.NewWriter(w)
+	for _, s := range Summarize(c) {
+		f := c.Files[s.Path]
+		fmt.Fprintln(out, "TN:")
+		fmt.Fprintf(out, "SF:%s\n", s.Path)
+		branches := Branches(f)
+		for _, line := range sortedLines(branches) {
+			for block, b := range branches[line] {
+				for i, n := range []int{b.True, b.False} {
+					taken := "-" // the condition never ran
+					if b.True+b.False != 0 {
+						taken = fmt.Sprint(n)
+					}
+					fmt.Fprintf(out, "BRDA:%d,%d,%d,%s\n", line, block, i, taken)
+				}
+			}
+		}
+		fmt.Fprintf(out, "BRF:%d\nBRH:%d\n", s.Branches, s.BranchesHit)
+		lines := Lines(f)
+		for _, line := range sortedLines(lines) {
+			fmt.Fprintf(out, "DA:%d,%d\n", line, lines[line])
+		}
+		fmt.Fprintf(out, "LF:%d\nLH:%d\n", s.Lines, s.LinesHit)
+		fmt.Fprintln(out, "end_of_record")
+	}
+	return out.Flush()
+}
+
+func sortedLines[V any](lines map[int]V) []int {
+	sorted := []int{}
+	for line := range lines {
+		sorted = append(sorted, line)
+	}
+	sort.Ints(sorted)
+	return sorted
+}
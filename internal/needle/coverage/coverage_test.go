@@ -0,0 +1,62 @@
+package coverage_test
+
+import (
+	"needle/internal/needle"
+	"needle/internal/needle/coverage"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const script = `fun sign(n) {
+    if (n < 0) {
+        return -1;
+    }
+    return 1;
+}
+var i = 0;
+while (i < 2) i = i + 1;
+say sign(i);
+`
+
+func TestLCOV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.ndl")
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	state := needle.New()
+	state.SetOutput(&strings.Builder{})
+	state.StartCoverage()
+	if err := state.RunFile(path); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := coverage.WriteLCOV(&out, state.StopCoverage()); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"TN:",
+		"SF:" + path,
+		"BRDA:2,0,0,0",
+		"BRDA:2,0,1,1",
+		"BRDA:8,0,0,2",
+		"BRDA:8,0,1,1",
+		"BRF:4",
+		"BRH:3",
+		"DA:1,1",
+		"DA:2,1",
+		"DA:3,0",
+		"DA:5,1",
+		"DA:7,1",
+		"DA:8,2",
+		"DA:9,1",
+		"LF:7",
+		"LH:6",
+		"end_of_record",
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, out.String())
+	}
+}
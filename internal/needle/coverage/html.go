@@ -0,0 +1,101 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"needle/doc"
+	"needle/internal/needle/evaluator"
+	"os"
+	"strings"
+)
+
+/* == html ================================================================== */
+
+const style = `
+body { font-family: monospace; background: #1e1e1e; }
+h1, h2, th, a { color: #c0c0c0; }
+table { border-collapse: collapse; }
+td, th { padding: 0 0.75em; text-align: left; white-space: pre; }
+td.num { text-align: right; }
+`
+
+// WriteHTML writes a page with the summary of c and the source of every
+// file. Lines that ran are in the primary color, those that did not in
+// the secondary one and the others in the content color. The sources are
+// read from disk when writing.
+func WriteHTML(w io.Writer, c *evaluator.Coverage) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, `<!DOCTYPE html>`)
+	fmt.Fprintln(out, `<html lang="en">`)
+	fmt.Fprintln(out, `<head>`)
+	fmt.Fprintln(out, `<meta charset="UTF-8" />`)
+	fmt.Fprintln(out, `<title>Needle coverage</title>`)
+	fmt.Fprintf(out, "<style>\n%s%s</style>\n", doc.Colors, style)
+	fmt.Fprintln(out, `</head>`)
+	fmt.Fprintln(out, `<body>`)
+	fmt.Fprintln(out, `<h1>Coverage</h1>`)
+	summaries := Summarize(c)
+	fmt.Fprintln(out, `<table>`)
+	fmt.Fprintln(out, `<tr><th>file</th><th>lines</th><th>branches</th></tr>`)
+	for i, s := range summaries {
+		fmt.Fprintf(out, `<tr><td><a href="#file%d">%s</a></td>`, i, html.EscapeString(s.Path))
+		fmt.Fprintf(out, `<td class="num">%s</td><td class="num">%s</td></tr>`+"\n",
+			ratio(s.LinesHit, s.Lines), ratio(s.BranchesHit, s.Branches))
+	}
+	fmt.Fprintln(out, `</table>`)
+	for i, s := range summaries {
+		fmt.Fprintf(out, "<h2 id=\"file%d\">%s</h2>\n", i, html.EscapeString(s.Path))
+		writeSource(out, c.Files[s.Path], s.Path)
+	}
+	fmt.Fprintln(out, `</body>`)
+	fmt.Fprintln(out, `</html>`)
+	return out.Flush()
+}
+
+// writeSource writes a row per line: its number, its count, how many
+// ways of its conditions were taken and the line itself.
+func writeSource(out io.Writer, f *evaluator.FileCoverage, path string) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(out, `<p><span class="secondary">%s</span></p>`+"\n", html.EscapeString(err.Error()))
+		return
+	}
+	lines, branches := Lines(f), Branches(f)
+	fmt.Fprintln(out, `<table>`)
+	for i, text := range strings.Split(strings.TrimRight(string(source), "\n"), "\n") {
+		n, executable := lines[i+1]
+		count, color := "", "content"
+		if executable {
+			count, color = fmt.Sprint(n), "primary"
+			if n == 0 {
+				color = "secondary"
+			}
+		}
+		taken, ways, title := 0, 0, []string{}
+		for _, b := range branches[i+1] {
+			taken += min(b.True, 1) + min(b.False, 1)
+			ways += 2
+			title = append(title, fmt.Sprintf("true %d, false %d", b.True, b.False))
+		}
+		ratio := ""
+		if ways != 0 {
+			ratio = fmt.Sprintf("%d/%d", taken, ways)
+			if taken != ways {
+				ratio = `<span class="secondary">` + ratio + "</span>"
+			}
+		}
+		fmt.Fprintf(out,
+			`<tr><td class="num content">%d</td><td class="num %s">%s</td>`+
+				`<td class="num" title="%s">%s</td><td class="%s">%s</td></tr>`+"\n",
+			i+1, color, count,
+			strings.Join(title, "; "), ratio,
+			color, html.EscapeString(strings.TrimRight(text, "\r")))
+	}
+	fmt.Fprintln(out, `</table>`)
+}
+
+func ratio(hit, total int) string {
+	return fmt.Sprintf("%.1f%% (%d/%d)", Percent(hit, total), hit, total)
+}
@@ -0,0 +1,340 @@
+package dap_test
+
+import (
+	"encoding/json"
+	"io"
+	"needle/internal/needle/dap"
+	"needle/internal/needle/framing"
+	"needle/internal/needle/framing/framingtest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client drives a debug adapter the way an editor would, its messages
+// decoded in the background so output events never block the server.
+type client struct {
+	*framingtest.Conn
+	t        *testing.T
+	messages chan *message
+	seq      int
+	output   strings.Builder // output events seen so far
+}
+
+type message struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Command    string          `json:"command"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+func start(t *testing.T) *client {
+	conn := framingtest.Start(t, func(in io.Reader, out io.Writer) error {
+		return dap.NewServer(in, out).Run()
+	})
+	c := &client{Conn: conn, t: t, messages: make(chan *message, 64)}
+	go func() {
+		defer close(c.messages)
+		for {
+			body, err := framing.Read(c.Out)
+			if err != nil {
+				return
+			}
+			msg := &message{}
+			if json.Unmarshal(body, msg) == nil {
+				c.messages <- msg
+			}
+		}
+	}()
+	return c
+}
+
+func (c *client) send(command string, args any) int {
+	c.t.Helper()
+	c.seq++
+	body, err := json.Marshal(map[string]any{
+		"seq": c.seq, "type": "request", "command": command, "arguments": args,
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := framing.Write(c.In, body); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.seq
+}
+
+// next returns the next message that is not an output event.
+func (c *client) next() *message {
+	c.t.Helper()
+	for {
+		select {
+		case msg, ok := <-c.messages:
+			if !ok {
+				c.t.Fatal("the server closed its output")
+			}
+			if msg.Type == "event" && msg.Event == "output" {
+				var body dap.OutputEvent
+				json.Unmarshal(msg.Body, &body)
+				c.output.WriteString(body.Output)
+				continue
+			}
+			return msg
+		case <-time.After(5 * time.Second):
+			c.t.Fatal("timed out waiting for the server")
+		}
+	}
+}
+
+// call sends a request, waits for its response and decodes the body of
+// the response into body.
+func (c *client) call(command string, args any, body any) {
+	c.t.Helper()
+	msg := c.response(c.send(command, args))
+	if !msg.Success {
+		c.t.Fatalf("%s: %s", command, msg.Message)
+	}
+	if body != nil {
+		if err := json.Unmarshal(msg.Body, body); err != nil {
+			c.t.Fatalf("%s: %s in %s", command, err, msg.Body)
+		}
+	}
+}
+
+func (c *client) response(seq int) *message {
+	c.t.Helper()
+	msg := c.next()
+	if msg.Type != "response" || msg.RequestSeq != seq {
+		c.t.Fatalf("expected the response to %d, got %+v", seq, msg)
+	}
+	return msg
+}
+
+func (c *client) event(name string) *message {
+	c.t.Helper()
+	msg := c.next()
+	if msg.Type != "event" || msg.Event != name {
+		c.t.Fatalf("expected a '%s' event, got %+v %s", name, msg, msg.Body)
+	}
+	return msg
+}
+
+// stopped waits for the script to stop and returns the reason and the
+// innermost frame.
+func (c *client) stopped() (string, dap.StackFrame) {
+	c.t.Helper()
+	var stop dap.StoppedEvent
+	json.Unmarshal(c.event("stopped").Body, &stop)
+	var trace struct {
+		StackFrames []dap.StackFrame `json:"stackFrames"`
+	}
+	c.call("stackTrace", map[string]any{"threadId": stop.ThreadID}, &trace)
+	return stop.Reason, trace.StackFrames[0]
+}
+
+func (c *client) evaluate(frame int, expr string) string {
+	c.t.Helper()
+	var result struct {
+		Result string `json:"result"`
+	}
+	c.call("evaluate", map[string]any{"expression": expr, "frameId": frame}, &result)
+	return result.Result
+}
+
+const script = `fun add(a, b) {
+    var sum = a + b;
+    return sum;
+}
+
+var total = 0;
+var xs = vec{1, 2};
+for (var i = 0; i < 3; i = i + 1) {
+    total = add(total, i);
+}
+say total;
+`
+
+func launch(t *testing.T, stopOnEntry bool, breakpoints ...int) (*client, string) {
+	path := filepath.Join(t.TempDir(), "main.ndl")
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := start(t)
+	var caps map[string]any
+	c.call("initialize", map[string]any{"adapterID": "needle"}, &caps)
+	if caps["supportsConfigurationDoneRequest"] != true {
+		t.Errorf("initialize: expected configurationDone support, got %v", caps)
+	}
+	c.event("initialized")
+	c.call("launch", map[string]any{"program": path, "stopOnEntry": stopOnEntry}, nil)
+	bps := []map[string]any{}
+	for _, line := range breakpoints {
+		bps = append(bps, map[string]any{"line": line})
+	}
+	var set struct {
+		Breakpoints []dap.Breakpoint `json:"breakpoints"`
+	}
+	c.call("setBreakpoints", map[string]any{"source": map[string]any{"path": path}, "breakpoints": bps}, &set)
+	for i, bp := range set.Breakpoints {
+		if !bp.Verified {
+			t.Errorf("breakpoint at line %d not verified: %s", breakpoints[i], bp.Message)
+		}
+	}
+	c.call("configurationDone", nil, nil)
+	return c, path
+}
+
+func (c *client) finish(code int) {
+	c.t.Helper()
+	var exited dap.ExitedEvent
+	json.Unmarshal(c.event("exited").Body, &exited)
+	if exited.ExitCode != code {
+		c.t.Errorf("expected exit code %d, got %d", code, exited.ExitCode)
+	}
+	c.event("terminated")
+	c.call("disconnect", nil, nil)
+	select {
+	case err := <-c.Done:
+		if err != nil {
+			c.t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("the server did not exit")
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	c, path := launch(t, false, 3)
+
+	for i, want := range []string{"0", "1", "3"} {
+		reason, frame := c.stopped()
+		if reason != "breakpoint" || frame.Line != 3 || frame.Name != "add" || frame.Source.Path != path {
+			t.Fatalf("expected to stop in add at line 3, got %s %+v", reason, frame)
+		}
+		if got := c.evaluate(frame.ID, "sum"); got != want {
+			t.Errorf("iteration %d: expected sum to be %s, got %s", i, want, got)
+		}
+		c.call("continue", map[string]any{"threadId": 1}, nil)
+	}
+	c.finish(0)
+	if got := c.output.String(); got != "3\n" {
+		t.Errorf("expected the output 3, got %q", got)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	c, path := launch(t, false, 2)
+	_, frame := c.stopped()
+
+	var trace struct {
+		StackFrames []dap.StackFrame `json:"stackFrames"`
+	}
+	c.call("stackTrace", map[string]any{"threadId": 1}, &trace)
+	if len(trace.StackFrames) != 2 || trace.StackFrames[1].Name != "<script>" || trace.StackFrames[1].Line != 9 {
+		t.Fatalf("expected add called from line 9, got %+v", trace.StackFrames)
+	}
+
+	var scopes struct {
+		Scopes []dap.Scope `json:"scopes"`
+	}
+	c.call("scopes", map[string]any{"frameId": frame.ID}, &scopes)
+	names := []string{}
+	for _, scope := range scopes.Scopes {
+		names = append(names, scope.Name)
+	}
+	if strings.Join(names, " ") != "Locals Enclosing Globals" {
+		t.Fatalf("expected Locals, Enclosing and Globals, got %v", names)
+	}
+	variables := func(ref int) map[string]dap.Variable {
+		var body struct {
+			Variables []dap.Variable `json:"variables"`
+		}
+		c.call("variables", map[string]any{"variablesReference": ref}, &body)
+		vars := map[string]dap.Variable{}
+		for _, v := range body.Variables {
+			vars[v.Name] = v
+		}
+		return vars
+	}
+	params := variables(scopes.Scopes[1].VariablesReference)
+	if params["a"].Value != "0" || params["b"].Value != "0" {
+		t.Errorf("expected a and b to be 0, got %+v", params)
+	}
+	globals := variables(scopes.Scopes[2].VariablesReference)
+	xs, ok := globals["xs"]
+	if !ok || xs.VariablesReference == 0 {
+		t.Fatalf("expected the vector xs to be expandable, got %+v", globals)
+	}
+	if elems := variables(xs.VariablesReference); elems["[1]"].Value != "2" {
+		t.Errorf("expected xs[1] to be 2, got %+v", elems)
+	}
+
+	// the caller frame sees the loop variable
+	if got := c.evaluate(trace.StackFrames[1].ID, "i + 10"); got != "10" {
+		t.Errorf("expected i + 10 to be 10, got %s", got)
+	}
+	msg := c.response(c.send("evaluate", map[string]any{"expression": "nope", "frameId": frame.ID}))
+	if msg.Success || !strings.Contains(msg.Message, "not exists") {
+		t.Errorf("expected an error for an undefined name, got %+v", msg)
+	}
+
+	c.call("setBreakpoints", map[string]any{"source": map[string]any{"path": path}, "breakpoints": []any{}}, nil)
+	c.call("continue", map[string]any{"threadId": 1}, nil)
+	c.finish(0)
+}
+
+func TestStepping(t *testing.T) {
+	c, _ := launch(t, true)
+	step := func(command string, reason string, line int) {
+		t.Helper()
+		c.call(command, map[string]any{"threadId": 1}, nil)
+		got, frame := c.stopped()
+		if got != reason || frame.Line != line {
+			t.Fatalf("%s: expected to stop at line %d, got %s at line %d", command, line, got, frame.Line)
+		}
+	}
+	if reason, frame := c.stopped(); reason != "entry" || frame.Line != 1 {
+		t.Fatalf("expected to stop on entry, got %s at %d", reason, frame.Line)
+	}
+	step("next", "step", 6)
+	step("next", "step", 7)
+	step("next", "step", 8)
+	step("next", "step", 9)
+	step("stepIn", "step", 2)
+	step("next", "step", 3)
+	step("stepOut", "step", 8)
+
+	c.call("pause", map[string]any{"threadId": 1}, nil)
+	c.call("continue", map[string]any{"threadId": 1}, nil)
+	if reason, _ := c.stopped(); reason != "pause" {
+		t.Errorf("expected to stop for the pause, got %s", reason)
+	}
+	c.call("continue", map[string]any{"threadId": 1}, nil)
+	c.finish(0)
+}
+
+func TestTerminate(t *testing.T) {
+	c, _ := launch(t, true)
+	c.stopped()
+	// the script may end before the response comes
+	seq := c.send("disconnect", nil)
+	for msg := c.next(); msg.Type != "response" || msg.RequestSeq != seq; msg = c.next() {
+		if msg.Type != "event" {
+			t.Fatalf("unexpected %+v", msg)
+		}
+	}
+	select {
+	case err := <-c.Done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server did not exit")
+	}
+}
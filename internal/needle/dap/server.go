@@ -0,0 +1,348 @@
+// Package dap is a Debug Adapter Protocol server for needle scripts, it
+// lets an editor drive a debugger.Session over a reader and a writer,
+// usually stdin and stdout.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"needle/internal/needle/debugger"
+	"needle/internal/needle/evaluator"
+	"path/filepath"
+	"sync"
+)
+
+// threadID names the only thread the server reports, tasks take turns
+// on the interpreter and the paused one is always shown.
+const threadID = 1
+
+// Server debugs one script for one client.
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	mu  sync.Mutex // guards out and seq, events come from other goroutines
+	seq int
+
+	session    *debugger.Session
+	launch     *LaunchArguments
+	configured bool
+	started    bool
+	handles    []any // envs and values by variables reference, while paused
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:      bufio.NewReader(in),
+		out:     out,
+		session: debugger.New(),
+	}
+}
+
+// Run serves requests until the client disconnects or closes the input.
+func (s *Server) Run() error {
+	for {
+		req, err := readRequest(s.in)
+		if errors.Is(err, io.EOF) {
+			s.session.Terminate()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		body, err := s.handle(req)
+		res := &response{
+			Type:       "response",
+			RequestSeq: req.Seq,
+			Success:    err == nil,
+			Command:    req.Command,
+			Body:       body,
+		}
+		if err != nil {
+			res.Message = err.Error()
+		}
+		s.send(res)
+		if err == nil {
+			s.after(req)
+		}
+		if req.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+func (s *Server) send(msg any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	switch msg := msg.(type) {
+	case *response:
+		msg.Seq = s.seq
+	case *event:
+		msg.Seq = s.seq
+	}
+	writeMessage(s.out, msg)
+}
+
+func (s *Server) event(name string, body any) {
+	s.send(&event{Type: "event", Event: name, Body: body})
+}
+
+// output turns what the script prints into output events.
+type output struct {
+	s *Server
+}
+
+func (o output) Write(p []byte) (int, error) {
+	o.s.event("output", OutputEvent{Category: "stdout", Output: string(p)})
+	return len(p), nil
+}
+
+func (s *Server) handle(req *request) (any, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		args := &LaunchArguments{}
+		if err := decode(req, args); err != nil {
+			return nil, err
+		}
+		if args.Program == "" {
+			return nil, errors.New("launch: missing 'program'")
+		}
+		s.launch = args
+		return nil, nil
+	case "configurationDone":
+		s.configured = true
+		return nil, nil
+	case "setBreakpoints":
+		args := &SetBreakpointsArguments{}
+		if err := decode(req, args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(args)
+	case "threads":
+		return map[string]any{"threads": []Thread{{ID: threadID, Name: "main"}}}, nil
+	case "stackTrace":
+		return s.stackTrace()
+	case "scopes":
+		args := &FrameArguments{}
+		if err := decode(req, args); err != nil {
+			return nil, err
+		}
+		return s.scopes(args.FrameID)
+	case "variables":
+		args := &VariablesArguments{}
+		if err := decode(req, args); err != nil {
+			return nil, err
+		}
+		return s.variables(args.VariablesReference)
+	case "evaluate":
+		args := &EvaluateArguments{}
+		if err := decode(req, args); err != nil {
+			return nil, err
+		}
+		return s.evaluate(args)
+	case "continue":
+		return map[string]any{"allThreadsContinued": true}, s.paused()
+	case "next", "stepIn", "stepOut":
+		return nil, s.paused()
+	case "pause":
+		s.session.Pause()
+		return nil, nil
+	case "disconnect", "terminate":
+		s.session.Terminate()
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported request '%s'", req.Command)
+}
+
+// after runs what follows the response to req: events, or resuming the
+// script, whose stops would otherwise come before the response.
+func (s *Server) after(req *request) {
+	switch req.Command {
+	case "initialize":
+		s.event("initialized", nil)
+	case "launch", "configurationDone":
+		if s.launch != nil && s.configured && !s.started {
+			s.start()
+		}
+	case "continue":
+		s.resume(s.session.Continue)
+	case "next":
+		s.resume(s.session.StepOver)
+	case "stepIn":
+		s.resume(s.session.StepIn)
+	case "stepOut":
+		s.resume(s.session.StepOut)
+	}
+}
+
+func decode(req *request, args any) error {
+	if len(req.Arguments) == 0 {
+		return nil
+	}
+	return json.Unmarshal(req.Arguments, args)
+}
+
+func (s *Server) start() {
+	s.started = true
+	if s.launch.StopOnEntry {
+		s.session.StopOnEntry()
+	}
+	s.session.Start(s.launch.Program, s.launch.Args, output{s})
+	go func() {
+		for ev := range s.session.Events() {
+			if ev.Stop != nil {
+				s.event("stopped", StoppedEvent{
+					Reason:            ev.Stop.Reason,
+					ThreadID:          threadID,
+					AllThreadsStopped: true,
+				})
+				continue
+			}
+			code := 0
+			if ev.Err != nil {
+				code = 1
+				var exit *evaluator.Exit
+				if errors.As(ev.Err, &exit) {
+					code = exit.Code
+				} else {
+					s.event("output", OutputEvent{Category: "stderr", Output: ev.Err.Error() + "\n"})
+				}
+			}
+			s.event("exited", ExitedEvent{ExitCode: code})
+			s.event("terminated", nil)
+			return
+		}
+	}()
+}
+
+func (s *Server) paused() error {
+	if !s.started {
+		return debugger.ErrNotPaused
+	}
+	_, err := s.session.Frames()
+	return err
+}
+
+func (s *Server) resume(step func() error) {
+	s.handles = nil
+	step()
+}
+
+/* == inspection ============================================================ */
+
+func (s *Server) setBreakpoints(args *SetBreakpointsArguments) (any, error) {
+	lines := []int{}
+	for _, bp := range args.Breakpoints {
+		lines = append(lines, bp.Line)
+	}
+	breakpoints := []Breakpoint{}
+	actual, err := s.session.SetBreakpoints(args.Source.Path, lines)
+	for i, line := range lines {
+		switch {
+		case err != nil:
+			breakpoints = append(breakpoints, Breakpoint{Line: line, Message: err.Error()})
+		case actual[i] == 0:
+			breakpoints = append(breakpoints, Breakpoint{Line: line, Message: "no statement on or after this line"})
+		default:
+			breakpoints = append(breakpoints, Breakpoint{Verified: true, Line: actual[i]})
+		}
+	}
+	return map[string]any{"breakpoints": breakpoints}, nil
+}
+
+func (s *Server) stackTrace() (any, error) {
+	frames, err := s.session.Frames()
+	if err != nil {
+		return nil, err
+	}
+	stack := []StackFrame{}
+	for i, frame := range frames {
+		sf := StackFrame{ID: i + 1, Name: frame.Name, Line: frame.Line, Column: 1}
+		if frame.File != "" {
+			sf.Source = &Source{Name: filepath.Base(frame.File), Path: frame.File}
+		}
+		stack = append(stack, sf)
+	}
+	return map[string]any{"stackFrames": stack, "totalFrames": len(stack)}, nil
+}
+
+// reference returns the variables reference of an env or a value, 0 for
+// values without children.
+func (s *Server) reference(x any) int {
+	if value, ok := x.(evaluator.Value); ok && len(debugger.Children(value)) == 0 {
+		return 0
+	}
+	s.handles = append(s.handles, x)
+	return len(s.handles)
+}
+
+func (s *Server) scopes(frameID int) (any, error) {
+	scopes := []Scope{}
+	var frameErr error
+	err := s.session.Inspect(func(e *evaluator.Evaluator) {
+		frames := e.Frames()
+		if frameID < 1 || frameID > len(frames) {
+			frameErr = fmt.Errorf("no frame %d", frameID)
+			return
+		}
+		for _, scope := range debugger.Scopes(frames[frameID-1]) {
+			scopes = append(scopes, Scope{
+				Name:               scope.Name,
+				VariablesReference: s.reference(scope.Env),
+				Expensive:          scope.Name == "Globals",
+			})
+		}
+	})
+	if err == nil {
+		err = frameErr
+	}
+	return map[string]any{"scopes": scopes}, err
+}
+
+func (s *Server) variables(ref int) (any, error) {
+	if ref < 1 || ref > len(s.handles) {
+		return nil, fmt.Errorf("no variables %d", ref)
+	}
+	vars := []Variable{}
+	err := s.session.Inspect(func(e *evaluator.Evaluator) {
+		var children []debugger.Variable
+		switch x := s.handles[ref-1].(type) {
+		case *evaluator.Env:
+			children = debugger.Vars(x)
+		case evaluator.Value:
+			children = debugger.Children(x)
+		}
+		for _, child := range children {
+			vars = append(vars, Variable{
+				Name:               child.Name,
+				Value:              child.Value.Say(),
+				Type:               string(child.Value.Type()),
+				VariablesReference: s.reference(child.Value),
+			})
+		}
+	})
+	return map[string]any{"variables": vars}, err
+}
+
+func (s *Server) evaluate(args *EvaluateArguments) (any, error) {
+	frame := max(args.FrameID-1, 0)
+	value, err := s.session.Evaluate(frame, args.Expression)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]any{"result": value.Say(), "type": string(value.Type())}
+	s.session.Inspect(func(*evaluator.Evaluator) {
+		result["variablesReference"] = s.reference(value)
+	})
+	return result, nil
+}
@@ -0,0 +1,315 @@
+// Package debugger pauses a running script at breakpoints and steps,
+// and lets a client inspect it while it is paused. The script runs on
+// its own goroutine, the client drives it from another one through a
+// Session: it waits for events and resumes the script with Continue or
+// one of the steps.
+package debugger
+
+import (
+	"errors"
+	"io"
+	"needle/internal/needle"
+	"needle/internal/needle/ast"
+	"needle/internal/needle/evaluator"
+	"needle/internal/needle/token"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Stop reasons.
+const (
+	ReasonEntry      = "entry"
+	ReasonBreakpoint = "breakpoint"
+	ReasonStep       = "step"
+	ReasonPause      = "pause"
+)
+
+// Event tells the client that the script stopped or ended.
+type Event struct {
+	Stop *Stop // nil once the script has ended
+	Err  error // what the script ended with
+}
+
+// Stop is where the script paused and why.
+type Stop struct {
+	Reason string
+	File   string
+	Line   int
+}
+
+type mode int
+
+const (
+	modeContinue mode = iota
+	modeStepIn
+	modeStepOver
+	modeStepOut
+)
+
+type location struct {
+	file  string
+	line  int
+	depth int
+}
+
+var ErrNotPaused = errors.New("the script is not paused")
+
+// Session debugs one run of a script.
+type Session struct {
+	mu          sync.Mutex
+	breakpoints map[string]map[int]int // first column by line by absolute path
+	paused      bool
+
+	entry     bool
+	interrupt atomic.Bool // pause at the next statement
+	kill      atomic.Bool // end the script at the next statement
+	events    chan Event
+	commands  chan func(*evaluator.Evaluator) bool
+
+	// only touched by the script goroutine
+	mode mode
+	from location // where the last step started
+}
+
+func New() *Session {
+	return &Session{
+		breakpoints: map[string]map[int]int{},
+		events:      make(chan Event, 1),
+		commands:    make(chan func(*evaluator.Evaluator) bool),
+	}
+}
+
+// StopOnEntry makes the script pause before its first statement.
+func (s *Session) StopOnEntry() {
+	s.entry = true
+}
+
+// Start runs the script at path with the session attached, args are
+// forwarded as 'os.args' and what the script prints goes to out.
+func (s *Session) Start(path string, args []string, out io.Writer) {
+	state := needle.New()
+	state.SetArgs(args)
+	state.SetOutput(out)
+	state.SetDebugger(s)
+	go func() {
+		defer state.Close()
+		err := state.RunFile(path)
+		var exit *evaluator.Exit
+		if errors.As(err, &exit) && s.kill.Load() {
+			err = nil
+		}
+		s.events <- Event{Err: err}
+	}()
+}
+
+// Events returns the events of the session, the last one has no Stop.
+func (s *Session) Events() <-chan Event {
+	return s.events
+}
+
+/* == breakpoints =========================================================== */
+
+// SetBreakpoints replaces the breakpoints of the script at path. A line
+// without a statement moves to the next one that has some, the result
+// holds where each breakpoint ended up, 0 if there is no statement after
+// it. The script stops before the first statement of the line only, so
+// once per loop iteration on a line like 'while (x) { f(); g(); }'.
+func (s *Session) SetBreakpoints(path string, lines []int) ([]int, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	source, err := needle.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	script, err := needle.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	starts := lineStarts(script)
+	steps := []int{}
+	for line := range starts {
+		steps = append(steps, line)
+	}
+	sort.Ints(steps)
+	set := map[int]int{}
+	actual := []int{}
+	for _, line := range lines {
+		i := sort.SearchInts(steps, line)
+		if i == len(steps) {
+			actual = append(actual, 0)
+			continue
+		}
+		set[steps[i]] = starts[steps[i]]
+		actual = append(actual, steps[i])
+	}
+	s.mu.Lock()
+	s.breakpoints[path] = set
+	s.mu.Unlock()
+	return actual, nil
+}
+
+// lineStarts returns the column of the first statement of every line
+// that has some.
+func lineStarts(script *ast.Script) map[int]int {
+	starts := map[int]int{}
+	ast.Inspect(script, func(node ast.Node) bool {
+		if evaluator.Steppable(node) {
+			pos := node.Pos()
+			if col, ok := starts[pos.Line]; !ok || pos.Column < col {
+				starts[pos.Line] = pos.Column
+			}
+		}
+		return true
+	})
+	return starts
+}
+
+func (s *Session) hasBreakpoint(file string, pos token.Position) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	col, ok := s.breakpoints[file][pos.Line]
+	return ok && col == pos.Column
+}
+
+/* == script side =========================================================== */
+
+// Step implements evaluator.Debugger, it runs on the script goroutine.
+func (s *Session) Step(e *evaluator.Evaluator, node ast.Node) {
+	if s.kill.Load() {
+		panic(&evaluator.Exit{Code: 1})
+	}
+	here := location{e.File(), node.Pos().Line, e.Depth()}
+	reason := ""
+	switch {
+	case s.entry:
+		s.entry = false
+		reason = ReasonEntry
+	case s.interrupt.CompareAndSwap(true, false):
+		reason = ReasonPause
+	case s.hasBreakpoint(here.file, node.Pos()):
+		reason = ReasonBreakpoint
+	case s.mode == modeStepIn && here != s.from,
+		s.mode == modeStepOver && (here.depth < s.from.depth ||
+			here.depth == s.from.depth && here != s.from),
+		s.mode == modeStepOut && here.depth < s.from.depth:
+		reason = ReasonStep
+	}
+	if reason == "" {
+		return
+	}
+	s.mu.Lock()
+	s.paused = true
+	s.mu.Unlock()
+	s.events <- Event{Stop: &Stop{Reason: reason, File: here.file, Line: here.line}}
+	for command := range s.commands {
+		if command(e) {
+			break
+		}
+	}
+	s.from = here
+	if s.kill.Load() {
+		panic(&evaluator.Exit{Code: 1})
+	}
+}
+
+/* == client side =========================================================== */
+
+// do runs f on the paused script goroutine, the script resumes if f
+// returns true.
+func (s *Session) do(f func(*evaluator.Evaluator) bool) error {
+	s.mu.Lock()
+	paused := s.paused
+	s.mu.Unlock()
+	if !paused {
+		return ErrNotPaused
+	}
+	done := make(chan struct{})
+	s.commands <- func(e *evaluator.Evaluator) bool {
+		defer close(done)
+		return f(e)
+	}
+	<-done
+	return nil
+}
+
+func (s *Session) resume(m mode) error {
+	return s.do(func(*evaluator.Evaluator) bool {
+		s.mu.Lock()
+		s.paused = false
+		s.mu.Unlock()
+		s.mode = m
+		return true
+	})
+}
+
+// Continue runs the script to the next breakpoint.
+func (s *Session) Continue() error {
+	return s.resume(modeContinue)
+}
+
+// StepIn runs the script to the next statement, into calls.
+func (s *Session) StepIn() error {
+	return s.resume(modeStepIn)
+}
+
+// StepOver runs the script to the next line of the current function or
+// of one of its callers.
+func (s *Session) StepOver() error {
+	return s.resume(modeStepOver)
+}
+
+// StepOut runs the script until the current function returns.
+func (s *Session) StepOut() error {
+	return s.resume(modeStepOut)
+}
+
+// Pause stops the running script at its next statement.
+func (s *Session) Pause() {
+	s.interrupt.Store(true)
+}
+
+// Terminate ends the script before its next statement, even one in a
+// 'finally' block.
+func (s *Session) Terminate() {
+	s.kill.Store(true)
+	s.Continue()
+}
+
+// Inspect runs f on the script goroutine while the script is paused,
+// values and envs must be read from f only.
+func (s *Session) Inspect(f func(e *evaluator.Evaluator)) error {
+	return s.do(func(e *evaluator.Evaluator) bool {
+		f(e)
+		return false
+	})
+}
+
+// Frames returns the call stack of the paused script, innermost first.
+func (s *Session) Frames() ([]evaluator.Frame, error) {
+	var frames []evaluator.Frame
+	err := s.Inspect(func(e *evaluator.Evaluator) {
+		frames = e.Frames()
+	})
+	return frames, err
+}
+
+// Evaluate runs source in the frame of the paused script at index frame
+// of Frames.
+func (s *Session) Evaluate(frame int, source string) (value evaluator.Value, err error) {
+	doErr := s.Inspect(func(e *evaluator.Evaluator) {
+		frames := e.Frames()
+		if frame < 0 || frame >= len(frames) {
+			err = errors.New("no such frame")
+			return
+		}
+		value, err = e.Evaluate(source, frames[frame].Env)
+	})
+	if doErr != nil {
+		return nil, doErr
+	}
+	return value, err
+}
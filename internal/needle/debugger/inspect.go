@@ -0,0 +1,78 @@
+package debugger
+
+import (
+	"fmt"
+	"needle/internal/needle/evaluator"
+	"sort"
+)
+
+// The functions below read values and envs, call them from Inspect.
+
+// Scope is an env of a frame, named for display.
+type Scope struct {
+	Name string
+	Env  *evaluator.Env
+}
+
+// Variable is a named value.
+type Variable struct {
+	Name  string
+	Value evaluator.Value
+}
+
+// Scopes returns the envs visible from frame, innermost first and
+// without the builtins.
+func Scopes(frame evaluator.Frame) []Scope {
+	scopes := []Scope{}
+	for env := frame.Env; env != nil && env.Outer() != nil; env = env.Outer() {
+		name := "Enclosing"
+		switch {
+		case env.Outer().Outer() == nil:
+			name = "Globals"
+		case len(scopes) == 0:
+			name = "Locals"
+		}
+		scopes = append(scopes, Scope{name, env})
+	}
+	return scopes
+}
+
+// Vars returns the variables declared in env, sorted by name.
+func Vars(env *evaluator.Env) []Variable {
+	vars := []Variable{}
+	for _, name := range env.Locals() {
+		value, _ := env.Get(name)
+		vars = append(vars, Variable{name, value})
+	}
+	return vars
+}
+
+// Children returns the elements of a vector, the pairs of a map and the
+// fields of an instance or a module, nil for other values.
+func Children(value evaluator.Value) []Variable {
+	vars := []Variable{}
+	switch value := value.(type) {
+	case *evaluator.Vector:
+		for i, elem := range value.Elems {
+			vars = append(vars, Variable{fmt.Sprintf("[%d]", i), elem})
+		}
+		return vars
+	case *evaluator.Map:
+		for _, key := range value.Pairs.Keys() {
+			elem, _ := value.Pairs.Get(key)
+			vars = append(vars, Variable{"[" + key.Say() + "]", elem})
+		}
+	case *evaluator.Instance:
+		for name, field := range value.Fields {
+			vars = append(vars, Variable{name, field})
+		}
+	case *evaluator.Module:
+		for name, member := range value.Store {
+			vars = append(vars, Variable{name, member})
+		}
+	default:
+		return nil
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	return vars
+}
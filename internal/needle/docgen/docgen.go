@@ -0,0 +1,277 @@
+// Package docgen makes documentation pages from the '///' comments of
+// scripts and from the Go-side docs of the builtins. Both go through the
+// same model, a Page of entries, rendered as HTML or Markdown with
+// cross-links between the pages.
+package docgen
+
+import (
+	"needle/internal/needle/ast"
+	"needle/internal/needle/evaluator"
+	"slices"
+	"strings"
+)
+
+// Kind is what an entry declares.
+type Kind string
+
+const (
+	Var    Kind = "var"
+	Fun    Kind = "fun"
+	Class  Kind = "class"
+	Init   Kind = "init"
+	Method Kind = "method"
+	Module Kind = "module"
+)
+
+// Param is a parameter of a function.
+type Param struct {
+	Name     string
+	Type     string // annotation, "" without
+	Default  string // source of the default value, "" without
+	Optional bool   // may be left out, for builtins
+	Rest     bool
+}
+
+// Entry is a documented declaration.
+type Entry struct {
+	Kind    Kind
+	Name    string
+	Keyword string // of functions: "fun", "fun*" or "async fun"
+	Params  []*Param
+	Type    string // annotation of a variable or result of a function
+	Doc     string
+	Members []*Entry // of classes and modules
+}
+
+// Page is the documentation of a script or of the builtins.
+type Page struct {
+	Name    string // also the name of the page file, without extension
+	Doc     string
+	Entries []*Entry
+}
+
+// BuiltinsPage is the name of the page of the builtins.
+const BuiltinsPage = "builtins"
+
+// FromScript returns the page of a script: its top level declarations,
+// but those with a name starting with '_', in source order.
+func FromScript(name string, script *ast.Script) *Page {
+	page := &Page{Name: name, Doc: script.Doc}
+	for _, decl := range script.Decls {
+		var entry *Entry
+		switch decl := decl.(type) {
+		case *ast.VarDecl:
+			entry = &Entry{Kind: Var, Name: decl.Name.Name, Doc: decl.Doc}
+			if decl.Type != nil {
+				entry.Type = decl.Type.String()
+			}
+		case *ast.FunDecl:
+			entry = function(Fun, decl.Name.Name, decl.Fun)
+		case *ast.ClassDecl:
+			entry = &Entry{Kind: Class, Name: decl.Name.Name, Doc: decl.Doc}
+			entry.Members = append(
+				members(Init, decl.Class.Inits),
+				members(Method, decl.Class.Funs)...,
+			)
+		}
+		if entry != nil && !strings.HasPrefix(entry.Name, "_") {
+			page.Entries = append(page.Entries, entry)
+		}
+	}
+	return page
+}
+
+func function(kind Kind, name string, lit *ast.FunLit) *Entry {
+	entry := &Entry{Kind: kind, Name: name, Keyword: "fun", Doc: lit.Doc}
+	switch {
+	case lit.Generator:
+		entry.Keyword = "fun*"
+	case lit.Async:
+		entry.Keyword = "async fun"
+	}
+	for _, p := range lit.Params {
+		param := &Param{Name: p.Name.Name}
+		if p.Type != nil {
+			param.Type = p.Type.String()
+		}
+		if p.Default != nil {
+			param.Default = p.Default.String()
+		}
+		entry.Params = append(entry.Params, param)
+	}
+	if lit.Rest != nil {
+		entry.Params = append(entry.Params, &Param{Name: lit.Rest.Name, Rest: true})
+	}
+	if lit.Return != nil {
+		entry.Type = lit.Return.String()
+	}
+	return entry
+}
+
+// members returns the entries of the methods or initializers of a class
+// in source order.
+func members(kind Kind, funs map[*ast.Ident]*ast.FunLit) []*Entry {
+	names := []*ast.Ident{}
+	for name := range funs {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b *ast.Ident) int {
+		if a.Position.Line != b.Position.Line {
+			return a.Position.Line - b.Position.Line
+		}
+		return a.Position.Column - b.Position.Column
+	})
+	entries := []*Entry{}
+	for _, name := range names {
+		entries = append(entries, function(kind, name.Name, funs[name]))
+	}
+	return entries
+}
+
+// Builtins returns the page of the global functions, base classes and
+// base modules.
+func Builtins() *Page {
+	functions, classes, modules, members := evaluator.Builtins()
+	page := &Page{
+		Name: BuiltinsPage,
+		Doc:  "The functions and classes every script starts with, and the modules it can import by name.",
+	}
+	for _, fun := range functions {
+		page.Entries = append(page.Entries, builtin(Fun, fun))
+	}
+	for _, class := range classes {
+		entry := builtin(Class, class)
+		for _, member := range members[class.Name] {
+			kind := Method
+			if member.Init {
+				kind = Init
+			}
+			entry.Members = append(entry.Members, builtin(kind, member))
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	for _, module := range modules {
+		entry := builtin(Module, module)
+		for _, member := range members[module.Name] {
+			kind := Var
+			if member.Function {
+				kind = Fun
+			}
+			entry.Members = append(entry.Members, builtin(kind, member))
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	return page
+}
+
+func builtin(kind Kind, doc *evaluator.BuiltinDoc) *Entry {
+	entry := &Entry{Kind: kind, Name: doc.Name, Doc: doc.Doc}
+	if doc.Function {
+		entry.Keyword = "fun"
+	}
+	for _, name := range doc.Params {
+		param := &Param{Name: name}
+		if rest, ok := strings.CutPrefix(name, "..."); ok {
+			param.Name, param.Rest = rest, true
+		} else if optional, ok := strings.CutSuffix(name, "?"); ok {
+			param.Name, param.Optional = optional, true
+		}
+		entry.Params = append(entry.Params, param)
+	}
+	return entry
+}
+
+/* == links ================================================================= */
+
+// links finds the anchors of the names declared by the pages: top level
+// names, and members qualified by their class or module.
+type links struct {
+	ext     string // of the page files
+	targets map[string]string
+	local   map[*Page]map[string]bool
+}
+
+func newLinks(pages []*Page, ext string) *links {
+	l := &links{ext: ext, targets: map[string]string{}, local: map[*Page]map[string]bool{}}
+	for _, page := range pages {
+		l.local[page] = map[string]bool{}
+		add := func(name string) {
+			l.local[page][name] = true
+			if _, ok := l.targets[name]; !ok {
+				l.targets[name] = page.Name + ext + "#" + name
+			}
+		}
+		for _, entry := range page.Entries {
+			add(entry.Name)
+			for _, member := range entry.Members {
+				add(anchor(entry, member))
+			}
+		}
+	}
+	return l
+}
+
+// find returns the link to name from page, preferring the declarations
+// of page.
+func (l *links) find(name string, page *Page) (string, bool) {
+	if l.local[page][name] {
+		return "#" + name, true
+	}
+	href, ok := l.targets[name]
+	return href, ok
+}
+
+// anchor returns the anchor of member of parent.
+func anchor(parent, member *Entry) string {
+	return parent.Name + "." + member.Name
+}
+
+/* == signatures ============================================================ */
+
+// signature returns the declaration of entry as source, its text passed
+// through text and its type names through typeName.
+func signature(entry *Entry, text, typeName func(string) string) string {
+	var str strings.Builder
+	switch entry.Kind {
+	case Class, Module, Init:
+		str.WriteString(text(string(entry.Kind) + " " + entry.Name))
+	case Var:
+		str.WriteString(text("var " + entry.Name))
+	default:
+		str.WriteString(text(entry.Keyword + " " + entry.Name))
+	}
+	if entry.Keyword != "" || entry.Kind == Init {
+		params := []string{}
+		for _, p := range entry.Params {
+			param := p.Name
+			switch {
+			case p.Rest:
+				param = "..." + param
+			case p.Optional:
+				param += "?"
+			}
+			param = text(param)
+			if p.Type != "" {
+				param += text(": ") + typeName(p.Type)
+			}
+			if p.Default != "" {
+				param += text(" = " + p.Default)
+			}
+			params = append(params, param)
+		}
+		str.WriteString(text("(") + strings.Join(params, text(", ")) + text(")"))
+	}
+	if entry.Type != "" {
+		str.WriteString(text(": ") + typeName(entry.Type))
+	}
+	return str.String()
+}
+
+// summary returns the first sentence of a doc.
+func summary(doc string) string {
+	doc = strings.Join(strings.Fields(doc), " ")
+	if i := strings.Index(doc, ". "); i >= 0 {
+		return doc[:i+1]
+	}
+	return doc
+}
@@ -0,0 +1,106 @@
+package docgen_test
+
+import (
+	"bytes"
+	"needle/internal/needle"
+	"needle/internal/needle/docgen"
+	"strings"
+	"testing"
+)
+
+const script = `/// Shapes of the plane.
+
+/// The unit, see ` + "`Point`" + `.
+var UNIT: Number = 1;
+
+// not a doc comment
+var undocumented = 2;
+
+/// A point.
+class Point {
+    /// Makes the point at (x, y).
+    init new(x: Number, y = 0) {}
+
+    /// The distance to the origin.
+    ///
+    /// ` + "```" + `
+    /// say Point.new(3, 4).norm(); // 5
+    /// ` + "```" + `
+    fun norm(): Number -> 0
+}
+
+say "x"; /// trailing, not a doc comment
+fun* each(...items) {}
+
+fun _hidden() {}
+`
+
+const markdown = "# geo\n\n" +
+	"[index](index.md)\n\n" +
+	"Shapes of the plane.\n\n" +
+	"## <a id=\"UNIT\"></a>`var UNIT: Number`\n\n" +
+	"The unit, see [`Point`](#Point).\n\n" +
+	"## <a id=\"undocumented\"></a>`var undocumented`\n\n" +
+	"## <a id=\"Point\"></a>`class Point`\n\n" +
+	"A point.\n\n" +
+	"### <a id=\"Point.new\"></a>`init new(x: Number, y = 0)`\n\n" +
+	"Makes the point at (x, y).\n\n" +
+	"### <a id=\"Point.norm\"></a>`fun norm(): Number`\n\n" +
+	"The distance to the origin.\n\n" +
+	"```needle\nsay Point.new(3, 4).norm(); // 5\n```\n\n" +
+	"## <a id=\"each\"></a>`fun* each(...items)`\n\n"
+
+func page(t *testing.T) *docgen.Page {
+	script, err := needle.Parse([]rune(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return docgen.FromScript("geo", script)
+}
+
+func TestMarkdown(t *testing.T) {
+	p := page(t)
+	var out bytes.Buffer
+	if err := docgen.WriteMarkdown(&out, p, []*docgen.Page{p, docgen.Builtins()}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != markdown {
+		t.Errorf("expected:\n%s\ngot:\n%s", markdown, out.String())
+	}
+}
+
+func TestHTML(t *testing.T) {
+	p := page(t)
+	var out bytes.Buffer
+	if err := docgen.WriteHTML(&out, p, []*docgen.Page{p, docgen.Builtins()}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<h3 id="Point.norm"><span class="primary">fun</span> norm(): <a href="builtins.html#Number">Number</a></h3>`,
+		`<p>The unit, see <a href="#Point"><code>Point</code></a>.</p>`,
+		`<span class="primary">say</span> Point.new(<span class="secondary">3</span>, <span class="secondary">4</span>).norm(); <span class="secondary">// 5</span>`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %s in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	var out bytes.Buffer
+	builtins := docgen.Builtins()
+	if err := docgen.WriteMarkdown(&out, builtins, []*docgen.Page{builtins}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"## <a id=\"print\"></a>`fun print(...values)`\n\nPrints values",
+		"### <a id=\"Channel.new\"></a>`init new(capacity?)`\n\n",
+		"### <a id=\"String.reverse\"></a>`fun reverse()`\n\n",
+		"## <a id=\"math\"></a>`module math`\n\n",
+		"### <a id=\"math.PI\"></a>`var PI`\n\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in:\n%s", want, out.String())
+		}
+	}
+}
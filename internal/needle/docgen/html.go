@@ -0,0 +1,124 @@
+package docgen
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"needle/doc"
+	"needle/internal/needle/highlight"
+	"strings"
+)
+
+/* == html ================================================================== */
+
+const style = `
+body { font-family: sans-serif; background: #1e1e1e; color: #c0c0c0; max-width: 60em; margin: auto; }
+a { color: #c0c0c0; }
+h2, h3 { font-family: monospace; font-weight: normal; }
+h3 { margin-left: 1.5em; }
+div.member { margin-left: 1.5em; }
+pre, code { font-family: monospace; }
+pre { background: #161616; padding: 0.5em; }
+`
+
+// htmlWriter writes the pages as HTML.
+type htmlWriter struct {
+	links *links
+	page  *Page
+}
+
+// WriteHTML writes page as HTML, linking the names declared by pages.
+func WriteHTML(w io.Writer, page *Page, pages []*Page) error {
+	hw := &htmlWriter{links: newLinks(pages, ".html"), page: page}
+	out := bufio.NewWriter(w)
+	header(out, page.Name)
+	fmt.Fprintln(out, `<p><a href="index.html">index</a></p>`)
+	fmt.Fprintf(out, "<h1>%s</h1>\n", html.EscapeString(page.Name))
+	hw.doc(out, page.Doc)
+	for _, entry := range page.Entries {
+		fmt.Fprintf(out, "<h2 id=\"%s\">%s</h2>\n",
+			html.EscapeString(entry.Name), hw.signature(entry))
+		hw.doc(out, entry.Doc)
+		for _, member := range entry.Members {
+			fmt.Fprintf(out, "<h3 id=\"%s\">%s</h3>\n",
+				html.EscapeString(anchor(entry, member)), hw.signature(member))
+			fmt.Fprintln(out, `<div class="member">`)
+			hw.doc(out, member.Doc)
+			fmt.Fprintln(out, `</div>`)
+		}
+	}
+	footer(out)
+	return out.Flush()
+}
+
+// WriteHTMLIndex writes a page listing pages with the summary of their
+// doc.
+func WriteHTMLIndex(w io.Writer, pages []*Page) error {
+	out := bufio.NewWriter(w)
+	header(out, "index")
+	fmt.Fprintln(out, `<h1>Needle documentation</h1>`)
+	fmt.Fprintln(out, `<ul>`)
+	for _, page := range pages {
+		fmt.Fprintf(out, "<li><a href=\"%s.html\">%s</a> %s</li>\n",
+			html.EscapeString(page.Name),
+			html.EscapeString(page.Name),
+			html.EscapeString(summary(page.Doc)))
+	}
+	fmt.Fprintln(out, `</ul>`)
+	footer(out)
+	return out.Flush()
+}
+
+func header(out io.Writer, title string) {
+	fmt.Fprintln(out, `<!DOCTYPE html>`)
+	fmt.Fprintln(out, `<html lang="en">`)
+	fmt.Fprintln(out, `<head>`)
+	fmt.Fprintln(out, `<meta charset="UTF-8" />`)
+	fmt.Fprintf(out, "<title>%s - Needle</title>\n", html.EscapeString(title))
+	fmt.Fprintf(out, "<style>\n%s%s</style>\n", doc.Colors, style)
+	fmt.Fprintln(out, `</head>`)
+	fmt.Fprintln(out, `<body>`)
+}
+
+func footer(out io.Writer) {
+	fmt.Fprintln(out, `</body>`)
+	fmt.Fprintln(out, `</html>`)
+}
+
+// signature returns the declaration of entry, its keyword in the primary
+// color and its types linked to their classes.
+func (hw *htmlWriter) signature(entry *Entry) string {
+	sig := signature(entry, html.EscapeString, hw.typeName)
+	keyword, rest, _ := strings.Cut(sig, " ")
+	return `<span class="primary">` + keyword + "</span> " + rest
+}
+
+func (hw *htmlWriter) typeName(t string) string {
+	name := strings.TrimSuffix(t, "?")
+	if href, ok := hw.links.find(name, hw.page); ok {
+		return fmt.Sprintf(`<a href="%s">%s</a>%s`,
+			html.EscapeString(href), html.EscapeString(name), strings.TrimPrefix(t, name))
+	}
+	return html.EscapeString(t)
+}
+
+// doc writes the paragraphs of a doc, linking the names in its code
+// spans, and highlights its examples.
+func (hw *htmlWriter) doc(out io.Writer, doc string) {
+	for _, b := range blocks(doc) {
+		if b.code {
+			fmt.Fprintf(out, "<pre>%s</pre>\n", highlight.HTML([]rune(b.text)))
+			continue
+		}
+		fmt.Fprintf(out, "<p>%s</p>\n", inline(b.text, html.EscapeString, hw.code))
+	}
+}
+
+func (hw *htmlWriter) code(code string) string {
+	if href, ok := hw.links.find(code, hw.page); ok {
+		return fmt.Sprintf(`<a href="%s"><code>%s</code></a>`,
+			html.EscapeString(href), html.EscapeString(code))
+	}
+	return "<code>" + html.EscapeString(code) + "</code>"
+}
@@ -0,0 +1,70 @@
+package docgen
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+/* == markdown ============================================================== */
+
+// markdownWriter writes the pages as Markdown.
+type markdownWriter struct {
+	links *links
+	page  *Page
+}
+
+// WriteMarkdown writes page as Markdown, linking the names declared by
+// pages. Signatures are code spans, so their types are not linked.
+func WriteMarkdown(w io.Writer, page *Page, pages []*Page) error {
+	mw := &markdownWriter{links: newLinks(pages, ".md"), page: page}
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "# %s\n\n", page.Name)
+	fmt.Fprint(out, "[index](index.md)\n\n")
+	mw.doc(out, page.Doc)
+	for _, entry := range page.Entries {
+		fmt.Fprintf(out, "## <a id=\"%s\"></a>`%s`\n\n", entry.Name, mw.signature(entry))
+		mw.doc(out, entry.Doc)
+		for _, member := range entry.Members {
+			fmt.Fprintf(out, "### <a id=\"%s\"></a>`%s`\n\n", anchor(entry, member), mw.signature(member))
+			mw.doc(out, member.Doc)
+		}
+	}
+	return out.Flush()
+}
+
+// WriteMarkdownIndex writes a page listing pages with the summary of
+// their doc.
+func WriteMarkdownIndex(w io.Writer, pages []*Page) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprint(out, "# Needle documentation\n\n")
+	for _, page := range pages {
+		fmt.Fprintf(out, "- [%s](%s.md) %s\n", page.Name, page.Name, summary(page.Doc))
+	}
+	return out.Flush()
+}
+
+func (mw *markdownWriter) signature(entry *Entry) string {
+	same := func(s string) string { return s }
+	return signature(entry, same, same)
+}
+
+// doc writes the paragraphs of a doc, linking the names in its code
+// spans, and its examples as needle code blocks.
+func (mw *markdownWriter) doc(out io.Writer, doc string) {
+	for _, b := range blocks(doc) {
+		if b.code {
+			fmt.Fprintf(out, "```needle\n%s\n```\n\n", b.text)
+			continue
+		}
+		same := func(s string) string { return s }
+		fmt.Fprintf(out, "%s\n\n", inline(b.text, same, mw.code))
+	}
+}
+
+func (mw *markdownWriter) code(code string) string {
+	if href, ok := mw.links.find(code, mw.page); ok {
+		return fmt.Sprintf("[`%s`](%s)", code, href)
+	}
+	return "`" + code + "`"
+}
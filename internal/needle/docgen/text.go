@@ -0,0 +1,62 @@
+package docgen
+
+import (
+	"strings"
+)
+
+/* == doc text ============================================================== */
+
+// block is a paragraph of a doc or an example fenced with '```'.
+type block struct {
+	code bool
+	text string
+}
+
+// blocks splits a doc on blank lines and fences.
+func blocks(doc string) []block {
+	result := []block{}
+	para := []string{}
+	flush := func() {
+		if len(para) != 0 {
+			result = append(result, block{text: strings.Join(para, "\n")})
+			para = nil
+		}
+	}
+	lines := strings.Split(doc, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case isFence(line):
+			flush()
+			code := []string{}
+			for i++; i < len(lines) && !isFence(lines[i]); i++ {
+				code = append(code, lines[i])
+			}
+			result = append(result, block{code: true, text: strings.Join(code, "\n")})
+		case strings.TrimSpace(line) == "":
+			flush()
+		default:
+			para = append(para, line)
+		}
+	}
+	flush()
+	return result
+}
+
+func isFence(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "```")
+}
+
+// inline returns a paragraph with its plain parts passed through text and
+// its `code` spans through code.
+func inline(para string, text, code func(string) string) string {
+	var str strings.Builder
+	for i, part := range strings.Split(para, "`") {
+		if i%2 == 0 {
+			str.WriteString(text(part))
+		} else {
+			str.WriteString(code(part))
+		}
+	}
+	return str.String()
+}
@@ -0,0 +1,339 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// testSuite collects the cases and hooks registered through the 'test'
+// module while a script runs.
+type testSuite struct {
+	cases    []testCase
+	setup    []Value
+	teardown []Value
+}
+
+type testCase struct {
+	name string
+	fun  Value
+}
+
+// TestResult is the outcome of one case registered with 'test'. Err is nil
+// when the case passed.
+type TestResult struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+// RunTests runs every registered case in order. Setup hooks run before
+// each case and teardown hooks after it, even when the case fails.
+func (e *Evaluator) RunTests() []TestResult {
+	e.globals.lock.Lock()
+	defer e.globals.lock.Unlock()
+	results := []TestResult{}
+	for _, c := range e.globals.tests.cases {
+		start := time.Now()
+		err := e.runTestCase(c)
+		results = append(results, TestResult{
+			Name:     c.name,
+			Duration: time.Since(start),
+			Err:      err,
+		})
+	}
+	return results
+}
+
+func (e *Evaluator) runTestCase(c testCase) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch r := r.(type) {
+			case *Exception:
+				err = r
+			case *Exit:
+				err = r
+			case *Signal:
+				err = errors.New("control flow escaped the test case")
+			default:
+				panic(r)
+			}
+		}
+	}()
+	suite := e.globals.tests
+	defer func() {
+		for _, hook := range suite.teardown {
+			e.awaitResult(e.call(hook, nil, nil))
+		}
+	}()
+	for _, hook := range suite.setup {
+		e.awaitResult(e.call(hook, nil, nil))
+	}
+	e.awaitResult(e.call(c.fun, nil, nil))
+	return nil
+}
+
+// awaitResult waits for the promise returned by an async test function.
+func (e *Evaluator) awaitResult(value Value) Value {
+	if p, ok := value.(*Promise); ok {
+		return e.awaitPromise(p)
+	}
+	return value
+}
+
+func (e *Evaluator) registerTest(name Value, fun Value) {
+	s, ok := name.(*String)
+	if !ok {
+		e.panicException("test name must be a string")
+	}
+	e.assertCallable(fun)
+	e.globals.tests.cases = append(e.globals.tests.cases, testCase{
+		name: s.Value,
+		fun:  fun,
+	})
+}
+
+func (e *Evaluator) assertCallable(value Value) {
+	switch value.(type) {
+	case *Function, *Native, *Method:
+	default:
+		e.panicException("'%s' is not callable", value.Type())
+	}
+}
+
+func (e *Evaluator) assertionFailed(message Value, format string, a ...any) {
+	msg := fmt.Sprintf(format, a...)
+	if message != nil {
+		msg = sprint(message) + ": " + msg
+	}
+	e.panicException("%s", msg)
+}
+
+// assertThrows calls fun and returns the exception it raised. If contains
+// is given the message of the exception must include it.
+func (e *Evaluator) assertThrows(fun Value, contains Value) Value {
+	e.assertCallable(fun)
+	var exc *Exception
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				x, ok := r.(*Exception)
+				if !ok {
+					panic(r)
+				}
+				exc = x
+			}
+		}()
+		e.awaitResult(e.call(fun, nil, nil))
+	}()
+	if exc == nil {
+		e.panicException("assertion failed: expected an exception")
+	}
+	if contains != nil {
+		s, ok := contains.(*String)
+		if !ok {
+			e.panicException("expected message must be a string")
+		}
+		if !strings.Contains(exc.Message, s.Value) {
+			e.panicException(
+				"assertion failed: expected exception containing %s, got %s",
+				s.Say(), (&String{Value: exc.Message}).Say(),
+			)
+		}
+	}
+	return exc
+}
+
+// diffValues compares vectors and maps element by element and returns one
+// line for every difference, prefixed with the path to it. Pairs under
+// comparison in seen are taken as equal when a cycle comes back to them.
+func diffValues(path string, want, got Value, seen map[[2]Value]bool) []string {
+	switch want := want.(type) {
+	case *Vector:
+		got, ok := got.(*Vector)
+		if !ok {
+			break
+		}
+		pair := [2]Value{want, got}
+		if seen[pair] {
+			return nil
+		}
+		seen[pair] = true
+		defer delete(seen, pair)
+		diffs := []string{}
+		if len(want.Elems) != len(got.Elems) {
+			diffs = append(diffs, fmt.Sprintf(
+				"%slength: expected %d, got %d",
+				pathPrefix(path), len(want.Elems), len(got.Elems),
+			))
+		}
+		for i := 0; i < min(len(want.Elems), len(got.Elems)); i++ {
+			sub := fmt.Sprintf("%s[%d]", path, i)
+			diffs = append(diffs, diffValues(sub, want.Elems[i], got.Elems[i], seen)...)
+		}
+		return diffs
+	case *Map:
+		got, ok := got.(*Map)
+		if !ok {
+			break
+		}
+		pair := [2]Value{want, got}
+		if seen[pair] {
+			return nil
+		}
+		seen[pair] = true
+		defer delete(seen, pair)
+		diffs := []string{}
+		for _, key := range sortedKeys(want, got) {
+			sub := fmt.Sprintf("%s[%s]", path, key.Say())
+			w, errW := want.Pairs.Get(key)
+			g, errG := got.Pairs.Get(key)
+			switch {
+			case errG != nil:
+				diffs = append(diffs, fmt.Sprintf(
+					"%smissing key %s", pathPrefix(path), key.Say(),
+				))
+			case errW != nil:
+				diffs = append(diffs, fmt.Sprintf(
+					"%sunexpected key %s", pathPrefix(path), key.Say(),
+				))
+			default:
+				diffs = append(diffs, diffValues(sub, w, g, seen)...)
+			}
+		}
+		return diffs
+	}
+	if valuesEqual(want, got) {
+		return nil
+	}
+	return []string{fmt.Sprintf(
+		"%sexpected %s, got %s", pathPrefix(path), want.Say(), got.Say(),
+	)}
+}
+
+func pathPrefix(path string) string {
+	if path == "" {
+		return ""
+	}
+	return path + ": "
+}
+
+// sortedKeys returns the keys of both maps, numbers first.
+func sortedKeys(a, b *Map) []Value {
+	seen := map[string]bool{}
+	keys := []Value{}
+	for _, key := range append(a.Pairs.Keys(), b.Pairs.Keys()...) {
+		if !seen[key.Say()] {
+			seen[key.Say()] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ni, iNum := keys[i].(*Number)
+		nj, jNum := keys[j].(*Number)
+		if iNum && jNum {
+			return ni.Value < nj.Value
+		}
+		if iNum != jNum {
+			return iNum
+		}
+		return keys[i].(*String).Value < keys[j].(*String).Value
+	})
+	return keys
+}
+
+// valuesEqual compares scalars by value and everything else by identity.
+func valuesEqual(a, b Value) bool {
+	switch a := a.(type) {
+	case *Number:
+		b, ok := b.(*Number)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	}
+	return a == b
+}
+
+func newTestModule() *Module {
+	store := map[string]Value{
+		"test": &Native{
+			Name:  "test",
+			Arity: 2,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				e.registerTest(args[0], args[1])
+				return e.globalNull()
+			},
+		},
+		"setup": &Native{
+			Name:  "setup",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				e.assertCallable(args[0])
+				e.globals.tests.setup = append(e.globals.tests.setup, args[0])
+				return e.globalNull()
+			},
+		},
+		"teardown": &Native{
+			Name:  "teardown",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				e.assertCallable(args[0])
+				e.globals.tests.teardown = append(e.globals.tests.teardown, args[0])
+				return e.globalNull()
+			},
+		},
+		"assert": &Native{
+			Name:     "assert",
+			Arity:    1,
+			Optional: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				if !toBoolean(args[0]) {
+					e.assertionFailed(optionalArg(args, 1), "assertion failed")
+				}
+				return e.globalNull()
+			},
+		},
+		"assert_eq": &Native{
+			Name:     "assert_eq",
+			Arity:    2,
+			Optional: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				diffs := diffValues("", args[1], args[0], map[[2]Value]bool{})
+				if len(diffs) != 0 {
+					e.assertionFailed(
+						optionalArg(args, 2),
+						"assertion failed: values differ\n\t%s",
+						strings.Join(diffs, "\n\t"),
+					)
+				}
+				return e.globalNull()
+			},
+		},
+		"assert_throws": &Native{
+			Name:     "assert_throws",
+			Arity:    1,
+			Optional: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				return e.assertThrows(args[0], optionalArg(args, 1))
+			},
+		},
+	}
+	return &Module{Store: store}
+}
+
+// optionalArg returns args[i] or nil if it was not passed.
+func optionalArg(args []Value, i int) Value {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"needle/internal/needle/ast"
+)
+
+type promiseState string
+
+const (
+	promisePending   promiseState = "pending"
+	promiseFulfilled promiseState = "fulfilled"
+	promiseRejected  promiseState = "rejected"
+)
+
+// Promise is the eventual result of an async function or background work.
+// A rejected promise holds the *Exception as its value.
+type Promise struct {
+	state   promiseState
+	value   Value
+	waiters []func(*Promise)
+	handled bool
+	loop    *Loop
+}
+
+// Loop is the event loop: it runs the callbacks of settled promises and
+// waits for background work such as timers. Everything runs on the
+// goroutine that drives the loop, async functions never run in parallel.
+type Loop struct {
+	ev       *Evaluator
+	ready    []func()
+	pending  int
+	wake     chan func()
+	rejected []*Promise
+}
+
+func newLoop(ev *Evaluator) *Loop {
+	return &Loop{
+		ev:    ev,
+		ready: []func(){},
+		wake:  make(chan func()),
+	}
+}
+
+// Run drains the loop and reports rejections nobody has handled.
+func (l *Loop) Run() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch r := r.(type) {
+			case *Exception:
+				err = r
+			case *Exit:
+				err = r
+			default:
+				panic(r)
+			}
+		}
+	}()
+	l.ev.globals.lock.Lock()
+	defer l.ev.globals.lock.Unlock()
+	l.runUntil(func() bool { return false })
+	return l.unhandled()
+}
+
+// runUntil runs callbacks until stop returns true. It returns false if
+// the loop ran out of work before that.
+func (l *Loop) runUntil(stop func() bool) bool {
+	for !stop() {
+		if len(l.ready) > 0 {
+			f := l.ready[0]
+			l.ready = l.ready[1:]
+			f()
+			continue
+		}
+		if l.pending == 0 {
+			return false
+		}
+		var f func()
+		l.ev.blocking(func() { f = <-l.wake })
+		l.pending--
+		f()
+	}
+	return true
+}
+
+func (l *Loop) unhandled() error {
+	errs := []error{}
+	for _, p := range l.rejected {
+		if !p.handled {
+			errs = append(errs, fmt.Errorf("unhandled rejection: %w", p.value.(*Exception)))
+		}
+	}
+	l.rejected = nil
+	return errors.Join(errs...)
+}
+
+func (l *Loop) newPromise() *Promise {
+	return &Promise{
+		state: promisePending,
+		loop:  l,
+	}
+}
+
+func (p *Promise) settle(state promiseState, value Value) {
+	if p.state != promisePending {
+		return
+	}
+	p.state = state
+	p.value = value
+	for _, f := range p.waiters {
+		p.schedule(f)
+	}
+	p.waiters = nil
+	if state == promiseRejected {
+		p.loop.rejected = append(p.loop.rejected, p)
+	}
+}
+
+// then calls f from the loop once the promise is settled.
+func (p *Promise) then(f func(*Promise)) {
+	p.handled = true
+	if p.state == promisePending {
+		p.waiters = append(p.waiters, f)
+		return
+	}
+	p.schedule(f)
+}
+
+func (p *Promise) schedule(f func(*Promise)) {
+	p.loop.ready = append(p.loop.ready, func() { f(p) })
+}
+
+// startAsync runs the body of an async function until its first 'await'
+// and returns the promise of its result. Every awaited promise resumes the
+// body from the loop when it settles.
+func (e *Evaluator) startAsync(g *Generator) *Promise {
+	result := e.loop.newPromise()
+	var step func(genResume)
+	step = func(msg genResume) {
+		out, exc := e.stepAsync(g, msg)
+		switch {
+		case exc != nil:
+			result.settle(promiseRejected, exc)
+		case out.done:
+			if out.value == nil {
+				out.value = e.globalNull()
+			}
+			result.settle(promiseFulfilled, out.value)
+		default:
+			out.value.(*Promise).then(func(p *Promise) {
+				if p.state == promiseRejected {
+					step(genResume{throw: p.value})
+				} else {
+					step(genResume{value: p.value})
+				}
+			})
+		}
+	}
+	step(genResume{})
+	return result
+}
+
+func (e *Evaluator) stepAsync(
+	g *Generator, msg genResume,
+) (out genYield, exc *Exception) {
+	defer func() {
+		if r := recover(); r != nil {
+			if x, ok := r.(*Exception); ok {
+				exc = x
+				return
+			}
+			panic(r)
+		}
+	}()
+	return e.transfer(g, msg), nil
+}
+
+func (e *Evaluator) evalAwaitExpr(node *ast.AwaitExpr) Value {
+	value := e.Eval(node.Value)
+	p, ok := value.(*Promise)
+	if !ok {
+		return value
+	}
+	if e.generator != nil && e.generator.Function.Async {
+		return e.suspend(p)
+	}
+	return e.awaitPromise(p)
+}
+
+// awaitPromise drives the loop until p settles. It is used by 'await'
+// outside async functions, where there is nothing to suspend.
+func (e *Evaluator) awaitPromise(p *Promise) Value {
+	p.handled = true
+	if !e.loop.runUntil(func() bool { return p.state != promisePending }) {
+		e.panicException("awaited promise can never settle")
+	}
+	if p.state == promiseRejected {
+		panic(p.value)
+	}
+	return p.value
+}
+
+// background runs work on its own goroutine and settles the returned
+// promise from the loop when it is done.
+func (e *Evaluator) background(work func() (Value, error)) *Promise {
+	p := e.loop.newPromise()
+	trace, line, file := e.stackTrace(), e.line, e.file
+	e.loop.pending++
+	go func() {
+		value, err := work()
+		e.loop.wake <- func() {
+			if err != nil {
+				p.settle(promiseRejected, &Exception{
+					Message:    err.Error(),
+					Line:       line,
+					File:       file,
+					StackTrace: trace,
+				})
+				return
+			}
+			p.settle(promiseFulfilled, value)
+		}
+	}()
+	return p
+}
+
+func (e *Evaluator) toPromise(value Value) *Promise {
+	if p, ok := value.(*Promise); ok {
+		return p
+	}
+	p := e.loop.newPromise()
+	p.settle(promiseFulfilled, value)
+	return p
+}
+
+func (e *Evaluator) promiseAll(values []Value) *Promise {
+	result := e.loop.newPromise()
+	results := make([]Value, len(values))
+	remaining := len(values)
+	if remaining == 0 {
+		result.settle(promiseFulfilled, &Vector{Elems: results})
+	}
+	for i, value := range values {
+		e.toPromise(value).then(func(p *Promise) {
+			if p.state == promiseRejected {
+				result.settle(promiseRejected, p.value)
+				return
+			}
+			results[i] = p.value
+			remaining--
+			if remaining == 0 {
+				result.settle(promiseFulfilled, &Vector{Elems: results})
+			}
+		})
+	}
+	return result
+}
+
+func (e *Evaluator) promiseRace(values []Value) *Promise {
+	result := e.loop.newPromise()
+	for _, value := range values {
+		e.toPromise(value).then(func(p *Promise) {
+			result.settle(p.state, p.value)
+		})
+	}
+	return result
+}
@@ -1,6 +1,12 @@
 package evaluator
 
-import "time"
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
 
 func loadBuiltins(env *Env) {
 	for name, native := range newBuiltins() {
@@ -14,29 +20,65 @@ func newBuiltins() map[string]*Native {
 			Name:  "clock",
 			Arity: 0,
 			Function: func(e *Evaluator, self Value, args ...Value) Value {
-				return &Number{Value: float64(time.Now().Unix())}
+				return e.newNumber(float64(time.Now().Unix()))
+			},
+		},
+		"print": {
+			Name:     "print",
+			Arity:    0,
+			Variadic: true,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				strs := make([]string, len(args))
+				for i, arg := range args {
+					strs[i] = sprint(arg)
+				}
+				fmt.Fprintln(e.globals.out, strings.Join(strs, " "))
+				return e.globalNull()
+			},
+		},
+		"sleep": {
+			Name:  "sleep",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				e.sleep(args[0])
+				return e.globalNull()
+			},
+		},
+		"select": {
+			Name:     "select",
+			Arity:    1,
+			Optional: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				cases, ok := args[0].(*Vector)
+				if !ok {
+					e.panicException("expected vector of cases")
+				}
+				var timeout Value
+				if len(args) == 2 {
+					timeout = args[1]
+				}
+				return e.selectChannels(cases.Elems, timeout)
 			},
 		},
 		"class_of": {
 			Name:  "class_of",
 			Arity: 1,
 			Function: func(e *Evaluator, self Value, args ...Value) Value {
-				switch obj := args[0].(type) {
-				case *Boolean:
-					return e.globals.Classes[CLASS_BOOLEAN]
-				case *Number:
-					return e.globals.Classes[CLASS_NUMBER]
-				case *String:
-					return e.globals.Classes[CLASS_STRING]
-				case *Vector:
-					return e.globals.Classes[CLASS_VECTOR]
-				case *Map:
-					return e.globals.Classes[CLASS_MAP]
-				case *Instance:
-					return obj.Class
+				if class := e.classOf(args[0]); class != nil {
+					return class
 				}
 				return e.globalNull()
 			},
 		},
 	}
 }
+
+// GlobalNames returns the names every script starts with: builtin
+// functions and base classes.
+func GlobalNames() []string {
+	names := slices.Collect(maps.Keys(newBuiltins()))
+	for name := range newBaseClasses() {
+		names = append(names, name)
+	}
+	return names
+}
@@ -1,6 +1,11 @@
 package evaluator
 
-import "strconv"
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
 
 const (
 	CLASS_BOOLEAN   = "Boolean"
@@ -9,6 +14,15 @@ const (
 	CLASS_VECTOR    = "Vector"
 	CLASS_MAP       = "Map"
 	CLASS_EXCEPTION = "Exception"
+	CLASS_GENERATOR = "Generator"
+	CLASS_TASK      = "Task"
+	CLASS_CHANNEL   = "Channel"
+	CLASS_PROMISE   = "Promise"
+	CLASS_FILE      = "File"
+	CLASS_PROCESS   = "Process"
+	CLASS_REGEX     = "Regex"
+	CLASS_DATETIME  = "DateTime"
+	CLASS_DURATION  = "Duration"
 )
 
 func newBooleanClass() *Class {
@@ -19,7 +33,7 @@ func newBooleanClass() *Class {
 			Arity: 0,
 			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
 				self := self0.(*Boolean)
-				return &String{Value: strconv.FormatBool(self.Value)}
+				return e.newString(strconv.FormatBool(self.Value))
 			},
 		},
 	}
@@ -33,9 +47,7 @@ func newNumberClass() *Class {
 			Arity: 0,
 			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
 				self := self0.(*Number)
-				return &String{
-					Value: strconv.FormatFloat(self.Value, 'g', -1, 64),
-				}
+				return e.newString(strconv.FormatFloat(self.Value, 'g', -1, 64))
 			},
 		},
 	}
@@ -55,7 +67,7 @@ func newStringClass() *Class {
 					alt := len(rev) - i - 1
 					rev[i], rev[alt] = rev[alt], rev[i]
 				}
-				return &String{Value: string(rev)}
+				return e.newString(string(rev))
 			},
 		},
 		"to_upper_case": &Native{
@@ -69,7 +81,15 @@ func newStringClass() *Class {
 						up[i] += 'A' - 'a'
 					}
 				}
-				return &String{Value: string(up)}
+				return e.newString(string(up))
+			},
+		},
+		"matches": &Native{
+			Name:  "matches",
+			Arity: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*String)
+				return e.globalBoolean(e.regexArg(args[0]).re.MatchString(self.Value))
 			},
 		},
 		"to_lower_case": &Native{
@@ -83,7 +103,7 @@ func newStringClass() *Class {
 						low[i] -= 'A' - 'a'
 					}
 				}
-				return &String{Value: string(low)}
+				return e.newString(string(low))
 			},
 		},
 	}
@@ -117,7 +137,7 @@ func newVectorClass() *Class {
 			Arity: 0,
 			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
 				self := self0.(*Vector)
-				return &Number{Value: float64(len(self.Elems))}
+				return e.newNumber(float64(len(self.Elems)))
 			},
 		},
 	}
@@ -132,7 +152,7 @@ func newMapClass() *Class {
 			Arity: 0,
 			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
 				self := self0.(*Map)
-				return &Number{Value: float64(self.Pairs.Size())}
+				return e.newNumber(float64(self.Pairs.Size()))
 			},
 		},
 		"keys": &Native{
@@ -163,7 +183,7 @@ func newExceptionClass() *Class {
 			Arity: 0,
 			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
 				self := self0.(*Exception)
-				return &String{Value: self.Message}
+				return e.newString(self.Message)
 			},
 		},
 	}
@@ -171,6 +191,211 @@ func newExceptionClass() *Class {
 	return &Class{Inits: inits, Funs: funs}
 }
 
+func newGeneratorClass() *Class {
+	funs := map[string]Value{
+		"next": &Native{
+			Name:  "next",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Generator)
+				return e.resumeGenerator(self, e.globalNull())
+			},
+		},
+		"send": &Native{
+			Name:  "send",
+			Arity: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Generator)
+				return e.resumeGenerator(self, args[0])
+			},
+		},
+		"close": &Native{
+			Name:  "close",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Generator)
+				e.closeGenerator(self)
+				return e.globalNull()
+			},
+		},
+		"done": &Native{
+			Name:  "done",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Generator)
+				return e.globalBoolean(self.state == genDone)
+			},
+		},
+	}
+	inits := map[string]Value{}
+	return &Class{Inits: inits, Funs: funs}
+}
+
+func newTaskClass() *Class {
+	funs := map[string]Value{
+		"join": &Native{
+			Name:  "join",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Task)
+				return e.joinTask(self)
+			},
+		},
+		"done": &Native{
+			Name:  "done",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Task)
+				select {
+				case <-self.done:
+					return e.globalBoolean(true)
+				default:
+					return e.globalBoolean(false)
+				}
+			},
+		},
+	}
+	inits := map[string]Value{}
+	return &Class{Inits: inits, Funs: funs}
+}
+
+func newChannelClass() *Class {
+	funs := map[string]Value{
+		"send": &Native{
+			Name:  "send",
+			Arity: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Channel)
+				e.sendChannel(self, args[0])
+				return e.globalNull()
+			},
+		},
+		"recv": &Native{
+			Name:  "recv",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Channel)
+				value, _ := e.recvChannel(self)
+				return value
+			},
+		},
+		"close": &Native{
+			Name:  "close",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Channel)
+				e.closeChannel(self)
+				return e.globalNull()
+			},
+		},
+		"length": &Native{
+			Name:  "length",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Channel)
+				return e.newNumber(float64(len(self.ch)))
+			},
+		},
+	}
+	inits := map[string]Value{
+		"new": &Native{
+			Name:     "new",
+			Arity:    0,
+			Optional: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				size := 0
+				if len(args) == 1 {
+					n, ok := args[0].(*Number)
+					if !ok || n.Value < 0 {
+						e.panicException("invalid channel capacity")
+					}
+					size = int(n.Value)
+				}
+				return newChannel(size)
+			},
+		},
+	}
+	return &Class{Inits: inits, Funs: funs}
+}
+
+func newPromiseClass() *Class {
+	funs := map[string]Value{
+		"state": &Native{
+			Name:  "state",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Promise)
+				return e.newString(string(self.state))
+			},
+		},
+	}
+	inits := map[string]Value{
+		"resolve": &Native{
+			Name:  "resolve",
+			Arity: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				return e.toPromise(args[0])
+			},
+		},
+		"reject": &Native{
+			Name:  "reject",
+			Arity: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				exc, ok := args[0].(*Exception)
+				if !ok {
+					exc = e.newException(args[0].Say())
+				}
+				p := e.loop.newPromise()
+				p.settle(promiseRejected, exc)
+				return p
+			},
+		},
+		"delay": &Native{
+			Name:     "delay",
+			Arity:    1,
+			Optional: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				ms, ok := args[0].(*Number)
+				if !ok {
+					e.panicException("non number agrument")
+				}
+				var value Value = e.globalNull()
+				if len(args) == 2 {
+					value = args[1]
+				}
+				d := time.Duration(ms.Value * float64(time.Millisecond))
+				return e.background(func() (Value, error) {
+					time.Sleep(d)
+					return value, nil
+				})
+			},
+		},
+		"all": &Native{
+			Name:  "all",
+			Arity: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				vec, ok := args[0].(*Vector)
+				if !ok {
+					e.panicException("expected vector")
+				}
+				return e.promiseAll(vec.Elems)
+			},
+		},
+		"race": &Native{
+			Name:  "race",
+			Arity: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				vec, ok := args[0].(*Vector)
+				if !ok {
+					e.panicException("expected vector")
+				}
+				return e.promiseRace(vec.Elems)
+			},
+		},
+	}
+	return &Class{Inits: inits, Funs: funs}
+}
+
 func newBaseClasses() map[string]*Class {
 	cs := map[string]*Class{
 		CLASS_BOOLEAN:   newBooleanClass(),
@@ -179,9 +404,28 @@ func newBaseClasses() map[string]*Class {
 		CLASS_VECTOR:    newVectorClass(),
 		CLASS_MAP:       newMapClass(),
 		CLASS_EXCEPTION: newExceptionClass(),
+		CLASS_GENERATOR: newGeneratorClass(),
+		CLASS_TASK:      newTaskClass(),
+		CLASS_CHANNEL:   newChannelClass(),
+		CLASS_PROMISE:   newPromiseClass(),
+		CLASS_FILE:      newFileClass(),
+		CLASS_PROCESS:   newProcessClass(),
+		CLASS_REGEX:     newRegexClass(),
+		CLASS_DATETIME:  newDateTimeClass(),
+		CLASS_DURATION:  newDurationClass(),
 	}
 	for name, cls := range cs {
 		cls.Name = name
 	}
 	return cs
 }
+
+// MethodNames returns the names of the methods of every base class,
+// keyed by class name.
+func MethodNames() map[string][]string {
+	methods := map[string][]string{}
+	for name, cls := range newBaseClasses() {
+		methods[name] = slices.Collect(maps.Keys(cls.Funs))
+	}
+	return methods
+}
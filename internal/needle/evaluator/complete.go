@@ -0,0 +1,93 @@
+package evaluator
+
+// Names returns every name visible at the top level of the script.
+func (e *Evaluator) Names() []string {
+	return e.env.Names()
+}
+
+// Members returns the properties reachable with '.' from the value at
+// path, a chain of names such as 'mod.sub'. It returns nil if the path
+// does not lead to a value.
+func (e *Evaluator) Members(path []string) []string {
+	if len(path) == 0 {
+		return nil
+	}
+	value, err := e.env.Get(path[0])
+	if err != nil {
+		return nil
+	}
+	for _, name := range path[1:] {
+		var ok bool
+		switch v := value.(type) {
+		case *Module:
+			value, ok = v.Store[name]
+		case *Instance:
+			value, ok = v.Fields[name]
+		}
+		if !ok {
+			return nil
+		}
+	}
+	names := []string{}
+	switch v := value.(type) {
+	case *Module:
+		for name := range v.Store {
+			names = append(names, name)
+		}
+		return names
+	case *Class:
+		for name := range v.Inits {
+			names = append(names, name)
+		}
+		return names
+	case *Instance:
+		for name := range v.Fields {
+			names = append(names, name)
+		}
+	}
+	if class := e.classOf(value); class != nil {
+		for name := range class.Funs {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// classOf returns the class of value or nil if it has none.
+func (e *Evaluator) classOf(value Value) *Class {
+	switch value := value.(type) {
+	case *Boolean:
+		return e.globals.Classes[CLASS_BOOLEAN]
+	case *Number:
+		return e.globals.Classes[CLASS_NUMBER]
+	case *String:
+		return e.globals.Classes[CLASS_STRING]
+	case *Vector:
+		return e.globals.Classes[CLASS_VECTOR]
+	case *Map:
+		return e.globals.Classes[CLASS_MAP]
+	case *Exception:
+		return e.globals.Classes[CLASS_EXCEPTION]
+	case *Generator:
+		return e.globals.Classes[CLASS_GENERATOR]
+	case *Task:
+		return e.globals.Classes[CLASS_TASK]
+	case *Channel:
+		return e.globals.Classes[CLASS_CHANNEL]
+	case *Promise:
+		return e.globals.Classes[CLASS_PROMISE]
+	case *File:
+		return e.globals.Classes[CLASS_FILE]
+	case *Process:
+		return e.globals.Classes[CLASS_PROCESS]
+	case *Regex:
+		return e.globals.Classes[CLASS_REGEX]
+	case *DateTime:
+		return e.globals.Classes[CLASS_DATETIME]
+	case *Duration:
+		return e.globals.Classes[CLASS_DURATION]
+	case *Instance:
+		return value.Class
+	}
+	return nil
+}
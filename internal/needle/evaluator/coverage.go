@@ -0,0 +1,122 @@
+package evaluator
+
+import (
+	"needle/internal/needle/ast"
+	"needle/internal/needle/token"
+)
+
+/* == coverage ============================================================== */
+
+// Coverage counts how many times the statements and branches of every
+// script ran, by absolute path of the script. Code run without a file is
+// under "".
+type Coverage struct {
+	Files map[string]*FileCoverage
+}
+
+// FileCoverage holds the counts of one script. Statements are keyed by
+// their position and branches by the position of the 'if', 'while', 'do'
+// or 'for' statement they belong to.
+type FileCoverage struct {
+	Stmts    map[token.Position]int
+	Branches map[token.Position]*Branch
+}
+
+// Branch counts how many times a condition was true and false: the then
+// and else clauses of an 'if', entering and leaving the body of a loop.
+type Branch struct {
+	True  int
+	False int
+}
+
+// StartCoverage makes the evaluator count statements and branches until
+// StopCoverage. Every script it runs from then on is reported, with the
+// statements that never ran.
+func (e *Evaluator) StartCoverage() {
+	e.globals.coverage = &Coverage{Files: map[string]*FileCoverage{}}
+}
+
+// StopCoverage returns the counts since StartCoverage, nil if it was not
+// called.
+func (e *Evaluator) StopCoverage() *Coverage {
+	c := e.globals.coverage
+	e.globals.coverage = nil
+	return c
+}
+
+// Merge adds the counts of other to c, as when the same scripts run in
+// several interpreters.
+func (c *Coverage) Merge(other *Coverage) {
+	for path, o := range other.Files {
+		f := c.file(path)
+		for pos, n := range o.Stmts {
+			f.Stmts[pos] += n
+		}
+		for pos, b := range o.Branches {
+			f.branch(pos).True += b.True
+			f.branch(pos).False += b.False
+		}
+	}
+}
+
+func (c *Coverage) file(path string) *FileCoverage {
+	f, ok := c.Files[path]
+	if !ok {
+		f = &FileCoverage{
+			Stmts:    map[token.Position]int{},
+			Branches: map[token.Position]*Branch{},
+		}
+		c.Files[path] = f
+	}
+	return f
+}
+
+func (f *FileCoverage) branch(pos token.Position) *Branch {
+	b, ok := f.Branches[pos]
+	if !ok {
+		b = &Branch{}
+		f.Branches[pos] = b
+	}
+	return b
+}
+
+// register adds the statements and branches of a script with no count,
+// so that those which never run are reported too.
+func (c *Coverage) register(path string, script *ast.Script) {
+	f := c.file(path)
+	ast.Inspect(script, func(node ast.Node) bool {
+		if Steppable(node) {
+			if _, ok := f.Stmts[node.Pos()]; !ok {
+				f.Stmts[node.Pos()] = 0
+			}
+		}
+		switch node.(type) {
+		case *ast.IfStmt, *ast.WhileStmt, *ast.DoStmt, *ast.ForStmt:
+			f.branch(node.Pos())
+		}
+		return true
+	})
+}
+
+func (c *Coverage) stmt(path string, node ast.Node) {
+	c.file(path).Stmts[node.Pos()]++
+}
+
+// cond counts a condition of node and returns it.
+func (c *Coverage) cond(path string, node ast.Node, cond bool) bool {
+	b := c.file(path).branch(node.Pos())
+	if cond {
+		b.True++
+	} else {
+		b.False++
+	}
+	return cond
+}
+
+// branch counts the condition of an 'if' or a loop when covering.
+func (e *Evaluator) branch(node ast.Node, cond bool) bool {
+	if c := e.globals.coverage; c != nil {
+		return c.cond(e.file, node, cond)
+	}
+	return cond
+}
@@ -0,0 +1,132 @@
+package evaluator
+
+import (
+	"errors"
+	"needle/internal/needle/ast"
+	"needle/internal/needle/parser"
+	"needle/internal/needle/scanner"
+	"sort"
+)
+
+// Debugger is told about every statement before it runs. Step may block
+// to pause the script, the evaluator holds the global lock meanwhile so
+// no other task runs either.
+type Debugger interface {
+	Step(e *Evaluator, node ast.Node)
+}
+
+// SetDebugger attaches d to e and every evaluator forked from it, it
+// must be called before the script starts.
+func (e *Evaluator) SetDebugger(d Debugger) {
+	e.globals.debugger = d
+}
+
+// Steppable reports whether the debugger is called before node runs:
+// declarations and statements other than blocks, and not the null
+// statements the parser fills missing clauses with.
+func Steppable(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.StmtDecl, *ast.Block:
+		return false
+	case *ast.ExprStmt:
+		_, implicit := node.Expr.(*ast.NullLit)
+		return !implicit
+	case ast.Decl, ast.Stmt:
+		return true
+	}
+	return false
+}
+
+// callSite is where a call was made from, recorded while debugging.
+type callSite struct {
+	file string
+	line int
+	env  *Env
+}
+
+// Frame is a call in progress, or the script at the bottom of the stack.
+type Frame struct {
+	Name string
+	File string
+	Line int
+	Env  *Env
+}
+
+// File returns the script being evaluated.
+func (e *Evaluator) File() string {
+	return e.file
+}
+
+// Depth returns the number of calls in progress.
+func (e *Evaluator) Depth() int {
+	return e.callStack.Length()
+}
+
+// Frames returns the call stack of a paused evaluator, innermost first.
+func (e *Evaluator) Frames() []Frame {
+	frames := []Frame{}
+	file, line, env := e.file, e.line, e.env
+	for i, fun := range e.stackTrace() {
+		frames = append(frames, Frame{frameName(fun), file, line, env})
+		if i >= len(e.callers) {
+			return frames
+		}
+		site := e.callers[len(e.callers)-1-i]
+		file, line, env = site.file, site.line, site.env
+	}
+	// a task starts with its function, there is no script below it
+	if line != 0 {
+		frames = append(frames, Frame{"<script>", file, line, env})
+	}
+	return frames
+}
+
+func frameName(fun Value) string {
+	switch fun := fun.(type) {
+	case *Function:
+		if fun.Name != "" {
+			return fun.Name
+		}
+	case *Native:
+		return fun.Name
+	}
+	return "(anonymous)"
+}
+
+// Evaluate runs source in env while e is paused and returns the value of
+// its last statement if that is an expression. The debugger is not told
+// about the statements source runs.
+func (e *Evaluator) Evaluate(source string, env *Env) (Value, error) {
+	script, errs := parser.New(scanner.New([]rune(source))).Parse()
+	if errs != nil {
+		// a bare expression may leave out the semicolon
+		var retryErrs []error
+		script, retryErrs = parser.New(scanner.New([]rune(source + ";"))).Parse()
+		if retryErrs != nil {
+			return nil, errors.Join(errs...)
+		}
+	}
+	debugger, oldEnv, oldLine := e.globals.debugger, e.env, e.line
+	e.globals.debugger, e.env = nil, env
+	defer func() { e.globals.debugger, e.env, e.line = debugger, oldEnv, oldLine }()
+	value, err := e.evalLast(script)
+	if value == nil && err == nil {
+		value = e.globalNull()
+	}
+	return value, err
+}
+
+// Outer returns the env enclosing e, nil for the builtins.
+func (e *Env) Outer() *Env {
+	return e.outer
+}
+
+// Locals returns the names declared in e itself, sorted.
+func (e *Env) Locals() []string {
+	names := []string{}
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
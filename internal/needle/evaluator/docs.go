@@ -0,0 +1,281 @@
+package evaluator
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+/* == builtin docs ========================================================== */
+
+// BuiltinDoc documents a global function, a base class, one of its
+// methods, a base module or one of its members.
+type BuiltinDoc struct {
+	Name string
+	// Function tells whether the value can be called with Params, which
+	// end in '?' when optional and start with '...' when variadic.
+	Function bool
+	Params   []string
+	Init     bool // an initializer, called on the class
+	Doc      string
+}
+
+type builtinDoc struct {
+	params []string
+	doc    string
+}
+
+// builtinDocs are keyed by name, qualified by class or module.
+var builtinDocs = map[string]builtinDoc{
+	"clock":    {nil, "Returns the current Unix time in whole seconds, see the time module for more precision."},
+	"print":    {[]string{"...values"}, "Prints values separated by spaces and a newline."},
+	"sleep":    {[]string{"ms"}, "Pauses the task for ms milliseconds."},
+	"select":   {[]string{"cases", "timeout?"}, "Waits for the first ready case of a vector of channel cases, or until timeout milliseconds."},
+	"class_of": {[]string{"value"}, "Returns the class of value, null if it has none."},
+
+	"Boolean":           {nil, "The class of `true` and `false`."},
+	"Boolean.to_string": {nil, "Returns \"true\" or \"false\"."},
+	"Number":            {nil, "The class of numbers, 64 bit floats."},
+	"Number.to_string":  {nil, "Returns the shortest decimal representation of the number."},
+
+	"String":               {nil, "The class of immutable strings of Unicode characters."},
+	"String.reverse":       {nil, "Returns the string with its characters in reverse order."},
+	"String.to_upper_case": {nil, "Returns the string with ASCII letters in upper case."},
+	"String.to_lower_case": {nil, "Returns the string with ASCII letters in lower case."},
+	"String.matches":       {[]string{"re"}, "Tells whether the `Regex` re, or the pattern string re, matches somewhere in the string."},
+
+	"Vector":        {nil, "The class of growable arrays, written `vec{1, 2}`."},
+	"Vector.push":   {[]string{"value"}, "Appends value at the end."},
+	"Vector.pop":    {nil, "Removes and returns the last element."},
+	"Vector.length": {nil, "Returns the number of elements."},
+
+	"Map":        {nil, "The class of hash maps, written `map{\"a\": 1}`."},
+	"Map.size":   {nil, "Returns the number of entries."},
+	"Map.keys":   {nil, "Returns a vector of the keys."},
+	"Map.values": {nil, "Returns a vector of the values."},
+
+	"Exception":         {nil, "The class of the values thrown by the runtime."},
+	"Exception.message": {nil, "Returns the message of the exception."},
+
+	"Generator":       {nil, "The class of the values returned by `fun*` functions. One dropped before it finishes is closed when garbage collected, its `finally` blocks running at some later point."},
+	"Generator.next":  {nil, "Resumes the generator and returns the next value it yields."},
+	"Generator.send":  {[]string{"value"}, "Resumes the generator, its `yield` evaluating to value."},
+	"Generator.close": {nil, "Stops the generator, running its pending `finally` blocks."},
+	"Generator.done":  {nil, "Tells whether the generator has returned."},
+
+	"Task":      {nil, "The class of the values returned by `spawn`. Tasks run concurrently but one at a time: they take turns at waits and every few steps, so they overlap waiting, not computing."},
+	"Task.join": {nil, "Waits for the task and returns its result, or rethrows its exception."},
+	"Task.done": {nil, "Tells whether the task has finished."},
+
+	"Channel":        {nil, "The class of channels between tasks."},
+	"Channel.new":    {[]string{"capacity?"}, "Makes a channel buffering capacity values, unbuffered by default."},
+	"Channel.send":   {[]string{"value"}, "Sends value, waiting while the channel is full."},
+	"Channel.recv":   {nil, "Receives a value, waiting while the channel is empty. Nothing detects a deadlock: a receive no task will ever send to waits forever, pass a timeout to `select` to bound it."},
+	"Channel.close":  {nil, "Closes the channel, once drained receiving returns null."},
+	"Channel.length": {nil, "Returns the number of buffered values."},
+
+	"Promise":         {nil, "The class of the values returned by `async` functions."},
+	"Promise.state":   {nil, "Returns \"pending\", \"fulfilled\" or \"rejected\"."},
+	"Promise.resolve": {[]string{"value"}, "Returns a promise fulfilled with value, or value itself if it is a promise."},
+	"Promise.reject":  {[]string{"error"}, "Returns a promise rejected with error."},
+	"Promise.delay":   {[]string{"ms", "value?"}, "Returns a promise fulfilled with value after ms milliseconds."},
+	"Promise.all":     {[]string{"promises"}, "Returns a promise of the vector of the results of promises."},
+	"Promise.race":    {[]string{"promises"}, "Returns a promise settled like the first of promises to settle."},
+
+	"math":           {nil, "Numeric constants and functions."},
+	"math.PI":        {nil, "The ratio of a circle's circumference to its diameter."},
+	"math.E":         {nil, "The base of natural logarithms."},
+	"math.INF":       {nil, "Positive infinity."},
+	"math.NAN":       {nil, "The number that is not a number, unequal to every number and itself."},
+	"math.pow":       {[]string{"x", "y"}, "Returns x to the power of y."},
+	"math.sqrt":      {[]string{"x"}, "Returns the square root of x."},
+	"math.sin":       {[]string{"x"}, "Returns the sine of x radians."},
+	"math.cos":       {[]string{"x"}, "Returns the cosine of x radians."},
+	"math.tan":       {[]string{"x"}, "Returns the tangent of x radians."},
+	"math.asin":      {[]string{"x"}, "Returns the arcsine of x in radians."},
+	"math.acos":      {[]string{"x"}, "Returns the arccosine of x in radians."},
+	"math.atan":      {[]string{"x"}, "Returns the arctangent of x in radians."},
+	"math.atan2":     {[]string{"y", "x"}, "Returns the angle of the point (x, y) from the x axis in radians."},
+	"math.hypot":     {[]string{"x", "y"}, "Returns the length of the hypotenuse of sides x and y."},
+	"math.exp":       {[]string{"x"}, "Returns e to the power of x."},
+	"math.log":       {[]string{"x", "base?"}, "Returns the logarithm of x in base, e by default."},
+	"math.log2":      {[]string{"x"}, "Returns the base 2 logarithm of x."},
+	"math.log10":     {[]string{"x"}, "Returns the base 10 logarithm of x."},
+	"math.floor":     {[]string{"x"}, "Returns the greatest integer not above x."},
+	"math.ceil":      {[]string{"x"}, "Returns the least integer not below x."},
+	"math.round":     {[]string{"x"}, "Returns the integer nearest to x, halves away from zero."},
+	"math.trunc":     {[]string{"x"}, "Returns x without its fraction."},
+	"math.abs":       {[]string{"x"}, "Returns the absolute value of x."},
+	"math.min":       {[]string{"x", "...rest"}, "Returns the least of its arguments."},
+	"math.max":       {[]string{"x", "...rest"}, "Returns the greatest of its arguments."},
+	"math.clamp":     {[]string{"x", "lo", "hi"}, "Returns x brought within lo and hi."},
+	"math.is_nan":    {[]string{"x"}, "Tells whether x is NAN."},
+	"math.is_finite": {[]string{"x"}, "Tells whether x is neither infinite nor NAN."},
+
+	"random":         {nil, "Pseudo-random numbers, seeded randomly unless `random.seed` is called. A seed gives the same numbers on every run."},
+	"random.seed":    {[]string{"n"}, "Restarts the numbers from the seed n."},
+	"random.int":     {[]string{"lo", "hi"}, "Returns an integer from lo to hi, both included. The bounds must be within ±2^53."},
+	"random.float":   {nil, "Returns a number from 0 included to 1 excluded."},
+	"random.choice":  {[]string{"vec"}, "Returns an element of vec, throws if it is empty."},
+	"random.shuffle": {[]string{"vec"}, "Puts the elements of vec in a random order."},
+	"random.sample":  {[]string{"vec", "k"}, "Returns a vector of k elements of vec at distinct positions, in random order."},
+
+	"json":           {nil, "Reading and writing JSON text."},
+	"json.parse":     {[]string{"text"}, "Returns the value of text: objects become maps with string keys and arrays vectors. Throws with the line and column of the first error."},
+	"json.stringify": {[]string{"value", "indent?"}, "Returns value as JSON text, indented by indent spaces, or by indent if it is a string. Instances are written through their `to_json()` method, cycles throw."},
+
+	"File":           {nil, "The class of the files opened with `fs.open` and of the pipes of a `Process`."},
+	"File.read":      {[]string{"n?"}, "Reads up to n bytes, null at the end of the file, or everything left without n."},
+	"File.read_line": {nil, "Reads the next line without its line end, null at the end of the file."},
+	"File.write":     {[]string{"text"}, "Writes text and returns the number of bytes written."},
+	"File.seek":      {[]string{"offset", "from?"}, "Moves to offset from \"start\", \"current\" or \"end\", the start by default, and returns the new position."},
+	"File.close":     {nil, "Closes the file."},
+
+	"fs":            {nil, "Files and directories. Paths are relative to the directory of the script and, in a sandbox, must be under its roots."},
+	"fs.read_text":  {[]string{"path"}, "Returns the content of the file at path."},
+	"fs.write_text": {[]string{"path", "text"}, "Writes text to the file at path, replacing its content."},
+	"fs.append":     {[]string{"path", "text"}, "Writes text at the end of the file at path, creating it if needed."},
+	"fs.read_lines": {[]string{"path"}, "Returns a vector of the lines of the file at path, without their line ends."},
+	"fs.exists":     {[]string{"path"}, "Tells whether there is a file or directory at path."},
+	"fs.list_dir":   {[]string{"path"}, "Returns a vector of the sorted names of the entries of the directory at path."},
+	"fs.mkdir":      {[]string{"path"}, "Makes the directory at path and its missing parents."},
+	"fs.remove":     {[]string{"path", "recursive?"}, "Removes the file or empty directory at path, or the directory and its content if recursive."},
+	"fs.rename":     {[]string{"from", "to"}, "Moves the file or directory at from to to."},
+	"fs.stat":       {[]string{"path"}, "Returns a map of the name, size, is_dir, mode and modified time in seconds of the file at path."},
+	"fs.glob":       {[]string{"pattern"}, "Returns a vector of the sorted paths matching pattern."},
+	"fs.open":       {[]string{"path", "mode?"}, "Opens the file at path and returns a `File`. Modes are \"r\", the default, \"w\", \"a\" and the same followed by \"+\" to also read or write."},
+
+	"process":       {nil, "Running other programs. Disabled in a sandbox."},
+	"process.run":   {[]string{"command", "args?", "options?"}, "Runs command with the vector args and returns a map of its stdout, stderr and exit code. Options are cwd, env, a map added to the environment, stdin, a string, and timeout in milliseconds."},
+	"process.spawn": {[]string{"command", "args?", "options?"}, "Starts command with the vector args and returns a `Process` to talk to it through pipes. Options are cwd, env and timeout, like for `process.run`."},
+
+	"Process":        {nil, "The class of the programs started with `process.spawn`."},
+	"Process.stdin":  {nil, "Returns the `File` writing to the input of the program."},
+	"Process.stdout": {nil, "Returns the `File` reading the output of the program."},
+	"Process.stderr": {nil, "Returns the `File` reading the error output of the program."},
+	"Process.pid":    {nil, "Returns the process ID of the program."},
+	"Process.wait":   {nil, "Closes the input of the program, waits for it to end and returns its exit code."},
+	"Process.kill":   {nil, "Kills the program."},
+
+	"re":         {nil, "Regular expressions, with the syntax of Go's regexp package."},
+	"re.compile": {[]string{"pattern"}, "Returns the `Regex` of pattern, throws if it is invalid."},
+
+	"Regex":          {nil, "The class of the patterns compiled with `re.compile`. Matches are maps of their text, start and end in characters, the vector of their groups and the map of their named groups."},
+	"Regex.pattern":  {nil, "Returns the pattern of the regex."},
+	"Regex.match":    {[]string{"text"}, "Returns the match of the whole text, null if the regex doesn't match all of it."},
+	"Regex.find":     {[]string{"text"}, "Returns the first match in text, null if there is none."},
+	"Regex.find_all": {[]string{"text", "n?"}, "Returns a vector of the matches in text, at most n of them."},
+	"Regex.replace":  {[]string{"text", "replacement"}, "Returns text with its matches replaced. A string replacement can refer to groups as $1 or ${name}, a function is called with each match and returns its replacement."},
+	"Regex.split":    {[]string{"text", "n?"}, "Returns a vector of the parts of text between the matches, at most n of them."},
+
+	"time":           {nil, "Dates, times and durations. Zones are named as in the IANA database, such as \"Europe/Paris\", or \"UTC\" and \"Local\"."},
+	"time.now":       {nil, "Returns the current `DateTime`, to the nanosecond where the system allows it."},
+	"time.monotonic": {nil, "Returns the seconds elapsed since the program started, on a clock that never goes back, for measuring time."},
+	"time.sleep":     {[]string{"ms"}, "Suspends the current task for ms milliseconds."},
+	"time.date":      {[]string{"year", "month", "day", "hour?", "minute?", "second?", "zone?"}, "Returns the `DateTime` of the fields, in zone or the local zone. Fields out of range carry over."},
+	"time.unix":      {[]string{"seconds", "zone?"}, "Returns the `DateTime` seconds after 1970-01-01 UTC, in zone or the local zone."},
+	"time.parse":     {[]string{"text", "layout", "zone?"}, "Returns the `DateTime` of text, read with the strftime layout. Missing fields are those of 1970-01-01 00:00:00 and the zone is zone, or the local zone, unless the layout has %z."},
+	"time.duration":  {[]string{"value"}, "Returns the `Duration` of value milliseconds, or of a string such as \"1h30m\" or \"250ms\"."},
+
+	"DateTime":            {nil, "The class of instants in a time zone. Adding or subtracting a `Duration` gives a DateTime, subtracting a DateTime gives a Duration, and DateTimes compare by instant."},
+	"DateTime.year":       {nil, "Returns the year."},
+	"DateTime.month":      {nil, "Returns the month, from 1 to 12."},
+	"DateTime.day":        {nil, "Returns the day of the month."},
+	"DateTime.hour":       {nil, "Returns the hour, from 0 to 23."},
+	"DateTime.minute":     {nil, "Returns the minute."},
+	"DateTime.second":     {nil, "Returns the second."},
+	"DateTime.nanosecond": {nil, "Returns the nanoseconds within the second."},
+	"DateTime.weekday":    {nil, "Returns the day of the week, from 0 for Sunday to 6."},
+	"DateTime.year_day":   {nil, "Returns the day of the year, from 1."},
+	"DateTime.unix":       {nil, "Returns the seconds since 1970-01-01 UTC, with their fraction."},
+	"DateTime.offset":     {nil, "Returns the offset of the zone from UTC in seconds."},
+	"DateTime.zone":       {nil, "Returns the name of the zone."},
+	"DateTime.in_zone":    {[]string{"zone"}, "Returns the same instant in zone."},
+	"DateTime.utc":        {nil, "Returns the same instant in UTC."},
+	"DateTime.format":     {[]string{"layout"}, "Returns the date formatted with the strftime directives %Y %y %m %d %e %H %I %M %S %f (microseconds) %L (milliseconds) %p %j %a %A %b %B %z %Z and %%."},
+	"DateTime.to_string":  {nil, "Returns the date in RFC 3339 format."},
+
+	"Duration":              {nil, "The class of the times between instants. Durations add and subtract, multiply and divide by numbers, divide by each other into a number and compare."},
+	"Duration.milliseconds": {nil, "Returns the duration in milliseconds."},
+	"Duration.seconds":      {nil, "Returns the duration in seconds."},
+	"Duration.minutes":      {nil, "Returns the duration in minutes."},
+	"Duration.hours":        {nil, "Returns the duration in hours."},
+	"Duration.to_string":    {nil, "Returns the duration such as \"1h30m0s\"."},
+
+	"os":          {nil, "The process and its environment."},
+	"os.args":     {nil, "The arguments given to the script."},
+	"os.env":      {[]string{"name", "default?"}, "Returns the environment variable name, default or null if it is not set."},
+	"os.set_env":  {[]string{"name", "value"}, "Sets the environment variable name, unsets it if value is null."},
+	"os.exit":     {[]string{"code?"}, "Ends the program with code, 0 by default."},
+	"os.cwd":      {nil, "Returns the working directory."},
+	"os.pid":      {nil, "Returns the process ID."},
+	"os.hostname": {nil, "Returns the host name."},
+
+	"test":               {nil, "Unit tests, run by 'needle test' for the `*_test.ndl` files."},
+	"test.test":          {[]string{"name", "fn"}, "Registers the test case fn under name."},
+	"test.setup":         {[]string{"fn"}, "Registers fn to run before every test case."},
+	"test.teardown":      {[]string{"fn"}, "Registers fn to run after every test case."},
+	"test.assert":        {[]string{"cond", "message?"}, "Fails the test case if cond is false."},
+	"test.assert_eq":     {[]string{"actual", "expected", "message?"}, "Fails the test case if actual differs from expected, listing the differences."},
+	"test.assert_throws": {[]string{"fn", "message?"}, "Calls fn, fails the test case if it doesn't throw and returns the exception."},
+}
+
+// Builtins returns the documentation of the global functions, of the base
+// classes and of the base modules, and of the members of the classes and
+// modules by name: initializers first. All are sorted by name.
+func Builtins() (functions, classes, modules []*BuiltinDoc, members map[string][]*BuiltinDoc) {
+	members = map[string][]*BuiltinDoc{}
+	builtins := newBuiltins()
+	for _, name := range slices.Sorted(maps.Keys(builtins)) {
+		functions = append(functions, nativeDoc(name, builtins[name]))
+	}
+	baseClasses := newBaseClasses()
+	for _, name := range slices.Sorted(maps.Keys(baseClasses)) {
+		classes = append(classes, &BuiltinDoc{Name: name, Doc: builtinDocs[name].doc})
+		class := baseClasses[name]
+		for _, init := range slices.Sorted(maps.Keys(class.Inits)) {
+			doc := nativeDoc(name+"."+init, class.Inits[init].(*Native))
+			doc.Init = true
+			members[name] = append(members[name], doc)
+		}
+		for _, fun := range slices.Sorted(maps.Keys(class.Funs)) {
+			members[name] = append(members[name], nativeDoc(name+"."+fun, class.Funs[fun].(*Native)))
+		}
+	}
+	baseModules := newBaseModules()
+	for _, name := range slices.Sorted(maps.Keys(baseModules)) {
+		modules = append(modules, &BuiltinDoc{Name: name, Doc: builtinDocs[name].doc})
+		store := baseModules[name].Store
+		for _, member := range slices.Sorted(maps.Keys(store)) {
+			qualified := name + "." + member
+			if native, ok := store[member].(*Native); ok {
+				members[name] = append(members[name], nativeDoc(qualified, native))
+			} else {
+				members[name] = append(members[name], &BuiltinDoc{Name: member, Doc: builtinDocs[qualified].doc})
+			}
+		}
+	}
+	return functions, classes, modules, members
+}
+
+// nativeDoc documents native under its qualified name, its parameters
+// are named after their position if the docs don't name them.
+func nativeDoc(qualified string, native *Native) *BuiltinDoc {
+	doc := &BuiltinDoc{Name: native.Name, Function: true}
+	meta, ok := builtinDocs[qualified]
+	doc.Doc, doc.Params = meta.doc, meta.params
+	if ok && meta.params != nil || native.Arity+native.Optional == 0 && !native.Variadic {
+		return doc
+	}
+	for i := range native.Arity + native.Optional {
+		param := fmt.Sprintf("arg%d", i+1)
+		if i >= native.Arity {
+			param += "?"
+		}
+		doc.Params = append(doc.Params, param)
+	}
+	if native.Variadic {
+		doc.Params = append(doc.Params, "...args")
+	}
+	return doc
+}
@@ -2,6 +2,7 @@ package evaluator
 
 import (
 	"errors"
+	"needle/internal/needle/ast"
 )
 
 var (
@@ -13,6 +14,7 @@ type Env struct {
 	store map[string]Value
 	outer *Env
 	self  Value
+	types map[string]*ast.Type // annotations, kept when checking types
 }
 
 func newEnv(outer *Env) *Env {
@@ -66,3 +68,18 @@ func (e *Env) GetSelf() Value {
 func (e *Env) SetSelf(self Value) {
 	e.self = self
 }
+
+// Names returns every name visible from e, inner declarations first.
+func (e *Env) Names() []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for env := e; env != nil; env = env.outer {
+		for name := range env.store {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
@@ -3,6 +3,9 @@ package evaluator
 import (
 	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
 	"needle/internal/needle/ast"
 	"needle/internal/needle/parser"
 	"needle/internal/needle/scanner"
@@ -11,6 +14,8 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"sync"
+	"sync/atomic"
 )
 
 type globals struct {
@@ -18,6 +23,23 @@ type globals struct {
 	True    *Boolean
 	False   *Boolean
 	Classes map[string]*Class
+
+	// lock is held by whichever task is evaluating. Tasks release it
+	// while they block and, when others are alive, every few steps.
+	lock  sync.Mutex
+	tasks atomic.Int32
+
+	out      io.Writer // where 'say' and print write
+	tests    *testSuite
+	debugger Debugger // nil unless a debugger is attached
+	profiler *profiler
+	stats    *statsCollector
+	coverage *Coverage
+	// annotations are checked, see SetTypeChecks
+	typeChecks bool
+	sandbox    *sandbox          // nil unless the script is confined
+	processes  map[*Process]bool // spawned and not waited for yet
+	random     *rand.Rand
 }
 
 type Evaluator struct {
@@ -27,6 +49,12 @@ type Evaluator struct {
 	env       *Env
 	callStack *pkg.Stack[Value]
 	globals   *globals
+	generator *coroutine // set while evaluating a generator body
+	loop      *Loop
+	ticks     int
+	file      string // script being evaluated, "" if it has no file
+	line      int    // line of the statement being evaluated
+	callers   []callSite
 }
 
 func New() *Evaluator {
@@ -39,7 +67,7 @@ func New() *Evaluator {
 	work := newEnv(roof)
 	wd, _ := os.Getwd()
 	mods := newBaseModules()
-	return &Evaluator{
+	ev := &Evaluator{
 		mods:      mods,
 		wd:        wd,
 		roof:      roof,
@@ -50,22 +78,92 @@ func New() *Evaluator {
 			True:    &Boolean{Value: true},
 			False:   &Boolean{Value: false},
 			Classes: classes,
+			out:     os.Stdout,
+			tests:   &testSuite{},
+			random:  newRandom(nil),
 		},
 	}
+	ev.loop = newLoop(ev)
+	return ev
 }
 
 func (e *Evaluator) SetWorkDir(wd string) {
 	e.wd = wd
 }
 
-func (e *Evaluator) EvalScript(script *ast.Script) (err error) {
+// SetFile records the path of the script, it names the script in
+// debugger frames.
+func (e *Evaluator) SetFile(path string) {
+	e.file = path
+}
+
+// SetArgs sets 'os.args', the arguments given to the script.
+func (e *Evaluator) SetArgs(args []string) {
+	elems := make([]Value, len(args))
+	for i, arg := range args {
+		elems[i] = e.newString(arg)
+	}
+	e.mods["os"].Store["args"] = &Vector{Elems: elems}
+}
+
+// SetOutput redirects everything the script prints.
+func (e *Evaluator) SetOutput(out io.Writer) {
+	e.globals.out = out
+}
+
+// Close ends what the script left running: the processes it spawned and
+// never waited for are killed.
+func (e *Evaluator) Close() {
+	e.globals.lock.Lock()
+	defer e.globals.lock.Unlock()
+	e.reapProcesses()
+}
+
+// Loop returns the event loop that settles promises and resumes async
+// functions, to be run once the script has been evaluated.
+func (e *Evaluator) Loop() *Loop {
+	return e.loop
+}
+
+// fork returns an evaluator sharing modules and globals with e,
+// but with its own env and call stack.
+func (e *Evaluator) fork() *Evaluator {
+	return &Evaluator{
+		mods:      e.mods,
+		wd:        e.wd,
+		roof:      e.roof,
+		env:       e.env,
+		callStack: pkg.NewStack[Value](),
+		globals:   e.globals,
+		loop:      e.loop,
+		file:      e.file,
+	}
+}
+
+func (e *Evaluator) EvalScript(script *ast.Script) error {
+	_, err := e.EvalLast(script)
+	return err
+}
+
+// EvalLast evaluates script like EvalScript and returns the value of its
+// last statement if that is a bare expression, nil otherwise.
+func (e *Evaluator) EvalLast(script *ast.Script) (Value, error) {
+	e.globals.lock.Lock()
+	defer e.globals.lock.Unlock()
+	return e.evalLast(script)
+}
+
+func (e *Evaluator) evalLast(script *ast.Script) (value Value, err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			if exc, ok := r.(*Exception); ok {
-				err = exc
-				return
+			switch r := r.(type) {
+			case *Exception:
+				err = r
+			case *Exit:
+				err = r
+			default:
+				panic(r)
 			}
-			panic(r)
 		}
 	}()
 	defer func() {
@@ -86,11 +184,47 @@ func (e *Evaluator) EvalScript(script *ast.Script) (err error) {
 			panic(r)
 		}
 	}()
-	e.Eval(script)
-	return nil
+	if c := e.globals.coverage; c != nil {
+		c.register(e.file, script)
+	}
+	decls := script.Decls
+	if len(decls) == 0 {
+		return nil, nil
+	}
+	for _, decl := range decls[:len(decls)-1] {
+		e.Eval(decl)
+	}
+	last := decls[len(decls)-1]
+	if decl, ok := last.(*ast.StmtDecl); ok {
+		if stmt, ok := decl.Stmt.(*ast.ExprStmt); ok {
+			e.line = stmt.Pos().Line
+			if c := e.globals.coverage; c != nil {
+				c.stmt(e.file, stmt)
+			}
+			return e.Eval(stmt.Expr), nil
+		}
+	}
+	e.Eval(last)
+	return nil, nil
 }
 
 func (e *Evaluator) Eval(node ast.Node) Value {
+	if stmt, ok := node.(ast.Stmt); ok {
+		e.line = stmt.Pos().Line
+	}
+	if e.globals.debugger != nil && Steppable(node) {
+		e.line = node.Pos().Line
+		e.globals.debugger.Step(e, node)
+	}
+	if p := e.globals.profiler; p != nil {
+		p.sample(e)
+	}
+	if c := e.globals.stats; c != nil {
+		c.node(node)
+	}
+	if c := e.globals.coverage; c != nil && Steppable(node) {
+		c.stmt(e.file, node)
+	}
 	switch node := node.(type) {
 	case *ast.Script:
 		return e.evalScript(node)
@@ -99,6 +233,8 @@ func (e *Evaluator) Eval(node ast.Node) Value {
 
 	case *ast.VarDecl:
 		return e.evalVarDecl(node)
+	case *ast.DestructDecl:
+		return e.evalDestructDecl(node)
 	case *ast.FunDecl:
 		return e.evalFunDecl(node)
 	case *ast.ClassDecl:
@@ -114,6 +250,8 @@ func (e *Evaluator) Eval(node ast.Node) Value {
 		return e.evalIfStmt(node)
 	case *ast.ForStmt:
 		return e.evalForStmt(node)
+	case *ast.ForInStmt:
+		return e.evalForInStmt(node)
 	case *ast.WhileStmt:
 		return e.evalWhileStmt(node)
 	case *ast.DoStmt:
@@ -122,6 +260,8 @@ func (e *Evaluator) Eval(node ast.Node) Value {
 		return e.Eval(node.Expr)
 	case *ast.AssignStmt:
 		return e.evalAssignStmt(node)
+	case *ast.DestructStmt:
+		return e.evalDestructStmt(node)
 	case *ast.TryStmt:
 		return e.evalTryStmt(node)
 	case *ast.ThrowStmt:
@@ -145,6 +285,12 @@ func (e *Evaluator) Eval(node ast.Node) Value {
 		return e.evalIndexExpr(node)
 	case *ast.SliceExpr:
 		return e.evalSliceExpr(node)
+	case *ast.YieldExpr:
+		return e.evalYieldExpr(node)
+	case *ast.AwaitExpr:
+		return e.evalAwaitExpr(node)
+	case *ast.SpawnExpr:
+		return e.evalSpawnExpr(node)
 
 	case *ast.Ident:
 		val, err := e.env.Get(node.Name)
@@ -162,9 +308,9 @@ func (e *Evaluator) Eval(node ast.Node) Value {
 	case *ast.BooleanLit:
 		return e.globalBoolean(node.Value)
 	case *ast.NumberLit:
-		return &Number{Value: node.Value}
+		return e.newNumber(node.Value)
 	case *ast.StringLit:
-		return &String{Value: node.Value}
+		return e.newString(node.Value)
 	case *ast.FunLit:
 		return e.evalFunLit(node)
 	case *ast.ClassLit:
@@ -180,6 +326,9 @@ func (e *Evaluator) Eval(node ast.Node) Value {
 }
 
 func (e *Evaluator) evalScript(node *ast.Script) Value {
+	if c := e.globals.coverage; c != nil {
+		c.register(e.file, node)
+	}
 	for _, decl := range node.Decls {
 		e.Eval(decl)
 	}
@@ -199,12 +348,34 @@ func (e *Evaluator) evalBlock(node *ast.Block) Value {
 /* == eval daclaration ====================================================== */
 
 func (e *Evaluator) evalVarDecl(node *ast.VarDecl) Value {
-	if err := e.env.Declare(node.Name.Name, e.Eval(node.Right)); err != nil {
+	value := e.Eval(node.Right)
+	if e.globals.typeChecks && node.Type != nil {
+		// a variable declared without value starts as null
+		if _, isNull := node.Right.(*ast.NullLit); !isNull {
+			e.checkType(node.Type, value, "'"+node.Name.Name+"'")
+		}
+		e.env.declareType(node.Name.Name, node.Type)
+	}
+	if err := e.env.Declare(node.Name.Name, value); err != nil {
 		e.panicException(err)
 	}
 	return nil
 }
 
+func (e *Evaluator) evalDestructDecl(node *ast.DestructDecl) Value {
+	e.destructure(
+		node.Pattern,
+		e.Eval(node.Right),
+		func(target ast.Pattern, value Value) {
+			name := target.(*ast.Ident).Name
+			if err := e.env.Declare(name, value); err != nil {
+				e.panicException(err)
+			}
+		},
+	)
+	return nil
+}
+
 func (e *Evaluator) evalFunDecl(node *ast.FunDecl) Value {
 	fun := e.evalFunLit(node.Fun)
 	fun.Name = node.Name.Name
@@ -256,12 +427,12 @@ func (e *Evaluator) evalImportDecl(node *ast.ImportDecl) Value {
 /* == eval statement ======================================================== */
 
 func (e *Evaluator) evalSayStmt(node *ast.SayStmt) Value {
-	fmt.Println(e.Eval(node.Expr).Say())
+	fmt.Fprintln(e.globals.out, e.Eval(node.Expr).Say())
 	return nil
 }
 
 func (e *Evaluator) evalIfStmt(node *ast.IfStmt) Value {
-	if toBoolean(e.Eval(node.Cond)) {
+	if e.branch(node, toBoolean(e.Eval(node.Cond))) {
 		e.Eval(node.Then)
 	} else {
 		e.Eval(node.Else)
@@ -276,7 +447,7 @@ func (e *Evaluator) evalForStmt(node *ast.ForStmt) Value {
 	e.Eval(node.Init)
 	cond := e.Eval(node.Cond)
 	defer catchBreak()
-	for toBoolean(cond) {
+	for e.branch(node, toBoolean(cond)) {
 		e.runLoop(node.Repeat)
 		e.Eval(node.Post)
 		cond = e.Eval(node.Cond)
@@ -284,10 +455,27 @@ func (e *Evaluator) evalForStmt(node *ast.ForStmt) Value {
 	return nil
 }
 
+func (e *Evaluator) evalForInStmt(node *ast.ForInStmt) Value {
+	iter := e.Eval(node.Iter)
+	defer catchBreak()
+	if g, ok := iter.(*Generator); ok && g.state != genDone {
+		// leaving early by break, return or throw runs its finally blocks
+		defer e.closeGenerator(g)
+	}
+	e.iterate(iter, func(value Value) {
+		oldEnv := e.env
+		e.env = newEnv(oldEnv)
+		defer func() { e.env = oldEnv }()
+		e.env.Declare(node.Name.Name, value)
+		e.runLoop(node.Repeat)
+	})
+	return nil
+}
+
 func (e *Evaluator) evalWhileStmt(node *ast.WhileStmt) Value {
 	cond := e.Eval(node.Cond)
 	defer catchBreak()
-	for toBoolean(cond) {
+	for e.branch(node, toBoolean(cond)) {
 		e.runLoop(node.Do)
 		cond = e.Eval(node.Cond)
 	}
@@ -295,13 +483,13 @@ func (e *Evaluator) evalWhileStmt(node *ast.WhileStmt) Value {
 }
 
 func (e *Evaluator) evalDoStmt(node *ast.DoStmt) Value {
-	var cond Value = e.globalBoolean(true)
 	defer catchBreak()
-	for toBoolean(cond) {
+	for {
 		e.runLoop(node.Do)
-		cond = e.Eval(node.While)
+		if !e.branch(node, toBoolean(e.Eval(node.While))) {
+			return nil
+		}
 	}
-	return nil
 }
 
 func (e *Evaluator) evalTryStmt(node *ast.TryStmt) Value {
@@ -323,10 +511,27 @@ func (e *Evaluator) evalThrowStmt(node *ast.ThrowStmt) Value {
 }
 
 func (e *Evaluator) evalAssignStmt(node *ast.AssignStmt) Value {
-	right := e.Eval(node.Right)
+	e.assign(node.Left, e.Eval(node.Right))
+	return nil
+}
 
-	switch left := node.Left.(type) {
+func (e *Evaluator) evalDestructStmt(node *ast.DestructStmt) Value {
+	e.destructure(
+		node.Pattern,
+		e.Eval(node.Right),
+		func(target ast.Pattern, value Value) {
+			e.assign(target.(ast.Expr), value)
+		},
+	)
+	return nil
+}
+
+func (e *Evaluator) assign(left ast.Expr, right Value) {
+	switch left := left.(type) {
 	case *ast.Ident: // name = value;
+		if e.globals.typeChecks {
+			e.checkType(e.env.lookupType(left.Name), right, "'"+left.Name+"'")
+		}
 		if err := e.env.Set(left.Name, right); err != nil {
 			e.panicException(err)
 		}
@@ -337,7 +542,98 @@ func (e *Evaluator) evalAssignStmt(node *ast.AssignStmt) Value {
 	default:
 		e.panicException("can't assign to")
 	}
-	return nil
+}
+
+// destructure matches value against pattern and hands every leaf target
+// with its value to bind. A nil value marks a missing element, which is
+// only allowed when the pattern provides a default.
+func (e *Evaluator) destructure(
+	pattern ast.Pattern, value Value, bind func(ast.Pattern, Value),
+) {
+	switch pattern := pattern.(type) {
+	case *ast.DefaultPattern:
+		if value == nil {
+			value = e.Eval(pattern.Default)
+		}
+		e.destructure(pattern.Target, value, bind)
+	case *ast.VectorPattern:
+		e.destructureVector(pattern, value, bind)
+	case *ast.MapPattern:
+		e.destructureMap(pattern, value, bind)
+	default:
+		bind(pattern, value)
+	}
+}
+
+func (e *Evaluator) destructureVector(
+	pattern *ast.VectorPattern, value Value, bind func(ast.Pattern, Value),
+) {
+	vec, ok := value.(*Vector)
+	if !ok {
+		e.panicException("can't destructure '%s' as vector", value.Type())
+	}
+	size := len(pattern.Elems)
+	if pattern.Rest == nil && len(vec.Elems) > size {
+		e.panicException(
+			"too many values to destructure: expected %d, got %d",
+			size,
+			len(vec.Elems),
+		)
+	}
+	for i, elem := range pattern.Elems {
+		var v Value
+		if i < len(vec.Elems) {
+			v = vec.Elems[i]
+		} else if _, ok := elem.(*ast.DefaultPattern); !ok {
+			e.panicException(
+				"not enough values to destructure: expected %d, got %d",
+				size,
+				len(vec.Elems),
+			)
+		}
+		e.destructure(elem, v, bind)
+	}
+	if pattern.Rest != nil {
+		rest := []Value{}
+		if len(vec.Elems) > size {
+			rest = slices.Clone(vec.Elems[size:])
+		}
+		e.destructure(pattern.Rest, &Vector{Elems: rest}, bind)
+	}
+}
+
+func (e *Evaluator) destructureMap(
+	pattern *ast.MapPattern, value Value, bind func(ast.Pattern, Value),
+) {
+	m, ok := value.(*Map)
+	if !ok {
+		e.panicException("can't destructure '%s' as map", value.Type())
+	}
+	taken := newHashTable()
+	for i, kExpr := range pattern.Keys {
+		key := e.Eval(kExpr)
+		v, err := m.Pairs.Get(key)
+		if err != nil {
+			_, hasDefault := pattern.Values[i].(*ast.DefaultPattern)
+			if err != errMissingKey || !hasDefault {
+				e.panicException("%s %s", err, key.Say())
+			}
+			v = nil
+		}
+		taken.Set(key, key)
+		e.destructure(pattern.Values[i], v, bind)
+	}
+	if pattern.Rest != nil {
+		rest := &Map{Pairs: newHashTable()}
+		for _, key := range m.Pairs.Keys() {
+			if _, err := taken.Get(key); err == nil {
+				continue
+			}
+			v, _ := m.Pairs.Get(key)
+			rest.Pairs.Set(key, v)
+		}
+		e.destructure(pattern.Rest, rest, bind)
+	}
 }
 
 func (e *Evaluator) propAssign(left *ast.PropExpr, right Value) {
@@ -348,6 +644,9 @@ func (e *Evaluator) propAssign(left *ast.PropExpr, right Value) {
 		if self == nil {
 			e.panicException("'self' is undefined")
 		}
+		if e.globals.typeChecks {
+			e.checkType(self.(*Instance).Class.fields[prop], right, "field '"+prop+"'")
+		}
 		self.(*Instance).Fields[prop] = right
 		return
 	}
@@ -401,9 +700,9 @@ func (e Evaluator) evalPrefixExpr(node *ast.PrefixExpr) Value {
 			e.panicException("expected 'number', got '%s'", right.Type())
 		}
 		if node.Op.Type == token.MINUS {
-			return &Number{Value: -right.(*Number).Value}
+			return e.newNumber(-right.(*Number).Value)
 		}
-		return &Number{Value: +right.(*Number).Value}
+		return e.newNumber(+right.(*Number).Value)
 	}
 
 	panic("unknown prefix operator")
@@ -439,6 +738,10 @@ func (e *Evaluator) evalInfixExpr(node *ast.InfixExpr) Value {
 		f, ok = numBinOps[node.Op.Type]
 	case *String:
 		f, ok = strBinOps[node.Op.Type]
+	case *DateTime:
+		f, ok = dateTimeBinOps[node.Op.Type]
+	case *Duration:
+		f, ok = durationBinOps[node.Op.Type]
 	default:
 		e.panicException("unsupported type")
 	}
@@ -449,33 +752,49 @@ func (e *Evaluator) evalInfixExpr(node *ast.InfixExpr) Value {
 	if err != nil {
 		e.panicException(err)
 	}
+	if c := e.globals.stats; c != nil {
+		c.alloc(res)
+	}
 	return res
 }
 
 func (e *Evaluator) evalCallExpr(node *ast.CallExpr) Value {
 	left := e.Eval(node.Left)
-	args := e.evalExprs(node.Arguments)
+	args, named := e.evalArguments(node.Arguments)
+	return e.call(left, args, named)
+}
+
+// call invokes a callable value: a function, a native or a bound method.
+func (e *Evaluator) call(
+	callee Value, args []Value, named map[string]Value,
+) Value {
 	var fun, self Value
 	var isInit bool
-	switch left := left.(type) {
+	switch callee := callee.(type) {
 	case *Method:
-		self = left.Self
-		fun = left.Function
-		isInit = left.IsInit
+		self = callee.Self
+		fun = callee.Function
+		isInit = callee.IsInit
 	case *Function, *Native:
 		self = nil
-		fun = left
+		fun = callee
 		isInit = false
 	default:
 		e.panicException("call not callable")
 	}
-	value := e.runCall(fun, self, args)
+	value := e.runCall(fun, self, args, named)
 	if isInit {
 		return self
 	}
 	return value
 }
 
+func (e *Evaluator) evalSpawnExpr(node *ast.SpawnExpr) Value {
+	left := e.Eval(node.Call.Left)
+	args, named := e.evalArguments(node.Call.Arguments)
+	return e.spawn(left, args, named)
+}
+
 func (e *Evaluator) evalPropExpr(node *ast.PropExpr) Value {
 	left := e.Eval(node.Left)
 	prop := node.Prop.Name
@@ -487,6 +806,14 @@ func (e *Evaluator) evalPropExpr(node *ast.PropExpr) Value {
 		if !ok {
 			e.panicException("missing initializer")
 		}
+		if native, ok := init.(*Native); ok {
+			// builtin classes construct their own values
+			return &Method{
+				Function: native,
+				Self:     left,
+				IsInit:   false,
+			}
+		}
 		self := &Instance{
 			Class:  left,
 			Fields: map[string]Value{},
@@ -536,6 +863,24 @@ func (e *Evaluator) evalPropExpr(node *ast.PropExpr) Value {
 		className = CLASS_MAP
 	case *Exception:
 		className = CLASS_EXCEPTION
+	case *Generator:
+		className = CLASS_GENERATOR
+	case *Task:
+		className = CLASS_TASK
+	case *Channel:
+		className = CLASS_CHANNEL
+	case *Promise:
+		className = CLASS_PROMISE
+	case *File:
+		className = CLASS_FILE
+	case *Process:
+		className = CLASS_PROCESS
+	case *Regex:
+		className = CLASS_REGEX
+	case *DateTime:
+		className = CLASS_DATETIME
+	case *Duration:
+		className = CLASS_DURATION
 	default:
 		panic("getting property from unsupported type")
 	}
@@ -570,7 +915,7 @@ func (e *Evaluator) evalIndexExpr(node *ast.IndexExpr) Value {
 		if err != nil {
 			e.panicException(err)
 		}
-		return &String{Value: string(chars[intIndex])}
+		return e.newString(string(chars[intIndex]))
 	}
 	e.panicException("type not supports index access")
 	return nil
@@ -594,7 +939,7 @@ func (e *Evaluator) evalSliceExpr(node *ast.SliceExpr) Value {
 		if err != nil {
 			e.panicException(err)
 		}
-		return &String{Value: string(chars[intStart:intEnd])}
+		return e.newString(string(chars[intStart:intEnd]))
 	default:
 		e.panicException("type not supports slice")
 	}
@@ -604,31 +949,40 @@ func (e *Evaluator) evalSliceExpr(node *ast.SliceExpr) Value {
 /* == eval literal ========================================================== */
 
 func (e *Evaluator) evalFunLit(node *ast.FunLit) *Function {
-	params, _ := pkg.SliceMap(
-		node.Params,
-		func(e *ast.Ident) (string, error) {
-			return e.Name, nil
-		},
-	)
-	return &Function{
-		Closure: e.env,
-		Body:    node.Body,
-		Params:  params,
+	fun := &Function{
+		Closure:  e.env,
+		Body:     node.Body,
+		Params:   []string{},
+		Defaults: []ast.Expr{},
+		file:     e.file,
+		pos:      node.Pos(),
+	}
+	for _, param := range node.Params {
+		fun.Params = append(fun.Params, param.Name.Name)
+		fun.Defaults = append(fun.Defaults, param.Default)
+	}
+	if node.Rest != nil {
+		fun.Rest = node.Rest.Name
+	}
+	if e.globals.typeChecks {
+		for _, param := range node.Params {
+			fun.types = append(fun.types, param.Type)
+		}
+		fun.result = node.Return
 	}
+	fun.Generator = node.Generator
+	fun.Async = node.Async
+	return fun
 }
 
 func (e *Evaluator) evalVectorLit(node *ast.VectorLit) *Vector {
-	vec := &Vector{Elems: []Value{}}
-	for _, expr := range node.Elems {
-		vec.Elems = append(vec.Elems, e.Eval(expr))
-	}
-	return vec
+	return &Vector{Elems: e.evalExprs(node.Elems)}
 }
 
 func (e *Evaluator) evalMapLit(node *ast.MapLit) *Map {
 	m := &Map{Pairs: newHashTable()}
-	for kExpr, vExpr := range node.Pairs {
-		m.Pairs.Set(e.Eval(kExpr), e.Eval(vExpr))
+	for _, kExpr := range node.Keys {
+		m.Pairs.Set(e.Eval(kExpr), e.Eval(node.Pairs[kExpr]))
 	}
 	return m
 }
@@ -644,29 +998,140 @@ func (e *Evaluator) evalClassLit(node *ast.ClassLit) *Class {
 	}
 	class.Inits, _ = pkg.MapMap(node.Inits, fmm)
 	class.Funs, _ = pkg.MapMap(node.Funs, fmm)
+	if e.globals.typeChecks {
+		class.fields = map[string]*ast.Type{}
+		for name, t := range node.Fields {
+			class.fields[name.Name] = t
+		}
+	}
 	return class
 }
 
 /* == utils ================================================================= */
 
-func (e *Evaluator) assertArgsLength(arity, args int) {
-	if arity != args {
+// assertArity checks the number of arguments against [min, max],
+// max < 0 means there is no upper bound.
+func (e *Evaluator) assertArity(min, max, args int) {
+	if min == max {
+		if args != min {
+			e.panicException(
+				"expected %d arguments, got %d",
+				min,
+				args,
+			)
+		}
+		return
+	}
+	if args < min && max < 0 {
+		e.panicException(
+			"expected at least %d arguments, got %d",
+			min,
+			args,
+		)
+	}
+	if args < min || (max >= 0 && args > max) {
 		e.panicException(
-			"expected %d arguments, got %d",
-			arity,
+			"expected %d to %d arguments, got %d",
+			min,
+			max,
 			args,
 		)
 	}
 }
 
+// evalExprs evaluates exprs in order, expanding '...vector' spreads in place.
 func (e *Evaluator) evalExprs(exprs []ast.Expr) []Value {
 	vals := []Value{}
 	for _, expr := range exprs {
+		if spread, ok := expr.(*ast.SpreadExpr); ok {
+			vals = append(vals, e.spread(spread)...)
+			continue
+		}
 		vals = append(vals, e.Eval(expr))
 	}
 	return vals
 }
 
+func (e *Evaluator) evalArguments(
+	exprs []ast.Expr,
+) ([]Value, map[string]Value) {
+	args := []Value{}
+	named := map[string]Value{}
+	for _, expr := range exprs {
+		switch expr := expr.(type) {
+		case *ast.SpreadExpr:
+			args = append(args, e.spread(expr)...)
+		case *ast.NamedArg:
+			name := expr.Name.Name
+			if _, ok := named[name]; ok {
+				e.panicException("duplicate named argument '%s'", name)
+			}
+			named[name] = e.Eval(expr.Value)
+		default:
+			args = append(args, e.Eval(expr))
+		}
+	}
+	return args, named
+}
+
+func (e *Evaluator) spread(node *ast.SpreadExpr) []Value {
+	value := e.Eval(node.Value)
+	vec, ok := value.(*Vector)
+	if !ok {
+		e.panicException("can't spread '%s'", value.Type())
+	}
+	return vec.Elems
+}
+
+// bindParams declares the parameters of fun in the current env. Defaults
+// are evaluated there too, so they can refer to the preceding parameters.
+func (e *Evaluator) bindParams(
+	fun *Function, args []Value, named map[string]Value,
+) {
+	min, max := fun.arityRange()
+	if len(named) == 0 {
+		e.assertArity(min, max, len(args))
+	} else if max >= 0 && len(args) > max {
+		e.panicException(
+			"expected at most %d positional arguments, got %d",
+			max,
+			len(args),
+		)
+	}
+	for i, param := range fun.Params {
+		value, isNamed := named[param]
+		switch {
+		case i < len(args):
+			if isNamed {
+				e.panicException("multiple values for argument '%s'", param)
+			}
+			value = args[i]
+		case isNamed:
+			delete(named, param)
+		case fun.Defaults[i] != nil:
+			value = e.Eval(fun.Defaults[i])
+		default:
+			e.panicException("missing argument '%s'", param)
+		}
+		if fun.types != nil && fun.types[i] != nil {
+			e.checkType(fun.types[i], value, "argument '"+param+"'")
+			e.env.declareType(param, fun.types[i])
+		}
+		e.env.Declare(param, value)
+	}
+	if len(named) != 0 {
+		names := slices.Sorted(maps.Keys(named))
+		e.panicException("unexpected named argument '%s'", names[0])
+	}
+	if fun.Rest != "" {
+		rest := []Value{}
+		if len(args) > len(fun.Params) {
+			rest = slices.Clone(args[len(fun.Params):])
+		}
+		e.env.Declare(fun.Rest, &Vector{Elems: rest})
+	}
+}
+
 func checkIndex(index0 Value, length int) (int, error) {
 	index, ok := index0.(*Number)
 	if !ok {
@@ -696,30 +1161,57 @@ func checkSlice(start0, end0 Value, length int) (int, int, error) {
 }
 
 func (e *Evaluator) runLoop(loop ast.Stmt) {
+	e.checkpoint()
 	defer catchContinue()
 	e.Eval(loop)
 }
 
 func (e *Evaluator) runCall(
-	fun Value, self Value, args []Value,
+	fun Value, self Value, args []Value, named map[string]Value,
 ) (value Value) {
+	e.checkpoint()
 	e.callStack.Push(fun)
 	defer e.callStack.Pop()
+	if p := e.globals.profiler; p != nil {
+		p.profile.Calls[funcID(fun)]++
+	}
+	if c := e.globals.stats; c != nil {
+		c.call(e)
+	}
+	if e.globals.debugger != nil {
+		e.callers = append(e.callers, callSite{e.file, e.line, e.env})
+		defer func() { e.callers = e.callers[:len(e.callers)-1] }()
+	}
 	switch fun := fun.(type) {
 	case *Function:
-		oldEnv := e.env
-		e.env = newEnv(fun.Closure)
-		defer func() { e.env = oldEnv }()
+		if fun.Generator {
+			return e.newGenerator(fun, self, args, named)
+		}
+		if fun.Async {
+			return e.startAsync(e.newGenerator(fun, self, args, named))
+		}
+		oldEnv, oldLine, oldFile := e.env, e.line, e.file
+		e.env, e.file = newEnv(fun.Closure), fun.file
+		defer func() { e.env, e.line, e.file = oldEnv, oldLine, oldFile }()
 		e.env.SetSelf(self)
-		e.assertArgsLength(len(fun.Params), len(args))
-		for i, arg := range args {
-			e.env.Declare(fun.Params[i], arg)
+		e.bindParams(fun, args, named)
+		if fun.result != nil {
+			return e.checkedBody(fun)
 		}
 		defer catchReturn(&value)
 		return e.Eval(fun.Body)
 	case *Native:
-		e.assertArgsLength(fun.Arity, len(args))
-		return fun.Function(e, self, args...)
+		if len(named) != 0 {
+			e.panicException("%s doesn't accept named arguments", fun.Say())
+		}
+		min, max := fun.arityRange()
+		e.assertArity(min, max, len(args))
+		value = fun.Function(e, self, args...)
+		if p := e.globals.profiler; p != nil {
+			// charge the time spent in the native to it
+			p.sample(e)
+		}
+		return value
 	default:
 		panic("unknown function type")
 	}
@@ -731,9 +1223,9 @@ func (e *Evaluator) runImport(absPath string) *Env {
 	oldEnv := e.env
 	e.env = newEnv(e.roof)
 	defer func() { e.env = oldEnv }()
-	oldWd := e.wd
-	e.wd = filepath.Dir(absPath)
-	defer func() { e.wd = oldWd }()
+	oldWd, oldFile := e.wd, e.file
+	e.wd, e.file = filepath.Dir(absPath), absPath
+	defer func() { e.wd, e.file = oldWd, oldFile }()
 
 	e.Eval(script)
 	modEnv := e.env
@@ -807,17 +1299,29 @@ func toBoolean(value Value) bool {
 }
 
 func (e *Evaluator) panicException(message any, a ...any) {
+	panic(e.newException(message, a...))
+}
+
+func (e *Evaluator) newException(message any, a ...any) *Exception {
+	msg := fmt.Sprintf("%s", message)
+	if len(a) != 0 {
+		msg = fmt.Sprintf(msg, a...)
+	}
+	return &Exception{
+		Message:    msg,
+		Line:       e.line,
+		File:       e.file,
+		StackTrace: e.stackTrace(),
+	}
+}
+
+func (e *Evaluator) stackTrace() []Value {
 	st := e.callStack.Shot()
 	nst := []Value{}
 	for f, err := st.Pop(); err == nil; f, err = st.Pop() {
 		nst = append(nst, f)
 	}
-	msg0 := fmt.Sprintf("%s", message)
-	msg := fmt.Sprintf(msg0, a...)
-	panic(&Exception{
-		Message:    msg,
-		StackTrace: nst,
-	})
+	return nst
 }
 
 /* == new value ============================================================= */
@@ -857,7 +1361,7 @@ var strBinOps = map[token.TokenType]binOp{
 		if v2.Type() != VAL_STRING {
 			return nil, errors.New("expected string")
 		}
-		return &String{Value: v1.(*String).Value + v2.(*String).Value}, nil
+		return newString(v1.(*String).Value + v2.(*String).Value), nil
 	},
 	token.EQ: func(v1, v2 Value) (Value, error) {
 		if v2.Type() != VAL_STRING {
@@ -878,25 +1382,25 @@ var numBinOps = map[token.TokenType]binOp{
 		if v2.Type() != VAL_NUMBER {
 			return nil, errors.New("expected number")
 		}
-		return &Number{Value: v1.(*Number).Value + v2.(*Number).Value}, nil
+		return newNumber(v1.(*Number).Value + v2.(*Number).Value), nil
 	},
 	token.MINUS: func(v1, v2 Value) (Value, error) {
 		if v2.Type() != VAL_NUMBER {
 			return nil, errors.New("expected number")
 		}
-		return &Number{Value: v1.(*Number).Value - v2.(*Number).Value}, nil
+		return newNumber(v1.(*Number).Value - v2.(*Number).Value), nil
 	},
 	token.STAR: func(v1, v2 Value) (Value, error) {
 		if v2.Type() != VAL_NUMBER {
 			return nil, errors.New("expected number")
 		}
-		return &Number{Value: v1.(*Number).Value * v2.(*Number).Value}, nil
+		return newNumber(v1.(*Number).Value * v2.(*Number).Value), nil
 	},
 	token.SLASH: func(v1, v2 Value) (Value, error) {
 		if v2.Type() != VAL_NUMBER {
 			return nil, errors.New("expected number")
 		}
-		return &Number{Value: v1.(*Number).Value / v2.(*Number).Value}, nil
+		return newNumber(v1.(*Number).Value / v2.(*Number).Value), nil
 	},
 	token.EQ: func(v1, v2 Value) (Value, error) {
 		if v2.Type() != VAL_NUMBER {
@@ -0,0 +1,377 @@
+package evaluator
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+/* == fs ==================================================================== */
+
+// File is a file opened with 'fs.open' or a pipe of a process.
+type File struct {
+	Path   string
+	file   *os.File
+	reader *bufio.Reader // reads of file, buffered for read_line
+}
+
+func newFile(path string, f *os.File) *File {
+	return &File{Path: path, file: f, reader: bufio.NewReader(f)}
+}
+
+// fileModes are the flags of the modes of 'fs.open'.
+var fileModes = map[string]int{
+	"r":  os.O_RDONLY,
+	"r+": os.O_RDWR,
+	"w":  os.O_WRONLY | os.O_CREATE | os.O_TRUNC,
+	"w+": os.O_RDWR | os.O_CREATE | os.O_TRUNC,
+	"a":  os.O_WRONLY | os.O_CREATE | os.O_APPEND,
+	"a+": os.O_RDWR | os.O_CREATE | os.O_APPEND,
+}
+
+func newFsModule() *Module {
+	store := map[string]Value{
+		"read_text": &Native{
+			Name:  "read_text",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				path := e.path(args[0])
+				var data []byte
+				var err error
+				e.blocking(func() { data, err = os.ReadFile(path) })
+				if err != nil {
+					e.panicException(err)
+				}
+				return e.newString(string(data))
+			},
+		},
+		"write_text": &Native{
+			Name:  "write_text",
+			Arity: 2,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				path, text := e.path(args[0]), e.stringArg(args[1])
+				var err error
+				e.blocking(func() { err = os.WriteFile(path, []byte(text), 0o666) })
+				if err != nil {
+					e.panicException(err)
+				}
+				return e.globalNull()
+			},
+		},
+		"append": &Native{
+			Name:  "append",
+			Arity: 2,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				path, text := e.path(args[0]), e.stringArg(args[1])
+				var err error
+				e.blocking(func() {
+					var f *os.File
+					f, err = os.OpenFile(path, fileModes["a"], 0o666)
+					if err == nil {
+						_, err = f.WriteString(text)
+						err = errors.Join(err, f.Close())
+					}
+				})
+				if err != nil {
+					e.panicException(err)
+				}
+				return e.globalNull()
+			},
+		},
+		"read_lines": &Native{
+			Name:  "read_lines",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				path := e.path(args[0])
+				var data []byte
+				var err error
+				e.blocking(func() { data, err = os.ReadFile(path) })
+				if err != nil {
+					e.panicException(err)
+				}
+				lines := &Vector{Elems: []Value{}}
+				text := strings.TrimSuffix(string(data), "\n")
+				if text == "" {
+					return lines
+				}
+				for _, line := range strings.Split(text, "\n") {
+					lines.Elems = append(lines.Elems, e.newString(strings.TrimSuffix(line, "\r")))
+				}
+				return lines
+			},
+		},
+		"exists": &Native{
+			Name:  "exists",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				path := e.path(args[0])
+				var err error
+				e.blocking(func() { _, err = os.Stat(path) })
+				return e.globalBoolean(err == nil)
+			},
+		},
+		"list_dir": &Native{
+			Name:  "list_dir",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				path := e.path(args[0])
+				var entries []os.DirEntry
+				var err error
+				e.blocking(func() { entries, err = os.ReadDir(path) })
+				if err != nil {
+					e.panicException(err)
+				}
+				names := &Vector{Elems: []Value{}}
+				for _, entry := range entries {
+					names.Elems = append(names.Elems, e.newString(entry.Name()))
+				}
+				return names
+			},
+		},
+		"mkdir": &Native{
+			Name:  "mkdir",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				path := e.path(args[0])
+				var err error
+				e.blocking(func() { err = os.MkdirAll(path, 0o777) })
+				if err != nil {
+					e.panicException(err)
+				}
+				return e.globalNull()
+			},
+		},
+		"remove": &Native{
+			Name:     "remove",
+			Arity:    1,
+			Optional: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				path := e.path(args[0])
+				remove := os.Remove
+				if len(args) == 2 && toBoolean(args[1]) {
+					remove = os.RemoveAll
+				}
+				var err error
+				e.blocking(func() { err = remove(path) })
+				if err != nil {
+					e.panicException(err)
+				}
+				return e.globalNull()
+			},
+		},
+		"rename": &Native{
+			Name:  "rename",
+			Arity: 2,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				from, to := e.path(args[0]), e.path(args[1])
+				var err error
+				e.blocking(func() { err = os.Rename(from, to) })
+				if err != nil {
+					e.panicException(err)
+				}
+				return e.globalNull()
+			},
+		},
+		"stat": &Native{
+			Name:  "stat",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				path := e.path(args[0])
+				var info os.FileInfo
+				var err error
+				e.blocking(func() { info, err = os.Stat(path) })
+				if err != nil {
+					e.panicException(err)
+				}
+				pairs := newHashTable()
+				pairs.Set(e.newString("name"), e.newString(info.Name()))
+				pairs.Set(e.newString("size"), e.newNumber(float64(info.Size())))
+				pairs.Set(e.newString("is_dir"), e.globalBoolean(info.IsDir()))
+				pairs.Set(e.newString("mode"), e.newNumber(float64(info.Mode().Perm())))
+				pairs.Set(e.newString("modified"), e.newNumber(float64(info.ModTime().UnixMilli())/1000))
+				return &Map{Pairs: pairs}
+			},
+		},
+		"glob": &Native{
+			Name:  "glob",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				return e.glob(e.stringArg(args[0]))
+			},
+		},
+		"open": &Native{
+			Name:     "open",
+			Arity:    1,
+			Optional: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				path, mode := e.path(args[0]), "r"
+				if len(args) == 2 {
+					mode = e.stringArg(args[1])
+				}
+				flag, ok := fileModes[mode]
+				if !ok {
+					e.panicException("unknown mode '%s'", mode)
+				}
+				var f *os.File
+				var err error
+				e.blocking(func() { f, err = os.OpenFile(path, flag, 0o666) })
+				if err != nil {
+					e.panicException(err)
+				}
+				return newFile(path, f)
+			},
+		},
+	}
+	return &Module{Store: store}
+}
+
+// glob returns the sorted paths matching pattern, relative to the working
+// directory if pattern is. Paths outside the sandbox are left out.
+func (e *Evaluator) glob(pattern string) *Vector {
+	var matches []string
+	var err error
+	e.blocking(func() { matches, err = filepath.Glob(absPath(e.wd, pattern)) })
+	if err != nil {
+		e.panicException(err)
+	}
+	paths := &Vector{Elems: []Value{}}
+	for _, match := range matches {
+		if sb := e.globals.sandbox; sb != nil && !sb.allows(match) {
+			continue
+		}
+		if !filepath.IsAbs(pattern) {
+			match, _ = filepath.Rel(e.wd, match)
+		}
+		paths.Elems = append(paths.Elems, e.newString(match))
+	}
+	return paths
+}
+
+func newFileClass() *Class {
+	funs := map[string]Value{
+		"read": &Native{
+			Name:     "read",
+			Arity:    0,
+			Optional: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*File)
+				if len(args) == 0 {
+					var data []byte
+					var err error
+					e.blocking(func() { data, err = io.ReadAll(self.reader) })
+					if err != nil {
+						e.panicException(err)
+					}
+					return e.newString(string(data))
+				}
+				n, ok := args[0].(*Number)
+				if !ok {
+					e.panicException("non number agrument")
+				}
+				data := make([]byte, max(int(n.Value), 0))
+				var read int
+				var err error
+				e.blocking(func() { read, err = io.ReadFull(self.reader, data) })
+				if read == 0 && len(data) != 0 && errors.Is(err, io.EOF) {
+					return e.globalNull()
+				}
+				if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+					e.panicException(err)
+				}
+				return e.newString(string(data[:read]))
+			},
+		},
+		"read_line": &Native{
+			Name:  "read_line",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*File)
+				var line string
+				var err error
+				e.blocking(func() { line, err = self.reader.ReadString('\n') })
+				if errors.Is(err, io.EOF) && line == "" {
+					return e.globalNull()
+				}
+				if err != nil && !errors.Is(err, io.EOF) {
+					e.panicException(err)
+				}
+				line = strings.TrimSuffix(line, "\n")
+				return e.newString(strings.TrimSuffix(line, "\r"))
+			},
+		},
+		"write": &Native{
+			Name:  "write",
+			Arity: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*File)
+				text := e.stringArg(args[0])
+				if buffered := self.reader.Buffered(); buffered != 0 {
+					// write where reading stopped, not after the buffer
+					if _, err := self.file.Seek(-int64(buffered), io.SeekCurrent); err != nil {
+						e.panicException(err)
+					}
+					self.reader.Reset(self.file)
+				}
+				var n int
+				var err error
+				e.blocking(func() { n, err = self.file.WriteString(text) })
+				if err != nil {
+					e.panicException(err)
+				}
+				return e.newNumber(float64(n))
+			},
+		},
+		"seek": &Native{
+			Name:     "seek",
+			Arity:    1,
+			Optional: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*File)
+				offset, ok := args[0].(*Number)
+				if !ok {
+					e.panicException("non number agrument")
+				}
+				whence := io.SeekStart
+				if len(args) == 2 {
+					from := e.stringArg(args[1])
+					whence = slices.Index([]string{"start", "current", "end"}, from)
+					if whence < 0 {
+						e.panicException("unknown origin '%s'", from)
+					}
+				}
+				skip := int64(offset.Value)
+				if whence == io.SeekCurrent {
+					// the file is ahead of what was read by what is buffered
+					skip -= int64(self.reader.Buffered())
+				}
+				var pos int64
+				var err error
+				e.blocking(func() { pos, err = self.file.Seek(skip, whence) })
+				if err != nil {
+					e.panicException(err)
+				}
+				self.reader.Reset(self.file)
+				return e.newNumber(float64(pos))
+			},
+		},
+		"close": &Native{
+			Name:  "close",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*File)
+				var err error
+				e.blocking(func() { err = self.file.Close() })
+				if err != nil {
+					e.panicException(err)
+				}
+				return e.globalNull()
+			},
+		},
+	}
+	inits := map[string]Value{}
+	return &Class{Inits: inits, Funs: funs}
+}
@@ -0,0 +1,233 @@
+package evaluator
+
+import (
+	"needle/internal/needle/ast"
+	"runtime"
+	"slices"
+)
+
+type genState int
+
+const (
+	genCreated genState = iota
+	genSuspended
+	genRunning
+	genDone
+)
+
+// Generator runs the body of a 'fun*' function as a coroutine. The body is
+// evaluated on its own goroutine by a forked evaluator, so it keeps its env
+// and call stack between resumptions. Control is handed over through the
+// channels and only one side runs at a time.
+//
+// A generator dropped while suspended is closed once it is garbage
+// collected, so its goroutine ends. Its 'finally' blocks then run at some
+// later point, whenever no task holds the lock. A generator its own body
+// refers to is never collected and stays suspended.
+type Generator struct {
+	*coroutine
+}
+
+// coroutine is what the body's goroutine shares with its Generator. The
+// goroutine only holds the coroutine, so the Generator can be collected.
+type coroutine struct {
+	Function *Function
+	state    genState
+	ev       *Evaluator
+	resume   chan genResume
+	yield    chan genYield
+}
+
+type genResume struct {
+	value Value
+	close bool
+	throw Value // exception raised at the suspension point
+}
+
+type genYield struct {
+	value Value
+	done  bool
+	panic any // exception or signal escaping the body
+}
+
+func (e *Evaluator) newGenerator(
+	fun *Function, self Value, args []Value, named map[string]Value,
+) *Generator {
+	ev := e.fork()
+	ev.env, ev.file = newEnv(fun.Closure), fun.file
+	ev.env.SetSelf(self)
+	// runCall has already pushed fun, keep the whole creation site
+	ev.callStack = e.callStack.Clone()
+	ev.callers = slices.Clone(e.callers)
+	ev.bindParams(fun, args, named)
+	co := &coroutine{
+		Function: fun,
+		state:    genCreated,
+		ev:       ev,
+		resume:   make(chan genResume),
+		yield:    make(chan genYield),
+	}
+	ev.generator = co
+	gen := &Generator{coroutine: co}
+	runtime.AddCleanup(gen, (*coroutine).abandon, co)
+	return gen
+}
+
+func (g *coroutine) start() {
+	go func() {
+		out := genYield{done: true}
+		defer func() { g.yield <- out }()
+		defer func() {
+			if r := recover(); r != nil {
+				if s, ok := r.(*Signal); ok {
+					switch s.Type {
+					case SIG_RETURN:
+						out.value = s.Value
+						return
+					case SIG_CLOSE:
+						return
+					}
+				}
+				out.panic = r
+			}
+		}()
+		g.ev.Eval(g.Function.Body)
+	}()
+}
+
+// transfer hands control to the generator body and waits until it yields
+// or finishes.
+func (e *Evaluator) transfer(g *Generator, msg genResume) genYield {
+	switch g.state {
+	case genRunning:
+		e.panicException("generator is already running")
+	case genCreated:
+		g.state = genRunning
+		g.start()
+	default:
+		g.state = genRunning
+		g.resume <- msg
+	}
+	out := <-g.yield
+	if out.done {
+		g.state = genDone
+	} else {
+		g.state = genSuspended
+	}
+	if out.panic != nil {
+		panic(out.panic)
+	}
+	return out
+}
+
+func (e *Evaluator) resumeGenerator(g *Generator, value Value) Value {
+	if g.state == genDone {
+		return e.globalNull()
+	}
+	if g.state == genCreated && value != e.globalNull() {
+		e.panicException("can't send non-null value to a just-started generator")
+	}
+	out := e.transfer(g, genResume{value: value})
+	if out.value == nil {
+		return e.globalNull()
+	}
+	return out.value
+}
+
+// abandon closes the coroutine of a collected generator if it is
+// suspended. It runs on the cleanup goroutine, so it waits for the lock on
+// a goroutine of its own.
+func (g *coroutine) abandon() {
+	go func() {
+		g.ev.globals.lock.Lock()
+		defer g.ev.globals.lock.Unlock()
+		if g.state != genSuspended {
+			return
+		}
+		g.state = genRunning
+		g.resume <- genResume{close: true}
+		// a body yielding from 'finally' is left suspended for good
+		if out := <-g.yield; out.done {
+			g.state = genDone
+		} else {
+			g.state = genSuspended
+		}
+	}()
+}
+
+// closeGenerator unwinds a suspended generator, running its 'finally' blocks.
+func (e *Evaluator) closeGenerator(g *Generator) {
+	switch g.state {
+	case genCreated:
+		g.state = genDone
+		return
+	case genDone:
+		return
+	}
+	out := e.transfer(g, genResume{close: true})
+	if !out.done {
+		g.state = genDone
+		e.panicException("generator ignored close")
+	}
+}
+
+func (e *Evaluator) evalYieldExpr(node *ast.YieldExpr) Value {
+	value := e.Eval(node.Value)
+	if e.generator == nil {
+		e.panicException("'yield' outside generator")
+	}
+	return e.suspend(value)
+}
+
+// suspend hands value over to whoever resumed the coroutine and waits
+// until it is resumed again.
+func (e *Evaluator) suspend(value Value) Value {
+	g := e.generator
+	g.yield <- genYield{value: value}
+	in := <-g.resume
+	if in.close {
+		panic(&Signal{Type: SIG_CLOSE})
+	}
+	if in.throw != nil {
+		panic(in.throw)
+	}
+	return in.value
+}
+
+// iterate calls f for every element of an iterable value: vector elements,
+// string characters, map keys, values received from a channel until it is
+// closed or values produced by a generator.
+func (e *Evaluator) iterate(iter Value, f func(Value)) {
+	switch iter := iter.(type) {
+	case *Vector:
+		for i := 0; i < len(iter.Elems); i++ {
+			f(iter.Elems[i])
+		}
+	case *String:
+		for _, r := range iter.Value {
+			f(e.newString(string(r)))
+		}
+	case *Map:
+		for _, key := range iter.Pairs.Keys() {
+			f(key)
+		}
+	case *Channel:
+		for {
+			value, ok := e.recvChannel(iter)
+			if !ok {
+				return
+			}
+			f(value)
+		}
+	case *Generator:
+		for {
+			value := e.resumeGenerator(iter, e.globalNull())
+			if iter.state == genDone {
+				return
+			}
+			f(value)
+		}
+	default:
+		e.panicException("'%s' is not iterable", iter.Type())
+	}
+}
@@ -0,0 +1,237 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/* == json ================================================================== */
+
+func newJsonModule() *Module {
+	store := map[string]Value{
+		"parse": &Native{
+			Name:  "parse",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				text, ok := args[0].(*String)
+				if !ok {
+					e.panicException("non string agrument")
+				}
+				return e.parseJSON(text.Value)
+			},
+		},
+		"stringify": &Native{
+			Name:     "stringify",
+			Arity:    1,
+			Optional: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				indent := ""
+				switch arg := optionalArg(args, 1).(type) {
+				case nil, *Null:
+				case *Number:
+					indent = strings.Repeat(" ", max(int(arg.Value), 0))
+				case *String:
+					indent = arg.Value
+				default:
+					e.panicException("indent must be a number or a string")
+				}
+				s := &jsonWriter{e: e, indent: indent, seen: map[Value]bool{}}
+				s.value(args[0], 0)
+				return e.newString(s.str.String())
+			},
+		},
+	}
+	return &Module{Store: store}
+}
+
+// parseJSON returns the value of a JSON text: objects are maps with
+// string keys, arrays are vectors.
+func (e *Evaluator) parseJSON(text string) Value {
+	var data any
+	err := json.Unmarshal([]byte(text), &data)
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return e.fromJSON(data)
+	case errors.As(err, &syntaxErr) && strings.HasPrefix(syntaxErr.Error(), "unexpected end"):
+		e.jsonError(text, len(text), "unexpected end of input")
+	case errors.As(err, &syntaxErr):
+		// the offset is past the offending byte
+		e.jsonError(text, int(syntaxErr.Offset)-1, syntaxErr.Error())
+	case errors.As(err, &typeErr):
+		// the offset is past the number
+		number := strings.TrimPrefix(typeErr.Value, "number ")
+		e.jsonError(text, int(typeErr.Offset)-len(number), "number out of range")
+	default:
+		e.panicException(err)
+	}
+	return nil
+}
+
+// jsonError throws message with the line and column of the byte at
+// offset in text.
+func (e *Evaluator) jsonError(text string, offset int, message string) {
+	offset = max(min(offset, len(text)), 0)
+	before := text[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1
+	e.panicException("invalid JSON at line %d, column %d: %s", line, column, message)
+}
+
+func (e *Evaluator) fromJSON(data any) Value {
+	switch data := data.(type) {
+	case nil:
+		return e.globalNull()
+	case bool:
+		return e.globalBoolean(data)
+	case float64:
+		return e.newNumber(data)
+	case string:
+		return e.newString(data)
+	case []any:
+		elems := make([]Value, len(data))
+		for i, elem := range data {
+			elems[i] = e.fromJSON(elem)
+		}
+		return &Vector{Elems: elems}
+	case map[string]any:
+		pairs := newHashTable()
+		for key, value := range data {
+			pairs.Set(e.newString(key), e.fromJSON(value))
+		}
+		return &Map{Pairs: pairs}
+	}
+	panic(fmt.Sprintf("unexpected JSON value %T", data))
+}
+
+// jsonWriter writes values as JSON text, seen holds the vectors, maps and
+// instances being written to detect cycles.
+type jsonWriter struct {
+	e      *Evaluator
+	indent string // "" for compact output
+	seen   map[Value]bool
+	str    strings.Builder
+}
+
+func (w *jsonWriter) value(value Value, depth int) {
+	switch value := value.(type) {
+	case *Null:
+		w.str.WriteString("null")
+	case *Boolean:
+		w.str.WriteString(strconv.FormatBool(value.Value))
+	case *Number:
+		if math.IsNaN(value.Value) || math.IsInf(value.Value, 0) {
+			w.e.panicException("can't stringify %s", value.Say())
+		}
+		w.str.WriteString(strconv.FormatFloat(value.Value, 'g', -1, 64))
+	case *String:
+		w.quote(value.Value)
+	case *Vector:
+		w.enter(value)
+		w.str.WriteByte('[')
+		for i, elem := range value.Elems {
+			w.separate(i, depth+1)
+			w.value(elem, depth+1)
+		}
+		w.close(len(value.Elems), depth, ']')
+		delete(w.seen, value)
+	case *Map:
+		w.enter(value)
+		keys := map[string]Value{}
+		for _, key := range value.Pairs.Keys() {
+			// 1 and "1" are different keys of a map but not of an object
+			if _, ok := keys[sprint(key)]; ok {
+				w.e.panicException("two keys of the map stringify to %s", strconv.Quote(sprint(key)))
+			}
+			keys[sprint(key)] = key
+		}
+		names := slices.Sorted(maps.Keys(keys))
+		w.str.WriteByte('{')
+		for i, name := range names {
+			w.separate(i, depth+1)
+			w.quote(name)
+			w.str.WriteByte(':')
+			if w.indent != "" {
+				w.str.WriteByte(' ')
+			}
+			elem, _ := value.Pairs.Get(keys[name])
+			w.value(elem, depth+1)
+		}
+		w.close(len(names), depth, '}')
+		delete(w.seen, value)
+	case *Instance:
+		fun, ok := value.Class.Funs["to_json"]
+		if !ok {
+			w.e.panicException("can't stringify an instance of %s without 'to_json'", anon(value.Class.Name))
+		}
+		w.enter(value)
+		w.value(w.e.call(&Method{Function: fun, Self: value}, nil, nil), depth)
+		delete(w.seen, value)
+	default:
+		w.e.panicException("can't stringify a %s", value.Type())
+	}
+}
+
+// enter marks value as being written, it must not contain itself.
+func (w *jsonWriter) enter(value Value) {
+	if w.seen[value] {
+		w.e.panicException("can't stringify a cyclic value")
+	}
+	w.seen[value] = true
+}
+
+// separate starts the element i of an array or object.
+func (w *jsonWriter) separate(i, depth int) {
+	if i != 0 {
+		w.str.WriteByte(',')
+	}
+	w.newline(depth)
+}
+
+// close ends an array or object of n elements with end.
+func (w *jsonWriter) close(n, depth int, end byte) {
+	if n != 0 {
+		w.newline(depth)
+	}
+	w.str.WriteByte(end)
+}
+
+func (w *jsonWriter) newline(depth int) {
+	if w.indent != "" {
+		w.str.WriteByte('\n')
+		w.str.WriteString(strings.Repeat(w.indent, depth))
+	}
+}
+
+func (w *jsonWriter) quote(s string) {
+	w.str.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			w.str.WriteString(`\"`)
+		case '\\':
+			w.str.WriteString(`\\`)
+		case '\n':
+			w.str.WriteString(`\n`)
+		case '\r':
+			w.str.WriteString(`\r`)
+		case '\t':
+			w.str.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&w.str, `\u%04x`, r)
+			} else {
+				w.str.WriteRune(r)
+			}
+		}
+	}
+	w.str.WriteByte('"')
+}
@@ -0,0 +1,108 @@
+package evaluator
+
+import "math"
+
+/* == math ================================================================== */
+
+func newMathModule() *Module {
+	// unary makes the native of a function of one number
+	unary := func(name string, f func(float64) float64) *Native {
+		return &Native{
+			Name:  name,
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				return e.newNumber(f(e.numberArg(args[0])))
+			},
+		}
+	}
+	// binary makes the native of a function of two numbers
+	binary := func(name string, f func(float64, float64) float64) *Native {
+		return &Native{
+			Name:  name,
+			Arity: 2,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				return e.newNumber(f(e.numberArg(args[0]), e.numberArg(args[1])))
+			},
+		}
+	}
+	// fold makes the native of a function of one or more numbers
+	fold := func(name string, f func(float64, float64) float64) *Native {
+		return &Native{
+			Name:     name,
+			Arity:    1,
+			Variadic: true,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				result := e.numberArg(args[0])
+				for _, arg := range args[1:] {
+					result = f(result, e.numberArg(arg))
+				}
+				return e.newNumber(result)
+			},
+		}
+	}
+	store := map[string]Value{
+		"PI":    newNumber(math.Pi),
+		"E":     newNumber(math.E),
+		"INF":   newNumber(math.Inf(1)),
+		"NAN":   newNumber(math.NaN()),
+		"pow":   binary("pow", math.Pow),
+		"sqrt":  unary("sqrt", math.Sqrt),
+		"sin":   unary("sin", math.Sin),
+		"cos":   unary("cos", math.Cos),
+		"tan":   unary("tan", math.Tan),
+		"asin":  unary("asin", math.Asin),
+		"acos":  unary("acos", math.Acos),
+		"atan":  unary("atan", math.Atan),
+		"atan2": binary("atan2", math.Atan2),
+		"hypot": binary("hypot", math.Hypot),
+		"exp":   unary("exp", math.Exp),
+		"log": &Native{
+			Name:     "log",
+			Arity:    1,
+			Optional: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				x := math.Log(e.numberArg(args[0]))
+				if len(args) == 2 {
+					x /= math.Log(e.numberArg(args[1]))
+				}
+				return e.newNumber(x)
+			},
+		},
+		"log2":  unary("log2", math.Log2),
+		"log10": unary("log10", math.Log10),
+		"floor": unary("floor", math.Floor),
+		"ceil":  unary("ceil", math.Ceil),
+		"round": unary("round", math.Round),
+		"trunc": unary("trunc", math.Trunc),
+		"abs":   unary("abs", math.Abs),
+		"min":   fold("min", math.Min),
+		"max":   fold("max", math.Max),
+		"clamp": &Native{
+			Name:  "clamp",
+			Arity: 3,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				x, lo, hi := e.numberArg(args[0]), e.numberArg(args[1]), e.numberArg(args[2])
+				if lo > hi {
+					e.panicException("clamp bounds out of order")
+				}
+				return e.newNumber(math.Min(math.Max(x, lo), hi))
+			},
+		},
+		"is_nan": &Native{
+			Name:  "is_nan",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				return e.globalBoolean(math.IsNaN(e.numberArg(args[0])))
+			},
+		},
+		"is_finite": &Native{
+			Name:  "is_finite",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				x := e.numberArg(args[0])
+				return e.globalBoolean(!math.IsNaN(x) && !math.IsInf(x, 0))
+			},
+		},
+	}
+	return &Module{Store: store}
+}
@@ -1,42 +1,149 @@
 package evaluator
 
-import "math"
+import (
+	"maps"
+	"os"
+	"slices"
+)
 
 func newBaseModules() map[string]*Module {
 	mods := map[string]*Module{
-		"math": newMathModule(),
+		"math":    newMathModule(),
+		"test":    newTestModule(),
+		"os":      newOsModule(),
+		"json":    newJsonModule(),
+		"fs":      newFsModule(),
+		"process": newProcessModule(),
+		"re":      newReModule(),
+		"time":    newTimeModule(),
+		"random":  newRandomModule(),
 	}
 	return mods
 }
 
-func newMathModule() *Module {
+func newOsModule() *Module {
 	store := map[string]Value{
-		"PI": &Number{Value: math.Pi},
-		"pow": &Native{
-			Name:  "pow",
+		"args": &Vector{Elems: []Value{}},
+		"env": &Native{
+			Name:     "env",
+			Arity:    1,
+			Optional: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				name, ok := args[0].(*String)
+				if !ok {
+					e.panicException("non string agrument")
+				}
+				if value, ok := os.LookupEnv(name.Value); ok {
+					return e.newString(value)
+				}
+				if len(args) == 2 {
+					return args[1]
+				}
+				return e.globalNull()
+			},
+		},
+		"set_env": &Native{
+			Name:  "set_env",
 			Arity: 2,
 			Function: func(e *Evaluator, self Value, args ...Value) Value {
-				if args[0].Type() != VAL_NUMBER ||
-					args[1].Type() != VAL_NUMBER {
-					e.panicException("non number agrument")
+				name, ok := args[0].(*String)
+				if !ok {
+					e.panicException("non string agrument")
+				}
+				if args[1].Type() == VAL_NULL {
+					os.Unsetenv(name.Value)
+					return e.globalNull()
+				}
+				if err := os.Setenv(name.Value, sprint(args[1])); err != nil {
+					e.panicException(err)
 				}
-				return &Number{
-					Value: math.Pow(
-						args[0].(*Number).Value, args[1].(*Number).Value,
-					),
+				return e.globalNull()
+			},
+		},
+		"exit": &Native{
+			Name:     "exit",
+			Arity:    0,
+			Optional: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				code := 0
+				if len(args) == 1 {
+					n, ok := args[0].(*Number)
+					if !ok {
+						e.panicException("non number agrument")
+					}
+					code = int(n.Value)
+				}
+				panic(&Exit{Code: code})
+			},
+		},
+		"cwd": &Native{
+			Name:  "cwd",
+			Arity: 0,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				wd, err := os.Getwd()
+				if err != nil {
+					e.panicException(err)
 				}
+				return e.newString(wd)
 			},
 		},
-		"sqrt": &Native{
-			Name:  "sqrt",
-			Arity: 1,
+		"pid": &Native{
+			Name:  "pid",
+			Arity: 0,
 			Function: func(e *Evaluator, self Value, args ...Value) Value {
-				if args[0].Type() != VAL_NUMBER {
-					e.panicException("non number agrument")
+				return e.newNumber(float64(os.Getpid()))
+			},
+		},
+		"hostname": &Native{
+			Name:  "hostname",
+			Arity: 0,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				name, err := os.Hostname()
+				if err != nil {
+					e.panicException(err)
 				}
-				return &Number{Value: math.Sqrt(args[0].(*Number).Value)}
+				return e.newString(name)
 			},
 		},
 	}
 	return &Module{Store: store}
 }
+
+// stringArg returns the string of an argument, it throws if the argument
+// is not a string.
+func (e *Evaluator) stringArg(value Value) string {
+	s, ok := value.(*String)
+	if !ok {
+		e.panicException("non string agrument")
+	}
+	return s.Value
+}
+
+// numberArg returns the number of an argument, it throws if the argument
+// is not a number.
+func (e *Evaluator) numberArg(value Value) float64 {
+	n, ok := value.(*Number)
+	if !ok {
+		e.panicException("non number agrument")
+	}
+	return n.Value
+}
+
+// vectorArg returns the vector of an argument, it throws if the argument
+// is not a vector.
+func (e *Evaluator) vectorArg(value Value) *Vector {
+	v, ok := value.(*Vector)
+	if !ok {
+		e.panicException("non vector agrument")
+	}
+	return v
+}
+
+// ModuleNames returns the names exported by the builtin module name.
+func ModuleNames(name string) ([]string, bool) {
+	mod, ok := newBaseModules()[name]
+	if !ok {
+		return nil, false
+	}
+	return slices.Collect(maps.Keys(mod.Store)), true
+}
@@ -0,0 +1,272 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+/* == process =============================================================== */
+
+// Process is a program started with 'process.spawn'.
+type Process struct {
+	Command string
+	cmd     *exec.Cmd
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stdin   *File
+	stdout  *File
+	stderr  *File
+	waited  bool
+	err     error // of the wait
+}
+
+func newProcessModule() *Module {
+	store := map[string]Value{
+		"run": &Native{
+			Name:     "run",
+			Arity:    1,
+			Optional: 2,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				e.assertUnsandboxed("'process'")
+				cmd, ctx, cancel := e.command(args)
+				defer cancel()
+				var stdout, stderr bytes.Buffer
+				cmd.Stdout, cmd.Stderr = &stdout, &stderr
+				if input := e.processOption(args, "stdin"); input != nil {
+					cmd.Stdin = strings.NewReader(e.stringArg(input))
+				}
+				var err error
+				e.blocking(func() { err = cmd.Run() })
+				e.checkExit(cmd, ctx, err)
+				result := newHashTable()
+				result.Set(e.newString("stdout"), e.newString(stdout.String()))
+				result.Set(e.newString("stderr"), e.newString(stderr.String()))
+				result.Set(e.newString("code"), e.newNumber(float64(cmd.ProcessState.ExitCode())))
+				return &Map{Pairs: result}
+			},
+		},
+		"spawn": &Native{
+			Name:     "spawn",
+			Arity:    1,
+			Optional: 2,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				e.assertUnsandboxed("'process'")
+				cmd, ctx, cancel := e.command(args)
+				p := &Process{Command: e.stringArg(args[0]), cmd: cmd, ctx: ctx, cancel: cancel}
+				// the ends the child uses, closed here once it has them, and
+				// the ends kept, closed too if the process can't start
+				child, parent := []*os.File{}, []*os.File{}
+				fail := func(err error) {
+					for _, f := range slices.Concat(child, parent) {
+						f.Close()
+					}
+					cancel()
+					e.panicException(err)
+				}
+				pipe := func(name string, write bool) *File {
+					r, w, err := os.Pipe()
+					if err != nil {
+						fail(err)
+					}
+					ours, theirs := r, w
+					if write {
+						ours, theirs = w, r
+					}
+					child, parent = append(child, theirs), append(parent, ours)
+					return newFile(name, ours)
+				}
+				p.stdin, p.stdout, p.stderr = pipe("stdin", true), pipe("stdout", false), pipe("stderr", false)
+				cmd.Stdin, cmd.Stdout, cmd.Stderr = child[0], child[1], child[2]
+				if err := cmd.Start(); err != nil {
+					fail(err)
+				}
+				for _, f := range child {
+					f.Close()
+				}
+				if e.globals.processes == nil {
+					e.globals.processes = map[*Process]bool{}
+				}
+				e.globals.processes[p] = true
+				return p
+			},
+		},
+	}
+	return &Module{Store: store}
+}
+
+// reapProcesses kills the processes spawned and never waited for, and
+// waits for them so none outlives the interpreter.
+func (e *Evaluator) reapProcesses() {
+	for p := range e.globals.processes {
+		killGroup(p.cmd)
+		p.stdin.file.Close()
+		e.blocking(func() { p.err = p.cmd.Wait() })
+		p.waited = true
+		p.cancel()
+		p.stdout.file.Close()
+		p.stderr.file.Close()
+	}
+	clear(e.globals.processes)
+}
+
+// processWaitDelay is how long a killed command has to close its output.
+const processWaitDelay = 100 * time.Millisecond
+
+// command returns the command of the arguments of 'run' and 'spawn': the
+// program, a vector of arguments and a map of options. The context ends
+// at the timeout option, if any.
+func (e *Evaluator) command(args []Value) (*exec.Cmd, context.Context, context.CancelFunc) {
+	name := e.stringArg(args[0])
+	argv := []string{}
+	if len(args) > 1 && args[1].Type() != VAL_NULL {
+		vec, ok := args[1].(*Vector)
+		if !ok {
+			e.panicException("arguments must be a vector")
+		}
+		for _, arg := range vec.Elems {
+			argv = append(argv, e.stringArg(arg))
+		}
+	}
+	dir := e.wd
+	if cwd := e.processOption(args, "cwd"); cwd != nil {
+		dir = absPath(e.wd, e.stringArg(cwd))
+	}
+	var env []string // nil inherits the environment
+	if option := e.processOption(args, "env"); option != nil {
+		vars, ok := option.(*Map)
+		if !ok {
+			e.panicException("env must be a map")
+		}
+		env = os.Environ()
+		for _, key := range vars.Pairs.Keys() {
+			prefix := sprint(key) + "="
+			env = slices.DeleteFunc(env, func(v string) bool { return strings.HasPrefix(v, prefix) })
+			if value, _ := vars.Pairs.Get(key); value.Type() != VAL_NULL {
+				env = append(env, prefix+sprint(value))
+			}
+		}
+	}
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if timeout := e.processOption(args, "timeout"); timeout != nil {
+		ms, ok := timeout.(*Number)
+		if !ok {
+			e.panicException("timeout must be a number")
+		}
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(ms.Value*float64(time.Millisecond)))
+	}
+	cmd := exec.CommandContext(ctx, name, argv...)
+	cmd.Dir, cmd.Env = dir, env
+	startGroup(cmd)
+	// once killed, don't wait for whatever still holds its output
+	cmd.WaitDelay = processWaitDelay
+	return cmd, ctx, cancel
+}
+
+// processOption returns the option name of the arguments of 'run' and
+// 'spawn', nil if it is not set.
+func (e *Evaluator) processOption(args []Value, name string) Value {
+	if len(args) < 3 || args[2].Type() == VAL_NULL {
+		return nil
+	}
+	options, ok := args[2].(*Map)
+	if !ok {
+		e.panicException("options must be a map")
+	}
+	value, err := options.Pairs.Get(e.newString(name))
+	if err != nil || value.Type() == VAL_NULL {
+		return nil
+	}
+	return value
+}
+
+// checkExit throws if the command couldn't run or was stopped by its
+// timeout. Exiting with a status is not an error.
+func (e *Evaluator) checkExit(cmd *exec.Cmd, ctx context.Context, err error) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		e.panicException("'%s' timed out", cmd.Args[0])
+	}
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		e.panicException(err)
+	}
+}
+
+// assertUnsandboxed throws if the script runs in a sandbox, what names
+// the refused feature.
+func (e *Evaluator) assertUnsandboxed(what string) {
+	if e.globals.sandbox != nil {
+		e.panicException("%s is disabled in the sandbox", what)
+	}
+}
+
+func newProcessClass() *Class {
+	funs := map[string]Value{
+		"stdin": &Native{
+			Name:  "stdin",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				return self0.(*Process).stdin
+			},
+		},
+		"stdout": &Native{
+			Name:  "stdout",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				return self0.(*Process).stdout
+			},
+		},
+		"stderr": &Native{
+			Name:  "stderr",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				return self0.(*Process).stderr
+			},
+		},
+		"pid": &Native{
+			Name:  "pid",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				return e.newNumber(float64(self0.(*Process).cmd.Process.Pid))
+			},
+		},
+		"wait": &Native{
+			Name:  "wait",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Process)
+				if !self.waited {
+					self.stdin.file.Close()
+					e.blocking(func() { self.err = self.cmd.Wait() })
+					self.waited = true
+					self.cancel()
+					delete(e.globals.processes, self)
+				}
+				e.checkExit(self.cmd, self.ctx, self.err)
+				return e.newNumber(float64(self.cmd.ProcessState.ExitCode()))
+			},
+		},
+		"kill": &Native{
+			Name:  "kill",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Process)
+				if self.waited {
+					return e.globalNull()
+				}
+				if err := killGroup(self.cmd); err != nil && !errors.Is(err, os.ErrProcessDone) && !errors.Is(err, syscall.ESRCH) {
+					e.panicException(err)
+				}
+				return e.globalNull()
+			},
+		},
+	}
+	inits := map[string]Value{}
+	return &Class{Inits: inits, Funs: funs}
+}
@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package evaluator
+
+import "os/exec"
+
+// Process groups are not supported here, only the command itself is
+// killed.
+
+func startGroup(cmd *exec.Cmd) {}
+
+func killGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,21 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package evaluator
+
+import (
+	"os/exec"
+
+	"golang.org/x/sys/unix"
+)
+
+// startGroup makes the command lead a process group of its own, so that
+// killing it reaches the programs it starts too.
+func startGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &unix.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return killGroup(cmd) }
+}
+
+// killGroup kills the process group of a command started with startGroup.
+func killGroup(cmd *exec.Cmd) error {
+	return unix.Kill(-cmd.Process.Pid, unix.SIGKILL)
+}
@@ -0,0 +1,215 @@
+package evaluator
+
+import (
+	"fmt"
+	"needle/internal/needle/ast"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/* == profile =============================================================== */
+
+// FuncID names a function in a profile, by name and by where it is
+// declared. Natives are declared nowhere, their File is empty.
+type FuncID struct {
+	Name   string
+	File   string
+	Line   int
+	Column int
+}
+
+// ScriptID stands for the code outside any function, at the root of
+// every stack.
+var ScriptID = FuncID{Name: "<script>"}
+
+// Sample is the time spent in one call stack.
+type Sample struct {
+	Stack []FuncID // innermost first, ending with ScriptID
+	Count int
+	Time  time.Duration
+}
+
+// Profile is what the evaluator records while profiling: every call,
+// and a sample of the call stack about every Period.
+type Profile struct {
+	Start    time.Time
+	Duration time.Duration
+	Period   time.Duration
+	Calls    map[FuncID]int
+	Samples  []*Sample
+}
+
+type profiler struct {
+	profile *Profile
+	due     atomic.Bool // set by the ticker, the evaluator samples when set
+	ticker  *time.Ticker
+	done    chan struct{}
+	last    time.Time
+	samples map[string]*Sample // by stack
+}
+
+// StartProfile makes the evaluator sample its call stack every period
+// until StopProfile. The samples are taken by the evaluating goroutine
+// between two nodes, a sample is weighted by the time since the last
+// one.
+func (e *Evaluator) StartProfile(period time.Duration) {
+	now := time.Now()
+	p := &profiler{
+		profile: &Profile{
+			Start:  now,
+			Period: period,
+			Calls:  map[FuncID]int{},
+		},
+		ticker:  time.NewTicker(period),
+		done:    make(chan struct{}),
+		last:    now,
+		samples: map[string]*Sample{},
+	}
+	go func() {
+		for {
+			select {
+			case <-p.ticker.C:
+				p.due.Store(true)
+			case <-p.done:
+				return
+			}
+		}
+	}()
+	e.globals.profiler = p
+}
+
+// StopProfile ends profiling and returns what was recorded, nil if
+// StartProfile was not called.
+func (e *Evaluator) StopProfile() *Profile {
+	p := e.globals.profiler
+	if p == nil {
+		return nil
+	}
+	e.globals.profiler = nil
+	p.ticker.Stop()
+	close(p.done)
+	p.profile.Duration = time.Since(p.profile.Start)
+	for _, sample := range p.samples {
+		p.profile.Samples = append(p.profile.Samples, sample)
+	}
+	return p.profile
+}
+
+// sample records the current call stack if the ticker asked for it.
+func (p *profiler) sample(e *Evaluator) {
+	if !p.due.CompareAndSwap(true, false) {
+		return
+	}
+	now := time.Now()
+	elapsed := now.Sub(p.last)
+	p.last = now
+	stack := []FuncID{}
+	var key strings.Builder
+	for _, fun := range e.stackTrace() {
+		id := funcID(fun)
+		stack = append(stack, id)
+		fmt.Fprintf(&key, "%s\x00%s\x00%d\x00%d\x00", id.Name, id.File, id.Line, id.Column)
+	}
+	stack = append(stack, ScriptID)
+	sample, ok := p.samples[key.String()]
+	if !ok {
+		sample = &Sample{Stack: stack}
+		p.samples[key.String()] = sample
+	}
+	sample.Count++
+	sample.Time += elapsed
+}
+
+func funcID(fun Value) FuncID {
+	switch fun := fun.(type) {
+	case *Function:
+		return FuncID{frameName(fun), fun.file, fun.pos.Line, fun.pos.Column}
+	case *Native:
+		return FuncID{Name: fun.Name}
+	}
+	return FuncID{Name: "(unknown)"}
+}
+
+/* == stats ================================================================= */
+
+// Stats counts what the evaluator did while collecting statistics.
+type Stats struct {
+	Nodes     map[string]int // evaluated nodes by type
+	Numbers   int64          // numbers allocated
+	Strings   int64          // strings allocated
+	PeakDepth int            // deepest call stack
+}
+
+type statsCollector struct {
+	stats *Stats
+	nodes map[reflect.Type]int
+}
+
+func newNumber(value float64) *Number {
+	return &Number{Value: value}
+}
+
+func newString(value string) *String {
+	return &String{Value: value}
+}
+
+// newNumber allocates a number, counting it while collecting stats.
+func (e *Evaluator) newNumber(value float64) *Number {
+	if c := e.globals.stats; c != nil {
+		c.stats.Numbers++
+	}
+	return newNumber(value)
+}
+
+// newString allocates a string, counting it while collecting stats.
+func (e *Evaluator) newString(value string) *String {
+	if c := e.globals.stats; c != nil {
+		c.stats.Strings++
+	}
+	return newString(value)
+}
+
+// StartStats makes the evaluator count nodes, allocations and call depth
+// until StopStats. Only the allocations of the evaluator and its tasks are
+// counted, not those of values built outside evaluation.
+func (e *Evaluator) StartStats() {
+	e.globals.stats = &statsCollector{
+		stats: &Stats{Nodes: map[string]int{}},
+		nodes: map[reflect.Type]int{},
+	}
+}
+
+// StopStats returns the counts since StartStats, nil if it was not
+// called.
+func (e *Evaluator) StopStats() *Stats {
+	c := e.globals.stats
+	if c == nil {
+		return nil
+	}
+	e.globals.stats = nil
+	for t, n := range c.nodes {
+		c.stats.Nodes[t.Elem().Name()] = n
+	}
+	return c.stats
+}
+
+// alloc counts value if it is a number or a string, for the operators
+// that allocate without an evaluator at hand.
+func (c *statsCollector) alloc(value Value) {
+	switch value.(type) {
+	case *Number:
+		c.stats.Numbers++
+	case *String:
+		c.stats.Strings++
+	}
+}
+
+func (c *statsCollector) node(node ast.Node) {
+	c.nodes[reflect.TypeOf(node)]++
+}
+
+func (c *statsCollector) call(e *Evaluator) {
+	c.stats.PeakDepth = max(c.stats.PeakDepth, e.callStack.Length())
+}
@@ -0,0 +1,98 @@
+package evaluator
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+/* == random ================================================================ */
+
+// newRandom returns a generator seeded with seed, or randomly if seed is
+// nil.
+func newRandom(seed *uint64) *rand.Rand {
+	if seed == nil {
+		return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	return rand.New(rand.NewPCG(*seed, 0))
+}
+
+func newRandomModule() *Module {
+	store := map[string]Value{
+		"seed": &Native{
+			Name:  "seed",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				seed := uint64(int64(e.numberArg(args[0])))
+				e.globals.random = newRandom(&seed)
+				return e.globalNull()
+			},
+		},
+		"int": &Native{
+			Name:  "int",
+			Arity: 2,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				lo, hi := math.Ceil(e.numberArg(args[0])), math.Floor(e.numberArg(args[1]))
+				// numbers are exact integers up to 2^53, and the span fits int64
+				for _, bound := range []float64{lo, hi} {
+					if math.IsNaN(bound) || math.Abs(bound) > 1<<53 {
+						e.panicException("bounds must be integers within ±2^53")
+					}
+				}
+				if lo > hi {
+					e.panicException("empty range")
+				}
+				span := int64(hi) - int64(lo) + 1
+				return e.newNumber(float64(int64(lo) + e.globals.random.Int64N(span)))
+			},
+		},
+		"float": &Native{
+			Name:  "float",
+			Arity: 0,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				return e.newNumber(e.globals.random.Float64())
+			},
+		},
+		"choice": &Native{
+			Name:  "choice",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				elems := e.vectorArg(args[0]).Elems
+				if len(elems) == 0 {
+					e.panicException("choice from an empty vector")
+				}
+				return elems[e.globals.random.IntN(len(elems))]
+			},
+		},
+		"shuffle": &Native{
+			Name:  "shuffle",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				elems := e.vectorArg(args[0]).Elems
+				e.globals.random.Shuffle(len(elems), func(i, j int) {
+					elems[i], elems[j] = elems[j], elems[i]
+				})
+				return e.globalNull()
+			},
+		},
+		"sample": &Native{
+			Name:  "sample",
+			Arity: 2,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				elems := e.vectorArg(args[0]).Elems
+				k := int(e.numberArg(args[1]))
+				if k < 0 || k > len(elems) {
+					e.panicException("sample of %d out of %d elements", k, len(elems))
+				}
+				// a partial shuffle of a copy, the first k are the sample
+				picked := slices.Clone(elems)
+				for i := range k {
+					j := i + e.globals.random.IntN(len(picked)-i)
+					picked[i], picked[j] = picked[j], picked[i]
+				}
+				return &Vector{Elems: picked[:k]}
+			},
+		},
+	}
+	return &Module{Store: store}
+}
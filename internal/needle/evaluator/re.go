@@ -0,0 +1,184 @@
+package evaluator
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+/* == re ==================================================================== */
+
+// Regex is a pattern compiled with 're.compile'.
+type Regex struct {
+	re    *regexp.Regexp
+	whole *regexp.Regexp // re preferring the longest match, for 'match'
+}
+
+func newReModule() *Module {
+	store := map[string]Value{
+		"compile": &Native{
+			Name:  "compile",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				return e.compileRegex(e.stringArg(args[0]))
+			},
+		},
+	}
+	return &Module{Store: store}
+}
+
+func (e *Evaluator) compileRegex(pattern string) *Regex {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		e.panicException("invalid pattern: %s", strings.TrimPrefix(err.Error(), "error parsing regexp: "))
+	}
+	// the leftmost-longest match covers all of a text if any match does
+	whole := regexp.MustCompile(pattern)
+	whole.Longest()
+	return &Regex{re: re, whole: whole}
+}
+
+// regexArg returns the regex of an argument, compiling it if it is a
+// string.
+func (e *Evaluator) regexArg(value Value) *Regex {
+	if re, ok := value.(*Regex); ok {
+		return re
+	}
+	return e.compileRegex(e.stringArg(value))
+}
+
+// regexMatch returns the map of a match of re in text: its text, start
+// and end in characters, the vector of its groups and the map of its
+// named groups. Groups that didn't take part are null.
+func (e *Evaluator) regexMatch(re *regexp.Regexp, text string, loc []int) *Map {
+	group := func(i int) Value {
+		if loc[2*i] < 0 {
+			return e.globalNull()
+		}
+		return e.newString(text[loc[2*i]:loc[2*i+1]])
+	}
+	groups := &Vector{Elems: []Value{}}
+	named := newHashTable()
+	for i, name := range re.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		groups.Elems = append(groups.Elems, group(i))
+		if name != "" {
+			named.Set(e.newString(name), group(i))
+		}
+	}
+	start := utf8.RuneCountInString(text[:loc[0]])
+	pairs := newHashTable()
+	pairs.Set(e.newString("text"), group(0))
+	pairs.Set(e.newString("start"), e.newNumber(float64(start)))
+	pairs.Set(e.newString("end"), e.newNumber(float64(start+utf8.RuneCountInString(text[loc[0]:loc[1]]))))
+	pairs.Set(e.newString("groups"), groups)
+	pairs.Set(e.newString("named"), &Map{Pairs: named})
+	return &Map{Pairs: pairs}
+}
+
+func newRegexClass() *Class {
+	funs := map[string]Value{
+		"pattern": &Native{
+			Name:  "pattern",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				return e.newString(self0.(*Regex).re.String())
+			},
+		},
+		"match": &Native{
+			Name:  "match",
+			Arity: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Regex)
+				text := e.stringArg(args[0])
+				loc := self.whole.FindStringSubmatchIndex(text)
+				if loc != nil && loc[0] == 0 && loc[1] == len(text) {
+					return e.regexMatch(self.re, text, loc)
+				}
+				return e.globalNull()
+			},
+		},
+		"find": &Native{
+			Name:  "find",
+			Arity: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Regex)
+				text := e.stringArg(args[0])
+				loc := self.re.FindStringSubmatchIndex(text)
+				if loc == nil {
+					return e.globalNull()
+				}
+				return e.regexMatch(self.re, text, loc)
+			},
+		},
+		"find_all": &Native{
+			Name:     "find_all",
+			Arity:    1,
+			Optional: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Regex)
+				text, n := e.stringArg(args[0]), -1
+				if len(args) == 2 {
+					limit, ok := args[1].(*Number)
+					if !ok {
+						e.panicException("non number agrument")
+					}
+					n = int(limit.Value)
+				}
+				matches := &Vector{Elems: []Value{}}
+				for _, loc := range self.re.FindAllStringSubmatchIndex(text, n) {
+					matches.Elems = append(matches.Elems, e.regexMatch(self.re, text, loc))
+				}
+				return matches
+			},
+		},
+		"replace": &Native{
+			Name:  "replace",
+			Arity: 2,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Regex)
+				text := e.stringArg(args[0])
+				if template, ok := args[1].(*String); ok {
+					return e.newString(self.re.ReplaceAllString(text, template.Value))
+				}
+				var out []byte
+				last := 0
+				for _, loc := range self.re.FindAllStringSubmatchIndex(text, -1) {
+					replacement, ok := e.call(args[1], []Value{e.regexMatch(self.re, text, loc)}, nil).(*String)
+					if !ok {
+						e.panicException("replacement must be a string")
+					}
+					out = append(out, text[last:loc[0]]...)
+					out = append(out, replacement.Value...)
+					last = loc[1]
+				}
+				return e.newString(string(append(out, text[last:]...)))
+			},
+		},
+		"split": &Native{
+			Name:     "split",
+			Arity:    1,
+			Optional: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				self := self0.(*Regex)
+				text, n := e.stringArg(args[0]), -1
+				if len(args) == 2 {
+					limit, ok := args[1].(*Number)
+					if !ok {
+						e.panicException("non number agrument")
+					}
+					n = int(limit.Value)
+				}
+				parts := &Vector{Elems: []Value{}}
+				for _, part := range self.re.Split(text, n) {
+					parts.Elems = append(parts.Elems, e.newString(part))
+				}
+				return parts
+			},
+		},
+	}
+	inits := map[string]Value{}
+	return &Class{Inits: inits, Funs: funs}
+}
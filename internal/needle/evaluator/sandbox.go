@@ -0,0 +1,65 @@
+package evaluator
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+/* == sandbox =============================================================== */
+
+// sandbox confines a script: the 'fs' module only reaches the files under
+// roots and the 'process' module is disabled.
+type sandbox struct {
+	roots []string // absolute, without symbolic links
+}
+
+// SetSandbox confines the script to the files under roots, relative to
+// the working directory, and disables running other programs. No roots
+// leaves the script without any file.
+func (e *Evaluator) SetSandbox(roots []string) {
+	sb := &sandbox{roots: []string{}}
+	for _, root := range roots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		sb.roots = append(sb.roots, realPath(abs))
+	}
+	e.globals.sandbox = sb
+}
+
+// allows tells whether the absolute path is under one of the roots.
+func (sb *sandbox) allows(path string) bool {
+	path = realPath(path)
+	for _, root := range sb.roots {
+		rel, err := filepath.Rel(root, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// realPath returns path with its symbolic links resolved, as far as it
+// exists.
+func realPath(path string) string {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	return filepath.Join(realPath(parent), filepath.Base(path))
+}
+
+// path returns the absolute path of a path argument, relative to the
+// working directory of the module. It throws if the sandbox doesn't
+// allow it.
+func (e *Evaluator) path(value Value) string {
+	path := filepath.Clean(absPath(e.wd, e.stringArg(value)))
+	if sb := e.globals.sandbox; sb != nil && !sb.allows(path) {
+		e.panicException("'%s' is outside the sandbox", path)
+	}
+	return path
+}
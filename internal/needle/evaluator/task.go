@@ -0,0 +1,231 @@
+package evaluator
+
+import (
+	"reflect"
+	"runtime"
+	"time"
+)
+
+// switchInterval is the number of loop iterations and calls a task runs
+// before it lets other tasks take the lock.
+const switchInterval = 512
+
+// Task is a function call running on its own goroutine with a forked
+// evaluator. Globals, classes and modules are shared with the spawner.
+type Task struct {
+	Function Value
+	done     chan struct{}
+	result   Value
+	panic    any
+}
+
+// Channel passes values between tasks. Closing it closes quit, never ch,
+// so closing can't race with a send blocked on ch.
+type Channel struct {
+	ch     chan Value
+	quit   chan struct{}
+	closed bool
+}
+
+func newChannel(size int) *Channel {
+	return &Channel{ch: make(chan Value, size), quit: make(chan struct{})}
+}
+
+func (e *Evaluator) spawn(
+	callee Value, args []Value, named map[string]Value,
+) *Task {
+	switch callee.(type) {
+	case *Method, *Function, *Native:
+	default:
+		e.panicException("call not callable")
+	}
+	task := &Task{
+		Function: callee,
+		done:     make(chan struct{}),
+	}
+	ev := e.fork()
+	e.globals.tasks.Add(1)
+	go func() {
+		defer close(task.done)
+		defer e.globals.tasks.Add(-1)
+		ev.globals.lock.Lock()
+		defer ev.globals.lock.Unlock()
+		defer func() {
+			if r := recover(); r != nil {
+				task.panic = r
+			}
+		}()
+		task.result = ev.call(callee, args, named)
+	}()
+	return task
+}
+
+// blocking runs f with the lock released, so other tasks can progress
+// while the current one waits.
+func (e *Evaluator) blocking(f func()) {
+	e.globals.lock.Unlock()
+	defer e.globals.lock.Lock()
+	f()
+}
+
+// checkpoint periodically hands the lock over to other running tasks.
+func (e *Evaluator) checkpoint() {
+	if e.globals.tasks.Load() == 0 {
+		return
+	}
+	e.ticks++
+	if e.ticks%switchInterval != 0 {
+		return
+	}
+	e.blocking(runtime.Gosched)
+}
+
+func (e *Evaluator) joinTask(t *Task) Value {
+	e.blocking(func() { <-t.done })
+	if t.panic != nil {
+		panic(t.panic)
+	}
+	if t.result == nil {
+		return e.globalNull()
+	}
+	return t.result
+}
+
+func (e *Evaluator) sendChannel(c *Channel, value Value) {
+	if c.closed {
+		e.panicException("send on closed channel")
+	}
+	sent := false
+	e.blocking(func() {
+		select {
+		case c.ch <- value:
+			sent = true
+		case <-c.quit:
+		}
+	})
+	if !sent {
+		e.panicException("send on closed channel")
+	}
+}
+
+// recvChannel returns null once the channel is closed and drained.
+func (e *Evaluator) recvChannel(c *Channel) (Value, bool) {
+	var value Value
+	var ok bool
+	e.blocking(func() {
+		select {
+		case value, ok = <-c.ch:
+		case <-c.quit:
+			value, ok = c.drain()
+		}
+	})
+	if !ok {
+		return e.globalNull(), false
+	}
+	return value, true
+}
+
+// drain returns a value left in a closed channel, if any.
+func (c *Channel) drain() (Value, bool) {
+	select {
+	case value := <-c.ch:
+		return value, true
+	default:
+		return nil, false
+	}
+}
+
+func (e *Evaluator) closeChannel(c *Channel) {
+	if c.closed {
+		e.panicException("close of closed channel")
+	}
+	c.closed = true
+	close(c.quit)
+}
+
+// selectChannels waits on several channel operations at once. A case is
+// a channel to receive from or 'vec{channel, value}' to send to. It returns
+// 'vec{index, value}' of the completed case, or null after the timeout.
+func (e *Evaluator) selectChannels(cases []Value, timeout Value) Value {
+	// every case is followed by the quit of its channel
+	sel := []reflect.SelectCase{}
+	channels := []*Channel{}
+	for _, c := range cases {
+		switch c := c.(type) {
+		case *Channel:
+			sel = append(sel, reflect.SelectCase{
+				Dir:  reflect.SelectRecv,
+				Chan: reflect.ValueOf(c.ch),
+			})
+			channels = append(channels, c)
+		case *Vector:
+			if len(c.Elems) != 2 {
+				e.panicException("send case must be vec{channel, value}")
+			}
+			ch, ok := c.Elems[0].(*Channel)
+			if !ok {
+				e.panicException("send case must be vec{channel, value}")
+			}
+			if ch.closed {
+				e.panicException("send on closed channel")
+			}
+			sel = append(sel, reflect.SelectCase{
+				Dir:  reflect.SelectSend,
+				Chan: reflect.ValueOf(ch.ch),
+				Send: reflect.ValueOf(&c.Elems[1]).Elem(),
+			})
+			channels = append(channels, ch)
+		default:
+			e.panicException("expected channel case, got '%s'", c.Type())
+		}
+		sel = append(sel, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(channels[len(channels)-1].quit),
+		})
+	}
+	if timeout != nil {
+		ms, ok := timeout.(*Number)
+		if !ok {
+			e.panicException("non number timeout")
+		}
+		after := time.After(time.Duration(ms.Value * float64(time.Millisecond)))
+		sel = append(sel, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(after),
+		})
+	}
+	var chosen int
+	var recv reflect.Value
+	var recvOK bool
+	e.blocking(func() { chosen, recv, recvOK = reflect.Select(sel) })
+	if chosen == len(sel)-1 && timeout != nil {
+		return e.globalNull()
+	}
+	op := sel[chosen/2*2]
+	var value Value = e.globalNull()
+	switch {
+	case chosen%2 == 1 && op.Dir == reflect.SelectSend:
+		e.panicException("send on closed channel")
+	case chosen%2 == 1:
+		// the channel is closed, receive what is left in it
+		if v, ok := channels[chosen/2].drain(); ok {
+			value = v
+		}
+	case op.Dir == reflect.SelectRecv && recvOK:
+		value = recv.Interface().(Value)
+	}
+	return &Vector{Elems: []Value{
+		e.newNumber(float64(chosen / 2)),
+		value,
+	}}
+}
+
+func (e *Evaluator) sleep(ms Value) {
+	n, ok := ms.(*Number)
+	if !ok {
+		e.panicException("non number agrument")
+	}
+	e.blocking(func() {
+		time.Sleep(time.Duration(n.Value * float64(time.Millisecond)))
+	})
+}
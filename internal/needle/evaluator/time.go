@@ -0,0 +1,612 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"needle/internal/needle/token"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // for systems without a zoneinfo database
+	"unicode"
+)
+
+/* == time ================================================================== */
+
+// DateTime is an instant in a time zone.
+type DateTime struct {
+	Value time.Time
+}
+
+// Duration is the time between two instants.
+type Duration struct {
+	Value time.Duration
+}
+
+// monotonicStart is where 'time.monotonic' counts from.
+var monotonicStart = time.Now()
+
+func newTimeModule() *Module {
+	store := map[string]Value{
+		"now": &Native{
+			Name:  "now",
+			Arity: 0,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				return &DateTime{Value: time.Now()}
+			},
+		},
+		"monotonic": &Native{
+			Name:  "monotonic",
+			Arity: 0,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				return e.newNumber(time.Since(monotonicStart).Seconds())
+			},
+		},
+		"sleep": &Native{
+			Name:  "sleep",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				e.sleep(args[0])
+				return e.globalNull()
+			},
+		},
+		"date": &Native{
+			Name:     "date",
+			Arity:    3,
+			Optional: 4,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				fields := [6]float64{}
+				for i := 0; i < len(args) && i < len(fields); i++ {
+					n, ok := args[i].(*Number)
+					if !ok {
+						e.panicException("non number agrument")
+					}
+					fields[i] = n.Value
+				}
+				loc := time.Local
+				if len(args) == 7 {
+					loc = e.location(args[6])
+				}
+				sec := int(fields[5])
+				nsec := int((fields[5] - float64(sec)) * 1e9)
+				t := time.Date(int(fields[0]), time.Month(fields[1]), int(fields[2]),
+					int(fields[3]), int(fields[4]), sec, nsec, loc)
+				return &DateTime{Value: t}
+			},
+		},
+		"unix": &Native{
+			Name:     "unix",
+			Arity:    1,
+			Optional: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				n, ok := args[0].(*Number)
+				if !ok {
+					e.panicException("non number agrument")
+				}
+				loc := time.Local
+				if len(args) == 2 {
+					loc = e.location(args[1])
+				}
+				sec := math.Floor(n.Value)
+				nsec := math.Round((n.Value - sec) * 1e9)
+				return &DateTime{Value: time.Unix(int64(sec), int64(nsec)).In(loc)}
+			},
+		},
+		"parse": &Native{
+			Name:     "parse",
+			Arity:    2,
+			Optional: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				text, layout := e.stringArg(args[0]), e.stringArg(args[1])
+				loc := time.Local
+				if len(args) == 3 {
+					loc = e.location(args[2])
+				}
+				t, err := strptime(text, layout, loc)
+				if err != nil {
+					e.panicException(err)
+				}
+				return &DateTime{Value: t}
+			},
+		},
+		"duration": &Native{
+			Name:  "duration",
+			Arity: 1,
+			Function: func(e *Evaluator, self Value, args ...Value) Value {
+				switch arg := args[0].(type) {
+				case *Number:
+					return &Duration{Value: time.Duration(arg.Value * float64(time.Millisecond))}
+				case *String:
+					d, err := time.ParseDuration(arg.Value)
+					if err != nil {
+						e.panicException("invalid duration '%s'", arg.Value)
+					}
+					return &Duration{Value: d}
+				}
+				e.panicException("expected number or string")
+				return nil
+			},
+		},
+	}
+	return &Module{Store: store}
+}
+
+// location returns the time zone named by a string argument: "UTC",
+// "Local" or a name of the IANA database such as "Europe/Paris".
+func (e *Evaluator) location(value Value) *time.Location {
+	name := e.stringArg(value)
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		e.panicException("unknown time zone '%s'", name)
+	}
+	return loc
+}
+
+var dateTimeBinOps = map[token.TokenType]binOp{
+	token.PLUS: func(v1, v2 Value) (Value, error) {
+		d, ok := v2.(*Duration)
+		if !ok {
+			return nil, errors.New("expected duration")
+		}
+		return &DateTime{Value: v1.(*DateTime).Value.Add(d.Value)}, nil
+	},
+	token.MINUS: func(v1, v2 Value) (Value, error) {
+		switch v2 := v2.(type) {
+		case *Duration:
+			return &DateTime{Value: v1.(*DateTime).Value.Add(-v2.Value)}, nil
+		case *DateTime:
+			return &Duration{Value: v1.(*DateTime).Value.Sub(v2.Value)}, nil
+		}
+		return nil, errors.New("expected datetime or duration")
+	},
+	token.EQ: func(v1, v2 Value) (Value, error) {
+		t, ok := v2.(*DateTime)
+		return &Boolean{Value: ok && v1.(*DateTime).Value.Equal(t.Value)}, nil
+	},
+	token.NE: func(v1, v2 Value) (Value, error) {
+		t, ok := v2.(*DateTime)
+		return &Boolean{Value: !ok || !v1.(*DateTime).Value.Equal(t.Value)}, nil
+	},
+	token.LT: compareDateTimes(func(c int) bool { return c < 0 }),
+	token.LE: compareDateTimes(func(c int) bool { return c <= 0 }),
+	token.GT: compareDateTimes(func(c int) bool { return c > 0 }),
+	token.GE: compareDateTimes(func(c int) bool { return c >= 0 }),
+}
+
+func compareDateTimes(test func(int) bool) binOp {
+	return func(v1, v2 Value) (Value, error) {
+		t, ok := v2.(*DateTime)
+		if !ok {
+			return nil, errors.New("expected datetime")
+		}
+		return &Boolean{Value: test(v1.(*DateTime).Value.Compare(t.Value))}, nil
+	}
+}
+
+var durationBinOps = map[token.TokenType]binOp{
+	token.PLUS: func(v1, v2 Value) (Value, error) {
+		d, ok := v2.(*Duration)
+		if !ok {
+			return nil, errors.New("expected duration")
+		}
+		return &Duration{Value: v1.(*Duration).Value + d.Value}, nil
+	},
+	token.MINUS: func(v1, v2 Value) (Value, error) {
+		d, ok := v2.(*Duration)
+		if !ok {
+			return nil, errors.New("expected duration")
+		}
+		return &Duration{Value: v1.(*Duration).Value - d.Value}, nil
+	},
+	token.STAR: func(v1, v2 Value) (Value, error) {
+		n, ok := v2.(*Number)
+		if !ok {
+			return nil, errors.New("expected number")
+		}
+		return &Duration{Value: time.Duration(float64(v1.(*Duration).Value) * n.Value)}, nil
+	},
+	token.SLASH: func(v1, v2 Value) (Value, error) {
+		switch v2 := v2.(type) {
+		case *Number:
+			if v2.Value == 0 {
+				return nil, errors.New("division by zero")
+			}
+			return &Duration{Value: time.Duration(float64(v1.(*Duration).Value) / v2.Value)}, nil
+		case *Duration:
+			if v2.Value == 0 {
+				return nil, errors.New("division by zero")
+			}
+			return newNumber(float64(v1.(*Duration).Value) / float64(v2.Value)), nil
+		}
+		return nil, errors.New("expected number or duration")
+	},
+	token.EQ: func(v1, v2 Value) (Value, error) {
+		d, ok := v2.(*Duration)
+		return &Boolean{Value: ok && v1.(*Duration).Value == d.Value}, nil
+	},
+	token.NE: func(v1, v2 Value) (Value, error) {
+		d, ok := v2.(*Duration)
+		return &Boolean{Value: !ok || v1.(*Duration).Value != d.Value}, nil
+	},
+	token.LT: compareDurations(func(a, b time.Duration) bool { return a < b }),
+	token.LE: compareDurations(func(a, b time.Duration) bool { return a <= b }),
+	token.GT: compareDurations(func(a, b time.Duration) bool { return a > b }),
+	token.GE: compareDurations(func(a, b time.Duration) bool { return a >= b }),
+}
+
+func compareDurations(test func(a, b time.Duration) bool) binOp {
+	return func(v1, v2 Value) (Value, error) {
+		d, ok := v2.(*Duration)
+		if !ok {
+			return nil, errors.New("expected duration")
+		}
+		return &Boolean{Value: test(v1.(*Duration).Value, d.Value)}, nil
+	}
+}
+
+func newDateTimeClass() *Class {
+	field := func(name string, get func(t time.Time) float64) *Native {
+		return &Native{
+			Name:  name,
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				return e.newNumber(get(self0.(*DateTime).Value))
+			},
+		}
+	}
+	funs := map[string]Value{
+		"year":       field("year", func(t time.Time) float64 { return float64(t.Year()) }),
+		"month":      field("month", func(t time.Time) float64 { return float64(t.Month()) }),
+		"day":        field("day", func(t time.Time) float64 { return float64(t.Day()) }),
+		"hour":       field("hour", func(t time.Time) float64 { return float64(t.Hour()) }),
+		"minute":     field("minute", func(t time.Time) float64 { return float64(t.Minute()) }),
+		"second":     field("second", func(t time.Time) float64 { return float64(t.Second()) }),
+		"nanosecond": field("nanosecond", func(t time.Time) float64 { return float64(t.Nanosecond()) }),
+		"weekday":    field("weekday", func(t time.Time) float64 { return float64(t.Weekday()) }),
+		"year_day":   field("year_day", func(t time.Time) float64 { return float64(t.YearDay()) }),
+		"unix": field("unix", func(t time.Time) float64 {
+			return float64(t.Unix()) + float64(t.Nanosecond())/1e9
+		}),
+		"offset": field("offset", func(t time.Time) float64 {
+			_, offset := t.Zone()
+			return float64(offset)
+		}),
+		"zone": &Native{
+			Name:  "zone",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				return e.newString(self0.(*DateTime).Value.Location().String())
+			},
+		},
+		"in_zone": &Native{
+			Name:  "in_zone",
+			Arity: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				return &DateTime{Value: self0.(*DateTime).Value.In(e.location(args[0]))}
+			},
+		},
+		"utc": &Native{
+			Name:  "utc",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				return &DateTime{Value: self0.(*DateTime).Value.UTC()}
+			},
+		},
+		"format": &Native{
+			Name:  "format",
+			Arity: 1,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				text, err := strftime(self0.(*DateTime).Value, e.stringArg(args[0]))
+				if err != nil {
+					e.panicException(err)
+				}
+				return e.newString(text)
+			},
+		},
+		"to_string": &Native{
+			Name:  "to_string",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				return e.newString(self0.Say())
+			},
+		},
+	}
+	inits := map[string]Value{}
+	return &Class{Inits: inits, Funs: funs}
+}
+
+func newDurationClass() *Class {
+	in := func(name string, unit time.Duration) *Native {
+		return &Native{
+			Name:  name,
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				d := self0.(*Duration).Value
+				return e.newNumber(float64(d) / float64(unit))
+			},
+		}
+	}
+	funs := map[string]Value{
+		"milliseconds": in("milliseconds", time.Millisecond),
+		"seconds":      in("seconds", time.Second),
+		"minutes":      in("minutes", time.Minute),
+		"hours":        in("hours", time.Hour),
+		"to_string": &Native{
+			Name:  "to_string",
+			Arity: 0,
+			Function: func(e *Evaluator, self0 Value, args ...Value) Value {
+				return e.newString(self0.Say())
+			},
+		},
+	}
+	inits := map[string]Value{}
+	return &Class{Inits: inits, Funs: funs}
+}
+
+/* == strftime ============================================================== */
+
+var (
+	monthNames = []string{"January", "February", "March", "April", "May", "June",
+		"July", "August", "September", "October", "November", "December"}
+	dayNames = []string{"Sunday", "Monday", "Tuesday", "Wednesday",
+		"Thursday", "Friday", "Saturday"}
+)
+
+// strftime formats t with the directives of C's strftime: %Y %y %m %d %e
+// %H %I %M %S %f (microseconds) %L (milliseconds) %p %j %a %A %b %B %z %Z
+// and %%.
+func strftime(t time.Time, layout string) (string, error) {
+	var out strings.Builder
+	runes := []rune(layout)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '%' {
+			out.WriteRune(runes[i])
+			continue
+		}
+		i++
+		if i == len(runes) {
+			return "", errors.New("layout ends with '%'")
+		}
+		switch runes[i] {
+		case 'Y':
+			fmt.Fprintf(&out, "%04d", t.Year())
+		case 'y':
+			fmt.Fprintf(&out, "%02d", t.Year()%100)
+		case 'm':
+			fmt.Fprintf(&out, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&out, "%02d", t.Day())
+		case 'e':
+			fmt.Fprintf(&out, "%2d", t.Day())
+		case 'H':
+			fmt.Fprintf(&out, "%02d", t.Hour())
+		case 'I':
+			fmt.Fprintf(&out, "%02d", (t.Hour()+11)%12+1)
+		case 'M':
+			fmt.Fprintf(&out, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&out, "%02d", t.Second())
+		case 'f':
+			fmt.Fprintf(&out, "%06d", t.Nanosecond()/1e3)
+		case 'L':
+			fmt.Fprintf(&out, "%03d", t.Nanosecond()/1e6)
+		case 'p':
+			out.WriteString(map[bool]string{true: "AM", false: "PM"}[t.Hour() < 12])
+		case 'j':
+			fmt.Fprintf(&out, "%03d", t.YearDay())
+		case 'a':
+			out.WriteString(dayNames[t.Weekday()][:3])
+		case 'A':
+			out.WriteString(dayNames[t.Weekday()])
+		case 'b':
+			out.WriteString(monthNames[t.Month()-1][:3])
+		case 'B':
+			out.WriteString(monthNames[t.Month()-1])
+		case 'z':
+			_, offset := t.Zone()
+			sign := '+'
+			if offset < 0 {
+				sign, offset = '-', -offset
+			}
+			fmt.Fprintf(&out, "%c%02d%02d", sign, offset/3600, offset/60%60)
+		case 'Z':
+			name, _ := t.Zone()
+			out.WriteString(name)
+		case '%':
+			out.WriteRune('%')
+		default:
+			return "", fmt.Errorf("unknown directive '%%%c'", runes[i])
+		}
+	}
+	return out.String(), nil
+}
+
+// strptime parses text with the directives of strftime. Fields missing
+// from the layout are those of 1970-01-01 00:00:00, in loc unless there
+// is a %z or a %Z of UTC.
+func strptime(text, layout string, loc *time.Location) (time.Time, error) {
+	p := &timeParser{text: []rune(text)}
+	year, month, day, hour, minute, second, nsec, yday := 1970, 1, 1, 0, 0, 0, 0, 0
+	pm := -1 // unset, else 0 or 1
+	runes := []rune(layout)
+	for i := 0; i < len(runes); i++ {
+		if unicode.IsSpace(runes[i]) {
+			p.skipSpace()
+			continue
+		}
+		if runes[i] != '%' {
+			if !p.literal(runes[i]) {
+				return time.Time{}, p.errorf(text, layout, "expected '%c'", runes[i])
+			}
+			continue
+		}
+		i++
+		if i == len(runes) {
+			return time.Time{}, errors.New("layout ends with '%'")
+		}
+		var ok bool
+		switch runes[i] {
+		case 'Y':
+			year, ok = p.number(4)
+		case 'y':
+			year, ok = p.number(2)
+			year += 1900
+			if year < 1969 {
+				year += 100
+			}
+		case 'm':
+			month, ok = p.number(2)
+		case 'd':
+			day, ok = p.number(2)
+		case 'e':
+			p.skipSpace()
+			day, ok = p.number(2)
+		case 'H', 'I':
+			hour, ok = p.number(2)
+		case 'M':
+			minute, ok = p.number(2)
+		case 'S':
+			second, ok = p.number(2)
+		case 'f', 'L':
+			start := p.pos
+			var frac int
+			frac, ok = p.number(9)
+			for digits := p.pos - start; digits < 9; digits++ {
+				frac *= 10
+			}
+			nsec = frac
+		case 'j':
+			yday, ok = p.number(3)
+		case 'p':
+			pm, ok = p.name([]string{"AM", "PM"}, 2)
+		case 'a':
+			_, ok = p.name(dayNames, 3)
+		case 'A':
+			_, ok = p.name(dayNames, 0)
+		case 'b':
+			month, ok = p.name(monthNames, 3)
+			month++
+		case 'B':
+			month, ok = p.name(monthNames, 0)
+			month++
+		case 'z':
+			var offset int
+			offset, ok = p.offset()
+			loc = time.FixedZone("", offset)
+			if offset == 0 {
+				loc = time.UTC
+			}
+		case 'Z':
+			start := p.pos
+			for p.pos < len(p.text) && unicode.IsLetter(p.text[p.pos]) {
+				p.pos++
+			}
+			ok = p.pos > start
+			if name := string(p.text[start:p.pos]); name == "UTC" || name == "GMT" || name == "Z" {
+				loc = time.UTC
+			}
+		case '%':
+			ok = p.literal('%')
+		default:
+			return time.Time{}, fmt.Errorf("unknown directive '%%%c'", runes[i])
+		}
+		if !ok {
+			return time.Time{}, p.errorf(text, layout, "bad '%%%c'", runes[i])
+		}
+	}
+	if p.pos < len(p.text) {
+		return time.Time{}, p.errorf(text, layout, "extra text")
+	}
+	if pm >= 0 {
+		if hour < 1 || hour > 12 {
+			return time.Time{}, p.errorf(text, layout, "hour out of range")
+		}
+		hour = hour%12 + 12*pm
+	}
+	if yday > 0 {
+		month, day = 1, yday
+	}
+	if month < 1 || month > 12 || hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, p.errorf(text, layout, "field out of range")
+	}
+	t := time.Date(year, time.Month(month), day, hour, minute, second, nsec, loc)
+	if t.Year() != year || yday == 0 && t.Day() != day {
+		return time.Time{}, p.errorf(text, layout, "day out of range")
+	}
+	return t, nil
+}
+
+type timeParser struct {
+	text []rune
+	pos  int
+}
+
+func (p *timeParser) errorf(text, layout, format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+	return fmt.Errorf("can't parse '%s' as '%s': %s at %d", text, layout, msg, p.pos)
+}
+
+func (p *timeParser) skipSpace() {
+	for p.pos < len(p.text) && unicode.IsSpace(p.text[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *timeParser) literal(r rune) bool {
+	if p.pos < len(p.text) && p.text[p.pos] == r {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// number reads up to width digits.
+func (p *timeParser) number(width int) (int, bool) {
+	start := p.pos
+	for p.pos < len(p.text) && p.pos-start < width && '0' <= p.text[p.pos] && p.text[p.pos] <= '9' {
+		p.pos++
+	}
+	n, err := strconv.Atoi(string(p.text[start:p.pos]))
+	return n, err == nil
+}
+
+// name reads one of names, cut to their first n letters if n isn't 0,
+// ignoring case, and returns its index.
+func (p *timeParser) name(names []string, n int) (int, bool) {
+	for i, name := range names {
+		if n != 0 {
+			name = name[:n]
+		}
+		end := p.pos + len(name)
+		if end <= len(p.text) && strings.EqualFold(string(p.text[p.pos:end]), name) {
+			p.pos = end
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// offset reads a zone offset, Z or ±hhmm with an optional colon, and
+// returns it in seconds.
+func (p *timeParser) offset() (int, bool) {
+	if p.literal('Z') {
+		return 0, true
+	}
+	sign := 1
+	if p.literal('-') {
+		sign = -1
+	} else if !p.literal('+') {
+		return 0, false
+	}
+	hours, ok := p.number(2)
+	if !ok {
+		return 0, false
+	}
+	p.literal(':')
+	minutes, ok := p.number(2)
+	if !ok {
+		return 0, false
+	}
+	return sign * (hours*3600 + minutes*60), true
+}
@@ -0,0 +1,120 @@
+package evaluator
+
+import (
+	"needle/internal/needle/ast"
+)
+
+/* == type checks =========================================================== */
+
+// SetTypeChecks makes the evaluator check values against the type
+// annotations of the script: declarations, assignments to annotated
+// variables and fields, arguments and returned values. A mismatch raises
+// an exception. Without checks annotations are ignored and cost nothing,
+// so it must be called before the script starts.
+func (e *Evaluator) SetTypeChecks(on bool) {
+	e.globals.typeChecks = on
+}
+
+// checkType raises an exception if value doesn't match t, what names the
+// variable, field or value being checked.
+func (e *Evaluator) checkType(t *ast.Type, value Value, what string) {
+	if t == nil || matchesType(t, value) {
+		return
+	}
+	e.panicException("type error: %s is %s, got %s", what, t, TypeName(value))
+}
+
+// checkedBody runs the body of fun and checks what it returns.
+func (e *Evaluator) checkedBody(fun *Function) Value {
+	value := func() (value Value) {
+		defer catchReturn(&value)
+		return e.Eval(fun.Body)
+	}()
+	result := value
+	if result == nil {
+		result = e.globalNull()
+	}
+	what := "the result"
+	if fun.Name != "" {
+		what += " of '" + fun.Name + "'"
+	}
+	e.checkType(fun.result, result, what)
+	return value
+}
+
+// valueTypes names the values of every type but instances, which have the
+// name of their class.
+var valueTypes = map[ValueType]string{
+	VAL_NULL:      "Null",
+	VAL_BOOLEAN:   CLASS_BOOLEAN,
+	VAL_NUMBER:    CLASS_NUMBER,
+	VAL_STRING:    CLASS_STRING,
+	VAL_FUNCTION:  "Function",
+	VAL_NATIVE:    "Function",
+	VAL_METHOD:    "Function",
+	VAL_CLASS:     "Class",
+	VAL_MODULE:    "Module",
+	VAL_VECTOR:    CLASS_VECTOR,
+	VAL_MAP:       CLASS_MAP,
+	VAL_EXCEPTION: CLASS_EXCEPTION,
+	VAL_GENERATOR: CLASS_GENERATOR,
+	VAL_TASK:      CLASS_TASK,
+	VAL_CHANNEL:   CLASS_CHANNEL,
+	VAL_PROMISE:   CLASS_PROMISE,
+	VAL_FILE:      CLASS_FILE,
+	VAL_PROCESS:   CLASS_PROCESS,
+	VAL_REGEX:     CLASS_REGEX,
+	VAL_DATETIME:  CLASS_DATETIME,
+	VAL_DURATION:  CLASS_DURATION,
+}
+
+// TypeNames returns the names annotations use for the types of values,
+// with Any which every value matches.
+func TypeNames() []string {
+	names := []string{"Any"}
+	seen := map[string]bool{}
+	for _, name := range valueTypes {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// TypeName returns the name of the type of value in annotations.
+func TypeName(value Value) string {
+	if instance, ok := value.(*Instance); ok {
+		return instance.Class.Name
+	}
+	return valueTypes[value.Type()]
+}
+
+func matchesType(t *ast.Type, value Value) bool {
+	switch {
+	case t.Name.Name == "Any":
+		return true
+	case value.Type() == VAL_NULL && t.Nullable:
+		return true
+	}
+	return TypeName(value) == t.Name.Name
+}
+
+// declareType records the annotation of a variable declared in e.
+func (e *Env) declareType(name string, t *ast.Type) {
+	if e.types == nil {
+		e.types = map[string]*ast.Type{}
+	}
+	e.types[name] = t
+}
+
+// lookupType returns the annotation of the variable name, nil if it has
+// none.
+func (e *Env) lookupType(name string) *ast.Type {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			return env.types[name]
+		}
+	}
+	return nil
+}
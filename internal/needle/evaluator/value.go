@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"needle/internal/needle/ast"
+	"needle/internal/needle/token"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
 )
@@ -28,6 +30,15 @@ const (
 	VAL_VECTOR    ValueType = "vector"
 	VAL_MAP       ValueType = "map"
 	VAL_EXCEPTION ValueType = "exception"
+	VAL_GENERATOR ValueType = "generator"
+	VAL_TASK      ValueType = "task"
+	VAL_CHANNEL   ValueType = "channel"
+	VAL_PROMISE   ValueType = "promise"
+	VAL_FILE      ValueType = "file"
+	VAL_PROCESS   ValueType = "process"
+	VAL_REGEX     ValueType = "regex"
+	VAL_DATETIME  ValueType = "datetime"
+	VAL_DURATION  ValueType = "duration"
 )
 
 type Value interface {
@@ -41,16 +52,26 @@ type Number struct{ Value float64 }
 type String struct{ Value string }
 
 type Function struct {
-	Name    string
-	Params  []string
-	Body    ast.Stmt
-	Closure *Env
+	Name      string
+	Params    []string
+	Defaults  []ast.Expr // nil for parameters without default
+	Rest      string     // empty if there is no rest parameter
+	Generator bool
+	Async     bool
+	Body      ast.Stmt
+	Closure   *Env
+	file      string // script declaring the function
+	pos       token.Position
+	types     []*ast.Type // of the parameters, kept when checking types
+	result    *ast.Type
 }
 
 type NativeFunction = func(e *Evaluator, self0 Value, args ...Value) Value
 type Native struct {
 	Name     string
-	Arity    int
+	Arity    int  // required arguments
+	Optional int  // optional arguments accepted after the required ones
+	Variadic bool // accepts any number of arguments after the above
 	Function NativeFunction
 }
 
@@ -65,9 +86,10 @@ type Module struct {
 }
 
 type Class struct {
-	Name  string
-	Inits map[string]Value
-	Funs  map[string]Value
+	Name   string
+	Inits  map[string]Value
+	Funs   map[string]Value
+	fields map[string]*ast.Type // kept when checking types
 }
 
 type Instance struct {
@@ -77,17 +99,37 @@ type Instance struct {
 
 type Exception struct {
 	Message    string
+	Line       int    // line of the statement that raised it, 0 if unknown
+	File       string // script of that line, "" if it has no file
 	StackTrace []Value
 }
 
 func (e *Exception) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf(
+			"Exception: %s\n%s",
+			e.Message,
+			sprintTrace(e.StackTrace),
+		)
+	}
 	return fmt.Sprintf(
-		"Exception: %s\n%s",
+		"Exception at line %d: %s\n%s",
+		e.Line,
 		e.Message,
 		sprintTrace(e.StackTrace),
 	)
 }
 
+// Exit is raised by 'os.exit' and unwinds the whole script, only
+// 'finally' blocks run on the way out.
+type Exit struct {
+	Code int
+}
+
+func (e *Exit) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
 type Vector struct{ Elems []Value }
 type Map struct{ Pairs *hashTable }
 
@@ -106,6 +148,15 @@ func (i *Instance) Type() ValueType  { return VAL_INSTANCE }
 func (e *Exception) Type() ValueType { return VAL_EXCEPTION }
 func (v *Vector) Type() ValueType    { return VAL_VECTOR }
 func (m *Map) Type() ValueType       { return VAL_MAP }
+func (g *Generator) Type() ValueType { return VAL_GENERATOR }
+func (t *Task) Type() ValueType      { return VAL_TASK }
+func (c *Channel) Type() ValueType   { return VAL_CHANNEL }
+func (p *Promise) Type() ValueType   { return VAL_PROMISE }
+func (f *File) Type() ValueType      { return VAL_FILE }
+func (p *Process) Type() ValueType   { return VAL_PROCESS }
+func (r *Regex) Type() ValueType     { return VAL_REGEX }
+func (t *DateTime) Type() ValueType  { return VAL_DATETIME }
+func (d *Duration) Type() ValueType  { return VAL_DURATION }
 
 /* == say =================================================================== */
 
@@ -148,6 +199,56 @@ func (v *Vector) Say() string {
 func (m *Map) Say() string {
 	return fmt.Sprintf("<map %p>", m)
 }
+func (g *Generator) Say() string {
+	return fmt.Sprintf("<generator %s %p>", anon(g.Function.Name), g)
+}
+func (t *Task) Say() string {
+	return fmt.Sprintf("<task %p of %s>", t, t.Function.Say())
+}
+func (c *Channel) Say() string {
+	return fmt.Sprintf("<channel %p>", c)
+}
+func (p *Promise) Say() string {
+	return fmt.Sprintf("<promise %s %p>", p.state, p)
+}
+func (f *File) Say() string {
+	return fmt.Sprintf("<file \"%s\" %p>", f.Path, f)
+}
+func (p *Process) Say() string {
+	return fmt.Sprintf("<process '%s' %d>", p.Command, p.cmd.Process.Pid)
+}
+func (r *Regex) Say() string {
+	return fmt.Sprintf("<regex /%s/>", r.re)
+}
+func (t *DateTime) Say() string {
+	return t.Value.Format(time.RFC3339Nano)
+}
+func (d *Duration) Say() string {
+	return d.Value.String()
+}
+
+/* == arity ================================================================= */
+
+// arityRange returns the accepted number of positional arguments,
+// max is -1 when there is no upper bound.
+func (f *Function) arityRange() (min, max int) {
+	for _, def := range f.Defaults {
+		if def == nil {
+			min++
+		}
+	}
+	if f.Rest != "" {
+		return min, -1
+	}
+	return min, len(f.Params)
+}
+
+func (n *Native) arityRange() (min, max int) {
+	if n.Variadic {
+		return n.Arity, -1
+	}
+	return n.Arity, n.Arity + n.Optional
+}
 
 /* == signal ================================================================ */
 
@@ -157,6 +258,7 @@ const (
 	SIG_RETURN SignalType = iota
 	SIG_BREAK
 	SIG_CONTINUE
+	SIG_CLOSE // unwinds a generator body on close()
 )
 
 type Signal struct {
@@ -173,6 +275,14 @@ func anon(n string) string {
 	return "(anonymous)"
 }
 
+// sprint formats value for plain output: strings are written without quotes.
+func sprint(value Value) string {
+	if s, ok := value.(*String); ok {
+		return s.Value
+	}
+	return value.Say()
+}
+
 func sprintTrace(trace []Value) string {
 	var str strings.Builder
 	for _, fun := range trace {
@@ -183,6 +293,11 @@ func sprintTrace(trace []Value) string {
 
 /* == hash table ============================================================ */
 
+var (
+	errMissingKey = errors.New("missing key")
+	errUnhashable = errors.New("unhashable type")
+)
+
 type hashTable struct {
 	numMap map[float64]Value
 	strMap map[string]Value
@@ -201,14 +316,14 @@ func (ht *hashTable) Get(key Value) (Value, error) {
 		if v, ok := ht.numMap[key.Value]; ok {
 			return v, nil
 		}
-		return nil, errors.New("missing key")
+		return nil, errMissingKey
 	case *String:
 		if v, ok := ht.strMap[key.Value]; ok {
 			return v, nil
 		}
-		return nil, errors.New("missing key")
+		return nil, errMissingKey
 	default:
-		return nil, errors.New("unhashable type")
+		return nil, errUnhashable
 	}
 }
 
@@ -223,7 +338,7 @@ func (ht *hashTable) Delete(key Value) (bool, error) {
 		delete(ht.strMap, key.Value)
 		return ok, nil
 	default:
-		return false, errors.New("unhashable type")
+		return false, errUnhashable
 	}
 }
 
@@ -238,7 +353,7 @@ func (ht *hashTable) Set(key Value, value Value) (bool, error) {
 		ht.strMap[key.Value] = value
 		return ok, nil
 	default:
-		return false, errors.New("unhashable type")
+		return false, errUnhashable
 	}
 }
 
@@ -249,10 +364,10 @@ func (ht *hashTable) Size() int {
 func (ht *hashTable) Keys() []Value {
 	keys := []Value{}
 	for k := range ht.numMap {
-		keys = append(keys, &Number{Value: k})
+		keys = append(keys, newNumber(k))
 	}
 	for k := range ht.strMap {
-		keys = append(keys, &String{Value: k})
+		keys = append(keys, newString(k))
 	}
 	return keys
 }
@@ -0,0 +1,840 @@
+// Package format prints scripts in canonical form: four space indents,
+// one statement per line and every comment of the source kept in place.
+package format
+
+import (
+	"math"
+	"needle/internal/needle/ast"
+	"needle/internal/needle/parser"
+	"needle/internal/needle/scanner"
+	"needle/internal/needle/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const indent = "    "
+
+// binding powers of the parser, see parser.Precedence
+const (
+	lowest  = int(parser.LOWEST)
+	unary   = int(parser.UN)
+	call    = int(parser.CALL)
+	highest = int(parser.HIGHEST)
+)
+
+// Source formats source, it returns the parse errors if it has any.
+func Source(source []rune) (string, []error) {
+	rec := &recorder{scanner: scanner.New(source)}
+	script, errs := parser.New(rec).Parse()
+	if errs != nil {
+		return "", errs
+	}
+	p := newPrinter(source, rec.tokens, rec.scanner.Comments())
+	p.script(script)
+	return p.out.String(), nil
+}
+
+// recorder keeps every token the parser reads, the printer finds
+// brackets, number literals and implicit nodes through them.
+type recorder struct {
+	scanner *scanner.Scanner
+	tokens  []*token.Token
+}
+
+func (r *recorder) NextToken() *token.Token {
+	tk := r.scanner.NextToken()
+	r.tokens = append(r.tokens, tk)
+	return tk
+}
+
+type comment struct {
+	*token.Comment
+	trailing bool // follows a token on the same line
+}
+
+type printer struct {
+	source   []rune
+	lines    []string // source lines, to keep blank lines
+	tokens   []*token.Token
+	index    map[token.Position]int            // token index by position
+	closing  map[token.Position]token.Position // closing bracket by opening
+	comments []*comment
+	next     int // first comment not printed yet
+	keywords map[string]bool
+
+	out      strings.Builder
+	depth    int
+	newlines int  // line breaks owed before the next write
+	open     bool // nothing written since the last opening bracket
+	line     int  // source line of the last item separated
+}
+
+func newPrinter(source []rune, tokens []*token.Token, comments []*token.Comment) *printer {
+	p := &printer{
+		source:   source,
+		lines:    strings.Split(string(source), "\n"),
+		tokens:   tokens,
+		index:    map[token.Position]int{},
+		closing:  map[token.Position]token.Position{},
+		keywords: map[string]bool{},
+	}
+	stack := []token.Position{}
+	for i, tk := range tokens {
+		p.index[tk.Position] = i
+		switch tk.Type {
+		case token.L_PAREN, token.L_BRACE, token.L_BRACK:
+			stack = append(stack, tk.Position)
+		case token.R_PAREN, token.R_BRACE, token.R_BRACK:
+			if len(stack) > 0 {
+				p.closing[stack[len(stack)-1]] = tk.Position
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	j := 0
+	for _, c := range comments {
+		for j < len(tokens) && before(tokens[j].Position, c.Position) {
+			j++
+		}
+		p.comments = append(p.comments, &comment{
+			Comment:  c,
+			trailing: j > 0 && tokens[j-1].Position.Line == c.Position.Line,
+		})
+	}
+	for _, word := range scanner.Keywords() {
+		p.keywords[word] = true
+	}
+	return p
+}
+
+/* == layout ================================================================ */
+
+func (p *printer) write(s string) {
+	if p.newlines > 0 && p.out.Len() > 0 {
+		p.out.WriteString(strings.Repeat("\n", p.newlines))
+		p.out.WriteString(strings.Repeat(indent, p.depth))
+	}
+	p.newlines = 0
+	p.out.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.newlines = max(p.newlines, 1)
+}
+
+// separate starts the line of an item found at pos in the source,
+// after a blank line if the source has one before the line of the item.
+func (p *printer) separate(pos token.Position) {
+	line := pos.Line
+	if !p.open && line > p.line && line >= 2 &&
+		strings.TrimSpace(p.lines[line-2]) == "" {
+		p.newlines = 2
+	} else {
+		p.newline()
+	}
+	p.open = false
+	p.line = line
+}
+
+// openBracket writes an opening bracket that starts an indented run of
+// lines, closeBracket ends it.
+func (p *printer) openBracket(s string) {
+	p.write(s)
+	p.depth++
+	p.open = true
+	p.newline()
+}
+
+// closeBracket also keeps the comments that follow the bracket on its
+// line, before the next token, on the line of the bracket.
+func (p *printer) closeBracket(s string, end token.Position) {
+	p.commentsBefore(end)
+	p.depth--
+	p.newline()
+	p.write(s)
+	p.open = false
+	if i, ok := p.index[end]; ok && i+1 < len(p.tokens) {
+		next := p.tokens[i+1].Position
+		for p.hasCommentBefore(next) && p.comments[p.next].Position.Line == end.Line {
+			p.commentsBefore(next)
+		}
+	}
+}
+
+// commentsBefore prints the comments that start before pos. A comment
+// that follows a token on its line stays at the end of the last line
+// written, the others get lines of their own.
+func (p *printer) commentsBefore(pos token.Position) {
+	for p.hasCommentBefore(pos) {
+		c := p.comments[p.next]
+		p.next++
+		if c.trailing && p.out.Len() > 0 {
+			p.out.WriteString(" " + c.Text)
+			p.newline()
+			continue
+		}
+		p.separate(c.Position)
+		p.write(c.Text)
+		p.newline()
+	}
+}
+
+func (p *printer) hasCommentBefore(pos token.Position) bool {
+	return p.next < len(p.comments) && before(p.comments[p.next].Position, pos)
+}
+
+func before(a, b token.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
+
+/* == declarations ========================================================== */
+
+func (p *printer) script(script *ast.Script) {
+	if strings.HasPrefix(string(p.source), "#!") {
+		p.write(p.lines[0])
+		p.newline()
+	}
+	p.decls(script.Decls, false)
+	p.commentsBefore(token.Position{Line: math.MaxInt})
+	if p.out.Len() > 0 {
+		p.out.WriteString("\n")
+	}
+}
+
+// decls prints a list of declarations one per line, or separated by
+// spaces if inline.
+func (p *printer) decls(decls []ast.Decl, inline bool) {
+	for i, decl := range decls {
+		// 'fun f() -> x;' is an arrow function and an empty statement
+		if i > 0 && isArrowDecl(decls[i-1]) && p.emptyDecl(decl) &&
+			!p.hasCommentBefore(decl.Pos()) {
+			p.write(";")
+			continue
+		}
+		if inline {
+			if i > 0 {
+				p.write(" ")
+			}
+		} else {
+			p.commentsBefore(decl.Pos())
+			p.separate(decl.Pos())
+		}
+		p.decl(decl)
+	}
+}
+
+func isArrowDecl(decl ast.Decl) bool {
+	fd, ok := decl.(*ast.FunDecl)
+	if !ok {
+		return false
+	}
+	_, ok = fd.Fun.Body.(*ast.ReturnStmt)
+	return ok
+}
+
+func (p *printer) emptyDecl(decl ast.Decl) bool {
+	sd, ok := decl.(*ast.StmtDecl)
+	return ok && p.empty(sd.Stmt)
+}
+
+func (p *printer) decl(decl ast.Decl) {
+	switch decl := decl.(type) {
+	case *ast.StmtDecl:
+		p.stmt(decl.Stmt)
+	case *ast.VarDecl:
+		if decl.Pos() == decl.Name.Pos() {
+			p.write(p.ident(decl.Name) + " := ")
+			p.expr(decl.Right, lowest)
+		} else {
+			p.write("var " + p.ident(decl.Name) + p.annotation(decl.Type))
+			if !p.implicit(decl.Right) {
+				p.write(" = ")
+				p.expr(decl.Right, lowest)
+			}
+		}
+		p.write(";")
+	case *ast.DestructDecl:
+		p.write("var ")
+		p.pattern(decl.Pattern)
+		p.write(" = ")
+		p.expr(decl.Right, lowest)
+		p.write(";")
+	case *ast.FunDecl:
+		p.write(funKeyword(decl.Fun) + " " + p.ident(decl.Name))
+		p.funTail(decl.Fun)
+	case *ast.ClassDecl:
+		p.write("class " + p.ident(decl.Name) + " ")
+		p.class(decl.Class)
+	case *ast.ImportDecl:
+		alias := "."
+		if !decl.Unwrap {
+			alias = p.ident(decl.Alias)
+		}
+		p.write("import " + alias + " " + quote(decl.Path.Value) + ";")
+	}
+}
+
+/* == statements ============================================================ */
+
+func (p *printer) stmt(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.Block:
+		p.block(stmt)
+	case *ast.ExprStmt, *ast.AssignStmt, *ast.DestructStmt:
+		p.simple(stmt)
+		p.write(";")
+	case *ast.IfStmt:
+		p.write("if (")
+		p.expr(stmt.Cond, lowest)
+		p.write(") ")
+		p.stmt(stmt.Then)
+		if !p.empty(stmt.Else) {
+			p.clause("else", stmt.Then, stmt.Else)
+			p.stmt(stmt.Else)
+		}
+	case *ast.WhileStmt:
+		p.write("while (")
+		p.expr(stmt.Cond, lowest)
+		p.write(") ")
+		p.stmt(stmt.Do)
+	case *ast.DoStmt:
+		p.write("do ")
+		p.stmt(stmt.Do)
+		p.clause("while", stmt.Do, stmt.While)
+		p.write("(")
+		p.expr(stmt.While, lowest)
+		p.write(");")
+	case *ast.ForStmt:
+		p.write("for (")
+		p.decl(stmt.Init)
+		if !p.implicit(stmt.Cond) {
+			p.write(" ")
+			p.expr(stmt.Cond, lowest)
+		}
+		p.write(";")
+		if !p.empty(stmt.Post) {
+			p.write(" ")
+			p.simple(stmt.Post)
+		}
+		p.write(") ")
+		p.stmt(stmt.Repeat)
+	case *ast.ForInStmt:
+		p.write("for (" + p.ident(stmt.Name) + " in ")
+		p.expr(stmt.Iter, lowest)
+		p.write(") ")
+		p.stmt(stmt.Repeat)
+	case *ast.SayStmt:
+		p.write("say ")
+		p.expr(stmt.Expr, lowest)
+		p.write(";")
+	case *ast.ReturnStmt:
+		p.write("return")
+		if !p.implicit(stmt.Value) {
+			p.write(" ")
+			p.expr(stmt.Value, lowest)
+		}
+		p.write(";")
+	case *ast.BreakStmt:
+		p.write("break;")
+	case *ast.ContinueStmt:
+		p.write("continue;")
+	case *ast.TryStmt:
+		p.write("try ")
+		p.stmt(stmt.Try)
+		// without a catch clause the parser names the exception '_' at
+		// the end of the try body
+		if tk := p.tokenAt(stmt.As.Pos()); tk != nil && tk.Type == token.IDENT {
+			p.clause("catch ("+p.ident(stmt.As)+")", stmt.Try, stmt.As)
+			p.stmt(stmt.Catch)
+		}
+		if !p.empty(stmt.Finally) {
+			last := stmt.Try
+			if !p.empty(stmt.Catch) {
+				last = stmt.Catch
+			}
+			p.clause("finally", last, stmt.Finally)
+			p.stmt(stmt.Finally)
+		}
+	case *ast.ThrowStmt:
+		p.write("throw ")
+		p.expr(stmt.Error, lowest)
+		p.write(";")
+	}
+}
+
+// clause writes the keyword that continues a statement after body and
+// before next: on the line of the closing brace of a block, after any
+// other statement on the same line only if the source has them so.
+func (p *printer) clause(keyword string, body ast.Stmt, next ast.Node) {
+	_, ok := body.(*ast.Block)
+	if p.newlines == 0 && (ok || body.Pos().Line == next.Pos().Line) {
+		p.write(" " + keyword + " ")
+		return
+	}
+	p.newline()
+	p.write(keyword + " ")
+}
+
+// block prints a block on one line if it is on one line in the source
+// and holds no comments, indented over several lines otherwise.
+func (p *printer) block(block *ast.Block) {
+	end := p.closing[block.Pos()]
+	if !p.hasCommentBefore(end) {
+		if len(block.Decls) == 0 {
+			p.write("{}")
+			return
+		}
+		if end.Line == block.Pos().Line {
+			p.write("{ ")
+			p.decls(block.Decls, true)
+			p.write(" }")
+			return
+		}
+	}
+	p.openBracket("{")
+	p.decls(block.Decls, false)
+	p.closeBracket("}", end)
+}
+
+// simple prints a statement that may appear in the head of a for loop,
+// without its semicolon.
+func (p *printer) simple(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.ExprStmt:
+		if !p.implicit(stmt.Expr) {
+			p.expr(stmt.Expr, lowest)
+		}
+	case *ast.AssignStmt:
+		p.expr(stmt.Left, lowest)
+		// 'a += b' is parsed into 'a = a + b' sharing the node of 'a'
+		if infix, ok := stmt.Right.(*ast.InfixExpr); ok && infix.Left == stmt.Left {
+			p.write(" " + infix.Op.Literal + "= ")
+			p.expr(infix.Right, lowest)
+			return
+		}
+		p.write(" = ")
+		p.expr(stmt.Right, lowest)
+	case *ast.DestructStmt:
+		// 'a, b = 1, 2' is parsed into vectors that start at their first
+		// element rather than at a 'vec' keyword
+		if vp, ok := stmt.Pattern.(*ast.VectorPattern); ok && vp.Pos() == vp.Elems[0].Pos() {
+			p.patterns(vp.Elems, vp.Rest)
+		} else {
+			p.pattern(stmt.Pattern)
+		}
+		p.write(" = ")
+		if vl, ok := stmt.Right.(*ast.VectorLit); ok && len(vl.Elems) > 0 &&
+			vl.Pos() == vl.Elems[0].Pos() {
+			for i, elem := range vl.Elems {
+				if i > 0 {
+					p.write(", ")
+				}
+				p.expr(elem, lowest)
+			}
+			return
+		}
+		p.expr(stmt.Right, lowest)
+	}
+}
+
+// empty reports whether stmt is a null statement the parser filled in
+// for a missing part, like an absent 'else'.
+func (p *printer) empty(stmt ast.Stmt) bool {
+	es, ok := stmt.(*ast.ExprStmt)
+	return ok && p.implicit(es.Expr)
+}
+
+// implicit reports whether expr was filled in by the parser: a null or
+// true literal that does not start at a matching token.
+func (p *printer) implicit(expr ast.Expr) bool {
+	tk := p.tokenAt(expr.Pos())
+	switch expr.(type) {
+	case *ast.NullLit:
+		return tk == nil || tk.Type != token.NULL
+	case *ast.BooleanLit:
+		return tk == nil || tk.Type != token.BOOLEAN
+	}
+	return false
+}
+
+func (p *printer) tokenAt(pos token.Position) *token.Token {
+	i, ok := p.index[pos]
+	if !ok {
+		return nil
+	}
+	return p.tokens[i]
+}
+
+/* == patterns ============================================================== */
+
+func (p *printer) pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.Ident:
+		p.write(p.ident(pattern))
+	case *ast.PropExpr:
+		p.expr(pattern, lowest)
+	case *ast.IndexExpr:
+		p.expr(pattern, lowest)
+	case *ast.VectorPattern:
+		p.write("vec{")
+		p.patterns(pattern.Elems, pattern.Rest)
+		p.write("}")
+	case *ast.MapPattern:
+		order := make([]int, len(pattern.Keys))
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(i, j int) bool {
+			return before(pattern.Keys[order[i]].Pos(), pattern.Keys[order[j]].Pos())
+		})
+		p.write("map{")
+		for n, i := range order {
+			if n > 0 {
+				p.write(", ")
+			}
+			p.expr(pattern.Keys[i], lowest)
+			p.write(": ")
+			p.pattern(pattern.Values[i])
+		}
+		if pattern.Rest != nil {
+			if len(order) > 0 {
+				p.write(", ")
+			}
+			p.write("...")
+			p.pattern(pattern.Rest)
+		}
+		p.write("}")
+	case *ast.DefaultPattern:
+		p.pattern(pattern.Target)
+		p.write(" = ")
+		p.expr(pattern.Default, lowest)
+	}
+}
+
+func (p *printer) patterns(elems []ast.Pattern, rest ast.Pattern) {
+	for i, elem := range elems {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.pattern(elem)
+	}
+	if rest != nil {
+		if len(elems) > 0 {
+			p.write(", ")
+		}
+		p.write("...")
+		p.pattern(rest)
+	}
+}
+
+/* == expressions =========================================================== */
+
+// expr prints expr, in parentheses if it binds looser than prec.
+func (p *printer) expr(expr ast.Expr, prec int) {
+	if precedence(expr) < prec {
+		p.write("(")
+		p.expr(expr, lowest)
+		p.write(")")
+		return
+	}
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		p.write(p.ident(expr))
+	case *ast.InfixExpr:
+		prec := precedence(expr)
+		p.expr(expr.Left, prec)
+		p.write(" " + expr.Op.Literal + " ")
+		p.expr(expr.Right, prec+1)
+	case *ast.PrefixExpr:
+		p.write(expr.Op.Literal)
+		if _, ok := expr.Right.(*ast.PrefixExpr); ok {
+			p.write("(")
+			p.expr(expr.Right, lowest)
+			p.write(")")
+		} else {
+			p.expr(expr.Right, unary)
+		}
+	case *ast.CallExpr:
+		p.expr(expr.Left, call)
+		items := make([]ast.Node, len(expr.Arguments))
+		for i, arg := range expr.Arguments {
+			items[i] = arg
+		}
+		p.list("(", ")", items, func(i int) {
+			p.expr(expr.Arguments[i], lowest)
+		})
+	case *ast.YieldExpr:
+		p.write("yield")
+		if !p.implicit(expr.Value) {
+			p.write(" ")
+			p.expr(expr.Value, lowest)
+		}
+	case *ast.AwaitExpr:
+		p.write("await ")
+		p.expr(expr.Value, unary)
+	case *ast.SpawnExpr:
+		p.write("spawn ")
+		p.expr(expr.Call, unary)
+	case *ast.SpreadExpr:
+		p.write("...")
+		p.expr(expr.Value, lowest)
+	case *ast.NamedArg:
+		p.write(p.ident(expr.Name) + ": ")
+		p.expr(expr.Value, lowest)
+	case *ast.PropExpr:
+		if _, ok := expr.Left.(*ast.NumberLit); ok {
+			// '1.x' would scan as the number '1.'
+			p.write("(")
+			p.expr(expr.Left, lowest)
+			p.write(")")
+		} else {
+			p.expr(expr.Left, call)
+		}
+		prop := p.ident(expr.Prop)
+		if p.keywords[expr.Prop.Name] {
+			prop = expr.Prop.Name // keywords need no quotes after a dot
+		}
+		p.write("." + prop)
+	case *ast.IndexExpr:
+		p.expr(expr.Left, call)
+		p.write("[")
+		p.expr(expr.Index, lowest)
+		p.write("]")
+	case *ast.SliceExpr:
+		p.expr(expr.Left, call)
+		p.write("[")
+		p.expr(expr.Start, lowest)
+		p.write(":")
+		p.expr(expr.End, lowest)
+		p.write("]")
+	case *ast.NullLit, *ast.BooleanLit, *ast.SelfLit:
+		p.write(expr.String())
+	case *ast.NumberLit:
+		if tk := p.tokenAt(expr.Pos()); tk != nil && tk.Type == token.NUMBER {
+			p.write(tk.Literal)
+		} else {
+			p.write(strconv.FormatFloat(expr.Value, 'f', -1, 64))
+		}
+	case *ast.StringLit:
+		p.write(quote(expr.Value))
+	case *ast.ClassLit:
+		p.write("class ")
+		p.class(expr)
+	case *ast.FunLit:
+		p.write(funKeyword(expr))
+		p.funTail(expr)
+	case *ast.VectorLit:
+		items := make([]ast.Node, len(expr.Elems))
+		for i, elem := range expr.Elems {
+			items[i] = elem
+		}
+		p.write("vec")
+		p.list("{", "}", items, func(i int) {
+			p.expr(expr.Elems[i], lowest)
+		})
+	case *ast.MapLit:
+		keys := make([]ast.Node, 0, len(expr.Pairs))
+		for key := range expr.Pairs {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return before(keys[i].Pos(), keys[j].Pos())
+		})
+		p.write("map")
+		p.list("{", "}", keys, func(i int) {
+			key := keys[i].(ast.Expr)
+			p.expr(key, lowest)
+			p.write(": ")
+			p.expr(expr.Pairs[key], lowest)
+		})
+	}
+}
+
+// precedence returns how tightly expr binds when printed without
+// parentheses, following the parser.
+func precedence(expr ast.Expr) int {
+	switch expr := expr.(type) {
+	case *ast.InfixExpr:
+		return int(parser.Precedence(expr.Op.Type))
+	case *ast.PrefixExpr, *ast.AwaitExpr, *ast.SpawnExpr:
+		return unary
+	case *ast.YieldExpr:
+		return lowest
+	case *ast.FunLit:
+		// an arrow body takes in everything that follows it
+		if _, ok := expr.Body.(*ast.Block); !ok {
+			return lowest
+		}
+	}
+	return highest
+}
+
+// list prints items between brackets, on one line or, if the source
+// breaks the line after the opening bracket, one item per line.
+func (p *printer) list(open, close string, items []ast.Node, item func(i int)) {
+	var start *token.Token
+	if len(items) > 0 {
+		if i, ok := p.index[items[0].Pos()]; ok && i > 0 {
+			start = p.tokens[i-1]
+		}
+	}
+	if start == nil || start.Literal != open ||
+		start.Position.Line == items[0].Pos().Line {
+		p.write(open)
+		for i := range items {
+			if i > 0 {
+				p.write(", ")
+			}
+			item(i)
+		}
+		p.write(close)
+		return
+	}
+	p.openBracket(open)
+	for i := range items {
+		p.commentsBefore(items[i].Pos())
+		p.separate(items[i].Pos())
+		item(i)
+		p.write(",")
+	}
+	p.closeBracket(close, p.closing[start.Position])
+}
+
+func (p *printer) class(lit *ast.ClassLit) {
+	type member struct {
+		name  *ast.Ident
+		fun   *ast.FunLit // nil for fields
+		field *ast.Type
+		init  bool
+	}
+	members := []member{}
+	for name, t := range lit.Fields {
+		members = append(members, member{name, nil, t, false})
+	}
+	for name, fun := range lit.Inits {
+		members = append(members, member{name, fun, nil, true})
+	}
+	for name, fun := range lit.Funs {
+		members = append(members, member{name, fun, nil, false})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return before(members[i].name.Pos(), members[j].name.Pos())
+	})
+
+	open := p.tokens[p.index[lit.Pos()]+1].Position
+	end := p.closing[open]
+	if len(members) == 0 && !p.hasCommentBefore(end) {
+		p.write("{}")
+		return
+	}
+	p.openBracket("{")
+	for _, m := range members {
+		p.commentsBefore(m.name.Pos())
+		p.separate(m.name.Pos())
+		if m.fun == nil {
+			p.write("var " + p.ident(m.name) + p.annotation(m.field) + ";")
+			continue
+		}
+		keyword := funKeyword(m.fun)
+		if m.init {
+			keyword = parser.LIT_INIT
+		}
+		p.write(keyword + " " + p.ident(m.name))
+		p.funTail(m.fun)
+	}
+	p.closeBracket("}", end)
+}
+
+// funTail prints the parameters and the body of a function.
+func (p *printer) funTail(fun *ast.FunLit) {
+	p.write("(")
+	for i, param := range fun.Params {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.write(p.ident(param.Name) + p.annotation(param.Type))
+		if param.Default != nil {
+			p.write(" = ")
+			p.expr(param.Default, lowest)
+		}
+	}
+	if fun.Rest != nil {
+		if len(fun.Params) > 0 {
+			p.write(", ")
+		}
+		p.write("..." + p.ident(fun.Rest))
+	}
+	p.write(")" + p.annotation(fun.Return))
+	if ret, ok := fun.Body.(*ast.ReturnStmt); ok {
+		p.write(" -> ")
+		p.expr(ret.Value, lowest)
+		return
+	}
+	p.write(" ")
+	p.stmt(fun.Body)
+}
+
+// annotation returns ': type', or nothing for a nil type.
+func (p *printer) annotation(t *ast.Type) string {
+	if t == nil {
+		return ""
+	}
+	if t.Nullable {
+		return ": " + p.ident(t.Name) + "?"
+	}
+	return ": " + p.ident(t.Name)
+}
+
+func funKeyword(fun *ast.FunLit) string {
+	switch {
+	case fun.Generator:
+		return "fun*"
+	case fun.Async:
+		return "async fun"
+	}
+	return "fun"
+}
+
+// ident returns the name of ident, in backquotes if it is a keyword or
+// is not made of letters, digits and underscores.
+func (p *printer) ident(ident *ast.Ident) string {
+	name := ident.Name
+	plain := name != "" && !p.keywords[name]
+	for i, r := range name {
+		letter := r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z'
+		if !letter && (i == 0 || r < '0' || r > '9') {
+			plain = false
+		}
+	}
+	if plain {
+		return name
+	}
+	return "`" + name + "`"
+}
+
+func quote(s string) string {
+	var str strings.Builder
+	str.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			str.WriteString(`\"`)
+		case '\\':
+			str.WriteString(`\\`)
+		case '\n':
+			str.WriteString(`\n`)
+		case '\r':
+			str.WriteString(`\r`)
+		case '\t':
+			str.WriteString(`\t`)
+		default:
+			str.WriteRune(r)
+		}
+	}
+	str.WriteByte('"')
+	return str.String()
+}
@@ -0,0 +1,128 @@
+package format_test
+
+import (
+	"needle/internal/needle/ast"
+	"needle/internal/needle/format"
+	"needle/internal/needle/parser"
+	"needle/internal/needle/scanner"
+	"needle/internal/needle/tester"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// positions are left out when comparing trees, formatting moves nodes
+var position = regexp.MustCompile(`(?m) \d+:\d+$`)
+
+func diff(want, got string) string {
+	return tester.Diff(strings.Split(want, "\n"), strings.Split(got, "\n"))
+}
+
+func tree(t *testing.T, source string) string {
+	t.Helper()
+	script, errs := parser.New(scanner.New([]rune(source))).Parse()
+	if errs != nil {
+		t.Fatalf("formatted code does not parse: %v\n%s", errs, source)
+	}
+	return position.ReplaceAllString(ast.Dump(script), "")
+}
+
+// TestRoundTrip formats every test script twice: the second pass must
+// not change anything and the result must parse to the same tree.
+func TestRoundTrip(t *testing.T) {
+	paths, err := tester.Scripts("../../../tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths = append(paths, "testdata/syntax.ndl")
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			source := string(b)
+			once, errs := format.Source([]rune(source))
+			if errs != nil {
+				t.Skip("does not parse")
+			}
+			twice, errs := format.Source([]rune(once))
+			if errs != nil {
+				t.Fatalf("formatted code does not parse: %v\n%s", errs, once)
+			}
+			if once != twice {
+				t.Errorf("formatting is not stable:\n%s", diff(once, twice))
+			}
+			if want, got := tree(t, source), tree(t, once); want != got {
+				t.Errorf("formatting changed the tree:\n%s", diff(want, got))
+			}
+		})
+	}
+}
+
+func TestSource(t *testing.T) {
+	cases := []struct{ name, in, want string }{
+		{
+			"spacing",
+			"var x=(1+2)*3-(4-5);x+=1;",
+			"var x = (1 + 2) * 3 - (4 - 5);\nx += 1;\n",
+		},
+		{
+			"blank lines",
+			"say 1;\n\n\n\nsay 2;\nsay 3;\n",
+			"say 1;\n\nsay 2;\nsay 3;\n",
+		},
+		{
+			"comments",
+			"// lead\nsay 1;   // trail\n{\n// inner\n}\n/* end */",
+			"// lead\nsay 1; // trail\n{\n    // inner\n}\n/* end */\n",
+		},
+		{
+			"blocks",
+			"if (a) { say 1; } else {\nsay 2;\n}\nwhile (b) {}",
+			"if (a) { say 1; } else {\n    say 2;\n}\nwhile (b) {}\n",
+		},
+		{
+			"clauses",
+			"if (a) say 1;\n    else say 2;\ntry f(); catch (e) say e;",
+			"if (a) say 1;\nelse say 2;\ntry f(); catch (e) say e;\n",
+		},
+		{
+			"lists",
+			"f(1,2);\nvar v = vec{\n1, 2};",
+			"f(1, 2);\nvar v = vec{\n    1,\n    2,\n};\n",
+		},
+		{
+			"implicit parts",
+			"for (;;) return; var x; fun f() -> 1;",
+			"for (;;) return;\nvar x;\nfun f() -> 1;\n",
+		},
+		{
+			"parentheses",
+			"say -(-a) + (b or c) * (await d).e; say (fun() -> 1)();",
+			"say -(-a) + (b or c) * (await d).e;\nsay (fun() -> 1)();\n",
+		},
+		{
+			"destructuring",
+			"a,b=b,a; var vec{c, ...d} = e;",
+			"a, b = b, a;\nvar vec{c, ...d} = e;\n",
+		},
+		{
+			"names and strings",
+			"`a b` := \"q\\\"\\n\";",
+			"`a b` := \"q\\\"\\n\";\n",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, errs := format.Source([]rune(c.in))
+			if errs != nil {
+				t.Fatal(errs)
+			}
+			if got != c.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+// Package framing reads and writes messages framed by a Content-Length
+// header, as the language server and debug adapter protocols send them.
+package framing
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// MaxLength bounds the body of a message read, so a bad header can't
+// exhaust memory.
+const MaxLength = 64 << 20
+
+// Read reads the body of one message.
+func Read(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad Content-Length: %w", err)
+	}
+	if length <= 0 || length > MaxLength {
+		return nil, fmt.Errorf("bad Content-Length: %d not in 1..%d", length, MaxLength)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Write writes body as one message.
+func Write(w io.Writer, body []byte) error {
+	_, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
@@ -0,0 +1,38 @@
+package framing_test
+
+import (
+	"bufio"
+	"bytes"
+	"needle/internal/needle/framing"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, body := range []string{`{"a":1}`, `{"b":"é"}`} {
+		if err := framing.Write(&buf, []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := bufio.NewReader(&buf)
+	for _, expected := range []string{`{"a":1}`, `{"b":"é"}`} {
+		body, err := framing.Read(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != expected {
+			t.Fatalf("expected %s, got %s", expected, body)
+		}
+	}
+}
+
+func TestBadLength(t *testing.T) {
+	for _, length := range []string{"-1", "0", "x", "", "1000000000000"} {
+		input := "Content-Length: " + length + "\r\n\r\n{}"
+		_, err := framing.Read(bufio.NewReader(strings.NewReader(input)))
+		if err == nil || !strings.Contains(err.Error(), "bad Content-Length") {
+			t.Errorf("length %q: expected a bad Content-Length error, got %v", length, err)
+		}
+	}
+}
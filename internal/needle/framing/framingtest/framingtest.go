@@ -0,0 +1,30 @@
+// Package framingtest connects tests to a server speaking framed messages.
+package framingtest
+
+import (
+	"bufio"
+	"io"
+	"testing"
+)
+
+// Conn is the editor's end of the pipes to a server.
+type Conn struct {
+	In   io.WriteCloser // what the server reads
+	Out  *bufio.Reader  // what the server writes
+	Done chan error     // the result of run once the server stops
+}
+
+// Start runs a server reading in and writing out on pipes the way an
+// editor would drive it. The input is closed when the test ends.
+func Start(t *testing.T, run func(in io.Reader, out io.Writer) error) *Conn {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &Conn{In: inW, Out: bufio.NewReader(outR), Done: make(chan error, 1)}
+	go func() {
+		err := run(inR, outW)
+		outW.Close()
+		c.Done <- err
+	}()
+	t.Cleanup(func() { inW.Close() })
+	return c
+}
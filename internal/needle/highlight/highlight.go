@@ -0,0 +1,237 @@
+// Package highlight colors needle source for the terminal and for HTML
+// pages. It scans the source with the scanner and keeps what the parser
+// skips, comments and whitespace, so the output has all of the source.
+package highlight
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"needle/doc"
+	"needle/internal/needle/scanner"
+	"needle/internal/needle/token"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/color"
+)
+
+// Kind is what a span of source is.
+type Kind int
+
+const (
+	Whitespace Kind = iota
+	Comment
+	Keyword
+	Ident
+	String
+	Number
+	Literal // true, false and null
+	Operator
+	Error // what the scanner doesn't accept
+)
+
+// Span is a part of the source, from rune Start to rune End.
+type Span struct {
+	Kind  Kind
+	Start int
+	End   int
+}
+
+// Spans cuts source into spans, in order and covering all of it.
+func Spans(source []rune) []Span {
+	// offset of the first rune of every line
+	lines := []int{0}
+	for i, r := range source {
+		if r == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	offset := func(pos token.Position) int {
+		return min(lines[pos.Line-1]+pos.Column-1, len(source))
+	}
+	spans := []Span{}
+	add := func(kind Kind, start, end int) {
+		if start >= end {
+			return
+		}
+		if n := len(spans); n > 0 && spans[n-1].Kind == kind && spans[n-1].End == start {
+			spans[n-1].End = end
+			return
+		}
+		spans = append(spans, Span{kind, start, end})
+	}
+	s := scanner.New(source)
+	last, seen := 0, 0 // end of the last span, comments added
+	afterDot := false
+	if len(source) >= 2 && source[0] == '#' && source[1] == '!' {
+		for last < len(source) && source[last] != '\n' {
+			last++
+		}
+		add(Comment, 0, last)
+	}
+	for {
+		tk := s.NextToken()
+		end := min(s.Offset(), len(source))
+		// the scanner skipped whitespace and comments up to the token
+		comments := s.Comments()
+		for ; seen < len(comments); seen++ {
+			start := offset(comments[seen].Position)
+			add(Whitespace, last, start)
+			last = start + len([]rune(comments[seen].Text))
+			add(Comment, start, last)
+		}
+		start := last
+		for start < end && unicode.IsSpace(source[start]) {
+			start++
+		}
+		add(Whitespace, last, start)
+		if tk.Type == token.EOF {
+			break
+		}
+		k := kind(tk)
+		if k == Keyword && afterDot {
+			k = Ident // a keyword naming a property
+		}
+		afterDot = tk.Type == token.DOT
+		add(k, start, end)
+		last = end
+	}
+	add(Whitespace, last, len(source))
+	return spans
+}
+
+func kind(tk *token.Token) Kind {
+	switch tk.Type {
+	case token.ERROR:
+		return Error
+	case token.IDENT:
+		return Ident
+	case token.STRING:
+		return String
+	case token.NUMBER:
+		return Number
+	case token.BOOLEAN, token.NULL:
+		return Literal
+	}
+	if unicode.IsLetter([]rune(tk.Literal)[0]) {
+		return Keyword
+	}
+	return Operator
+}
+
+/* == html ================================================================== */
+
+// htmlColors are the classes of the doc palette the kinds are wrapped
+// in, the other kinds are left as text.
+var htmlColors = map[Kind]string{
+	Keyword: "primary",
+	String:  "secondary",
+	Number:  "secondary",
+	Literal: "secondary",
+	Comment: "secondary",
+}
+
+// HTML returns source escaped for HTML, keywords in the primary color of
+// doc.Colors and literals and comments in the secondary one.
+func HTML(source []rune) string {
+	var str strings.Builder
+	for _, sp := range Spans(source) {
+		text := html.EscapeString(string(source[sp.Start:sp.End]))
+		if c, ok := htmlColors[sp.Kind]; ok {
+			str.WriteString(`<span class="` + c + `">` + text + "</span>")
+		} else {
+			str.WriteString(text)
+		}
+	}
+	return str.String()
+}
+
+// WriteHTML writes a page showing source under title.
+func WriteHTML(w io.Writer, title string, source []rune) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, `<!DOCTYPE html>`)
+	fmt.Fprintln(out, `<html lang="en">`)
+	fmt.Fprintln(out, `<head>`)
+	fmt.Fprintln(out, `<meta charset="UTF-8" />`)
+	fmt.Fprintf(out, "<title>%s</title>\n", html.EscapeString(title))
+	fmt.Fprintf(out, "<style>\n%s%s</style>\n", doc.Colors, style)
+	fmt.Fprintln(out, `</head>`)
+	fmt.Fprintln(out, `<body>`)
+	fmt.Fprintf(out, "<pre>%s</pre>\n", HTML(source))
+	fmt.Fprintln(out, `</body>`)
+	fmt.Fprintln(out, `</html>`)
+	return out.Flush()
+}
+
+const style = `
+body { background: #1e1e1e; color: #c0c0c0; }
+pre { font-family: monospace; }
+`
+
+/* == ansi ================================================================== */
+
+var ansiColors = map[Kind]*color.Color{
+	Keyword: color.New(color.FgCyan),
+	String:  color.New(color.FgGreen),
+	Number:  color.New(color.FgMagenta),
+	Literal: color.New(color.FgMagenta),
+	Comment: color.New(color.FgHiBlack),
+	Error:   color.New(color.FgRed),
+}
+
+// ANSI returns source with terminal colors, or as is if color.NoColor is
+// set. Colors are closed at the end of every line, so the result can be
+// split into lines.
+func ANSI(source []rune) string {
+	var str strings.Builder
+	for _, sp := range Spans(source) {
+		text := string(source[sp.Start:sp.End])
+		c, ok := ansiColors[sp.Kind]
+		if !ok {
+			str.WriteString(text)
+			continue
+		}
+		for i, line := range strings.Split(text, "\n") {
+			if i != 0 {
+				str.WriteByte('\n')
+			}
+			if line != "" {
+				str.WriteString(c.Sprint(line))
+			}
+		}
+	}
+	return str.String()
+}
+
+// Excerpt returns line of source, colored as by ANSI and numbered, and
+// below it a caret under column. Columns count runes from 1, there is no
+// caret if column is 0. The excerpt is "" if source has no such line.
+func Excerpt(source []rune, line, column int) string {
+	lines := strings.Split(ANSI(source), "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	number := strconv.Itoa(line)
+	gutter := strings.Repeat(" ", len(number))
+	text := strings.TrimSuffix(lines[line-1], "\r")
+	excerpt := fmt.Sprintf(" %s | %s\n", number, text)
+	if column < 1 {
+		return excerpt
+	}
+	// the plain line, to keep its tabs under the caret
+	plain := []rune(strings.Split(string(source), "\n")[line-1])
+	var pad strings.Builder
+	for i := 0; i < column-1 && i < len(plain); i++ {
+		if plain[i] == '\t' {
+			pad.WriteByte('\t')
+		} else {
+			pad.WriteByte(' ')
+		}
+	}
+	return excerpt + fmt.Sprintf(" %s | %s%s\n", gutter, pad.String(), caret.Sprint("^"))
+}
+
+var caret = color.New(color.FgRed, color.Bold)
@@ -0,0 +1,100 @@
+package highlight_test
+
+import (
+	"needle/internal/needle/highlight"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+const script = "#!/usr/bin/env needle\n" +
+	"/* block */ var s = \"a\\\"b\"; // line\n" +
+	"say s and `odd name` != null, 1.5, p.spawn;\n" +
+	"@ \"open\n"
+
+func TestSpans(t *testing.T) {
+	source := []rune(script)
+	spans := highlight.Spans(source)
+	last := 0
+	got := []string{}
+	for _, sp := range spans {
+		if sp.Start != last {
+			t.Fatalf("span at %d starts at %d", last, sp.Start)
+		}
+		last = sp.End
+		if sp.Kind != highlight.Whitespace {
+			got = append(got, string(source[sp.Start:sp.End]))
+		}
+	}
+	if last != len(source) {
+		t.Fatalf("spans end at %d of %d", last, len(source))
+	}
+	expected := []string{
+		"#!/usr/bin/env needle", "/* block */", "var", "s", "=", `"a\"b"`, ";", "// line",
+		"say", "s", "and", "`odd name`", "!=", "null", ",", "1.5", ",", "p", ".", "spawn", ";",
+		"@", "\"open\n",
+	}
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	kinds := map[string]highlight.Kind{}
+	for _, sp := range spans {
+		kinds[string(source[sp.Start:sp.End])] = sp.Kind
+	}
+	for text, kind := range map[string]highlight.Kind{
+		"#!/usr/bin/env needle": highlight.Comment,
+		"/* block */":           highlight.Comment,
+		"var":                   highlight.Keyword,
+		"and":                   highlight.Keyword,
+		"`odd name`":            highlight.Ident,
+		"spawn":                 highlight.Ident,
+		`"a\"b"`:                highlight.String,
+		"null":                  highlight.Literal,
+		"1.5":                   highlight.Number,
+		"!=":                    highlight.Operator,
+		"@":                     highlight.Error,
+	} {
+		if kinds[text] != kind {
+			t.Errorf("expected %q to be of kind %d, got %d", text, kind, kinds[text])
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	got := highlight.HTML([]rune(`var s = "<a>"; // x & y`))
+	expected := `<span class="primary">var</span> s = <span class="secondary">&#34;&lt;a&gt;&#34;</span>; ` +
+		`<span class="secondary">// x &amp; y</span>`
+	if got != expected {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestANSI(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	color.NoColor = false
+	got := highlight.ANSI([]rune("/* a\nb */ 1"))
+	expected := "\x1b[90m/* a\x1b[0m\n\x1b[90mb */\x1b[0m \x1b[35m1\x1b[0m"
+	if got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	color.NoColor = true
+	if got := highlight.ANSI([]rune(script)); got != script {
+		t.Fatalf("expected the source without colors, got %q", got)
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	color.NoColor = true
+	source := []rune("var a = 1;\n\tsay a +;\n")
+	if got, expected := highlight.Excerpt(source, 2, 8), " 2 | \tsay a +;\n   | \t      ^\n"; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if got, expected := highlight.Excerpt(source, 1, 0), " 1 | var a = 1;\n"; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if got := highlight.Excerpt(source, 9, 1); got != "" {
+		t.Errorf("expected no excerpt past the end, got %q", got)
+	}
+}
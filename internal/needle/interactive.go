@@ -0,0 +1,82 @@
+package needle
+
+import (
+	"errors"
+	"needle/internal/needle/evaluator"
+	"needle/internal/needle/parser"
+	"needle/internal/needle/scanner"
+	"sort"
+	"strings"
+)
+
+// Eval runs source like Run and returns the value of its last statement
+// if that is a bare expression, nil otherwise.
+func (n *Needle) Eval(source []rune) (evaluator.Value, error) {
+	script, err := Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	value, err := n.ev.EvalLast(script)
+	if err != nil {
+		return nil, err
+	}
+	return value, n.loop.Run()
+}
+
+// Incomplete reports whether source fails to parse only because it ends
+// too early, like an unclosed block or comment.
+func Incomplete(source []rune) bool {
+	_, err := Parse(source)
+	var compileErr *CompileError
+	if !errors.As(err, &compileErr) {
+		return false
+	}
+	tokens := Tokens(source)
+	eof := tokens[len(tokens)-1].Position
+	for _, e := range compileErr.Errors {
+		var parseErr *parser.Error
+		if !errors.As(e, &parseErr) {
+			continue
+		}
+		if parseErr.Message == "unterminated comment" {
+			return true
+		}
+		pos := parseErr.Position
+		if pos.Line > eof.Line || pos.Line == eof.Line && pos.Column >= eof.Column {
+			return true
+		}
+	}
+	return false
+}
+
+// Complete returns the completions of the name or 'a.b.c' path that ends
+// at pos in line, and where the completed part of it starts.
+func (n *Needle) Complete(line []rune, pos int) (int, []string) {
+	start := pos
+	for start > 0 && isPathRune(line[start-1]) {
+		start--
+	}
+	path := strings.Split(string(line[start:pos]), ".")
+	prefix := path[len(path)-1]
+	var names []string
+	if len(path) == 1 {
+		names = append(n.ev.Names(), scanner.Keywords()...)
+	} else {
+		names = n.ev.Members(path[:len(path)-1])
+	}
+	seen := map[string]bool{}
+	candidates := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+	return pos - len([]rune(prefix)), candidates
+}
+
+func isPathRune(r rune) bool {
+	return r == '_' || r == '.' ||
+		'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9'
+}
@@ -0,0 +1,404 @@
+// Package lint finds likely bugs in a script without running it: unused
+// names, shadowing, unreachable code and the like. Every rule has a
+// stable ID, a diagnostic is silenced by a '// lint:ignore' comment on
+// its line or on the line above, optionally followed by the IDs or names
+// of the rules to silence.
+package lint
+
+import (
+	"fmt"
+	"needle/internal/needle"
+	"needle/internal/needle/ast"
+	"needle/internal/needle/parser"
+	"needle/internal/needle/resolver"
+	"needle/internal/needle/scanner"
+	"needle/internal/needle/token"
+	"sort"
+	"strings"
+)
+
+// Severity tells whether a diagnostic is a certain bug or a likely one.
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+)
+
+// Rule is a check of the linter. The ID of a rule never changes, nor is
+// it given to another rule.
+type Rule struct {
+	ID       string
+	Name     string
+	Severity Severity
+	About    string
+}
+
+var (
+	Resolve = &Rule{"L000", "resolve", Error,
+		"names and imports the resolver can't find"}
+	UnusedVariable = &Rule{"L001", "unused-variable", Warning,
+		"local variables, functions and classes that are never used"}
+	UnusedImport = &Rule{"L002", "unused-import", Warning,
+		"imported modules that are never used"}
+	Shadow = &Rule{"L003", "shadow", Warning,
+		"declarations hiding a name of an enclosing scope"}
+	Unreachable = &Rule{"L004", "unreachable", Warning,
+		"statements after return, throw, break or continue"}
+	SelfOutsideClass = &Rule{"L005", "self-outside-class", Error,
+		"'self' outside the methods of a class"}
+	AssignUndeclared = &Rule{"L006", "assign-undeclared", Error,
+		"assignments to names that are not declared"}
+	MismatchedCompare = &Rule{"L007", "mismatched-compare", Warning,
+		"comparisons of values of different types, never equal"}
+)
+
+// Rules returns every rule in order of ID.
+func Rules() []*Rule {
+	return []*Rule{
+		Resolve, UnusedVariable, UnusedImport, Shadow, Unreachable,
+		SelfOutsideClass, AssignUndeclared, MismatchedCompare,
+	}
+}
+
+// Find returns the rule with the ID or name, nil if there is none.
+func Find(idOrName string) *Rule {
+	for _, rule := range Rules() {
+		if rule.ID == idOrName || rule.Name == idOrName {
+			return rule
+		}
+	}
+	return nil
+}
+
+// Diagnostic is a problem found by a rule.
+type Diagnostic struct {
+	Rule     *Rule
+	Position token.Position
+	Message  string
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf(
+		"%s at line %d, column %d [%s %s]",
+		d.Message, d.Position.Line, d.Position.Column, d.Rule.ID, d.Rule.Name,
+	)
+}
+
+// Config tells which rules run, all of them by default.
+type Config struct {
+	Disabled map[*Rule]bool
+}
+
+/* == linter ================================================================ */
+
+type linter struct {
+	config      Config
+	script      *ast.Script
+	info        *resolver.Info
+	diagnostics []*Diagnostic
+}
+
+// Lint checks source, whose imports are relative to wd, and returns the
+// diagnostics sorted by position. A script that doesn't parse gives a
+// needle.CompileError.
+func Lint(source []rune, wd string, config Config) ([]*Diagnostic, error) {
+	s := scanner.New(source)
+	script, errs := parser.New(s).Parse()
+	if errs != nil {
+		return nil, &needle.CompileError{Errors: errs}
+	}
+	errs, info := resolver.Analyze(script, wd)
+	l := &linter{config: config, script: script, info: info}
+	l.resolveErrors(errs)
+	l.unused()
+	l.shadows()
+	ast.Inspect(script, l.inspect)
+	l.selfOutsideClass(script, false)
+
+	diagnostics := ignore(l.diagnostics, s.Comments(), source)
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Position, diagnostics[j].Position
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return diagnostics, nil
+}
+
+func (l *linter) report(rule *Rule, node ast.Node, message string, a ...any) {
+	if l.config.Disabled[rule] {
+		return
+	}
+	l.diagnostics = append(l.diagnostics, &Diagnostic{
+		Rule:     rule,
+		Position: node.Pos(),
+		Message:  fmt.Sprintf(message, a...),
+	})
+}
+
+// ignore drops the diagnostics silenced by a comment: on the line of the
+// comment, and on the next one if the comment is alone on its line.
+func ignore(diagnostics []*Diagnostic, comments []*token.Comment, source []rune) []*Diagnostic {
+	lines := strings.Split(string(source), "\n")
+	// the rules silenced by line, nil for all of them
+	silenced := map[int][]string{}
+	for _, c := range comments {
+		text, ok := strings.CutPrefix(c.Text, "// lint:ignore")
+		if !ok || text != "" && text[0] != ' ' {
+			continue
+		}
+		rules := strings.Fields(text)
+		silencedLines := []int{c.Position.Line}
+		line := []rune(lines[c.Position.Line-1])
+		if strings.TrimSpace(string(line[:c.Position.Column-1])) == "" {
+			silencedLines = append(silencedLines, c.Position.Line+1)
+		}
+		for _, line := range silencedLines {
+			if len(rules) == 0 {
+				silenced[line] = nil
+			} else if old, ok := silenced[line]; !ok || old != nil {
+				silenced[line] = append(old, rules...)
+			}
+		}
+	}
+	kept := []*Diagnostic{}
+	for _, d := range diagnostics {
+		rules, ok := silenced[d.Position.Line]
+		if ok && (rules == nil || contains(rules, d.Rule)) {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept
+}
+
+func contains(rules []string, rule *Rule) bool {
+	for _, r := range rules {
+		if r == rule.ID || r == rule.Name {
+			return true
+		}
+	}
+	return false
+}
+
+/* == rules ================================================================= */
+
+// resolveErrors reports what the resolver found, assignments to
+// undeclared names under their own rule.
+func (l *linter) resolveErrors(errs []error) {
+	targets := map[token.Position]bool{}
+	var pattern func(ast.Pattern)
+	pattern = func(node ast.Pattern) {
+		switch node := node.(type) {
+		case *ast.VectorPattern:
+			for _, elem := range node.Elems {
+				pattern(elem)
+			}
+			if node.Rest != nil {
+				pattern(node.Rest)
+			}
+		case *ast.MapPattern:
+			for _, value := range node.Values {
+				pattern(value)
+			}
+			if node.Rest != nil {
+				pattern(node.Rest)
+			}
+		case *ast.DefaultPattern:
+			pattern(node.Target)
+		case *ast.Ident:
+			targets[node.Pos()] = true
+		}
+	}
+	ast.Inspect(l.script, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.AssignStmt:
+			targets[node.Left.Pos()] = true
+		case *ast.DestructStmt:
+			pattern(node.Pattern)
+		}
+		return true
+	})
+	for _, err := range errs {
+		err := err.(*resolver.Error)
+		rule := Resolve
+		message := err.Message
+		if targets[err.Position] && strings.HasPrefix(message, "undeclared name") {
+			rule = AssignUndeclared
+			message = "assignment to " + message
+		}
+		if !l.config.Disabled[rule] {
+			l.diagnostics = append(l.diagnostics, &Diagnostic{rule, err.Position, message})
+		}
+	}
+}
+
+// unused reports the local declarations and the imports never used. Top
+// level declarations are what a module exports, they are left out, and
+// so are names starting with '_'.
+func (l *linter) unused() {
+	uses := map[*ast.Ident]int{}
+	for use, decl := range l.info.Uses {
+		if use != decl {
+			uses[decl]++
+		}
+	}
+	exported := map[*ast.Ident]bool{}
+	for _, decl := range l.script.Decls {
+		switch decl := decl.(type) {
+		case *ast.VarDecl:
+			exported[decl.Name] = true
+		case *ast.FunDecl:
+			exported[decl.Name] = true
+		case *ast.ClassDecl:
+			exported[decl.Name] = true
+		case *ast.DestructDecl:
+			ast.Inspect(decl.Pattern, func(node ast.Node) bool {
+				if ident, ok := node.(*ast.Ident); ok {
+					exported[ident] = true
+				}
+				return true
+			})
+		}
+	}
+	for name, decl := range l.info.Decls {
+		if uses[name] != 0 || strings.HasPrefix(name.Name, "_") {
+			continue
+		}
+		switch decl.(type) {
+		case *ast.ImportDecl:
+			l.report(UnusedImport, name, "module '%s' is imported and not used", name.Name)
+		case *ast.VarDecl, *ast.DestructDecl, *ast.FunDecl, *ast.ClassDecl:
+			if !exported[name] {
+				l.report(UnusedVariable, name, "'%s' is declared and not used", name.Name)
+			}
+		}
+	}
+}
+
+// shadows reports the declarations hiding another one, but parameters:
+// a function has its own names for what it is given.
+func (l *linter) shadows() {
+	for name, outer := range l.info.Shadows {
+		switch l.info.Decls[name].(type) {
+		case *ast.Param, *ast.FunLit:
+			continue
+		}
+		l.report(Shadow, name, "'%s' shadows the declaration at line %d", name.Name, outer.Pos().Line)
+	}
+}
+
+func (l *linter) inspect(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.Script:
+		l.unreachable(node.Decls)
+	case *ast.Block:
+		l.unreachable(node.Decls)
+	case *ast.InfixExpr:
+		l.compare(node)
+	}
+	return true
+}
+
+// unreachable reports the first declaration following a jump.
+func (l *linter) unreachable(decls []ast.Decl) {
+	for i, decl := range decls[:max(len(decls)-1, 0)] {
+		stmt, ok := decl.(*ast.StmtDecl)
+		if !ok {
+			continue
+		}
+		var jump string
+		switch stmt.Stmt.(type) {
+		case *ast.ReturnStmt:
+			jump = "return"
+		case *ast.ThrowStmt:
+			jump = "throw"
+		case *ast.BreakStmt:
+			jump = "break"
+		case *ast.ContinueStmt:
+			jump = "continue"
+		default:
+			continue
+		}
+		l.report(Unreachable, decls[i+1], "unreachable code after '%s'", jump)
+		return
+	}
+}
+
+// selfOutsideClass reports 'self' outside a class literal, functions
+// nested in a method see the 'self' of the method.
+func (l *linter) selfOutsideClass(root ast.Node, inClass bool) {
+	ast.Inspect(root, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.ClassLit:
+			if node != root {
+				l.selfOutsideClass(node, true)
+				return false
+			}
+		case *ast.SelfLit:
+			if !inClass {
+				l.report(SelfOutsideClass, node, "'self' used outside a class")
+			}
+		}
+		return true
+	})
+}
+
+// compare reports equality tests between values whose types are known
+// to differ: such values are never equal.
+func (l *linter) compare(node *ast.InfixExpr) {
+	switch node.Op.Type {
+	case token.EQ, token.NE, token.IS, token.ISNT:
+	default:
+		return
+	}
+	left, right := typeOf(node.Left), typeOf(node.Right)
+	if left == "" || right == "" || left == right {
+		return
+	}
+	always := "false"
+	if node.Op.Type == token.NE || node.Op.Type == token.ISNT {
+		always = "true"
+	}
+	l.report(MismatchedCompare, node,
+		"comparison of a %s with a %s is always %s", left, right, always)
+}
+
+// typeOf returns the type of the value of expr if it is known without
+// running it, "" otherwise.
+func typeOf(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.NullLit:
+		return "null"
+	case *ast.BooleanLit:
+		return "boolean"
+	case *ast.NumberLit:
+		return "number"
+	case *ast.StringLit:
+		return "string"
+	case *ast.VectorLit:
+		return "vector"
+	case *ast.MapLit:
+		return "map"
+	case *ast.FunLit:
+		return "function"
+	case *ast.ClassLit:
+		return "class"
+	case *ast.PrefixExpr:
+		switch expr.Op.Type {
+		case token.WOW:
+			return "boolean"
+		case token.MINUS, token.PLUS:
+			return "number"
+		}
+	case *ast.InfixExpr:
+		switch expr.Op.Type {
+		case token.LT, token.LE, token.GT, token.GE,
+			token.EQ, token.NE, token.IS, token.ISNT:
+			return "boolean"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package lint_test
+
+import (
+	"fmt"
+	"needle/internal/needle/lint"
+	"strings"
+	"testing"
+)
+
+const script = `import os "os";
+
+var x = 1;
+
+fun f(a) {
+    var unused = 2;
+    var x = 3;
+    if (a == "1") {
+        return x;
+        say "dead";
+    }
+    undeclared = 4;
+    var _skipped = 5;
+    return self;
+}
+
+class P {
+    init new(v) { self.v = v; }
+}
+
+say 1 == "1";
+say nope;
+// lint:ignore L001 shadow
+fun g() { var x = 1; }
+fun h() { var y = 1; } // lint:ignore
+fun k() { var z = 1; }
+`
+
+func TestLint(t *testing.T) {
+	diagnostics, err := lint.Lint([]rune(script), t.TempDir(), lint.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, d := range diagnostics {
+		got = append(got, fmt.Sprintf("%d:%d %s", d.Position.Line, d.Position.Column, d.Rule.ID))
+	}
+	want := []string{
+		"1:8 L002",
+		"6:9 L001",
+		"7:9 L003",
+		"10:9 L004",
+		"12:5 L006",
+		"14:12 L005",
+		"21:5 L007",
+		"22:5 L000",
+		"26:15 L001",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	config := lint.Config{Disabled: map[*lint.Rule]bool{}}
+	for _, rule := range lint.Rules() {
+		config.Disabled[rule] = rule != lint.Find("unused-import")
+	}
+	diagnostics, err := lint.Lint([]rune(script), t.TempDir(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Rule != lint.UnusedImport {
+		t.Errorf("expected only the unused import, got %v", diagnostics)
+	}
+}
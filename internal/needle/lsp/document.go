@@ -0,0 +1,551 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"needle/internal/needle"
+	"needle/internal/needle/ast"
+	"needle/internal/needle/parser"
+	"needle/internal/needle/resolver"
+	"needle/internal/needle/scanner"
+	"needle/internal/needle/token"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// document is an open file with what the server knows about it, all of
+// it computed again on every change.
+type document struct {
+	uri     string
+	wd      string // directory imports are relative to
+	source  []rune
+	lines   [][]rune
+	tokens  map[token.Position]*token.Token
+	closing map[token.Position]token.Position // closing brace by opening
+	script  *ast.Script
+	errors  []error // syntax errors, then resolution errors
+	info    *resolver.Info
+}
+
+func newDocument(uri, text string) *document {
+	d := &document{
+		uri:     uri,
+		wd:      uriDir(uri),
+		source:  []rune(text),
+		tokens:  map[token.Position]*token.Token{},
+		closing: map[token.Position]token.Position{},
+	}
+	for _, line := range strings.Split(text, "\n") {
+		d.lines = append(d.lines, []rune(strings.TrimSuffix(line, "\r")))
+	}
+	stack := []token.Position{}
+	for _, tk := range needle.Tokens(d.source) {
+		d.tokens[tk.Position] = tk
+		switch tk.Type {
+		case token.L_BRACE:
+			stack = append(stack, tk.Position)
+		case token.R_BRACE:
+			if len(stack) > 0 {
+				d.closing[stack[len(stack)-1]] = tk.Position
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	script, errs := parser.New(scanner.New(d.source)).Parse()
+	d.script = script
+	d.errors = errs
+	resolveErrs, info := resolver.Analyze(script, d.wd)
+	if errs == nil {
+		// a script that does not parse gives misleading name errors
+		d.errors = resolveErrs
+	}
+	d.info = info
+	return d
+}
+
+// uriDir returns the directory of a file URI, the working directory if
+// uri is not a file URI.
+func uriDir(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "."
+	}
+	return filepath.Dir(filepath.FromSlash(u.Path))
+}
+
+/* == positions ============================================================= */
+
+// position converts a script position to a protocol position.
+func (d *document) position(pos token.Position) Position {
+	line := max(min(pos.Line-1, len(d.lines)-1), 0)
+	runes := d.lines[line]
+	col := max(min(pos.Column-1, len(runes)), 0)
+	return Position{Line: line, Character: len(utf16.Encode(runes[:col]))}
+}
+
+// scriptPosition converts a protocol position to a script position.
+func (d *document) scriptPosition(pos Position) token.Position {
+	line := max(min(pos.Line, len(d.lines)-1), 0)
+	units := 0
+	col := 0
+	for _, r := range d.lines[line] {
+		if units >= pos.Character {
+			break
+		}
+		units += len(utf16.Encode([]rune{r}))
+		col++
+	}
+	return token.Position{Line: line + 1, Column: col + 1}
+}
+
+// span returns the range of n runes from pos.
+func (d *document) span(pos token.Position, n int) Range {
+	end := pos
+	end.Column += n
+	return Range{Start: d.position(pos), End: d.position(end)}
+}
+
+// identRange returns the range of an identifier, with its backquotes.
+func (d *document) identRange(id *ast.Ident) Range {
+	n := len([]rune(id.Name))
+	if d.runeAt(id.Pos()) == '`' {
+		n += 2
+	}
+	return d.span(id.Pos(), n)
+}
+
+// errorRange returns the range of the token at pos, or one rune.
+func (d *document) errorRange(pos token.Position) Range {
+	n := 1
+	if tk := d.tokens[pos]; tk != nil && tk.Type != token.EOF {
+		n = max(len([]rune(tk.Literal)), 1)
+	}
+	return d.span(pos, n)
+}
+
+func (d *document) runeAt(pos token.Position) rune {
+	if pos.Line < 1 || pos.Line > len(d.lines) {
+		return 0
+	}
+	line := d.lines[pos.Line-1]
+	if pos.Column < 1 || pos.Column > len(line) {
+		return 0
+	}
+	return line[pos.Column-1]
+}
+
+// wholeRange covers the whole document.
+func (d *document) wholeRange() Range {
+	last := len(d.lines) - 1
+	return Range{
+		End: Position{Line: last, Character: len(utf16.Encode(d.lines[last]))},
+	}
+}
+
+// endOf returns where the construct starting at start ends: after the
+// brace closing the first block that opens on the start line or, if
+// none does, at the end of that line.
+func (d *document) endOf(start token.Position, body ast.Node) token.Position {
+	var open token.Position
+	switch body := body.(type) {
+	case *ast.Block:
+		open = body.Pos()
+	case *ast.ClassLit:
+		// the brace follows the class name or keyword
+		for col := body.Pos().Column; col <= len(d.lines[body.Pos().Line-1]); col++ {
+			pos := token.Position{Line: body.Pos().Line, Column: col}
+			if tk := d.tokens[pos]; tk != nil && tk.Type == token.L_BRACE {
+				open = pos
+				break
+			}
+		}
+	}
+	if end, ok := d.closing[open]; ok {
+		end.Column++
+		return end
+	}
+	return token.Position{Line: start.Line, Column: len(d.lines[start.Line-1]) + 1}
+}
+
+/* == diagnostics =========================================================== */
+
+func (d *document) diagnostics() []Diagnostic {
+	diags := []Diagnostic{}
+	for _, err := range d.errors {
+		var pos token.Position
+		var message string
+		var parseErr *parser.Error
+		var resolveErr *resolver.Error
+		switch {
+		case errors.As(err, &parseErr):
+			pos, message = parseErr.Position, parseErr.Message
+		case errors.As(err, &resolveErr):
+			pos, message = resolveErr.Position, resolveErr.Message
+		default:
+			pos, message = token.Position{Line: 1, Column: 1}, err.Error()
+		}
+		diags = append(diags, Diagnostic{
+			Range:    d.errorRange(pos),
+			Severity: severityError,
+			Source:   "needle",
+			Message:  message,
+		})
+	}
+	return diags
+}
+
+/* == names ================================================================= */
+
+// member is a method declared in a class literal.
+type member struct {
+	fun  *ast.FunLit
+	init bool
+}
+
+// identAt returns the identifier at pos, and the property expression
+// or class member it names if it names one.
+func (d *document) identAt(pos token.Position) (*ast.Ident, *ast.PropExpr, *member) {
+	var found *ast.Ident
+	props := map[*ast.Ident]*ast.PropExpr{}
+	members := map[*ast.Ident]*member{}
+	ast.Inspect(d.script, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.PropExpr:
+			props[node.Prop] = node
+		case *ast.ClassLit:
+			for name, fun := range node.Inits {
+				members[name] = &member{fun, true}
+			}
+			for name, fun := range node.Funs {
+				members[name] = &member{fun, false}
+			}
+		case *ast.Ident:
+			r := d.identRange(node)
+			at := d.position(pos)
+			if r.Start.Line == at.Line &&
+				r.Start.Character <= at.Character && at.Character <= r.End.Character {
+				found = node
+			}
+		}
+		return true
+	})
+	if found == nil {
+		return nil, nil, nil
+	}
+	return found, props[found], members[found]
+}
+
+// declaration returns the identifier that declares id, nil if id is not
+// declared in the document.
+func (d *document) declaration(id *ast.Ident) *ast.Ident {
+	return d.info.Uses[id]
+}
+
+// importOf returns the import declaring the alias name, nil if there
+// is none.
+func (d *document) importOf(name string) *ast.ImportDecl {
+	for id, decl := range d.info.Decls {
+		if imp, ok := decl.(*ast.ImportDecl); ok && id.Name == name {
+			return imp
+		}
+	}
+	return nil
+}
+
+// hover describes the identifier at pos in markdown, "" if it is not
+// known.
+func (d *document) hover(pos token.Position) (string, Range) {
+	id, prop, m := d.identAt(pos)
+	if id == nil {
+		return "", Range{}
+	}
+	var text string
+	switch {
+	case prop != nil:
+		text = d.describeProp(prop)
+	case m != nil && m.init:
+		text = signature(parser.LIT_INIT, id.Name, m.fun)
+	case m != nil:
+		text = signature(funKeyword(m.fun), id.Name, m.fun)
+	default:
+		text = d.describe(id)
+	}
+	if text == "" {
+		return "", Range{}
+	}
+	text = "```needle\n" + text + "\n```"
+	if doc := d.doc(id, prop, m); doc != "" {
+		text += "\n\n" + doc
+	}
+	return text, d.identRange(id)
+}
+
+// doc returns the doc comment of the declaration of the identifier at
+// hand, "" if it has none.
+func (d *document) doc(id *ast.Ident, prop *ast.PropExpr, m *member) string {
+	switch {
+	case prop != nil:
+		return ""
+	case m != nil:
+		return m.fun.Doc
+	}
+	decl := d.declaration(id)
+	if decl == nil {
+		return ""
+	}
+	switch node := d.info.Decls[decl].(type) {
+	case *ast.FunDecl:
+		return node.Fun.Doc
+	case *ast.ClassDecl:
+		return node.Doc
+	case *ast.VarDecl:
+		return node.Doc
+	}
+	return ""
+}
+
+func (d *document) describe(id *ast.Ident) string {
+	decl := d.declaration(id)
+	if decl == nil {
+		if methods, ok := baseMethods()[id.Name]; ok {
+			return fmt.Sprintf("class %s // builtin, %d methods", id.Name, len(methods))
+		}
+		for _, name := range builtinNames() {
+			if name == id.Name {
+				return fmt.Sprintf("fun %s // builtin", id.Name)
+			}
+		}
+		return ""
+	}
+	switch node := d.info.Decls[decl].(type) {
+	case *ast.FunDecl:
+		return signature(funKeyword(node.Fun), decl.Name, node.Fun)
+	case *ast.ClassDecl:
+		lines := []string{"class " + decl.Name}
+		for _, name := range sortedNames(node.Class.Inits) {
+			lines = append(lines, indent+signature(parser.LIT_INIT, name.Name, node.Class.Inits[name]))
+		}
+		for _, name := range sortedNames(node.Class.Funs) {
+			fun := node.Class.Funs[name]
+			lines = append(lines, indent+signature(funKeyword(fun), name.Name, fun))
+		}
+		return strings.Join(lines, "\n")
+	case *ast.VarDecl:
+		if fun, ok := node.Right.(*ast.FunLit); ok {
+			return "var " + signature(funKeyword(fun), decl.Name, fun)
+		}
+		return "var " + decl.Name
+	case *ast.DestructDecl:
+		return "var " + decl.Name
+	case *ast.Param:
+		return "(parameter) " + decl.Name
+	case *ast.FunLit:
+		return "(parameter) ..." + decl.Name
+	case *ast.ForInStmt:
+		return "(loop variable) " + decl.Name
+	case *ast.TryStmt:
+		return "(exception) " + decl.Name
+	case *ast.ImportDecl:
+		return fmt.Sprintf("import %s %s", decl.Name, node.Path)
+	}
+	return ""
+}
+
+func (d *document) describeProp(prop *ast.PropExpr) string {
+	name := prop.Prop.Name
+	if left, ok := prop.Left.(*ast.Ident); ok {
+		if decl := d.declaration(left); decl != nil {
+			if imp, ok := d.info.Decls[decl].(*ast.ImportDecl); ok {
+				return fmt.Sprintf("%s.%s // module %s", left.Name, name, imp.Path)
+			}
+		}
+	}
+	classes := []string{}
+	for _, class := range sortedKeys(baseMethods()) {
+		for _, method := range baseMethods()[class] {
+			if method == name {
+				classes = append(classes, class)
+			}
+		}
+	}
+	if len(classes) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("fun %s // method of %s", name, strings.Join(classes, ", "))
+}
+
+const indent = "    "
+
+// signature returns 'keyword name(params)'.
+func signature(keyword, name string, fun *ast.FunLit) string {
+	params := []string{}
+	for _, param := range fun.Params {
+		params = append(params, param.String())
+	}
+	if fun.Rest != nil {
+		params = append(params, "..."+fun.Rest.Name)
+	}
+	return fmt.Sprintf("%s %s(%s)", keyword, name, strings.Join(params, ", "))
+}
+
+func funKeyword(fun *ast.FunLit) string {
+	switch {
+	case fun.Generator:
+		return "fun*"
+	case fun.Async:
+		return "async fun"
+	}
+	return "fun"
+}
+
+/* == symbols =============================================================== */
+
+func (d *document) symbols(decls []ast.Decl) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for _, decl := range decls {
+		switch decl := decl.(type) {
+		case *ast.FunDecl:
+			symbols = append(symbols, d.funSymbol(decl.Pos(), decl.Name, decl.Fun, symbolFunction))
+		case *ast.ClassDecl:
+			symbol := d.symbol(decl.Pos(), decl.Name, decl.Class, symbolClass)
+			names := append(sortedNames(decl.Class.Inits), sortedNames(decl.Class.Funs)...)
+			sortIdents(names)
+			for _, name := range names {
+				if fun, ok := decl.Class.Inits[name]; ok {
+					symbol.Children = append(symbol.Children,
+						d.funSymbol(name.Pos(), name, fun, symbolConstructor))
+				} else {
+					symbol.Children = append(symbol.Children,
+						d.funSymbol(name.Pos(), name, decl.Class.Funs[name], symbolMethod))
+				}
+			}
+			symbols = append(symbols, symbol)
+		case *ast.VarDecl:
+			if fun, ok := decl.Right.(*ast.FunLit); ok {
+				symbols = append(symbols, d.funSymbol(decl.Pos(), decl.Name, fun, symbolFunction))
+			} else {
+				symbols = append(symbols, d.symbol(decl.Pos(), decl.Name, nil, symbolVariable))
+			}
+		case *ast.DestructDecl:
+			ast.Inspect(decl.Pattern, func(node ast.Node) bool {
+				if id, ok := node.(*ast.Ident); ok && d.info.Decls[id] == decl {
+					symbols = append(symbols, d.symbol(decl.Pos(), id, nil, symbolVariable))
+				}
+				return true
+			})
+		}
+	}
+	return symbols
+}
+
+func (d *document) funSymbol(start token.Position, name *ast.Ident, fun *ast.FunLit, kind int) DocumentSymbol {
+	symbol := d.symbol(start, name, fun.Body, kind)
+	symbol.Detail = signature(funKeyword(fun), name.Name, fun)
+	if block, ok := fun.Body.(*ast.Block); ok {
+		symbol.Children = d.symbols(block.Decls)
+	}
+	return symbol
+}
+
+// symbol returns the symbol of a declaration that starts at start and
+// whose body, if any, is body.
+func (d *document) symbol(start token.Position, name *ast.Ident, body ast.Node, kind int) DocumentSymbol {
+	selection := d.identRange(name)
+	r := Range{Start: d.position(start), End: d.position(d.endOf(start, body))}
+	if before(r.End, selection.End) {
+		r.End = selection.End
+	}
+	return DocumentSymbol{
+		Name:           name.Name,
+		Kind:           kind,
+		Range:          r,
+		SelectionRange: selection,
+	}
+}
+
+func before(a, b Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Character < b.Character
+}
+
+/* == completion ============================================================ */
+
+// completion returns the candidates for the word that ends at pos.
+func (d *document) completion(pos token.Position) []CompletionItem {
+	line := d.lines[pos.Line-1]
+	end := min(pos.Column-1, len(line))
+	start := end
+	for start > 0 && isNameRune(line[start-1]) {
+		start--
+	}
+	prefix := string(line[start:end])
+	items := []CompletionItem{}
+	seen := map[string]bool{}
+	add := func(label string, kind int, detail string) {
+		if strings.HasPrefix(label, prefix) && !seen[label] {
+			seen[label] = true
+			items = append(items, CompletionItem{Label: label, Kind: kind, Detail: detail})
+		}
+	}
+
+	if start > 0 && line[start-1] == '.' {
+		left := start - 1
+		for left > 0 && isNameRune(line[left-1]) {
+			left--
+		}
+		if imp := d.importOf(string(line[left : start-1])); imp != nil {
+			names, _ := resolver.Exports(imp.Path.Value, d.wd)
+			for _, name := range names {
+				add(name, completionVariable, "module "+imp.Path.String())
+			}
+			return sortItems(items)
+		}
+		for _, class := range sortedKeys(baseMethods()) {
+			for _, method := range baseMethods()[class] {
+				add(method, completionMethod, class)
+			}
+		}
+		return sortItems(items)
+	}
+
+	for id, decl := range d.info.Decls {
+		switch decl := decl.(type) {
+		case *ast.FunDecl:
+			add(id.Name, completionFunction, signature(funKeyword(decl.Fun), id.Name, decl.Fun))
+		case *ast.ClassDecl:
+			add(id.Name, completionClass, "class")
+		case *ast.ImportDecl:
+			add(id.Name, completionModule, "module "+decl.Path.String())
+		default:
+			add(id.Name, completionVariable, "")
+		}
+	}
+	ast.Inspect(d.script, func(node ast.Node) bool {
+		if imp, ok := node.(*ast.ImportDecl); ok && imp.Unwrap {
+			names, _ := resolver.Exports(imp.Path.Value, d.wd)
+			for _, name := range names {
+				add(name, completionVariable, "module "+imp.Path.String())
+			}
+		}
+		return true
+	})
+	for _, name := range builtinNames() {
+		if _, ok := baseMethods()[name]; ok {
+			add(name, completionClass, "builtin class")
+		} else {
+			add(name, completionFunction, "builtin")
+		}
+	}
+	for _, word := range scanner.Keywords() {
+		add(word, completionKeyword, "")
+	}
+	return sortItems(items)
+}
+
+func isNameRune(r rune) bool {
+	return r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9'
+}
@@ -0,0 +1,358 @@
+package lsp_test
+
+import (
+	"encoding/json"
+	"io"
+	"needle/internal/needle/framing"
+	"needle/internal/needle/framing/framingtest"
+	"needle/internal/needle/lsp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// client drives a server the way an editor would.
+type client struct {
+	*framingtest.Conn
+	t      *testing.T
+	nextID int
+}
+
+func start(t *testing.T) *client {
+	conn := framingtest.Start(t, func(in io.Reader, out io.Writer) error {
+		return lsp.NewServer(in, out).Run()
+	})
+	return &client{Conn: conn, t: t}
+}
+
+type incoming struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (c *client) send(msg map[string]any) {
+	c.t.Helper()
+	msg["jsonrpc"] = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := framing.Write(c.In, body); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) receive() *incoming {
+	c.t.Helper()
+	body, err := framing.Read(c.Out)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	msg := &incoming{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+func (c *client) notify(method string, params any) {
+	c.t.Helper()
+	c.send(map[string]any{"method": method, "params": params})
+}
+
+// call sends a request and decodes the result of its response into
+// result, it fails on error responses.
+func (c *client) call(method string, params any, result any) {
+	c.t.Helper()
+	msg := c.request(method, params)
+	if msg.Error != nil {
+		c.t.Fatalf("%s: %s (%d)", method, msg.Error.Message, msg.Error.Code)
+	}
+	if err := json.Unmarshal(msg.Result, result); err != nil {
+		c.t.Fatalf("%s: %s in %s", method, err, msg.Result)
+	}
+}
+
+func (c *client) request(method string, params any) *incoming {
+	c.t.Helper()
+	c.nextID++
+	c.send(map[string]any{"id": c.nextID, "method": method, "params": params})
+	msg := c.receive()
+	if msg.ID == nil || *msg.ID != c.nextID {
+		c.t.Fatalf("%s: expected the response to %d, got %+v", method, c.nextID, msg)
+	}
+	return msg
+}
+
+// diagnostics waits for the diagnostics of the next change.
+func (c *client) diagnostics() lsp.PublishDiagnosticsParams {
+	c.t.Helper()
+	msg := c.receive()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected diagnostics, got %+v", msg)
+	}
+	var params lsp.PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.t.Fatal(err)
+	}
+	return params
+}
+
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+func at(uri string, line, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	}
+}
+
+func labels(items []lsp.CompletionItem) []string {
+	labels := []string{}
+	for _, item := range items {
+		labels = append(labels, item.Label)
+	}
+	return labels
+}
+
+const script = `import m "math";
+import util "./util.ndl";
+
+class Point {
+  init new(x, y) { self.x = x; self.y = y; }
+  fun norm() -> m.sqrt(self.x * self.x + self.y * self.y)
+}
+
+fun add(a, b) {
+  var sum = a + b;
+  return sum;
+}
+
+var p = Point.new(3, 4);
+print(add(p.norm(), util.twice(1)));
+`
+
+func TestSession(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "util.ndl"), []byte("fun twice(x) -> x * 2;\nvar answer = 42;\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri := fileURI(filepath.Join(dir, "main.ndl"))
+	c := start(t)
+
+	var init struct {
+		Capabilities map[string]any `json:"capabilities"`
+	}
+	c.call("initialize", map[string]any{"capabilities": map[string]any{}}, &init)
+	for _, capability := range []string{"definitionProvider", "hoverProvider",
+		"documentSymbolProvider", "completionProvider", "documentFormattingProvider"} {
+		if init.Capabilities[capability] == nil {
+			t.Errorf("initialize: missing %s", capability)
+		}
+	}
+	c.notify("initialized", map[string]any{})
+
+	t.Run("diagnostics", func(t *testing.T) {
+		c.t = t
+		c.notify("textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{
+				"uri": uri, "languageId": "needle", "version": 1,
+				"text": "var a = 1;\nprint(b);\nvar c = (;\n",
+			},
+		})
+		diags := c.diagnostics()
+		if diags.URI != uri || len(diags.Diagnostics) != 1 {
+			t.Fatalf("expected one syntax error, got %+v", diags)
+		}
+		if line := diags.Diagnostics[0].Range.Start.Line; line != 2 {
+			t.Errorf("expected the syntax error on line 2, got %d", line)
+		}
+
+		c.notify("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": uri, "version": 2},
+			"contentChanges": []map[string]any{{"text": "var a = 1;\nprint(b);\n"}},
+		})
+		diags = c.diagnostics()
+		if len(diags.Diagnostics) != 1 || diags.Diagnostics[0].Range != (lsp.Range{
+			Start: lsp.Position{Line: 1, Character: 6},
+			End:   lsp.Position{Line: 1, Character: 7},
+		}) {
+			t.Fatalf("expected an undefined name at 2:7, got %+v", diags)
+		}
+
+		c.notify("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": uri, "version": 3},
+			"contentChanges": []map[string]any{{"text": script}},
+		})
+		if diags := c.diagnostics(); len(diags.Diagnostics) != 0 {
+			t.Fatalf("expected no diagnostics, got %+v", diags)
+		}
+	})
+
+	t.Run("definition", func(t *testing.T) {
+		c.t = t
+		var loc lsp.Location
+		c.call("textDocument/definition", at(uri, 10, 10), &loc) // sum in 'return sum'
+		want := lsp.Range{Start: lsp.Position{Line: 9, Character: 6}, End: lsp.Position{Line: 9, Character: 9}}
+		if loc.URI != uri || loc.Range != want {
+			t.Errorf("expected %v, got %+v", want, loc)
+		}
+		c.call("textDocument/definition", at(uri, 14, 7), &loc) // add in print(add(...))
+		if loc.Range.Start != (lsp.Position{Line: 8, Character: 4}) {
+			t.Errorf("expected the declaration of add, got %+v", loc)
+		}
+		msg := c.request("textDocument/definition", at(uri, 14, 1)) // print is a builtin
+		if string(msg.Result) != "null" {
+			t.Errorf("expected null for a builtin, got %s", msg.Result)
+		}
+	})
+
+	t.Run("hover", func(t *testing.T) {
+		c.t = t
+		var hover lsp.Hover
+		c.call("textDocument/hover", at(uri, 14, 8), &hover)
+		if want := "```needle\nfun add(a, b)\n```"; hover.Contents.Value != want {
+			t.Errorf("expected %q, got %q", want, hover.Contents.Value)
+		}
+		c.call("textDocument/hover", at(uri, 13, 9), &hover)
+		if want := "```needle\nclass Point\n    init new(x, y)\n    fun norm()\n```"; hover.Contents.Value != want {
+			t.Errorf("expected %q, got %q", want, hover.Contents.Value)
+		}
+	})
+
+	t.Run("symbols", func(t *testing.T) {
+		c.t = t
+		var symbols []lsp.DocumentSymbol
+		c.call("textDocument/documentSymbol", map[string]any{"textDocument": map[string]any{"uri": uri}}, &symbols)
+		names := []string{}
+		for _, symbol := range symbols {
+			names = append(names, symbol.Name)
+		}
+		if want := []string{"Point", "add", "p"}; !slices.Equal(names, want) {
+			t.Fatalf("expected %v, got %v", want, names)
+		}
+		point := symbols[0]
+		if len(point.Children) != 2 || point.Children[0].Name != "new" || point.Children[1].Name != "norm" {
+			t.Errorf("expected new and norm in Point, got %+v", point.Children)
+		}
+		if point.Range.Start.Line != 3 || point.Range.End.Line != 6 {
+			t.Errorf("expected Point on lines 3 to 6, got %+v", point.Range)
+		}
+		add := symbols[1]
+		if len(add.Children) != 1 || add.Children[0].Name != "sum" {
+			t.Errorf("expected sum in add, got %+v", add.Children)
+		}
+	})
+
+	t.Run("completion", func(t *testing.T) {
+		c.t = t
+		edit := func(text string) {
+			c.notify("textDocument/didChange", map[string]any{
+				"textDocument":   map[string]any{"uri": uri},
+				"contentChanges": []map[string]any{{"text": script + text}},
+			})
+			c.diagnostics()
+		}
+		var items []lsp.CompletionItem
+
+		edit("ad")
+		c.call("textDocument/completion", at(uri, 15, 2), &items)
+		if got := labels(items); !slices.Contains(got, "add") || slices.Contains(got, "print") {
+			t.Errorf("expected add and no print, got %v", got)
+		}
+
+		edit("pr")
+		c.call("textDocument/completion", at(uri, 15, 2), &items)
+		if got := labels(items); !slices.Contains(got, "print") {
+			t.Errorf("expected the builtin print, got %v", got)
+		}
+
+		edit("m.sq")
+		c.call("textDocument/completion", at(uri, 15, 4), &items)
+		if got := labels(items); !slices.Equal(got, []string{"sqrt"}) {
+			t.Errorf("expected sqrt, got %v", got)
+		}
+
+		edit("util.")
+		c.call("textDocument/completion", at(uri, 15, 5), &items)
+		if got := labels(items); !slices.Equal(got, []string{"answer", "twice"}) {
+			t.Errorf("expected answer and twice, got %v", got)
+		}
+
+		edit("[1].pu")
+		c.call("textDocument/completion", at(uri, 15, 6), &items)
+		if got := labels(items); !slices.Contains(got, "push") {
+			t.Errorf("expected the builtin method push, got %v", got)
+		}
+	})
+
+	t.Run("formatting", func(t *testing.T) {
+		c.t = t
+		c.notify("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": uri},
+			"contentChanges": []map[string]any{{"text": "var   a=1;\n"}},
+		})
+		c.diagnostics()
+		var edits []lsp.TextEdit
+		options := map[string]any{"tabSize": 2, "insertSpaces": true}
+		c.call("textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": uri}, "options": options}, &edits)
+		if len(edits) != 1 || edits[0].NewText != "var a = 1;\n" {
+			t.Errorf("expected one edit to 'var a = 1;', got %+v", edits)
+		}
+
+		c.notify("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": uri},
+			"contentChanges": []map[string]any{{"text": "var a = 1;\n"}},
+		})
+		c.diagnostics()
+		c.call("textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": uri}, "options": options}, &edits)
+		if len(edits) != 0 {
+			t.Errorf("expected no edits, got %+v", edits)
+		}
+	})
+
+	c.t = t
+	if msg := c.request("textDocument/unknown", map[string]any{}); msg.Error == nil || msg.Error.Code != -32601 {
+		t.Errorf("expected method not found, got %+v", msg)
+	}
+	c.notify("textDocument/didClose", map[string]any{"textDocument": map[string]any{"uri": uri}})
+	if diags := c.diagnostics(); len(diags.Diagnostics) != 0 {
+		t.Errorf("expected the diagnostics cleared, got %+v", diags)
+	}
+	var null any
+	c.call("shutdown", nil, &null)
+	c.notify("exit", nil)
+	select {
+	case err := <-c.Done:
+		if err != nil {
+			t.Errorf("exit: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server did not exit")
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	c := start(t)
+	c.notify("exit", nil)
+	select {
+	case err := <-c.Done:
+		if err == nil {
+			t.Error("expected an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server did not exit")
+	}
+}
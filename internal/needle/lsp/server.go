@@ -0,0 +1,272 @@
+// Package lsp is a Language Server Protocol server for needle scripts.
+// It talks JSON-RPC over a reader and a writer, usually stdin and stdout.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"needle/internal/needle"
+	"needle/internal/needle/ast"
+	"needle/internal/needle/evaluator"
+	"slices"
+	"sort"
+)
+
+// Server answers the requests of one client.
+type Server struct {
+	in       *bufio.Reader
+	out      io.Writer
+	docs     map[string]*document
+	shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: map[string]*document{},
+	}
+}
+
+// Run serves requests until the client sends 'exit' or closes the input.
+// Exiting without a 'shutdown' request first is an error.
+func (s *Server) Run() error {
+	for {
+		msg, err := readMessage(s.in)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var rpcErr *responseError
+		if errors.As(err, &rpcErr) {
+			s.reply(nil, nil, rpcErr)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("lsp: exit without shutdown")
+			}
+			return nil
+		}
+		if msg.ID == nil {
+			s.notification(msg)
+			continue
+		}
+		result, err := s.request(msg)
+		if err != nil && !errors.As(err, &rpcErr) {
+			rpcErr = &responseError{Code: codeInternalError, Message: err.Error()}
+		}
+		s.reply(msg.ID, result, rpcErr)
+	}
+}
+
+func (s *Server) reply(id *json.RawMessage, result any, rpcErr *responseError) {
+	msg := &message{ID: id, Error: rpcErr}
+	if id == nil {
+		null := json.RawMessage("null")
+		msg.ID = &null
+	}
+	if rpcErr == nil {
+		msg.Result, _ = json.Marshal(result)
+	}
+	writeMessage(s.out, msg)
+}
+
+func (s *Server) notify(method string, params any) {
+	raw, _ := json.Marshal(params)
+	writeMessage(s.out, &message{Method: method, Params: raw})
+}
+
+func (s *Server) notification(msg *message) {
+	switch msg.Method {
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if json.Unmarshal(msg.Params, &params) == nil {
+			s.open(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if json.Unmarshal(msg.Params, &params) == nil && len(params.ContentChanges) > 0 {
+			// the server asks for full syncs, the last change is the text
+			text := params.ContentChanges[len(params.ContentChanges)-1].Text
+			s.open(params.TextDocument.URI, text)
+		}
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if json.Unmarshal(msg.Params, &params) == nil {
+			delete(s.docs, params.TextDocument.URI)
+			s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+				URI:         params.TextDocument.URI,
+				Diagnostics: []Diagnostic{},
+			})
+		}
+	}
+}
+
+func (s *Server) open(uri, text string) {
+	doc := newDocument(uri, text)
+	s.docs[uri] = doc
+	s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: doc.diagnostics(),
+	})
+}
+
+func (s *Server) request(msg *message) (any, error) {
+	if s.shutdown {
+		return nil, &responseError{Code: codeInvalidRequest, Message: "server is shut down"}
+	}
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":           1, // full text on every change
+				"definitionProvider":         true,
+				"hoverProvider":              true,
+				"documentSymbolProvider":     true,
+				"documentFormattingProvider": true,
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{"."},
+				},
+			},
+			"serverInfo": map[string]string{
+				"name":    "needle",
+				"version": needle.Version,
+			},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/definition":
+		return withPosition(s, msg, func(doc *document, params TextDocumentPositionParams) (any, error) {
+			id, prop, _ := doc.identAt(doc.scriptPosition(params.Position))
+			if id == nil || prop != nil {
+				return nil, nil
+			}
+			decl := doc.declaration(id)
+			if decl == nil {
+				return nil, nil
+			}
+			return Location{URI: doc.uri, Range: doc.identRange(decl)}, nil
+		})
+	case "textDocument/hover":
+		return withPosition(s, msg, func(doc *document, params TextDocumentPositionParams) (any, error) {
+			text, r := doc.hover(doc.scriptPosition(params.Position))
+			if text == "" {
+				return nil, nil
+			}
+			return Hover{Contents: MarkupContent{Kind: "markdown", Value: text}, Range: r}, nil
+		})
+	case "textDocument/completion":
+		return withPosition(s, msg, func(doc *document, params TextDocumentPositionParams) (any, error) {
+			return doc.completion(doc.scriptPosition(params.Position)), nil
+		})
+	case "textDocument/documentSymbol":
+		return withDocument(s, msg, func(doc *document) (any, error) {
+			return doc.symbols(doc.script.Decls), nil
+		})
+	case "textDocument/formatting":
+		return withDocument(s, msg, func(doc *document) (any, error) {
+			out, err := needle.Format(doc.source)
+			if err != nil {
+				// nothing to do until the script parses
+				return nil, nil
+			}
+			edits := []TextEdit{}
+			if out != string(doc.source) {
+				edits = append(edits, TextEdit{Range: doc.wholeRange(), NewText: out})
+			}
+			return edits, nil
+		})
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+}
+
+// withDocument decodes the document of a request and runs f on it, the
+// result is null for documents that are not open.
+func withDocument(s *Server, msg *message, f func(*document) (any, error)) (any, error) {
+	var params DocumentParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+	return f(doc)
+}
+
+func withPosition(s *Server, msg *message, f func(*document, TextDocumentPositionParams) (any, error)) (any, error) {
+	var params TextDocumentPositionParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+	return f(doc, params)
+}
+
+/* == utility =============================================================== */
+
+// baseMethods returns the sorted method names of every base class.
+func baseMethods() map[string][]string {
+	methods := evaluator.MethodNames()
+	for _, names := range methods {
+		sort.Strings(names)
+	}
+	return methods
+}
+
+func builtinNames() []string {
+	names := evaluator.GlobalNames()
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedNames returns the method names of a class in source order.
+func sortedNames(funs map[*ast.Ident]*ast.FunLit) []*ast.Ident {
+	names := []*ast.Ident{}
+	for name := range funs {
+		names = append(names, name)
+	}
+	sortIdents(names)
+	return names
+}
+
+func sortIdents(ids []*ast.Ident) {
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := ids[i].Pos(), ids[j].Pos()
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+func sortItems(items []CompletionItem) []CompletionItem {
+	slices.SortFunc(items, func(a, b CompletionItem) int {
+		switch {
+		case a.Label < b.Label:
+			return -1
+		case a.Label > b.Label:
+			return 1
+		}
+		return 0
+	})
+	return items
+}
@@ -1,24 +1,43 @@
 package parser
 
 import (
-	"errors"
 	"fmt"
 	"needle/internal/needle/ast"
 	"needle/internal/needle/token"
+	"slices"
 	"strconv"
+	"strings"
+	"unicode"
 )
 
 type Tokenizer interface {
 	NextToken() *token.Token
 }
 
+// commenter is a tokenizer keeping the comments it skips, the parser
+// takes doc comments from it.
+type commenter interface {
+	Comments() []*token.Comment
+}
+
 type Parser struct {
 	tokenizer Tokenizer
+	previous  *token.Token
 	current   *token.Token
 	backpack  *token.Token
 	errors    []error
+	kind      funKind // kind of the function being parsed
 }
 
+type funKind int
+
+const (
+	funNone funKind = iota // top level
+	funPlain
+	funGenerator
+	funAsync
+)
+
 func New(tokenizer Tokenizer) *Parser {
 	p := &Parser{
 		tokenizer: tokenizer,
@@ -32,13 +51,14 @@ func New(tokenizer Tokenizer) *Parser {
 func (p *Parser) Parse() (*ast.Script, []error) {
 	script := &ast.Script{
 		Decls: []ast.Decl{},
+		Doc:   p.scriptDoc(),
 	}
 
 	for !p.check(token.EOF) {
 		decl := p.catch(p.declaration)
 		if decl == nil {
 			p.synchronize()
-			decl = newBadDecl()
+			decl = p.newBadDecl()
 		}
 		script.Decls = append(script.Decls, decl)
 		p.advance()
@@ -48,8 +68,25 @@ func (p *Parser) Parse() (*ast.Script, []error) {
 }
 
 func (p *Parser) declaration() ast.Decl {
+	doc := p.doc()
+	decl := p.undocumentedDecl()
+	switch decl := decl.(type) {
+	case *ast.VarDecl:
+		decl.Doc = doc
+	case *ast.FunDecl:
+		decl.Fun.Doc = doc
+	case *ast.ClassDecl:
+		decl.Doc = doc
+	}
+	return decl
+}
+
+func (p *Parser) undocumentedDecl() ast.Decl {
 	switch p.current.Type {
 	case token.VAR:
+		if t := p.peek().Type; t == token.VEC || t == token.MAP {
+			return p.destructDecl()
+		}
 		return p.varDecl()
 	case token.IDENT:
 		if p.peek().Type == token.DEF {
@@ -57,9 +94,19 @@ func (p *Parser) declaration() ast.Decl {
 		}
 	case token.IMPORT:
 		return p.importDecl()
-	case token.FUN:
+	case token.FUN, token.FUN_STAR:
+		if p.peek().Type == token.IDENT {
+			return p.funDecl(p.funKind())
+		}
+	case token.ASYNC:
+		p.expect(token.FUN)
 		if p.peek().Type == token.IDENT {
-			return p.funDecl()
+			return p.funDecl(funAsync)
+		}
+		expr := p.postfix(p.funLit(funAsync), LOWEST)
+		return &ast.StmtDecl{
+			Loc:  ast.Loc{Position: expr.Pos()},
+			Stmt: p.exprStmt(expr),
 		}
 	case token.CLASS:
 		if p.peek().Type == token.IDENT {
@@ -67,6 +114,7 @@ func (p *Parser) declaration() ast.Decl {
 		}
 	}
 	return &ast.StmtDecl{
+		Loc:  p.loc(),
 		Stmt: p.statement(),
 	}
 }
@@ -74,7 +122,7 @@ func (p *Parser) declaration() ast.Decl {
 func (p *Parser) statement() ast.Stmt {
 	switch p.current.Type {
 	case token.SEMI:
-		return newNullStmt()
+		return p.newNullStmt()
 	case token.L_BRACE:
 		return p.block()
 	case token.FOR:
@@ -94,21 +142,31 @@ func (p *Parser) statement() ast.Stmt {
 	case token.RETURN:
 		return p.returnStmt()
 	case token.BREAK:
+		loc := p.loc()
 		p.expect(token.SEMI)
-		return &ast.BreakStmt{}
+		return &ast.BreakStmt{Loc: loc}
 	case token.CONTINUE:
+		loc := p.loc()
 		p.expect(token.SEMI)
-		return &ast.ContinueStmt{}
+		return &ast.ContinueStmt{Loc: loc}
 	}
 
-	expr := p.expression(LOWEST)
+	return p.exprStmt(p.expression(LOWEST))
+}
+
+// exprStmt finishes a statement that starts with an already parsed
+// expression: an assignment or an expression statement.
+func (p *Parser) exprStmt(expr ast.Expr) ast.Stmt {
+	if isDestruct(expr, p.peek().Type) {
+		return p.destructStmt(expr, true)
+	}
 	if isAssign(p.peek().Type) {
 		p.advance()
 		return p.assignStmt(expr, true)
 	}
 
 	p.expect(token.SEMI)
-	return &ast.ExprStmt{Expr: expr}
+	return &ast.ExprStmt{Loc: ast.Loc{Position: expr.Pos()}, Expr: expr}
 }
 
 func (p *Parser) expression(prec precedence) ast.Expr {
@@ -127,40 +185,53 @@ func (p *Parser) expression(prec precedence) ast.Expr {
 
 	case token.CLASS:
 		expr = p.classLit()
-	case token.FUN:
-		expr = p.funLit()
+	case token.FUN, token.FUN_STAR:
+		expr = p.funLit(p.funKind())
+	case token.ASYNC:
+		p.expect(token.FUN)
+		expr = p.funLit(funAsync)
+	case token.YIELD:
+		expr = p.yieldExpr()
+	case token.AWAIT:
+		expr = p.awaitExpr()
+	case token.SPAWN:
+		expr = p.spawnExpr()
 	case token.VEC:
 		expr = p.vectorLit()
 	case token.MAP:
 		expr = p.mapLit()
 
 	case token.NULL:
-		expr = &ast.NullLit{}
+		expr = &ast.NullLit{Loc: p.loc()}
 	case token.BOOLEAN:
 		if val, err := strconv.ParseBool(p.current.Literal); err != nil {
 			panic(err)
 		} else {
-			expr = &ast.BooleanLit{Value: val}
+			expr = &ast.BooleanLit{Loc: p.loc(), Value: val}
 		}
 	case token.NUMBER:
 		if val, err := strconv.ParseFloat(p.current.Literal, 64); err != nil {
 			panic(err)
 		} else {
-			expr = &ast.NumberLit{Value: val}
+			expr = &ast.NumberLit{Loc: p.loc(), Value: val}
 		}
 	case token.STRING:
-		expr = &ast.StringLit{Value: p.current.Literal}
+		expr = &ast.StringLit{Loc: p.loc(), Value: p.current.Literal}
 
 	case token.IDENT:
 		expr = p.ident()
 	case token.SELF:
-		expr = &ast.SelfLit{}
+		expr = &ast.SelfLit{Loc: p.loc()}
 
 	case token.MINUS, token.PLUS, token.WOW:
 		op := p.current
 		p.advance()
 		e := p.expression(UN)
-		expr = &ast.PrefixExpr{Right: e, Op: op}
+		expr = &ast.PrefixExpr{
+			Loc:   ast.Loc{Position: op.Position},
+			Right: e,
+			Op:    op,
+		}
 	default:
 		panicParseError(
 			p.current,
@@ -169,6 +240,12 @@ func (p *Parser) expression(prec precedence) ast.Expr {
 		)
 	}
 
+	return p.postfix(expr, prec)
+}
+
+// postfix parses the infix and postfix operators following expr
+// while they bind tighter than prec.
+func (p *Parser) postfix(expr ast.Expr, prec precedence) ast.Expr {
 	for prec < p.peekPrecedence() {
 		p.advance()
 		switch p.current.Type {
@@ -197,14 +274,18 @@ func (p *Parser) expression(prec precedence) ast.Expr {
 /* == declarations ========================================================== */
 
 func (p *Parser) varDecl() *ast.VarDecl {
-	decl := &ast.VarDecl{}
+	decl := &ast.VarDecl{Loc: p.loc()}
 
 	p.expect(token.IDENT)
 	decl.Name = p.ident()
 
 	p.advance()
+	if p.check(token.COLON) {
+		decl.Type = p.typeAnnotation()
+		p.advance()
+	}
 	if p.check(token.SEMI) {
-		decl.Right = newNullExpr()
+		decl.Right = p.newNullExpr()
 		return decl
 	} else if p.check(token.ASSIGN) {
 		p.advance()
@@ -219,8 +300,19 @@ func (p *Parser) varDecl() *ast.VarDecl {
 	return nil
 }
 
+func (p *Parser) destructDecl() *ast.DestructDecl {
+	decl := &ast.DestructDecl{Loc: p.loc()}
+	p.advance()
+	decl.Pattern = p.pattern()
+	p.expect(token.ASSIGN)
+	p.advance()
+	decl.Right = p.expression(LOWEST)
+	p.expect(token.SEMI)
+	return decl
+}
+
 func (p *Parser) defDecl() *ast.VarDecl {
-	decl := &ast.VarDecl{}
+	decl := &ast.VarDecl{Loc: p.loc()}
 	decl.Name = p.ident()
 	p.expect(token.DEF)
 	p.advance()
@@ -230,10 +322,10 @@ func (p *Parser) defDecl() *ast.VarDecl {
 }
 
 func (p *Parser) importDecl() *ast.ImportDecl {
-	decl := &ast.ImportDecl{}
+	decl := &ast.ImportDecl{Loc: p.loc()}
 	if p.peek().Type == token.DOT {
 		p.advance()
-		decl.Alias = &ast.Ident{Name: "."}
+		decl.Alias = &ast.Ident{Loc: p.loc(), Name: "."}
 		decl.Unwrap = true
 	} else {
 		p.expect(token.IDENT)
@@ -241,21 +333,21 @@ func (p *Parser) importDecl() *ast.ImportDecl {
 		decl.Unwrap = false
 	}
 	p.expect(token.STRING)
-	decl.Path = &ast.StringLit{Value: p.current.Literal}
+	decl.Path = &ast.StringLit{Loc: p.loc(), Value: p.current.Literal}
 	p.expect(token.SEMI)
 	return decl
 }
 
-func (p *Parser) funDecl() *ast.FunDecl {
-	decl := &ast.FunDecl{}
+func (p *Parser) funDecl(kind funKind) *ast.FunDecl {
+	decl := &ast.FunDecl{Loc: p.loc()}
 	p.expect(token.IDENT)
 	decl.Name = p.ident()
-	decl.Fun = p.funLit()
+	decl.Fun = p.funLit(kind)
 	return decl
 }
 
 func (p *Parser) classDecl() *ast.ClassDecl {
-	decl := &ast.ClassDecl{}
+	decl := &ast.ClassDecl{Loc: p.loc()}
 	p.expect(token.IDENT)
 	decl.Name = p.ident()
 	decl.Class = p.classLit()
@@ -266,6 +358,7 @@ func (p *Parser) classDecl() *ast.ClassDecl {
 
 func (p *Parser) block() *ast.Block {
 	block := &ast.Block{
+		Loc:   p.loc(),
 		Decls: []ast.Decl{},
 	}
 
@@ -274,7 +367,7 @@ func (p *Parser) block() *ast.Block {
 		decl := p.catch(p.declaration)
 		if decl == nil {
 			p.synchronize()
-			decl = newBadDecl()
+			decl = p.newBadDecl()
 		}
 		block.Decls = append(block.Decls, decl)
 		p.advance()
@@ -289,28 +382,36 @@ func (p *Parser) block() *ast.Block {
 	return block
 }
 
-func (p *Parser) forStmt() *ast.ForStmt {
-	stmt := &ast.ForStmt{}
+func (p *Parser) forStmt() ast.Stmt {
+	stmt := &ast.ForStmt{Loc: p.loc()}
 	p.expect(token.L_PAREN)
 	p.advance()
+	if p.check(token.IDENT) && p.peek().Type == token.IN {
+		return p.forInStmt(stmt.Loc)
+	}
 	stmt.Init = p.declaration()
 	p.advance()
 	if p.check(token.SEMI) {
-		stmt.Cond = &ast.BooleanLit{Value: true}
+		stmt.Cond = &ast.BooleanLit{Loc: p.loc(), Value: true}
 	} else {
 		stmt.Cond = p.expression(LOWEST)
 		p.expect(token.SEMI)
 	}
 	p.advance()
 	if p.check(token.R_PAREN) {
-		stmt.Post = newNullStmt()
+		stmt.Post = p.newNullStmt()
 	} else {
 		post := p.expression(LOWEST)
-		if isAssign(p.peek().Type) {
+		if isDestruct(post, p.peek().Type) {
+			stmt.Post = p.destructStmt(post, false)
+		} else if isAssign(p.peek().Type) {
 			p.advance()
 			stmt.Post = p.assignStmt(post, false)
 		} else {
-			stmt.Post = &ast.ExprStmt{Expr: post}
+			stmt.Post = &ast.ExprStmt{
+				Loc:  ast.Loc{Position: post.Pos()},
+				Expr: post,
+			}
 		}
 		p.expect(token.R_PAREN)
 	}
@@ -319,8 +420,20 @@ func (p *Parser) forStmt() *ast.ForStmt {
 	return stmt
 }
 
+func (p *Parser) forInStmt(loc ast.Loc) *ast.ForInStmt {
+	stmt := &ast.ForInStmt{Loc: loc}
+	stmt.Name = p.ident()
+	p.expect(token.IN)
+	p.advance()
+	stmt.Iter = p.expression(LOWEST)
+	p.expect(token.R_PAREN)
+	p.advance()
+	stmt.Repeat = p.statement()
+	return stmt
+}
+
 func (p *Parser) whileStmt() *ast.WhileStmt {
-	stmt := &ast.WhileStmt{}
+	stmt := &ast.WhileStmt{Loc: p.loc()}
 	p.expect(token.L_PAREN)
 	p.advance()
 	stmt.Cond = p.expression(LOWEST)
@@ -331,7 +444,7 @@ func (p *Parser) whileStmt() *ast.WhileStmt {
 }
 
 func (p *Parser) doStmt() *ast.DoStmt {
-	stmt := &ast.DoStmt{}
+	stmt := &ast.DoStmt{Loc: p.loc()}
 	p.advance()
 	stmt.Do = p.statement()
 	p.expect(token.WHILE)
@@ -344,7 +457,7 @@ func (p *Parser) doStmt() *ast.DoStmt {
 }
 
 func (p *Parser) ifStmt() *ast.IfStmt {
-	stmt := &ast.IfStmt{}
+	stmt := &ast.IfStmt{Loc: p.loc()}
 	p.expect(token.L_PAREN)
 	p.advance()
 	stmt.Cond = p.expression(LOWEST)
@@ -356,13 +469,13 @@ func (p *Parser) ifStmt() *ast.IfStmt {
 		p.advance()
 		stmt.Else = p.statement()
 	} else {
-		stmt.Else = newNullStmt()
+		stmt.Else = p.newNullStmt()
 	}
 	return stmt
 }
 
 func (p *Parser) sayStmt() *ast.SayStmt {
-	stmt := &ast.SayStmt{}
+	stmt := &ast.SayStmt{Loc: p.loc()}
 	p.advance()
 	stmt.Expr = p.expression(LOWEST)
 	p.expect(token.SEMI)
@@ -370,7 +483,7 @@ func (p *Parser) sayStmt() *ast.SayStmt {
 }
 
 func (p *Parser) tryStmt() *ast.TryStmt {
-	stmt := &ast.TryStmt{}
+	stmt := &ast.TryStmt{Loc: p.loc()}
 	ended := false
 	p.advance()
 	stmt.Try = p.statement()
@@ -384,8 +497,8 @@ func (p *Parser) tryStmt() *ast.TryStmt {
 		stmt.Catch = p.statement()
 		ended = true
 	} else {
-		stmt.As = &ast.Ident{Name: "_"}
-		stmt.Catch = newNullStmt()
+		stmt.As = &ast.Ident{Loc: p.loc(), Name: "_"}
+		stmt.Catch = p.newNullStmt()
 	}
 	if p.peek().Type == token.FINALLY {
 		p.advance()
@@ -393,7 +506,7 @@ func (p *Parser) tryStmt() *ast.TryStmt {
 		stmt.Finally = p.statement()
 		ended = true
 	} else {
-		stmt.Finally = newNullStmt()
+		stmt.Finally = p.newNullStmt()
 	}
 	if !ended {
 		panicParseError(
@@ -405,7 +518,7 @@ func (p *Parser) tryStmt() *ast.TryStmt {
 }
 
 func (p *Parser) throwStmt() *ast.ThrowStmt {
-	stmt := &ast.ThrowStmt{}
+	stmt := &ast.ThrowStmt{Loc: p.loc()}
 	p.advance()
 	stmt.Error = p.expression(LOWEST)
 	p.expect(token.SEMI)
@@ -413,10 +526,10 @@ func (p *Parser) throwStmt() *ast.ThrowStmt {
 }
 
 func (p *Parser) returnStmt() *ast.ReturnStmt {
-	stmt := &ast.ReturnStmt{}
+	stmt := &ast.ReturnStmt{Loc: p.loc()}
 	p.advance()
 	if p.check(token.SEMI) {
-		stmt.Value = newNullExpr()
+		stmt.Value = p.newNullExpr()
 		return stmt
 	}
 	stmt.Value = p.expression(LOWEST)
@@ -425,7 +538,10 @@ func (p *Parser) returnStmt() *ast.ReturnStmt {
 }
 
 func (p *Parser) assignStmt(left ast.Expr, semiEnd bool) *ast.AssignStmt {
-	stmt := &ast.AssignStmt{Left: left}
+	stmt := &ast.AssignStmt{
+		Loc:  ast.Loc{Position: left.Pos()},
+		Left: left,
+	}
 	if p.check(token.ASSIGN) {
 		p.advance()
 		stmt.Right = p.expression(LOWEST)
@@ -433,6 +549,7 @@ func (p *Parser) assignStmt(left ast.Expr, semiEnd bool) *ast.AssignStmt {
 		op := convertToken(p.current)
 		p.advance()
 		stmt.Right = &ast.InfixExpr{
+			Loc:   ast.Loc{Position: left.Pos()},
 			Left:  left,
 			Op:    op,
 			Right: p.expression(LOWEST),
@@ -444,34 +561,260 @@ func (p *Parser) assignStmt(left ast.Expr, semiEnd bool) *ast.AssignStmt {
 	return stmt
 }
 
+func (p *Parser) destructStmt(first ast.Expr, semiEnd bool) *ast.DestructStmt {
+	stmt := &ast.DestructStmt{Loc: ast.Loc{Position: first.Pos()}}
+	if p.peek().Type == token.ASSIGN {
+		stmt.Pattern = p.target(first)
+	} else {
+		pattern := &ast.VectorPattern{
+			Loc:   ast.Loc{Position: first.Pos()},
+			Elems: []ast.Pattern{p.target(first)},
+		}
+		for p.peek().Type == token.COMMA {
+			p.advance()
+			p.advance()
+			if p.check(token.ELLIPSIS) {
+				p.advance()
+				pattern.Rest = p.target(p.expression(LOWEST))
+				break
+			}
+			pattern.Elems = append(
+				pattern.Elems,
+				p.target(p.expression(LOWEST)),
+			)
+		}
+		stmt.Pattern = pattern
+	}
+	p.expect(token.ASSIGN)
+	p.advance()
+	right := p.expression(LOWEST)
+	if p.peek().Type == token.COMMA {
+		vec := &ast.VectorLit{
+			Loc:   ast.Loc{Position: right.Pos()},
+			Elems: []ast.Expr{right},
+		}
+		for p.peek().Type == token.COMMA {
+			p.advance()
+			p.advance()
+			vec.Elems = append(vec.Elems, p.expression(LOWEST))
+		}
+		right = vec
+	}
+	stmt.Right = right
+	if semiEnd {
+		p.expect(token.SEMI)
+	}
+	return stmt
+}
+
+/* == patterns ============================================================== */
+
+func (p *Parser) pattern() ast.Pattern {
+	switch p.current.Type {
+	case token.IDENT:
+		return p.ident()
+	case token.VEC:
+		return p.vectorPattern()
+	case token.MAP:
+		return p.mapPattern()
+	}
+	panicParseError(
+		p.current,
+		"expected pattern",
+	)
+	return nil
+}
+
+func (p *Parser) vectorPattern() *ast.VectorPattern {
+	pattern := &ast.VectorPattern{
+		Loc:   p.loc(),
+		Elems: []ast.Pattern{},
+	}
+	p.expect(token.L_BRACE)
+	p.advance()
+	if p.check(token.R_BRACE) {
+		return pattern
+	}
+	for {
+		if p.check(token.ELLIPSIS) {
+			pattern.Rest = p.restPattern()
+			break
+		}
+		pattern.Elems = append(pattern.Elems, p.patternElement())
+		p.advance()
+		if p.check(token.R_BRACE) {
+			break
+		}
+		if !p.check(token.COMMA) {
+			panicParseError(
+				p.current,
+				"expected ',' or '}'",
+			)
+		}
+		p.advance()
+		if p.check(token.R_BRACE) {
+			break
+		}
+	}
+	return pattern
+}
+
+func (p *Parser) mapPattern() *ast.MapPattern {
+	pattern := &ast.MapPattern{
+		Loc:    p.loc(),
+		Keys:   []ast.Expr{},
+		Values: []ast.Pattern{},
+	}
+	p.expect(token.L_BRACE)
+	p.advance()
+	if p.check(token.R_BRACE) {
+		return pattern
+	}
+	for {
+		if p.check(token.ELLIPSIS) {
+			pattern.Rest = p.restPattern()
+			break
+		}
+		pattern.Keys = append(pattern.Keys, p.expression(LOWEST))
+		p.expect(token.COLON)
+		p.advance()
+		pattern.Values = append(pattern.Values, p.patternElement())
+		p.advance()
+		if p.check(token.R_BRACE) {
+			break
+		}
+		if !p.check(token.COMMA) {
+			panicParseError(
+				p.current,
+				"expected ',' or '}'",
+			)
+		}
+		p.advance()
+		if p.check(token.R_BRACE) {
+			break
+		}
+	}
+	return pattern
+}
+
+func (p *Parser) patternElement() ast.Pattern {
+	target := p.pattern()
+	if p.peek().Type != token.ASSIGN {
+		return target
+	}
+	p.advance()
+	p.advance()
+	return &ast.DefaultPattern{
+		Loc:     ast.Loc{Position: target.Pos()},
+		Target:  target,
+		Default: p.expression(LOWEST),
+	}
+}
+
+// restPattern parses '...name' which must close the enclosing pattern.
+func (p *Parser) restPattern() ast.Pattern {
+	p.expect(token.IDENT)
+	rest := p.ident()
+	p.advance()
+	if p.check(token.COMMA) {
+		p.advance()
+	}
+	if !p.check(token.R_BRACE) {
+		panicParseError(
+			p.current,
+			"expected '}' after rest element",
+		)
+	}
+	return rest
+}
+
+// target converts an already parsed expression into an assignment pattern.
+func (p *Parser) target(expr ast.Expr) ast.Pattern {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return expr
+	case *ast.PropExpr:
+		return expr
+	case *ast.IndexExpr:
+		return expr
+	case *ast.VectorLit:
+		pattern := &ast.VectorPattern{
+			Loc:   expr.Loc,
+			Elems: []ast.Pattern{},
+		}
+		for _, elem := range expr.Elems {
+			pattern.Elems = append(pattern.Elems, p.target(elem))
+		}
+		return pattern
+	case *ast.MapLit:
+		pattern := &ast.MapPattern{
+			Loc:    expr.Loc,
+			Keys:   []ast.Expr{},
+			Values: []ast.Pattern{},
+		}
+		for _, k := range expr.Keys {
+			pattern.Keys = append(pattern.Keys, k)
+			pattern.Values = append(pattern.Values, p.target(expr.Pairs[k]))
+		}
+		return pattern
+	}
+	panicParseError(
+		p.current,
+		"can't assign to '%s'",
+		expr,
+	)
+	return nil
+}
+
 /* == expressions =========================================================== */
 
 func (p *Parser) ident() *ast.Ident {
 	return &ast.Ident{
+		Loc:  p.loc(),
 		Name: p.current.Literal,
 	}
 }
 
 func (p *Parser) classLit() *ast.ClassLit {
 	lit := &ast.ClassLit{
-		Inits: map[*ast.Ident]*ast.FunLit{},
-		Funs:  map[*ast.Ident]*ast.FunLit{},
+		Loc:    p.loc(),
+		Inits:  map[*ast.Ident]*ast.FunLit{},
+		Funs:   map[*ast.Ident]*ast.FunLit{},
+		Fields: map[*ast.Ident]*ast.Type{},
 	}
 	p.expect(token.L_BRACE)
 	p.advance()
 	for !p.check(token.R_BRACE) {
-		if p.current.Literal == LIT_INIT {
+		doc := p.doc()
+		if p.check(token.VAR) {
 			p.expect(token.IDENT)
 			name := p.ident()
-			lit.Inits[name] = p.funLit()
-		} else if p.check(token.FUN) {
+			var t *ast.Type
+			if p.peek().Type == token.COLON {
+				p.advance()
+				t = p.typeAnnotation()
+			}
+			p.expect(token.SEMI)
+			lit.Fields[name] = t
+		} else if p.current.Literal == LIT_INIT {
 			p.expect(token.IDENT)
 			name := p.ident()
-			lit.Funs[name] = p.funLit()
+			lit.Inits[name] = p.funLit(funPlain)
+			lit.Inits[name].Doc = doc
+		} else if p.check(token.FUN) || p.check(token.FUN_STAR) ||
+			p.check(token.ASYNC) {
+			kind := p.funKind()
+			if p.check(token.ASYNC) {
+				p.expect(token.FUN)
+			}
+			p.expect(token.IDENT)
+			name := p.ident()
+			lit.Funs[name] = p.funLit(kind)
+			lit.Funs[name].Doc = doc
 		} else {
 			panicParseError(
 				p.current,
-				"expected method declaration",
+				"expected field or method declaration",
 			)
 		}
 		p.advance()
@@ -485,14 +828,25 @@ func (p *Parser) classLit() *ast.ClassLit {
 	return lit
 }
 
-func (p *Parser) funLit() *ast.FunLit {
-	lit := &ast.FunLit{}
+func (p *Parser) funLit(kind funKind) *ast.FunLit {
+	lit := &ast.FunLit{
+		Loc:       p.loc(),
+		Generator: kind == funGenerator,
+		Async:     kind == funAsync,
+	}
+	outer := p.kind
+	p.kind = kind
+	defer func() { p.kind = outer }()
 	p.expect(token.L_PAREN)
-	lit.Params = p.parameters()
+	lit.Params, lit.Rest = p.parameters()
+	if p.peek().Type == token.COLON {
+		p.advance()
+		lit.Return = p.typeAnnotation()
+	}
 	if p.peek().Type != token.L_BRACE {
 		p.expect(token.ARROW)
 		p.advance()
-		lit.Body = &ast.ReturnStmt{Value: p.expression(LOWEST)}
+		lit.Body = &ast.ReturnStmt{Loc: p.loc(), Value: p.expression(LOWEST)}
 	} else {
 		p.advance()
 		lit.Body = p.statement()
@@ -500,22 +854,67 @@ func (p *Parser) funLit() *ast.FunLit {
 	return lit
 }
 
+func (p *Parser) yieldExpr() *ast.YieldExpr {
+	if p.kind != funGenerator {
+		panicParseError(
+			p.current,
+			"'yield' outside generator",
+		)
+	}
+	expr := &ast.YieldExpr{Loc: p.loc()}
+	switch p.peek().Type {
+	case token.SEMI, token.R_PAREN, token.R_BRACE, token.R_BRACK,
+		token.COMMA, token.COLON:
+		expr.Value = p.newNullExpr()
+	default:
+		p.advance()
+		expr.Value = p.expression(LOWEST)
+	}
+	return expr
+}
+
+func (p *Parser) awaitExpr() *ast.AwaitExpr {
+	if p.kind != funAsync && p.kind != funNone {
+		panicParseError(
+			p.current,
+			"'await' outside async function",
+		)
+	}
+	loc := p.loc()
+	p.advance()
+	return &ast.AwaitExpr{Loc: loc, Value: p.expression(UN)}
+}
+
+func (p *Parser) spawnExpr() *ast.SpawnExpr {
+	loc := p.loc()
+	p.advance()
+	call, ok := p.expression(UN).(*ast.CallExpr)
+	if !ok {
+		panicParseError(
+			p.current,
+			"expected call after 'spawn'",
+		)
+	}
+	return &ast.SpawnExpr{Loc: loc, Call: call}
+}
+
 func (p *Parser) vectorLit() *ast.VectorLit {
-	lit := &ast.VectorLit{}
+	lit := &ast.VectorLit{Loc: p.loc()}
 	p.expect(token.L_BRACE)
 	lit.Elems = p.vectorElements()
 	return lit
 }
 
 func (p *Parser) mapLit() *ast.MapLit {
-	lit := &ast.MapLit{}
+	lit := &ast.MapLit{Loc: p.loc()}
 	p.expect(token.L_BRACE)
-	lit.Pairs = p.mapPairs()
+	lit.Pairs, lit.Keys = p.mapPairs()
 	return lit
 }
 
 func (p *Parser) infixExpr(left ast.Expr) *ast.InfixExpr {
 	expr := &ast.InfixExpr{
+		Loc:  ast.Loc{Position: left.Pos()},
 		Left: left,
 		Op:   p.current,
 	}
@@ -526,24 +925,47 @@ func (p *Parser) infixExpr(left ast.Expr) *ast.InfixExpr {
 }
 
 func (p *Parser) callExpr(left ast.Expr) *ast.CallExpr {
-	expr := &ast.CallExpr{Left: left}
+	expr := &ast.CallExpr{
+		Loc:  ast.Loc{Position: left.Pos()},
+		Left: left,
+	}
 	expr.Arguments = p.arguments()
 	return expr
 }
 
 func (p *Parser) propExpr(left ast.Expr) *ast.PropExpr {
-	expr := &ast.PropExpr{Left: left}
-	p.expect(token.IDENT)
+	expr := &ast.PropExpr{
+		Loc:  ast.Loc{Position: left.Pos()},
+		Left: left,
+	}
+	p.advance()
+	// keywords name properties too after a dot, as in 'process.spawn'
+	if !p.check(token.IDENT) && !isKeyword(p.current) {
+		panicParseError(p.current, "expected '%s'", token.IDENT)
+	}
 	expr.Prop = p.ident()
 	return expr
 }
 
+// isKeyword tells whether tkn is a reserved word.
+func isKeyword(tkn *token.Token) bool {
+	switch tkn.Type {
+	case token.IDENT, token.STRING, token.NUMBER, token.ERROR, token.EOF, token.FUN_STAR:
+		return false
+	}
+	return tkn.Literal != "" && unicode.IsLetter([]rune(tkn.Literal)[0])
+}
+
 func (p *Parser) indexOrSliceExpr(left ast.Expr) ast.Expr {
 	p.advance()
 	index := p.expression(LOWEST)
 	p.advance()
 	if p.check(token.R_BRACK) {
-		return &ast.IndexExpr{Left: left, Index: index}
+		return &ast.IndexExpr{
+			Loc:   ast.Loc{Position: left.Pos()},
+			Left:  left,
+			Index: index,
+		}
 	}
 	if !p.check(token.COLON) {
 		panicParseError(
@@ -554,16 +976,21 @@ func (p *Parser) indexOrSliceExpr(left ast.Expr) ast.Expr {
 	p.advance()
 	end := p.expression(LOWEST)
 	p.expect(token.R_BRACK)
-	return &ast.SliceExpr{Left: left, Start: index, End: end}
+	return &ast.SliceExpr{
+		Loc:   ast.Loc{Position: left.Pos()},
+		Left:  left,
+		Start: index,
+		End:   end,
+	}
 }
 
 /* == parse utility ========================================================= */
 
-func (p *Parser) mapPairs() map[ast.Expr]ast.Expr {
-	pairs := map[ast.Expr]ast.Expr{}
+func (p *Parser) mapPairs() (map[ast.Expr]ast.Expr, []ast.Expr) {
+	pairs, keys := map[ast.Expr]ast.Expr{}, []ast.Expr{}
 	if p.peek().Type == token.R_BRACE {
 		p.advance()
-		return pairs
+		return pairs, keys
 	}
 	for {
 		p.advance()
@@ -572,6 +999,7 @@ func (p *Parser) mapPairs() map[ast.Expr]ast.Expr {
 		p.advance()
 		v := p.expression(LOWEST)
 		pairs[k] = v
+		keys = append(keys, k)
 		p.advance()
 		if p.check(token.R_BRACE) {
 			break
@@ -587,7 +1015,7 @@ func (p *Parser) mapPairs() map[ast.Expr]ast.Expr {
 			break
 		}
 	}
-	return pairs
+	return pairs, keys
 }
 
 func (p *Parser) vectorElements() []ast.Expr {
@@ -597,7 +1025,14 @@ func (p *Parser) vectorElements() []ast.Expr {
 		return elems
 	}
 	for {
-		expr := p.expression(LOWEST)
+		var expr ast.Expr
+		if p.check(token.ELLIPSIS) {
+			loc := p.loc()
+			p.advance()
+			expr = &ast.SpreadExpr{Loc: loc, Value: p.expression(LOWEST)}
+		} else {
+			expr = p.expression(LOWEST)
+		}
 		elems = append(elems, expr)
 		p.advance()
 		if p.check(token.R_BRACE) {
@@ -619,12 +1054,21 @@ func (p *Parser) vectorElements() []ast.Expr {
 
 func (p *Parser) arguments() []ast.Expr {
 	args := []ast.Expr{}
+	named := false
 	p.advance()
 	if p.check(token.R_PAREN) {
 		return args
 	}
 	for {
-		expr := p.expression(LOWEST)
+		expr := p.argument()
+		if _, ok := expr.(*ast.NamedArg); ok {
+			named = true
+		} else if named {
+			panicParseError(
+				p.current,
+				"positional argument follows named argument",
+			)
+		}
 		args = append(args, expr)
 		p.advance()
 		if p.check(token.R_PAREN) {
@@ -644,23 +1088,68 @@ func (p *Parser) arguments() []ast.Expr {
 	return args
 }
 
-func (p *Parser) parameters() []*ast.Ident {
-	params := []*ast.Ident{}
+// argument parses a call argument: 'expr', '...expr' or 'name: expr'.
+func (p *Parser) argument() ast.Expr {
+	if p.check(token.ELLIPSIS) {
+		loc := p.loc()
+		p.advance()
+		return &ast.SpreadExpr{Loc: loc, Value: p.expression(LOWEST)}
+	}
+	if p.check(token.IDENT) && p.peek().Type == token.COLON {
+		arg := &ast.NamedArg{Loc: p.loc(), Name: p.ident()}
+		p.advance()
+		p.advance()
+		arg.Value = p.expression(LOWEST)
+		return arg
+	}
+	return p.expression(LOWEST)
+}
+
+func (p *Parser) parameters() ([]*ast.Param, *ast.Ident) {
+	params := []*ast.Param{}
+	var rest *ast.Ident
 	p.advance()
 	if p.check(token.R_PAREN) {
-		return params
+		return params, rest
 	}
 	for {
+		if p.check(token.ELLIPSIS) {
+			p.expect(token.IDENT)
+			rest = p.ident()
+			p.advance()
+			if p.check(token.COMMA) {
+				p.advance()
+			}
+			if !p.check(token.R_PAREN) {
+				panicParseError(
+					p.current,
+					"expected ')' after rest parameter",
+				)
+			}
+			break
+		}
 		if !p.check(token.IDENT) {
 			panicParseError(
 				p.current,
 				"expected 'identifier'",
 			)
 		}
-		params = append(
-			params,
-			p.ident(),
-		)
+		param := &ast.Param{Loc: p.loc(), Name: p.ident()}
+		if p.peek().Type == token.COLON {
+			p.advance()
+			param.Type = p.typeAnnotation()
+		}
+		if p.peek().Type == token.ASSIGN {
+			p.advance()
+			p.advance()
+			param.Default = p.expression(LOWEST)
+		} else if len(params) > 0 && params[len(params)-1].Default != nil {
+			panicParseError(
+				p.current,
+				"parameter without default follows parameter with default",
+			)
+		}
+		params = append(params, param)
 		p.advance()
 		if p.check(token.R_PAREN) {
 			break
@@ -676,7 +1165,18 @@ func (p *Parser) parameters() []*ast.Ident {
 			break
 		}
 	}
-	return params
+	return params, rest
+}
+
+// typeAnnotation parses the type following the current ':'.
+func (p *Parser) typeAnnotation() *ast.Type {
+	p.expect(token.IDENT)
+	t := &ast.Type{Loc: p.loc(), Name: p.ident()}
+	if p.peek().Type == token.QUEST {
+		p.advance()
+		t.Nullable = true
+	}
+	return t
 }
 
 /* == utility =============================================================== */
@@ -689,6 +1189,22 @@ func isAssign(t token.TokenType) bool {
 		t == token.SLASH_ASSIGN
 }
 
+// isDestruct reports whether an expression followed by t starts a
+// destructuring assignment: 'a, b = ...' or 'vec{a, b} = ...'.
+func isDestruct(expr ast.Expr, t token.TokenType) bool {
+	if t == token.COMMA {
+		return true
+	}
+	if t != token.ASSIGN {
+		return false
+	}
+	switch expr.(type) {
+	case *ast.VectorLit, *ast.MapLit:
+		return true
+	}
+	return false
+}
+
 func convertToken(tk *token.Token) *token.Token {
 	switch tk.Type {
 	case token.PLUS_ASSIGN:
@@ -716,6 +1232,17 @@ func convertToken(tk *token.Token) *token.Token {
 	}
 }
 
+// funKind returns the kind of function introduced by the current token.
+func (p *Parser) funKind() funKind {
+	switch p.current.Type {
+	case token.FUN_STAR:
+		return funGenerator
+	case token.ASYNC:
+		return funAsync
+	}
+	return funPlain
+}
+
 func (p *Parser) currentPrecedence() precedence {
 	return precedences[p.current.Type]
 }
@@ -766,30 +1293,45 @@ func (p *Parser) check(t token.TokenType) bool {
 }
 
 func (p *Parser) peek() *token.Token {
-	temp := p.current
+	previous, temp := p.previous, p.current
 	p.advance()
 	tkn := p.current
-	p.current = temp
+	p.previous, p.current = previous, temp
 	p.backpack = tkn
 	return tkn
 }
 
 func (p *Parser) advance() {
+	p.previous = p.current
 	if p.backpack != nil {
 		p.current = p.backpack
 		p.backpack = nil
 		return
 	}
 	next := p.tokenizer.NextToken()
-	if next.Type == token.ERROR {
-		panicParseError(
-			next,
-			"error token",
-		)
+	for next.Type == token.ERROR {
+		// report bad tokens and go on as if they were not there
+		p.errors = append(p.errors, &Error{
+			Message:  badTokenMessage(next),
+			Position: next.Position,
+		})
+		next = p.tokenizer.NextToken()
 	}
 	p.current = next
 }
 
+func badTokenMessage(tk *token.Token) string {
+	switch {
+	case strings.HasPrefix(tk.Literal, "/*"):
+		return "unterminated comment"
+	case strings.HasPrefix(tk.Literal, "\""):
+		return "unterminated string"
+	case strings.HasPrefix(tk.Literal, "`"):
+		return "unterminated identifier"
+	}
+	return fmt.Sprintf("unexpected character '%s'", tk.Literal)
+}
+
 const (
 	LIT_INIT  = "init"
 	LIT_GET   = "get"
@@ -838,32 +1380,107 @@ var precedences = map[token.TokenType]precedence{
 	token.DOT:     CALL,
 }
 
-func newNullStmt() *ast.ExprStmt {
+// Precedence returns how tightly the infix or postfix operator t binds,
+// LOWEST if t is not one.
+func Precedence(t token.TokenType) precedence {
+	return precedences[t]
+}
+
+func (p *Parser) newNullStmt() *ast.ExprStmt {
 	return &ast.ExprStmt{
-		Expr: newNullExpr(),
+		Loc:  p.loc(),
+		Expr: p.newNullExpr(),
 	}
 }
 
-func newNullExpr() ast.Expr {
-	return &ast.NullLit{}
+func (p *Parser) newNullExpr() ast.Expr {
+	return &ast.NullLit{Loc: p.loc()}
 }
 
-func newBadDecl() *ast.BadDecl {
-	return &ast.BadDecl{}
+func (p *Parser) newBadDecl() *ast.BadDecl {
+	return &ast.BadDecl{Loc: p.loc()}
+}
+
+// doc returns the '///' comments on the lines right above the current
+// token, without their slashes, "" if there are none.
+func (p *Parser) doc() string {
+	c, ok := p.tokenizer.(commenter)
+	if !ok {
+		return ""
+	}
+	comments := c.Comments()
+	pos := p.current.Position
+	lines := []string{}
+	for i := len(comments) - 1; i >= 0; i-- {
+		comment := comments[i]
+		at := comment.Position
+		if at.Line > pos.Line || at.Line == pos.Line && at.Column > pos.Column {
+			continue // scanned ahead with peek
+		}
+		if at.Line != pos.Line-len(lines)-1 ||
+			!strings.HasPrefix(comment.Text, "///") ||
+			p.previous != nil && p.previous.Position.Line >= at.Line {
+			break
+		}
+		text := strings.TrimPrefix(comment.Text, "///")
+		lines = append(lines, strings.TrimPrefix(text, " "))
+	}
+	slices.Reverse(lines)
+	return strings.Join(lines, "\n")
+}
+
+// scriptDoc returns the '///' comments on the first lines of the script
+// if a blank line separates them from the first token.
+func (p *Parser) scriptDoc() string {
+	c, ok := p.tokenizer.(commenter)
+	if !ok {
+		return ""
+	}
+	lines := []string{}
+	next := 0 // line of the next comment of the block
+	for _, comment := range c.Comments() {
+		at := comment.Position
+		if !strings.HasPrefix(comment.Text, "///") || next != 0 && at.Line != next {
+			break
+		}
+		text := strings.TrimPrefix(comment.Text, "///")
+		lines = append(lines, strings.TrimPrefix(text, " "))
+		next = at.Line + 1
+	}
+	if len(lines) == 0 || p.current.Position.Line <= next {
+		return ""
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (p *Parser) loc() ast.Loc {
+	return ast.Loc{Position: p.current.Position}
 }
 
 /* == error ================================================================= */
 
+// Error is a syntax error with the position of the offending token.
+type Error struct {
+	Message  string
+	Position token.Position
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf(
+		"%s at line %d, column %d",
+		err.Message,
+		err.Position.Line,
+		err.Position.Column,
+	)
+}
+
 type parseError struct {
 	Error error
 }
 
 func panicParseError(token *token.Token, message string, a ...any) {
-	finalMessage := fmt.Sprintf(
-		"%s at line %d, column %d",
-		fmt.Sprintf(message, a...),
-		token.Position.Line,
-		token.Position.Column,
-	)
-	panic(&parseError{Error: errors.New(finalMessage)})
+	panic(&parseError{Error: &Error{
+		Message:  fmt.Sprintf(message, a...),
+		Position: token.Position,
+	}})
 }
@@ -0,0 +1,149 @@
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+	"needle/internal/needle/evaluator"
+	"strings"
+)
+
+/* == pprof ================================================================= */
+
+// WritePprof writes p in the gzipped protobuf format 'go tool pprof'
+// reads, with the samples counted and their time. Every function has a
+// single location, the line it is declared at.
+func WritePprof(w io.Writer, p *evaluator.Profile) error {
+	b := &pprofBuilder{strings: map[string]int64{"": 0}, table: []string{""}, functions: map[evaluator.FuncID]uint64{}}
+	out := &protobuf{}
+
+	valueType := func(kind, unit string) []byte {
+		vt := &protobuf{}
+		vt.int(1, b.string(kind))
+		vt.int(2, b.string(unit))
+		return vt.bytes
+	}
+	out.message(1, valueType("samples", "count"))
+	out.message(1, valueType("cpu", "nanoseconds"))
+	for _, sample := range p.Samples {
+		s := &protobuf{}
+		ids := []uint64{}
+		for _, id := range sample.Stack {
+			ids = append(ids, b.function(id))
+		}
+		s.packed(1, ids)
+		s.packed(2, []uint64{uint64(sample.Count), uint64(sample.Time.Nanoseconds())})
+		out.message(2, s.bytes)
+	}
+	for i, id := range b.order {
+		n := uint64(i + 1)
+		line := &protobuf{}
+		line.uint(1, n)
+		line.int(2, int64(id.Line))
+		location := &protobuf{}
+		location.uint(1, n)
+		location.message(4, line.bytes)
+		out.message(4, location.bytes)
+
+		// pprof drops what is between angle brackets, as in C++ templates
+		name := b.string(strings.Trim(id.Name, "<>"))
+		function := &protobuf{}
+		function.uint(1, n)
+		function.int(2, name)
+		function.int(3, name)
+		function.int(4, b.string(id.File))
+		function.int(5, int64(id.Line))
+		out.message(5, function.bytes)
+	}
+	periodType := valueType("cpu", "nanoseconds")
+	for _, s := range b.table {
+		out.message(6, []byte(s))
+	}
+	out.int(9, p.Start.UnixNano())
+	out.int(10, p.Duration.Nanoseconds())
+	out.message(11, periodType)
+	out.int(12, p.Period.Nanoseconds())
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(out.bytes); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// pprofBuilder numbers the strings and functions of a profile, the ids
+// of locations are those of their function.
+type pprofBuilder struct {
+	strings   map[string]int64
+	table     []string
+	functions map[evaluator.FuncID]uint64
+	order     []evaluator.FuncID
+}
+
+func (b *pprofBuilder) string(s string) int64 {
+	i, ok := b.strings[s]
+	if !ok {
+		i = int64(len(b.table))
+		b.strings[s] = i
+		b.table = append(b.table, s)
+	}
+	return i
+}
+
+func (b *pprofBuilder) function(id evaluator.FuncID) uint64 {
+	n, ok := b.functions[id]
+	if !ok {
+		b.order = append(b.order, id)
+		n = uint64(len(b.order))
+		b.functions[id] = n
+	}
+	return n
+}
+
+/* == protobuf ============================================================== */
+
+// protobuf encodes the few wire types a profile needs. Zero values are
+// left out as proto3 does.
+type protobuf struct {
+	bytes []byte
+}
+
+func (p *protobuf) varint(x uint64) {
+	for x >= 0x80 {
+		p.bytes = append(p.bytes, byte(x)|0x80)
+		x >>= 7
+	}
+	p.bytes = append(p.bytes, byte(x))
+}
+
+func (p *protobuf) key(field int, wireType uint64) {
+	p.varint(uint64(field)<<3 | wireType)
+}
+
+func (p *protobuf) uint(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	p.key(field, 0)
+	p.varint(x)
+}
+
+func (p *protobuf) int(field int, x int64) {
+	p.uint(field, uint64(x))
+}
+
+// message writes a length-delimited field: a nested message, a string or
+// packed numbers. Strings are written even when empty, the string table
+// starts with one.
+func (p *protobuf) message(field int, b []byte) {
+	p.key(field, 2)
+	p.varint(uint64(len(b)))
+	p.bytes = append(p.bytes, b...)
+}
+
+func (p *protobuf) packed(field int, xs []uint64) {
+	packed := &protobuf{}
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	p.message(field, packed.bytes)
+}
@@ -0,0 +1,121 @@
+// Package profile prints and exports what the evaluator records while
+// profiling: a report sorted by time, folded stacks for flame graphs and
+// the protobuf format of pprof.
+package profile
+
+import (
+	"fmt"
+	"io"
+	"needle/internal/needle/evaluator"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry sums the samples and calls of one function.
+type Entry struct {
+	Func  evaluator.FuncID
+	Self  time.Duration // in the function itself
+	Total time.Duration // in the function and what it called
+	Calls int
+}
+
+// Entries returns a function per entry, by decreasing self then total
+// time.
+func Entries(p *evaluator.Profile) []*Entry {
+	entries := map[evaluator.FuncID]*Entry{}
+	entry := func(id evaluator.FuncID) *Entry {
+		e, ok := entries[id]
+		if !ok {
+			e = &Entry{Func: id}
+			entries[id] = e
+		}
+		return e
+	}
+	for id, calls := range p.Calls {
+		entry(id).Calls = calls
+	}
+	for _, sample := range p.Samples {
+		entry(sample.Stack[0]).Self += sample.Time
+		// a recursive function is charged once per sample
+		seen := map[evaluator.FuncID]bool{}
+		for _, id := range sample.Stack {
+			if !seen[id] {
+				seen[id] = true
+				entry(id).Total += sample.Time
+			}
+		}
+	}
+	sorted := []*Entry{}
+	for _, e := range entries {
+		sorted = append(sorted, e)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Self != b.Self {
+			return a.Self > b.Self
+		}
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		return Name(a.Func) < Name(b.Func)
+	})
+	return sorted
+}
+
+// Name returns 'name file:line:column', 'name' for natives.
+func Name(id evaluator.FuncID) string {
+	if id.File == "" {
+		return id.Name
+	}
+	return fmt.Sprintf("%s %s:%d:%d", id.Name, filepath.Base(id.File), id.Line, id.Column)
+}
+
+// Report prints the functions of p by decreasing self time.
+func Report(w io.Writer, p *evaluator.Profile) {
+	var sampled time.Duration
+	count := 0
+	for _, sample := range p.Samples {
+		sampled += sample.Time
+		count += sample.Count
+	}
+	fmt.Fprintf(w, "%d samples every %v over %v\n", count, p.Period, p.Duration.Round(time.Microsecond))
+	fmt.Fprintf(w, "%12s %7s %12s %7s %10s  %s\n", "self", "self%", "total", "total%", "calls", "function")
+	for _, e := range Entries(p) {
+		fmt.Fprintf(w, "%12v %6.2f%% %12v %6.2f%% %10d  %s\n",
+			e.Self.Round(time.Microsecond), percent(e.Self, sampled),
+			e.Total.Round(time.Microsecond), percent(e.Total, sampled),
+			e.Calls, Name(e.Func))
+	}
+}
+
+func percent(d, of time.Duration) float64 {
+	if of == 0 {
+		return 0
+	}
+	return 100 * float64(d) / float64(of)
+}
+
+// WriteFolded writes a line per call stack, outermost function first and
+// functions separated by ';', followed by the microseconds spent in it:
+// the input of flamegraph.pl and most flame graph viewers.
+func WriteFolded(w io.Writer, p *evaluator.Profile) error {
+	lines := []string{}
+	for _, sample := range p.Samples {
+		names := []string{}
+		for i := len(sample.Stack) - 1; i >= 0; i-- {
+			// ';' separates frames and ' ' the weight
+			name := strings.NewReplacer(";", ",", " ", "_").Replace(Name(sample.Stack[i]))
+			names = append(names, name)
+		}
+		lines = append(lines, fmt.Sprintf("%s %d", strings.Join(names, ";"), sample.Time.Microseconds()))
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,438 @@
+// Package resolver checks that every name a script uses is declared and
+// that its imports can be found, without running it.
+package resolver
+
+import (
+	"fmt"
+	"needle/internal/needle/ast"
+	"needle/internal/needle/evaluator"
+	"needle/internal/needle/parser"
+	"needle/internal/needle/scanner"
+	"needle/internal/needle/token"
+	"needle/internal/pkg"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Error is a resolution error with the position of the offending node.
+type Error struct {
+	Message  string
+	Position token.Position
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf(
+		"%s at line %d, column %d",
+		err.Message,
+		err.Position.Line,
+		err.Position.Column,
+	)
+}
+
+type scope struct {
+	// names maps to the declaring identifier, nil for builtins and the
+	// names of unwrapped modules
+	names map[string]*ast.Ident
+	outer *scope
+	// open is set by imports whose names are unknown, every name is
+	// then assumed to be declared
+	open bool
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{names: map[string]*ast.Ident{}, outer: outer}
+}
+
+// lookup returns the identifier declaring name, if name is declared.
+func (s *scope) lookup(name string) (*ast.Ident, bool) {
+	for ; s != nil; s = s.outer {
+		if decl, ok := s.names[name]; ok {
+			return decl, true
+		}
+		if s.open {
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+type Resolver struct {
+	wd    string
+	scope *scope
+	// function bodies are resolved once the whole script is declared,
+	// they can use names declared after them
+	deferred []func()
+	errors   []error
+	info     *Info
+}
+
+// Info is what resolving a script tells about its names.
+type Info struct {
+	// Uses maps each identifier that refers to a declaration, and each
+	// declared identifier, to the identifier declaring it. Names of
+	// builtins and unwrapped modules are left out.
+	Uses map[*ast.Ident]*ast.Ident
+	// Decls maps each declared identifier to the node declaring it: a
+	// declaration, a parameter, a function for its rest parameter, or
+	// the 'for' or 'try' statement of a loop variable or exception.
+	Decls map[*ast.Ident]ast.Node
+	// Shadows maps each declared identifier that hides a declaration of
+	// an enclosing scope to the identifier it hides. Builtins are left
+	// out.
+	Shadows map[*ast.Ident]*ast.Ident
+}
+
+// Resolve checks script, whose imports are relative to wd, and returns
+// the errors sorted by position.
+func Resolve(script *ast.Script, wd string) []error {
+	errs, _ := Analyze(script, wd)
+	return errs
+}
+
+// Analyze is Resolve that also returns where every name is declared.
+func Analyze(script *ast.Script, wd string) ([]error, *Info) {
+	roof := newScope(nil)
+	for _, name := range evaluator.GlobalNames() {
+		roof.names[name] = nil
+	}
+	r := &Resolver{
+		wd:     wd,
+		scope:  newScope(roof),
+		errors: []error{},
+		info: &Info{
+			Uses:    map[*ast.Ident]*ast.Ident{},
+			Decls:   map[*ast.Ident]ast.Node{},
+			Shadows: map[*ast.Ident]*ast.Ident{},
+		},
+	}
+	r.resolve(script)
+	for len(r.deferred) > 0 {
+		f := r.deferred[0]
+		r.deferred = r.deferred[1:]
+		f()
+	}
+	sort.SliceStable(r.errors, func(i, j int) bool {
+		a := r.errors[i].(*Error).Position
+		b := r.errors[j].(*Error).Position
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	if len(r.errors) == 0 {
+		return nil, r.info
+	}
+	return r.errors, r.info
+}
+
+func (r *Resolver) resolve(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Script:
+		for _, decl := range node.Decls {
+			r.resolve(decl)
+		}
+	case *ast.Block:
+		r.inScope(func() {
+			for _, decl := range node.Decls {
+				r.resolve(decl)
+			}
+		})
+
+	case *ast.BadDecl, *ast.BadStmt:
+	case *ast.StmtDecl:
+		r.resolve(node.Stmt)
+	case *ast.VarDecl:
+		r.resolve(node.Right)
+		r.declare(node.Name, node)
+	case *ast.DestructDecl:
+		r.resolve(node.Right)
+		r.pattern(node.Pattern, node)
+	case *ast.FunDecl:
+		r.declare(node.Name, node)
+		r.resolve(node.Fun)
+	case *ast.ClassDecl:
+		r.declare(node.Name, node)
+		r.resolve(node.Class)
+	case *ast.ImportDecl:
+		r.importDecl(node)
+
+	case *ast.ExprStmt:
+		r.resolve(node.Expr)
+	case *ast.IfStmt:
+		r.resolve(node.Cond)
+		r.resolve(node.Then)
+		r.resolve(node.Else)
+	case *ast.WhileStmt:
+		r.resolve(node.Cond)
+		r.resolve(node.Do)
+	case *ast.DoStmt:
+		r.resolve(node.Do)
+		r.resolve(node.While)
+	case *ast.ForStmt:
+		r.inScope(func() {
+			r.resolve(node.Init)
+			r.resolve(node.Cond)
+			r.resolve(node.Repeat)
+			r.resolve(node.Post)
+		})
+	case *ast.ForInStmt:
+		r.resolve(node.Iter)
+		r.inScope(func() {
+			r.declare(node.Name, node)
+			r.resolve(node.Repeat)
+		})
+	case *ast.AssignStmt:
+		r.resolve(node.Left)
+		r.resolve(node.Right)
+	case *ast.DestructStmt:
+		r.resolve(node.Right)
+		r.pattern(node.Pattern, nil)
+	case *ast.SayStmt:
+		r.resolve(node.Expr)
+	case *ast.ReturnStmt:
+		r.resolve(node.Value)
+	case *ast.BreakStmt, *ast.ContinueStmt:
+	case *ast.TryStmt:
+		r.resolve(node.Try)
+		r.inScope(func() {
+			r.declare(node.As, node)
+			r.resolve(node.Catch)
+		})
+		r.resolve(node.Finally)
+	case *ast.ThrowStmt:
+		r.resolve(node.Error)
+
+	case *ast.Ident:
+		decl, ok := r.scope.lookup(node.Name)
+		if !ok {
+			r.errorf(node, "undeclared name '%s'", node.Name)
+		} else if decl != nil {
+			r.info.Uses[node] = decl
+		}
+	case *ast.InfixExpr:
+		r.resolve(node.Left)
+		r.resolve(node.Right)
+	case *ast.PrefixExpr:
+		r.resolve(node.Right)
+	case *ast.CallExpr:
+		r.resolve(node.Left)
+		for _, arg := range node.Arguments {
+			r.resolve(arg)
+		}
+	case *ast.YieldExpr:
+		r.resolve(node.Value)
+	case *ast.AwaitExpr:
+		r.resolve(node.Value)
+	case *ast.SpawnExpr:
+		r.resolve(node.Call)
+	case *ast.SpreadExpr:
+		r.resolve(node.Value)
+	case *ast.NamedArg:
+		r.resolve(node.Value)
+	case *ast.PropExpr:
+		r.resolve(node.Left)
+	case *ast.IndexExpr:
+		r.resolve(node.Left)
+		r.resolve(node.Index)
+	case *ast.SliceExpr:
+		r.resolve(node.Left)
+		r.resolve(node.Start)
+		r.resolve(node.End)
+
+	case *ast.NullLit, *ast.BooleanLit, *ast.NumberLit, *ast.StringLit,
+		*ast.SelfLit:
+	case *ast.ClassLit:
+		for _, fun := range node.Inits {
+			r.resolve(fun)
+		}
+		for _, fun := range node.Funs {
+			r.resolve(fun)
+		}
+	case *ast.FunLit:
+		r.funLit(node)
+	case *ast.VectorLit:
+		for _, elem := range node.Elems {
+			r.resolve(elem)
+		}
+	case *ast.MapLit:
+		for _, key := range node.Keys {
+			r.resolve(key)
+			r.resolve(node.Pairs[key])
+		}
+
+	case nil:
+	default:
+		panic(fmt.Sprintf("resolver: unknown node %T", node))
+	}
+}
+
+func (r *Resolver) funLit(node *ast.FunLit) {
+	closure := r.scope
+	r.deferred = append(r.deferred, func() {
+		old := r.scope
+		r.scope = newScope(closure)
+		defer func() { r.scope = old }()
+		for _, param := range node.Params {
+			if param.Default != nil {
+				r.resolve(param.Default)
+			}
+			r.declare(param.Name, param)
+		}
+		if node.Rest != nil {
+			r.declare(node.Rest, node)
+		}
+		r.resolve(node.Body)
+	})
+}
+
+// pattern declares the identifiers of the destructuring declaration
+// decl or, if decl is nil, resolves the targets of an assignment.
+func (r *Resolver) pattern(node ast.Pattern, decl ast.Node) {
+	switch node := node.(type) {
+	case *ast.VectorPattern:
+		for _, elem := range node.Elems {
+			r.pattern(elem, decl)
+		}
+		if node.Rest != nil {
+			r.pattern(node.Rest, decl)
+		}
+	case *ast.MapPattern:
+		for i, key := range node.Keys {
+			r.resolve(key)
+			r.pattern(node.Values[i], decl)
+		}
+		if node.Rest != nil {
+			r.pattern(node.Rest, decl)
+		}
+	case *ast.DefaultPattern:
+		r.resolve(node.Default)
+		r.pattern(node.Target, decl)
+	case *ast.Ident:
+		if decl != nil {
+			r.declare(node, decl)
+		} else {
+			r.resolve(node)
+		}
+	default:
+		r.resolve(node)
+	}
+}
+
+func (r *Resolver) importDecl(node *ast.ImportDecl) {
+	path := node.Path.Value
+	names, err := Exports(path, r.wd)
+	if err != nil {
+		if pkg.IsAlphaString(path) {
+			r.errorf(node.Path, "%s", err)
+		} else {
+			r.errorf(node.Path, "can't import '%s': %s", path, err)
+		}
+		r.scope.open = node.Unwrap
+	}
+	if !node.Unwrap {
+		r.declare(node.Alias, node)
+		return
+	}
+	for _, name := range names {
+		r.scope.names[name] = nil
+	}
+}
+
+// Exports returns the top level names of the module an import of path
+// loads, a file path is relative to wd.
+func Exports(path, wd string) ([]string, error) {
+	if pkg.IsAlphaString(path) {
+		names, ok := evaluator.ModuleNames(path)
+		if !ok {
+			return nil, fmt.Errorf("module '%s' doesn't exist", path)
+		}
+		return names, nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(wd, path)
+	}
+	return moduleNames(path)
+}
+
+// moduleNames parses the module at path and returns its top level names.
+func moduleNames(path string) ([]string, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	script, errs := parser.New(scanner.New([]rune(string(source)))).Parse()
+	if errs != nil {
+		return nil, errs[0]
+	}
+	names := []string{}
+	var collect func(ast.Pattern)
+	collect = func(node ast.Pattern) {
+		switch node := node.(type) {
+		case *ast.Ident:
+			names = append(names, node.Name)
+		case *ast.VectorPattern:
+			for _, elem := range node.Elems {
+				collect(elem)
+			}
+			if node.Rest != nil {
+				collect(node.Rest)
+			}
+		case *ast.MapPattern:
+			for _, value := range node.Values {
+				collect(value)
+			}
+			if node.Rest != nil {
+				collect(node.Rest)
+			}
+		case *ast.DefaultPattern:
+			collect(node.Target)
+		}
+	}
+	for _, decl := range script.Decls {
+		switch decl := decl.(type) {
+		case *ast.VarDecl:
+			names = append(names, decl.Name.Name)
+		case *ast.DestructDecl:
+			collect(decl.Pattern)
+		case *ast.FunDecl:
+			names = append(names, decl.Name.Name)
+		case *ast.ClassDecl:
+			names = append(names, decl.Name.Name)
+		case *ast.ImportDecl:
+			if !decl.Unwrap {
+				names = append(names, decl.Alias.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// declare declares name in the current scope, decl is the node that
+// declares it, see Info.Decls.
+func (r *Resolver) declare(name *ast.Ident, decl ast.Node) {
+	if _, ok := r.scope.names[name.Name]; ok {
+		r.errorf(name, "'%s' is already declared", name.Name)
+		return
+	}
+	if outer, ok := r.scope.outer.lookup(name.Name); ok && outer != nil {
+		r.info.Shadows[name] = outer
+	}
+	r.scope.names[name.Name] = name
+	r.info.Uses[name] = name
+	r.info.Decls[name] = decl
+}
+
+func (r *Resolver) inScope(f func()) {
+	old := r.scope
+	r.scope = newScope(old)
+	defer func() { r.scope = old }()
+	f()
+}
+
+func (r *Resolver) errorf(node ast.Node, message string, a ...any) {
+	r.errors = append(r.errors, &Error{
+		Message:  fmt.Sprintf(message, a...),
+		Position: node.Pos(),
+	})
+}
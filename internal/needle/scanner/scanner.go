@@ -8,10 +8,11 @@ import (
 const eof = -1
 
 type Scanner struct {
-	source []rune
-	arrow  int
-	line   int
-	column int
+	source   []rune
+	arrow    int
+	line     int
+	column   int
+	comments []*token.Comment
 }
 
 func New(source []rune) *Scanner {
@@ -27,9 +28,24 @@ func (s *Scanner) Reset() {
 	s.arrow = 0
 	s.column = 1
 	s.line = 1
+	s.comments = nil
+}
+
+// Comments returns the comments skipped so far, in source order.
+func (s *Scanner) Comments() []*token.Comment {
+	return s.comments
+}
+
+// Offset returns how many runes were read, which is where the last token
+// ends.
+func (s *Scanner) Offset() int {
+	return s.arrow
 }
 
 func (s *Scanner) NextToken() *token.Token {
+	if s.arrow == 0 {
+		s.skipShebang()
+	}
 	s.skipWhite()
 	r := s.read()
 
@@ -50,6 +66,13 @@ func (s *Scanner) NextToken() *token.Token {
 				return token.NewToken(token.NE, "!=", s.line, s.column-2)
 			}
 		}
+	} else if r == '.' && s.peek() == '.' {
+		s.read()
+		if s.peek() != '.' {
+			return token.NewToken(token.ERROR, "..", s.line, s.column-2)
+		}
+		s.read()
+		return token.NewToken(token.ELLIPSIS, "...", s.line, s.column-3)
 	} else if r == '/' && (s.peek() == '/' || s.peek() == '*') {
 		if errToken := s.skipComment(); errToken != nil {
 			return errToken
@@ -108,21 +131,36 @@ func (s *Scanner) skipWhite() {
 	}
 }
 
+// skipShebang skips a '#!' first line, so scripts can be made executable.
+func (s *Scanner) skipShebang() {
+	if len(s.source) < 2 || s.source[0] != '#' || s.source[1] != '!' {
+		return
+	}
+	for r := s.read(); r != '\n' && r != eof; r = s.read() {
+	}
+}
+
+// skipComment skips a comment and keeps it as trivia, the opening '/'
+// is already read.
 func (s *Scanner) skipComment() *token.Token {
+	start := s.arrow - 1
+	ln, col := s.line, s.column-1
 	mode := s.read() // '/' or '*'
 	if mode == '/' {
 		for {
-			r := s.read()
+			r := s.peek()
 			if r == '\n' || r == eof {
+				s.addComment(start, ln, col)
 				return nil
 			}
+			s.read()
 		}
 	} else {
-		ln, col := s.line, s.column-2
 		for {
 			r := s.read()
 			if r == '*' && s.peek() == '/' {
 				s.read()
+				s.addComment(start, ln, col)
 				return nil
 			}
 			if r == eof {
@@ -132,6 +170,14 @@ func (s *Scanner) skipComment() *token.Token {
 	}
 }
 
+func (s *Scanner) addComment(start, ln, col int) {
+	text := strings.TrimSuffix(string(s.source[start:s.arrow]), "\r")
+	s.comments = append(s.comments, &token.Comment{
+		Text:     text,
+		Position: token.Position{Line: ln, Column: col},
+	})
+}
+
 func (s *Scanner) readIdentifier(firstChar rune) *token.Token {
 	column := s.column - 1
 	var str strings.Builder
@@ -144,6 +190,10 @@ func (s *Scanner) readIdentifier(firstChar rune) *token.Token {
 		str.WriteRune(s.read())
 	}
 	literal := str.String()
+	if literal == "fun" && s.peek() == '*' {
+		s.read()
+		return token.NewToken(token.FUN_STAR, "fun*", s.line, column)
+	}
 	var type_ token.TokenType
 	if t, ok := indentifiers[literal]; ok {
 		type_ = t
@@ -285,6 +335,7 @@ var indentifiers = map[string]token.TokenType{
 	"false": token.BOOLEAN,
 
 	"for":     token.FOR,
+	"in":      token.IN,
 	"while":   token.WHILE,
 	"do":      token.DO,
 	"if":      token.IF,
@@ -297,12 +348,16 @@ var indentifiers = map[string]token.TokenType{
 	"self": token.SELF,
 
 	"return":   token.RETURN,
+	"yield":    token.YIELD,
+	"async":    token.ASYNC,
+	"await":    token.AWAIT,
 	"break":    token.BREAK,
 	"continue": token.CONTINUE,
 
 	"import": token.IMPORT,
 
-	"say": token.SAY,
+	"say":   token.SAY,
+	"spawn": token.SPAWN,
 }
 
 var escapes = map[string]rune{
@@ -312,3 +367,12 @@ var escapes = map[string]rune{
 	`\"`: '"',
 	`\\`: '\\',
 }
+
+// Keywords returns every reserved word.
+func Keywords() []string {
+	words := make([]string, 0, len(indentifiers))
+	for word := range indentifiers {
+		words = append(words, word)
+	}
+	return words
+}
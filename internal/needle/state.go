@@ -1,87 +1,182 @@
 package needle
 
 import (
-	"fmt"
+	"errors"
+	"io"
+	"needle/internal/needle/ast"
 	"needle/internal/needle/evaluator"
+	"needle/internal/needle/format"
 	"needle/internal/needle/parser"
+	"needle/internal/needle/resolver"
 	"needle/internal/needle/scanner"
 	"needle/internal/needle/token"
+	"needle/internal/needle/typecheck"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 type Needle struct {
-	ev *evaluator.Evaluator
+	ev   *evaluator.Evaluator
+	loop *evaluator.Loop
 }
 
 func New() *Needle {
+	ev := evaluator.New()
 	return &Needle{
-		ev: evaluator.New(),
+		ev:   ev,
+		loop: ev.Loop(),
 	}
 }
 
-func (n *Needle) Run(source []rune) error {
-	s := scanner.New(source)
-	script, errs := parser.New(s).Parse()
-	if errs != nil {
-		for _, err := range errs {
-			fmt.Println("compile error: ", err)
+// Version of the interpreter.
+const Version = "0.0.0"
+
+// CompileError holds every syntax or resolution error found in a script.
+type CompileError struct {
+	Errors []error
+	File   string // script the errors are in, "" if unknown
+}
+
+func (err *CompileError) Error() string {
+	var str strings.Builder
+	for i, e := range err.Errors {
+		if i != 0 {
+			str.WriteByte('\n')
 		}
-		return errs[0]
+		str.WriteString("compile error: ")
+		str.WriteString(e.Error())
 	}
-	return n.ev.EvalScript(script)
+	return str.String()
 }
 
-func (n *Needle) RunFile(path string) error {
-	abs, _ := filepath.Abs(path)
-	dir := filepath.Dir(abs)
-	n.ev.SetWorkDir(dir)
-	return n.Run(readFile(path))
+// ErrorPosition returns where a syntax, resolution or type error is in
+// its script.
+func ErrorPosition(err error) (token.Position, bool) {
+	var parseErr *parser.Error
+	var resolveErr *resolver.Error
+	var typeErr *typecheck.Error
+	switch {
+	case errors.As(err, &parseErr):
+		return parseErr.Position, true
+	case errors.As(err, &resolveErr):
+		return resolveErr.Position, true
+	case errors.As(err, &typeErr):
+		return typeErr.Position, true
+	}
+	return token.Position{}, false
 }
 
-func (n *Needle) RunFile_debug(path string) error {
-	abs, _ := filepath.Abs(path)
-	dir := filepath.Dir(abs)
-	n.ev.SetWorkDir(dir)
-	fmt.Println("[file path] ->", abs)
-	fmt.Println("[work dir] ->", dir)
+// SetArgs sets the arguments the script reads from 'os.args'.
+func (n *Needle) SetArgs(args []string) {
+	n.ev.SetArgs(args)
+}
 
-	s := scanner.New(readFile(path))
+// SetOutput redirects everything the script prints.
+func (n *Needle) SetOutput(out io.Writer) {
+	n.ev.SetOutput(out)
+}
 
-	fmt.Println("== tokens ==")
-	tokens := collectTokens(s)
-	token.PrintTokens(tokens)
-	s.Reset()
+// SetDebugger attaches a debugger that pauses the script, see package
+// debugger.
+func (n *Needle) SetDebugger(d evaluator.Debugger) {
+	n.ev.SetDebugger(d)
+}
 
-	script, errs := parser.New(s).Parse()
+// StartProfile samples the call stack of the script every period until
+// StopProfile, see package profile for the reports.
+func (n *Needle) StartProfile(period time.Duration) {
+	n.ev.StartProfile(period)
+}
 
-	fmt.Println("== ast ==")
-	fmt.Println(script)
+// StopProfile returns what was recorded since StartProfile.
+func (n *Needle) StopProfile() *evaluator.Profile {
+	return n.ev.StopProfile()
+}
 
-	if errs != nil {
-		fmt.Println("== errors ==")
-		for _, err := range errs {
-			fmt.Println(err)
-		}
-		return errs[0]
-	}
+// StartStats counts evaluated nodes, allocations and call depth until
+// StopStats.
+func (n *Needle) StartStats() {
+	n.ev.StartStats()
+}
+
+// StopStats returns the counts since StartStats.
+func (n *Needle) StopStats() *evaluator.Stats {
+	return n.ev.StopStats()
+}
+
+// SetTypeChecks makes the script check its values against its type
+// annotations while it runs.
+func (n *Needle) SetTypeChecks(on bool) {
+	n.ev.SetTypeChecks(on)
+}
+
+// SetSandbox confines the script to the files under roots, see
+// evaluator.SetSandbox.
+func (n *Needle) SetSandbox(roots []string) {
+	n.ev.SetSandbox(roots)
+}
 
-	start := time.Now()
+// StartCoverage counts the statements and branches the script runs until
+// StopCoverage, see package coverage for the reports.
+func (n *Needle) StartCoverage() {
+	n.ev.StartCoverage()
+}
 
-	fmt.Println("== runtime ==")
-	err := n.ev.EvalScript(script)
+// StopCoverage returns the counts since StartCoverage.
+func (n *Needle) StopCoverage() *evaluator.Coverage {
+	return n.ev.StopCoverage()
+}
 
-	fmt.Println("== result ==")
-	fmt.Printf("program ends in %v\n", time.Since(start))
+// Close kills the processes the scripts spawned and never waited for.
+func (n *Needle) Close() {
+	n.ev.Close()
+}
 
+func (n *Needle) Run(source []rune) error {
+	s := scanner.New(source)
+	script, errs := parser.New(s).Parse()
+	if errs != nil {
+		return &CompileError{Errors: errs}
+	}
+	if err := n.ev.EvalScript(script); err != nil {
+		return err
+	}
+	return n.loop.Run()
+}
+
+func (n *Needle) RunFile(path string) error {
+	source, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+	abs, _ := filepath.Abs(path)
+	n.ev.SetWorkDir(filepath.Dir(abs))
+	n.ev.SetFile(abs)
+	err = n.Run(source)
+	var compileErr *CompileError
+	if errors.As(err, &compileErr) {
+		compileErr.File = abs
+	}
 	return err
 }
 
-func collectTokens(tkz parser.Tokenizer) []*token.Token {
+// TestFile runs the script at path and then every case it registered
+// with the 'test' module.
+func (n *Needle) TestFile(path string) ([]evaluator.TestResult, error) {
+	if err := n.RunFile(path); err != nil {
+		return nil, err
+	}
+	return n.ev.RunTests(), nil
+}
+
+// Tokens scans source to the end, the last token is EOF.
+func Tokens(source []rune) []*token.Token {
+	s := scanner.New(source)
 	tks := []*token.Token{}
 	for {
-		tk := tkz.NextToken()
+		tk := s.NextToken()
 		tks = append(tks, tk)
 		if tk.Type == token.EOF {
 			break
@@ -90,7 +185,54 @@ func collectTokens(tkz parser.Tokenizer) []*token.Token {
 	return tks
 }
 
-func readFile(path string) []rune {
-	b, _ := os.ReadFile(path)
-	return []rune(string(b))
+func Parse(source []rune) (*ast.Script, error) {
+	script, errs := parser.New(scanner.New(source)).Parse()
+	if errs != nil {
+		return script, &CompileError{Errors: errs}
+	}
+	return script, nil
+}
+
+// Check parses source and resolves its names and imports, relative to wd,
+// without running it.
+func Check(source []rune, wd string) error {
+	script, err := Parse(source)
+	if err != nil {
+		return err
+	}
+	if errs := resolver.Resolve(script, wd); errs != nil {
+		return &CompileError{Errors: errs}
+	}
+	return nil
+}
+
+// CheckTypes does what Check does and then reports the values whose
+// inferred types don't match the annotations or their use, see package
+// typecheck.
+func CheckTypes(source []rune, wd string) error {
+	if err := Check(source, wd); err != nil {
+		return err
+	}
+	script, _ := Parse(source)
+	if errs := typecheck.Check(script, wd); errs != nil {
+		return &CompileError{Errors: errs}
+	}
+	return nil
+}
+
+// Format returns source in canonical form, see package format.
+func Format(source []rune) (string, error) {
+	out, errs := format.Source(source)
+	if errs != nil {
+		return "", &CompileError{Errors: errs}
+	}
+	return out, nil
+}
+
+func ReadFile(path string) ([]rune, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []rune(string(b)), nil
 }
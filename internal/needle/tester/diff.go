@@ -0,0 +1,50 @@
+package tester
+
+import "strings"
+
+// Diff returns a line diff of want and got built from their longest common
+// subsequence. Removed lines are marked with '-', added lines with '+'.
+func Diff(want, got []string) string {
+	// lcs[i][j] is the length of the common subsequence of want[i:], got[j:]
+	lcs := make([][]int, len(want)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(got)+1)
+	}
+	for i := len(want) - 1; i >= 0; i-- {
+		for j := len(got) - 1; j >= 0; j-- {
+			if want[i] == got[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var str strings.Builder
+	line := func(mark string, text string) {
+		str.WriteString(mark)
+		str.WriteString(text)
+		str.WriteByte('\n')
+	}
+	i, j := 0, 0
+	for i < len(want) && j < len(got) {
+		switch {
+		case want[i] == got[j]:
+			line("  ", want[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			line("- ", want[i])
+			i++
+		default:
+			line("+ ", got[j])
+			j++
+		}
+	}
+	for ; i < len(want); i++ {
+		line("- ", want[i])
+	}
+	for ; j < len(got); j++ {
+		line("+ ", got[j])
+	}
+	return str.String()
+}
@@ -0,0 +1,356 @@
+// Package tester runs needle scripts annotated with their expected output
+// and errors.
+//
+// Scripts named '*_test.ndl' are suites instead: their cases are registered
+// with the builtin 'test' module and run one by one after the script.
+//
+// A script lists what it prints with '// expect: <line>' comments, in order.
+// Trailing whitespace is ignored, both in the comments and the output.
+// Errors are declared with one of:
+//
+//	// expect error: <message>          any error containing message
+//	// expect runtime error: line <N>   exception raised at line N,
+//	                                    optionally followed by ': <message>'
+//	// expect compile error: <message>  syntax error on the comment's line
+package tester
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"needle/internal/needle"
+	"needle/internal/needle/evaluator"
+	"needle/internal/needle/parser"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	markExpect        = "// expect: "
+	markError         = "// expect error: "
+	markRuntimeError  = "// expect runtime error: "
+	markCompileError  = "// expect compile error: "
+	scriptExtension   = ".ndl"
+	suiteSuffix       = "_test.ndl"
+	runtimeLinePrefix = "line "
+)
+
+var ansi = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// Case is what a script expects from its run.
+type Case struct {
+	Path   string
+	Output []string
+
+	Error         string // substring of any error
+	RuntimeLine   int    // line of the expected exception
+	RuntimeError  string // substring of the expected exception
+	CompileErrors []compileError
+}
+
+type compileError struct {
+	line    int
+	message string
+}
+
+func (c *Case) expectsError() bool {
+	return c.Error != "" || c.RuntimeLine != 0 || len(c.CompileErrors) != 0
+}
+
+// Result is the outcome of one script. Err is nil when the script passed.
+// Cases holds the results of a suite, Coverage what the script ran when
+// covering.
+type Result struct {
+	Path     string
+	Err      error
+	Cases    []evaluator.TestResult
+	Coverage *evaluator.Coverage
+}
+
+// IsSuite reports whether the script at path is a suite of test cases.
+func IsSuite(path string) bool {
+	return strings.HasSuffix(filepath.Base(path), suiteSuffix)
+}
+
+// Discover returns the suites under root in lexical order. A path that
+// names a file is returned as is, suite or annotated script.
+func Discover(root string) ([]string, error) {
+	return walk(root, IsSuite)
+}
+
+// Scripts returns every script under root in lexical order, annotated
+// scripts and suites alike, as the interpreter's own tests are laid out.
+func Scripts(root string) ([]string, error) {
+	return walk(root, func(string) bool { return true })
+}
+
+func walk(root string, keep func(path string) bool) ([]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{root}, nil
+	}
+	paths := []string{}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && filepath.Ext(path) == scriptExtension && keep(path) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// Load reads the annotations of the script at path.
+func Load(path string) (*Case, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Case{Path: path, Output: []string{}}
+	for i, line := range strings.Split(string(source), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if _, text, ok := strings.Cut(line, markExpect); ok {
+			// leading spaces are kept for indented output
+			c.Output = append(c.Output, strings.TrimRightFunc(text, unicode.IsSpace))
+		} else if _, text, ok := strings.Cut(line, markError); ok {
+			c.Error = strings.TrimSpace(text)
+		} else if _, text, ok := strings.Cut(line, markRuntimeError); ok {
+			if err := c.parseRuntimeError(text); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+			}
+		} else if _, text, ok := strings.Cut(line, markCompileError); ok {
+			c.CompileErrors = append(c.CompileErrors, compileError{
+				line:    i + 1,
+				message: strings.TrimSpace(text),
+			})
+		}
+	}
+	return c, nil
+}
+
+func (c *Case) parseRuntimeError(text string) error {
+	text, ok := strings.CutPrefix(strings.TrimSpace(text), runtimeLinePrefix)
+	if !ok {
+		return errors.New("expected 'line <N>' in runtime error annotation")
+	}
+	num, message, _ := strings.Cut(text, ":")
+	line, err := strconv.Atoi(strings.TrimSpace(num))
+	if err != nil || line <= 0 {
+		return fmt.Errorf("invalid line '%s' in runtime error annotation", num)
+	}
+	c.RuntimeLine = line
+	c.RuntimeError = strings.TrimSpace(message)
+	return nil
+}
+
+// RunFile runs the script at path in a fresh interpreter and checks it
+// against its annotations, or runs its cases if it is a suite.
+func RunFile(path string) error {
+	return runOne(path, false).Err
+}
+
+func runScript(path string, cover bool) (*evaluator.Coverage, error) {
+	c, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	state := needle.New()
+	defer state.Close()
+	state.SetOutput(&out)
+	if cover {
+		state.StartCoverage()
+	}
+	runErr := state.RunFile(path)
+	coverage := state.StopCoverage()
+	output := strings.Split(ansi.ReplaceAllString(out.String(), ""), "\n")
+	if output[len(output)-1] == "" {
+		output = output[:len(output)-1]
+	}
+	for i, line := range output {
+		output[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	if err := c.checkError(runErr); err != nil {
+		return coverage, err
+	}
+	if !slices.Equal(c.Output, output) {
+		return coverage, fmt.Errorf("output mismatch (-want +got):\n%s", Diff(c.Output, output))
+	}
+	return coverage, nil
+}
+
+// RunSuite runs the script at path in a fresh interpreter and then the
+// cases it registered. Whatever the suite prints is discarded.
+func RunSuite(path string) ([]evaluator.TestResult, error) {
+	cases, _, err := runSuite(path, false)
+	return cases, err
+}
+
+func runSuite(path string, cover bool) ([]evaluator.TestResult, *evaluator.Coverage, error) {
+	state := needle.New()
+	defer state.Close()
+	state.SetOutput(io.Discard)
+	if cover {
+		state.StartCoverage()
+	}
+	results, err := state.TestFile(path)
+	coverage := state.StopCoverage()
+	if err != nil {
+		return nil, coverage, err
+	}
+	failed := []string{}
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", r.Name, r.Err))
+		}
+	}
+	if len(failed) != 0 {
+		return results, coverage, fmt.Errorf(
+			"%d of %d cases failed:\n%s",
+			len(failed), len(results), strings.Join(failed, "\n"),
+		)
+	}
+	return results, coverage, nil
+}
+
+func (c *Case) checkError(err error) error {
+	var exit *evaluator.Exit
+	if errors.As(err, &exit) && exit.Code == 0 {
+		err = nil
+	}
+	if err == nil {
+		if c.expectsError() {
+			return errors.New("expected an error, script succeeded")
+		}
+		return nil
+	}
+	if !c.expectsError() {
+		return fmt.Errorf("unexpected error: %w", err)
+	}
+	if c.Error != "" && !strings.Contains(err.Error(), c.Error) {
+		return fmt.Errorf("expected error containing '%s', got: %w", c.Error, err)
+	}
+	if c.RuntimeLine != 0 {
+		var exc *evaluator.Exception
+		if !errors.As(err, &exc) {
+			return fmt.Errorf("expected runtime error, got: %w", err)
+		}
+		if exc.Line != c.RuntimeLine {
+			return fmt.Errorf(
+				"expected runtime error at line %d, got line %d: %s",
+				c.RuntimeLine, exc.Line, exc.Message,
+			)
+		}
+		if !strings.Contains(exc.Message, c.RuntimeError) {
+			return fmt.Errorf(
+				"expected runtime error containing '%s', got '%s'",
+				c.RuntimeError, exc.Message,
+			)
+		}
+	}
+	if len(c.CompileErrors) != 0 {
+		return c.checkCompileErrors(err)
+	}
+	return nil
+}
+
+// checkCompileErrors wants every reported syntax error to be annotated on
+// its line and every annotation to be matched.
+func (c *Case) checkCompileErrors(err error) error {
+	var compileErr *needle.CompileError
+	if !errors.As(err, &compileErr) {
+		return fmt.Errorf("expected compile error, got: %w", err)
+	}
+	matched := make([]bool, len(c.CompileErrors))
+	for _, e := range compileErr.Errors {
+		var parseErr *parser.Error
+		if !errors.As(e, &parseErr) {
+			return fmt.Errorf("unexpected compile error: %w", e)
+		}
+		found := false
+		for i, want := range c.CompileErrors {
+			if want.line == parseErr.Position.Line &&
+				strings.Contains(parseErr.Message, want.message) {
+				matched[i] = true
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unexpected compile error: %w", e)
+		}
+	}
+	for i, ok := range matched {
+		if !ok {
+			want := c.CompileErrors[i]
+			return fmt.Errorf(
+				"missing compile error '%s' at line %d, got:\n%w",
+				want.message, want.line, err,
+			)
+		}
+	}
+	return nil
+}
+
+// Run runs scripts in parallel, each in its own interpreter, and returns
+// their results in the order of paths. With cover every result holds the
+// coverage of its script, see MergeCoverage.
+func Run(paths []string, cover bool) []Result {
+	results := make([]Result, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = runOne(paths[i], cover)
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func runOne(path string, cover bool) Result {
+	if IsSuite(path) {
+		cases, coverage, err := runSuite(path, cover)
+		return Result{Path: path, Err: err, Cases: cases, Coverage: coverage}
+	}
+	coverage, err := runScript(path, cover)
+	return Result{Path: path, Err: err, Coverage: coverage}
+}
+
+// MergeCoverage adds up the coverage of results. The suites themselves
+// are left out, they are the tests and not what is tested.
+func MergeCoverage(results []Result) *evaluator.Coverage {
+	coverage := &evaluator.Coverage{Files: map[string]*evaluator.FileCoverage{}}
+	for _, result := range results {
+		if result.Coverage != nil {
+			coverage.Merge(result.Coverage)
+		}
+	}
+	for path := range coverage.Files {
+		if IsSuite(path) {
+			delete(coverage.Files, path)
+		}
+	}
+	return coverage
+}
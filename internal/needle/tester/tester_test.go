@@ -0,0 +1,171 @@
+package tester_test
+
+import (
+	"needle/internal/needle/tester"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// write writes source to a script in a fresh directory and returns its
+// path.
+func write(t *testing.T, source string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "script.ndl")
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		err    string // substring of the error, empty if the script passes
+	}{
+		{
+			"output",
+			"say 1; // expect: 1\nsay \"a\"; // expect: \"a\"\n",
+			"",
+		},
+		{
+			"trailing whitespace",
+			"say \"a \"; // expect: \"a \"\nsay 1; // expect: 1 \t\n",
+			"",
+		},
+		{
+			"output mismatch",
+			"say 1; // expect: 1\nsay 3; // expect: 2\n",
+			"output mismatch (-want +got):\n  1\n- 2\n+ 3\n",
+		},
+		{
+			"runtime error",
+			"say 1; // expect: 1\nthrow \"boom\";\n// expect runtime error: line 2: boom\n",
+			"",
+		},
+		{
+			"runtime error without message",
+			"\nthrow \"boom\"; // expect runtime error: line 2\n",
+			"",
+		},
+		{
+			"runtime error on another line",
+			"say 1;\nthrow \"boom\"; // expect runtime error: line 1: boom\n",
+			"expected runtime error at line 1, got line 2",
+		},
+		{
+			"runtime error with another message",
+			"throw \"boom\"; // expect runtime error: line 1: bang\n",
+			"expected runtime error containing 'bang'",
+		},
+		{
+			"runtime error missing",
+			"say 1; // expect: 1\n// expect runtime error: line 1\n",
+			"expected an error, script succeeded",
+		},
+		{
+			"runtime error without line",
+			"throw \"boom\"; // expect runtime error: boom\n",
+			"expected 'line <N>' in runtime error annotation",
+		},
+		{
+			"runtime error with invalid line",
+			"throw \"boom\"; // expect runtime error: line 0: boom\n",
+			"invalid line '0' in runtime error annotation",
+		},
+		{
+			"compile error",
+			"var a = ; // expect compile error: expected\n",
+			"",
+		},
+		{
+			"compile error on another line",
+			"\nvar a = ;\n// expect compile error: expected\n",
+			"unexpected compile error",
+		},
+		{
+			"compile error missing",
+			"var a = ; // expect compile error: expected\nvar b = 1; // expect compile error: expected\n",
+			"missing compile error 'expected' at line 2",
+		},
+		{
+			"compile error at runtime",
+			"throw \"boom\"; // expect compile error: boom\n",
+			"expected compile error",
+		},
+		{
+			"unexpected error",
+			"throw \"boom\";\n",
+			"unexpected error",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := tester.RunFile(write(t, test.source))
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("expected no error, got: %s", err)
+			case test.err != "" && err == nil:
+				t.Fatalf("expected error containing %q, script passed", test.err)
+			case test.err != "" && !strings.Contains(err.Error(), test.err):
+				t.Fatalf("expected error containing %q, got: %s", test.err, err)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		want, got []string
+		expected  string
+	}{
+		{nil, nil, ""},
+		{[]string{"a", "b"}, []string{"a", "b"}, "  a\n  b\n"},
+		{[]string{"a", "b", "c"}, []string{"a", "c"}, "  a\n- b\n  c\n"},
+		{[]string{"a", "c"}, []string{"a", "b", "c"}, "  a\n+ b\n  c\n"},
+		{[]string{"a", "b"}, []string{"a", "x"}, "  a\n- b\n+ x\n"},
+		{[]string{"a"}, []string{}, "- a\n"},
+		{[]string{}, []string{"a"}, "+ a\n"},
+	}
+	for _, test := range tests {
+		if got := tester.Diff(test.want, test.got); got != test.expected {
+			t.Errorf("Diff(%q, %q): expected %q, got %q", test.want, test.got, test.expected, got)
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"util.ndl", "util_test.ndl", "sub/b_test.ndl", "notes.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rel := func(paths []string, err error) string {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, path := range paths {
+			name, _ := filepath.Rel(dir, path)
+			names = append(names, filepath.ToSlash(name))
+		}
+		return strings.Join(names, " ")
+	}
+	if got := rel(tester.Discover(dir)); got != "sub/b_test.ndl util_test.ndl" {
+		t.Errorf("Discover: got %q", got)
+	}
+	if got := rel(tester.Scripts(dir)); got != "sub/b_test.ndl util.ndl util_test.ndl" {
+		t.Errorf("Scripts: got %q", got)
+	}
+	file := filepath.Join(dir, "util.ndl")
+	if got := rel(tester.Discover(file)); got != "util.ndl" {
+		t.Errorf("Discover of a file: got %q", got)
+	}
+}
@@ -18,6 +18,12 @@ type Token struct {
 	Position Position
 }
 
+// Comment is a comment kept as trivia, Text includes the delimiters.
+type Comment struct {
+	Text     string
+	Position Position
+}
+
 func NewToken(t TokenType, lit string, ln, col int) *Token {
 	return &Token{
 		Type:    t,
@@ -82,7 +88,8 @@ const (
 	DOT    TokenType = "."
 	WOW    TokenType = "!"
 
-	ARROW TokenType = "->"
+	ARROW    TokenType = "->"
+	ELLIPSIS TokenType = "..."
 
 	OR  TokenType = "or"
 	AND TokenType = "and"
@@ -95,12 +102,14 @@ const (
 	NUMBER  TokenType = "number"
 	STRING  TokenType = "string"
 
-	FUN   TokenType = "fun"
-	CLASS TokenType = "class"
-	VEC   TokenType = "vec"
-	MAP   TokenType = "map"
+	FUN      TokenType = "fun"
+	FUN_STAR TokenType = "fun*"
+	CLASS    TokenType = "class"
+	VEC      TokenType = "vec"
+	MAP      TokenType = "map"
 
 	FOR     TokenType = "for"
+	IN      TokenType = "in"
 	WHILE   TokenType = "while"
 	DO      TokenType = "do"
 	IF      TokenType = "if"
@@ -113,9 +122,13 @@ const (
 	SELF TokenType = "self"
 
 	RETURN   TokenType = "return"
+	YIELD    TokenType = "yield"
+	ASYNC    TokenType = "async"
+	AWAIT    TokenType = "await"
 	BREAK    TokenType = "break"
 	CONTINUE TokenType = "continue"
 
 	IMPORT TokenType = "import"
 	SAY    TokenType = "say"
+	SPAWN  TokenType = "spawn"
 )
@@ -0,0 +1,674 @@
+// Package typecheck infers the types of a script and reports where they
+// contradict its annotations or what is known of its functions, classes
+// and builtin values, without running it.
+//
+// Typing is gradual: a value whose type can't be inferred goes anywhere,
+// an unannotated variable has the type of its value only if it is never
+// assigned again.
+package typecheck
+
+import (
+	"fmt"
+	"maps"
+	"needle/internal/needle/ast"
+	"needle/internal/needle/evaluator"
+	"needle/internal/needle/resolver"
+	"needle/internal/needle/token"
+	"slices"
+	"sort"
+)
+
+// Error is a type error with the position of the offending node.
+type Error struct {
+	Message  string
+	Position token.Position
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf(
+		"%s at line %d, column %d",
+		err.Message,
+		err.Position.Line,
+		err.Position.Column,
+	)
+}
+
+/* == types ================================================================= */
+
+// typ is what is known of a value, nil when nothing is.
+type typ struct {
+	name     string // of the type, as in annotations
+	nullable bool
+	fun      *ast.FunLit   // the function, when known
+	funName  string        // quoted for messages
+	class    *ast.ClassLit // the class of a class or of an instance
+	makes    *typ          // what calling fun returns if not its annotation
+}
+
+func (t *typ) String() string {
+	if t.nullable {
+		return t.name + "?"
+	}
+	return t.name
+}
+
+func named(name string) *typ {
+	return &typ{name: name}
+}
+
+// known reports whether t is more than Any.
+func known(t *typ) bool {
+	return t != nil && t.name != "Any"
+}
+
+// assignable reports whether a value of type from may go where to is
+// expected.
+func assignable(to, from *typ) bool {
+	switch {
+	case !known(to) || !known(from):
+		return true
+	case from.name == "Null":
+		return to.nullable || to.name == "Null"
+	}
+	return from.name == to.name
+}
+
+/* == checker =============================================================== */
+
+type checker struct {
+	info *resolver.Info
+	// the type of every variable known to have one, by declaring
+	// identifier
+	vars      map[*ast.Ident]*typ
+	annotated map[*ast.Ident]bool
+	assigned  map[*ast.Ident]bool
+	classes   map[string]*ast.ClassLit // declared classes by name
+	typeNames []string                 // of builtin types
+	names     map[*ast.ClassLit]string
+	methods   map[string][]string // of builtin classes
+	funs      []*ast.FunLit       // enclosing functions, innermost last
+	class     []*ast.ClassLit     // enclosing classes, innermost last
+	errors    []error
+}
+
+// Check returns the type errors of script, whose imports are relative to
+// wd, sorted by position.
+func Check(script *ast.Script, wd string) []error {
+	_, info := resolver.Analyze(script, wd)
+	c := &checker{
+		info:      info,
+		vars:      map[*ast.Ident]*typ{},
+		annotated: map[*ast.Ident]bool{},
+		assigned:  map[*ast.Ident]bool{},
+		classes:   map[string]*ast.ClassLit{},
+		names:     map[*ast.ClassLit]string{},
+		methods:   evaluator.MethodNames(),
+		typeNames: evaluator.TypeNames(),
+		errors:    []error{},
+	}
+	c.declare(script)
+	c.stmt(script)
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		a := c.errors[i].(*Error).Position
+		b := c.errors[j].(*Error).Position
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	if len(c.errors) == 0 {
+		return nil
+	}
+	return c.errors
+}
+
+func (c *checker) errorf(node ast.Node, message string, a ...any) {
+	c.errors = append(c.errors, &Error{
+		Message:  fmt.Sprintf(message, a...),
+		Position: node.Pos(),
+	})
+}
+
+// declare records what is known before checking: classes, functions,
+// annotations and the variables assigned after their declaration.
+func (c *checker) declare(script *ast.Script) {
+	ast.Inspect(script, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.ClassDecl:
+			c.classes[node.Name.Name] = node.Class
+			c.names[node.Class] = node.Name.Name
+		case *ast.AssignStmt:
+			if ident, ok := node.Left.(*ast.Ident); ok {
+				c.assigned[c.info.Uses[ident]] = true
+			}
+		case *ast.DestructStmt:
+			ast.Inspect(node.Pattern, func(node ast.Node) bool {
+				if ident, ok := node.(*ast.Ident); ok {
+					c.assigned[c.info.Uses[ident]] = true
+				}
+				return true
+			})
+		}
+		return true
+	})
+	ast.Inspect(script, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunDecl:
+			c.vars[node.Name] = &typ{name: "Function", fun: node.Fun, funName: "'" + node.Name.Name + "'"}
+		case *ast.ClassDecl:
+			c.vars[node.Name] = &typ{name: "Class", class: node.Class}
+		case *ast.VarDecl:
+			if node.Type != nil {
+				c.vars[node.Name] = c.annotation(node.Type)
+				c.annotated[node.Name] = true
+			}
+		case *ast.Param:
+			if node.Type != nil {
+				c.vars[node.Name] = c.annotation(node.Type)
+				c.annotated[node.Name] = true
+			}
+		case *ast.Type:
+			if !c.isType(node.Name.Name) {
+				c.errorf(node, "unknown type '%s'", node.Name.Name)
+			}
+		}
+		return true
+	})
+}
+
+func (c *checker) isType(name string) bool {
+	_, ok := c.classes[name]
+	return ok || slices.Contains(c.typeNames, name)
+}
+
+// annotation returns the type an annotation stands for, nil if it names
+// no type.
+func (c *checker) annotation(t *ast.Type) *typ {
+	if t == nil || !c.isType(t.Name.Name) {
+		return nil
+	}
+	result := &typ{name: t.Name.Name, nullable: t.Nullable}
+	result.class = c.classes[t.Name.Name]
+	return result
+}
+
+// instance returns the type of the instances of class.
+func (c *checker) instance(class *ast.ClassLit) *typ {
+	name, ok := c.names[class]
+	if !ok {
+		name = "(anonymous class)"
+	}
+	return &typ{name: name, class: class}
+}
+
+/* == statements ============================================================ */
+
+func (c *checker) stmt(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Script:
+		for _, decl := range node.Decls {
+			c.stmt(decl)
+		}
+	case *ast.Block:
+		for _, decl := range node.Decls {
+			c.stmt(decl)
+		}
+	case *ast.StmtDecl:
+		c.stmt(node.Stmt)
+	case *ast.VarDecl:
+		t := c.expr(node.Right)
+		_, isNull := node.Right.(*ast.NullLit)
+		switch {
+		case node.Type != nil && !isNull:
+			// a variable declared without value starts as null
+			if want := c.vars[node.Name]; !assignable(want, t) {
+				c.errorf(node.Right, "cannot use %s as %s in the declaration of '%s'", t, want, node.Name.Name)
+			}
+		case node.Type == nil && !c.assigned[node.Name]:
+			c.vars[node.Name] = t
+		}
+	case *ast.DestructDecl:
+		c.expr(node.Right)
+	case *ast.FunDecl:
+		c.funLit(node.Fun)
+	case *ast.ClassDecl:
+		c.classLit(node.Class)
+
+	case *ast.ExprStmt:
+		c.expr(node.Expr)
+	case *ast.IfStmt:
+		c.expr(node.Cond)
+		c.stmt(node.Then)
+		c.stmt(node.Else)
+	case *ast.WhileStmt:
+		c.expr(node.Cond)
+		c.stmt(node.Do)
+	case *ast.DoStmt:
+		c.stmt(node.Do)
+		c.expr(node.While)
+	case *ast.ForStmt:
+		c.stmt(node.Init)
+		c.expr(node.Cond)
+		c.stmt(node.Repeat)
+		c.stmt(node.Post)
+	case *ast.ForInStmt:
+		c.expr(node.Iter)
+		c.stmt(node.Repeat)
+	case *ast.AssignStmt:
+		c.assign(node)
+	case *ast.DestructStmt:
+		c.expr(node.Right)
+	case *ast.SayStmt:
+		c.expr(node.Expr)
+	case *ast.ReturnStmt:
+		c.returnStmt(node)
+	case *ast.TryStmt:
+		c.stmt(node.Try)
+		c.stmt(node.Catch)
+		c.stmt(node.Finally)
+	case *ast.ThrowStmt:
+		c.expr(node.Error)
+	}
+}
+
+func (c *checker) assign(node *ast.AssignStmt) {
+	t := c.expr(node.Right)
+	switch left := node.Left.(type) {
+	case *ast.Ident:
+		decl := c.info.Uses[left]
+		if want := c.vars[decl]; c.annotated[decl] && !assignable(want, t) {
+			c.errorf(node.Right, "cannot use %s as %s in the assignment of '%s'", t, want, left.Name)
+		}
+	case *ast.PropExpr:
+		if _, isSelf := left.Left.(*ast.SelfLit); isSelf && len(c.class) > 0 {
+			class := c.class[len(c.class)-1]
+			if field, ok := fieldType(class, left.Prop.Name); ok {
+				want := c.annotation(field)
+				if !assignable(want, t) {
+					c.errorf(node.Right, "cannot use %s as %s in the assignment of field '%s'", t, want, left.Prop.Name)
+				}
+			}
+			return
+		}
+		c.expr(left.Left)
+	case *ast.IndexExpr:
+		c.expr(left.Left)
+		c.expr(left.Index)
+	}
+}
+
+func (c *checker) returnStmt(node *ast.ReturnStmt) {
+	t := c.expr(node.Value)
+	if len(c.funs) == 0 {
+		return
+	}
+	fun := c.funs[len(c.funs)-1]
+	if fun.Return == nil || fun.Generator || fun.Async {
+		return
+	}
+	if want := c.annotation(fun.Return); !assignable(want, t) {
+		c.errorf(node.Value, "cannot return %s from a function returning %s", t, want)
+	}
+}
+
+func (c *checker) funLit(lit *ast.FunLit) {
+	c.funs = append(c.funs, lit)
+	defer func() { c.funs = c.funs[:len(c.funs)-1] }()
+	for _, param := range lit.Params {
+		if param.Default == nil {
+			continue
+		}
+		t := c.expr(param.Default)
+		if want := c.annotation(param.Type); !assignable(want, t) {
+			c.errorf(param.Default, "cannot use %s as %s for the default of '%s'", t, want, param.Name.Name)
+		}
+	}
+	c.stmt(lit.Body)
+}
+
+func (c *checker) classLit(lit *ast.ClassLit) {
+	c.class = append(c.class, lit)
+	defer func() { c.class = c.class[:len(c.class)-1] }()
+	for _, fun := range lit.Inits {
+		c.funLit(fun)
+	}
+	for _, fun := range lit.Funs {
+		c.funLit(fun)
+	}
+}
+
+// fieldType returns the annotation of a declared field, nil if it has
+// none, and whether the field is declared.
+func fieldType(class *ast.ClassLit, name string) (*ast.Type, bool) {
+	for ident, t := range class.Fields {
+		if ident.Name == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func method(funs map[*ast.Ident]*ast.FunLit, name string) *ast.FunLit {
+	for ident, fun := range funs {
+		if ident.Name == name {
+			return fun
+		}
+	}
+	return nil
+}
+
+/* == expressions =========================================================== */
+
+// expr checks node and returns its type, nil if it can't be inferred.
+func (c *checker) expr(node ast.Expr) *typ {
+	switch node := node.(type) {
+	case *ast.NullLit:
+		return named("Null")
+	case *ast.BooleanLit:
+		return named("Boolean")
+	case *ast.NumberLit:
+		return named("Number")
+	case *ast.StringLit:
+		return named("String")
+	case *ast.VectorLit:
+		for _, elem := range node.Elems {
+			c.expr(elem)
+		}
+		return named("Vector")
+	case *ast.MapLit:
+		for key, value := range node.Pairs {
+			c.expr(key)
+			c.expr(value)
+		}
+		return named("Map")
+	case *ast.FunLit:
+		c.funLit(node)
+		return &typ{name: "Function", fun: node, funName: "the function"}
+	case *ast.ClassLit:
+		c.classLit(node)
+		return &typ{name: "Class", class: node}
+	case *ast.SelfLit:
+		if len(c.class) == 0 {
+			return nil
+		}
+		return c.instance(c.class[len(c.class)-1])
+
+	case *ast.Ident:
+		decl := c.info.Uses[node]
+		if decl == nil || c.assigned[decl] && !c.annotated[decl] {
+			return nil
+		}
+		return c.vars[decl]
+	case *ast.PrefixExpr:
+		return c.prefix(node)
+	case *ast.InfixExpr:
+		return c.infix(node)
+	case *ast.CallExpr:
+		return c.call(node)
+	case *ast.PropExpr:
+		return c.prop(node)
+	case *ast.IndexExpr:
+		left := c.expr(node.Left)
+		c.expr(node.Index)
+		if known(left) && left.name == "String" {
+			return left
+		}
+	case *ast.SliceExpr:
+		left := c.expr(node.Left)
+		c.expr(node.Start)
+		c.expr(node.End)
+		if known(left) && (left.name == "String" || left.name == "Vector") {
+			return left
+		}
+	case *ast.YieldExpr:
+		c.expr(node.Value)
+	case *ast.AwaitExpr:
+		c.expr(node.Value)
+	case *ast.SpawnExpr:
+		c.call(node.Call)
+		return named("Task")
+	case *ast.SpreadExpr:
+		c.expr(node.Value)
+	case *ast.NamedArg:
+		return c.expr(node.Value)
+	}
+	return nil
+}
+
+func (c *checker) prefix(node *ast.PrefixExpr) *typ {
+	right := c.expr(node.Right)
+	switch node.Op.Type {
+	case token.WOW:
+		return named("Boolean")
+	case token.MINUS, token.PLUS:
+		if known(right) && right.name != "Number" {
+			c.errorf(node, "operator '%s' is not defined on %s", node.Op.Literal, right)
+		}
+		return named("Number")
+	}
+	return nil
+}
+
+// infix checks the operands of the operators defined on numbers and
+// strings only. The equality of other values is left to the linter.
+func (c *checker) infix(node *ast.InfixExpr) *typ {
+	left, right := c.expr(node.Left), c.expr(node.Right)
+	op := node.Op.Type
+	switch op {
+	case token.EQ, token.NE, token.IS, token.ISNT:
+		return named("Boolean")
+	case token.AND, token.OR:
+		if known(left) && known(right) && left.name == right.name {
+			return named(left.name)
+		}
+		return nil
+	}
+	if !known(left) {
+		return nil
+	}
+	if left.name == "DateTime" || left.name == "Duration" {
+		return c.timeInfix(node, left, right)
+	}
+	switch {
+	case left.name == "Number":
+	case left.name == "String" && op == token.PLUS:
+	default:
+		c.errorf(node, "operator '%s' is not defined on %s", node.Op.Literal, left)
+		return nil
+	}
+	if known(right) && right.name != left.name {
+		c.errorf(node, "mismatched types %s and %s for '%s'", left, right, node.Op.Literal)
+	}
+	switch op {
+	case token.LT, token.LE, token.GT, token.GE:
+		return named("Boolean")
+	}
+	return named(left.name)
+}
+
+// timeOps are the results of the arithmetic of DateTime and Duration by
+// left operand, operator and right operand.
+var timeOps = map[[3]string]string{
+	{"DateTime", "+", "Duration"}: "DateTime",
+	{"DateTime", "-", "Duration"}: "DateTime",
+	{"DateTime", "-", "DateTime"}: "Duration",
+	{"Duration", "+", "Duration"}: "Duration",
+	{"Duration", "-", "Duration"}: "Duration",
+	{"Duration", "*", "Number"}:   "Duration",
+	{"Duration", "/", "Number"}:   "Duration",
+	{"Duration", "/", "Duration"}: "Number",
+}
+
+// timeInfix returns the type of an operation on a DateTime or a Duration,
+// nil when it depends on an unknown right operand.
+func (c *checker) timeInfix(node *ast.InfixExpr, left, right *typ) *typ {
+	op := node.Op.Literal
+	switch node.Op.Type {
+	case token.LT, token.LE, token.GT, token.GE:
+		if known(right) && right.name != left.name {
+			c.errorf(node, "mismatched types %s and %s for '%s'", left, right, op)
+		}
+		return named("Boolean")
+	}
+	if known(right) {
+		if result, ok := timeOps[[3]string{left.name, op, right.name}]; ok {
+			return named(result)
+		}
+		c.errorf(node, "mismatched types %s and %s for '%s'", left, right, op)
+		return nil
+	}
+	results := map[string]bool{}
+	for key, result := range timeOps {
+		if key[0] == left.name && key[1] == op {
+			results[result] = true
+		}
+	}
+	if len(results) == 0 {
+		c.errorf(node, "operator '%s' is not defined on %s", op, left)
+	}
+	if len(results) != 1 {
+		return nil
+	}
+	for result := range results {
+		return named(result)
+	}
+	return nil
+}
+
+// prop returns the type of a property: a method of a class or of a
+// builtin value, or a field read through 'self'.
+func (c *checker) prop(node *ast.PropExpr) *typ {
+	left := c.expr(node.Left)
+	if !known(left) {
+		return nil
+	}
+	name := node.Prop.Name
+	switch {
+	case left.name == "Null":
+		c.errorf(node.Prop, "property '%s' of null", name)
+	case left.name == "Class" && left.class != nil:
+		if init := method(left.class.Inits, name); init != nil {
+			return &typ{
+				name:    "Function",
+				fun:     init,
+				funName: "'" + name + "'",
+				makes:   c.instance(left.class),
+			}
+		}
+		c.errorf(node.Prop, "%s has no initializer '%s'", c.instance(left.class), name)
+	case left.class != nil:
+		if fun := method(left.class.Funs, name); fun != nil {
+			return &typ{name: "Function", fun: fun, funName: "'" + name + "'"}
+		}
+		_, isSelf := node.Left.(*ast.SelfLit)
+		if !isSelf {
+			c.errorf(node.Prop, "%s has no method '%s'", left, name)
+			return nil
+		}
+		if field, ok := fieldType(left.class, name); ok {
+			return c.annotation(field)
+		}
+		if len(left.class.Fields) != 0 {
+			c.errorf(node.Prop, "%s has no field or method '%s'", left, name)
+		}
+	default:
+		methods, ok := c.methods[left.name]
+		if ok && !slices.Contains(methods, name) {
+			c.errorf(node.Prop, "%s has no method '%s'", left, name)
+		}
+	}
+	return nil
+}
+
+func (c *checker) call(node *ast.CallExpr) *typ {
+	callee := c.expr(node.Left)
+	args := []argument{}
+	namedArgs := map[string]argument{}
+	spread := false
+	for _, arg := range node.Arguments {
+		switch arg := arg.(type) {
+		case *ast.SpreadExpr:
+			c.expr(arg.Value)
+			spread = true
+		case *ast.NamedArg:
+			namedArgs[arg.Name.Name] = argument{arg.Value, c.expr(arg.Value)}
+		default:
+			args = append(args, argument{arg, c.expr(arg)})
+		}
+	}
+	if callee == nil || callee.fun == nil {
+		return nil
+	}
+	if !spread {
+		c.arguments(node, callee, args, namedArgs)
+	}
+	switch fun := callee.fun; {
+	case fun.Generator:
+		return named("Generator")
+	case fun.Async:
+		return named("Promise")
+	case callee.makes != nil:
+		return callee.makes
+	default:
+		return c.annotation(fun.Return)
+	}
+}
+
+// argument is an argument of a call and its type.
+type argument struct {
+	expr ast.Expr
+	t    *typ
+}
+
+// arguments checks the number and the types of the arguments of a call
+// to a known function.
+func (c *checker) arguments(node *ast.CallExpr, callee *typ, args []argument, namedArgs map[string]argument) {
+	fun := callee.fun
+	min, max := 0, len(fun.Params)
+	for _, param := range fun.Params {
+		if param.Default == nil {
+			min++
+		}
+	}
+	if fun.Rest != nil {
+		max = -1
+	}
+	switch {
+	case len(namedArgs) == 0 && (len(args) < min || max >= 0 && len(args) > max):
+		c.errorf(node, "%s expects %s, got %d", callee.funName, arity(min, max), len(args))
+		return
+	case max >= 0 && len(args) > max:
+		c.errorf(node, "%s expects at most %d positional arguments, got %d", callee.funName, max, len(args))
+		return
+	}
+	params := map[string]bool{}
+	for i, param := range fun.Params {
+		params[param.Name.Name] = true
+		arg, isNamed := namedArgs[param.Name.Name]
+		switch {
+		case i < len(args):
+			arg = args[i]
+		case !isNamed && param.Default == nil:
+			c.errorf(node, "missing argument '%s' to %s", param.Name.Name, callee.funName)
+			continue
+		}
+		if want := c.annotation(param.Type); !assignable(want, arg.t) {
+			c.errorf(arg.expr, "cannot use %s as %s for argument '%s' of %s", arg.t, want, param.Name.Name, callee.funName)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(namedArgs)) {
+		if !params[name] {
+			c.errorf(namedArgs[name].expr, "%s has no parameter '%s'", callee.funName, name)
+		}
+	}
+}
+
+func arity(min, max int) string {
+	switch {
+	case min == max:
+		return fmt.Sprintf("%d arguments", min)
+	case max < 0:
+		return fmt.Sprintf("at least %d arguments", min)
+	}
+	return fmt.Sprintf("%d to %d arguments", min, max)
+}
@@ -0,0 +1,99 @@
+package typecheck_test
+
+import (
+	"bytes"
+	"fmt"
+	"needle/internal/needle"
+	"needle/internal/needle/typecheck"
+	"strings"
+	"testing"
+)
+
+const script = `var x: Number = 1;
+x = "one";
+fun add(a: Number, b: Number): Number -> a + b;
+add(1, 2, 3);
+add("a", 2);
+var s = "hello";
+s.push(1);
+var n: Number? = null;
+var bad: Strng = "a";
+fun name(): String { return 1; }
+class Point {
+    var x: Number;
+    init new(x) { self.x = "x"; }
+    fun norm() -> self.x * self.z
+}
+var p = Point.new(1);
+p.size();
+Point.make();
+say 1 + "a";
+add(1, c: 2);
+var free = 1;
+free = "free";
+say free - 1;
+fun span(a: DateTime, b: DateTime): Duration -> a - b;
+fun later(a: DateTime, d: Duration): DateTime -> a + d * 2;
+fun wrong(a: DateTime, b: DateTime) -> a + b;
+fun worse(d: Duration) -> d + 1;
+`
+
+func TestCheck(t *testing.T) {
+	script, err := needle.Parse([]rune(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, err := range typecheck.Check(script, t.TempDir()) {
+		err := err.(*typecheck.Error)
+		got = append(got, fmt.Sprintf("%d:%d %s", err.Position.Line, err.Position.Column, err.Message))
+	}
+	want := []string{
+		"2:5 cannot use String as Number in the assignment of 'x'",
+		"4:1 'add' expects 2 arguments, got 3",
+		"5:5 cannot use String as Number for argument 'a' of 'add'",
+		"7:3 String has no method 'push'",
+		"9:10 unknown type 'Strng'",
+		"10:29 cannot return Number from a function returning String",
+		"13:28 cannot use String as Number in the assignment of field 'x'",
+		"14:33 Point has no field or method 'z'",
+		"17:3 Point has no method 'size'",
+		"18:7 Point has no initializer 'make'",
+		"19:5 mismatched types Number and String for '+'",
+		"20:1 missing argument 'b' to 'add'",
+		"20:11 'add' has no parameter 'c'",
+		"26:40 mismatched types DateTime and DateTime for '+'",
+		"27:27 mismatched types Duration and Number for '+'",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestRuntimeChecks(t *testing.T) {
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{`var x: Number = "1";`, "type error: 'x' is Number, got String"},
+		{`var x: Number?; x = 1; x = null; x = "1";`, "type error: 'x' is Number?, got String"},
+		{`fun f(a: String) {} f(1);`, "type error: argument 'a' is String, got Number"},
+		{`fun f(): Number -> "1"; f();`, "type error: the result of 'f' is Number, got String"},
+		{`fun f(): Number {} f();`, "type error: the result of 'f' is Number, got Null"},
+		{`class C { var v: Boolean; init new() { self.v = 1; } } C.new();`,
+			"type error: field 'v' is Boolean, got Number"},
+		{`class C { init new() {} } var c: C = C.new(); var a: Any = c; say a;`, ""},
+	}
+	for _, test := range tests {
+		state := needle.New()
+		state.SetOutput(&bytes.Buffer{})
+		state.SetTypeChecks(true)
+		err := state.Run([]rune(test.source))
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %s", test.source, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: expected %q, got %v", test.source, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"bytes"
+	"needle/internal/needle"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a buffer written by the interpreter while the test reads.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestDroppedGenerator drops suspended generators and checks that they
+// are closed once collected, their 'finally' blocks running.
+func TestDroppedGenerator(t *testing.T) {
+	script := `fun* naturals() {
+    try {
+        for (i := 0; ; i += 1) yield i;
+    } finally {
+        say "closed";
+    }
+}
+fun drop() {
+    var g = naturals();
+    g.next();
+}
+for (i := 0; i < 10; i += 1) drop();
+`
+	state := needle.New()
+	var out syncBuffer
+	state.SetOutput(&out)
+	if err := state.Run([]rune(script)); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(out.String(), "closed") != 10 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 10 generators closed, got output %q", out.String())
+		}
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
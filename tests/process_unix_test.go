@@ -0,0 +1,38 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"needle/internal/needle"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestUnwaitedProcess checks that closing the interpreter kills and reaps
+// a process the script spawned and never waited for.
+func TestUnwaitedProcess(t *testing.T) {
+	state := needle.New()
+	var out bytes.Buffer
+	state.SetOutput(&out)
+	err := state.Run([]rune(`import process "process";
+say process.spawn("/bin/sleep", vec{"30"}).pid();
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(out.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(pid, 0); err != nil {
+		t.Fatalf("the process is not running: %s", err)
+	}
+	state.Close()
+	if err := syscall.Kill(pid, 0); !errors.Is(err, syscall.ESRCH) {
+		t.Fatalf("expected the process to be gone, got %v", err)
+	}
+}
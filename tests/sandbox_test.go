@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"bytes"
+	"needle/internal/needle"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSandbox runs a script confined to its directory and checks that
+// the files around it are out of reach, through symbolic links too, and
+// that it can't run other programs.
+func TestSandbox(t *testing.T) {
+	root := t.TempDir()
+	inside := filepath.Join(root, "inside")
+	if err := os.Mkdir(inside, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(inside, "link")); err != nil {
+		t.Fatal(err)
+	}
+	script := `import fs "fs";
+import process "process";
+fs.write_text("a.txt", "a");
+say fs.read_text("a.txt");
+say fs.glob("*.txt").length();
+for (path in vec{"../secret.txt", "link/secret.txt", "/"}) {
+    try {
+        fs.exists(path);
+        say "reached " + path;
+    } catch (e) {
+        say "refused";
+    }
+}
+try {
+    process.run("/bin/echo");
+    say "ran";
+} catch (e) {
+    say "refused";
+}
+`
+	path := filepath.Join(inside, "main.ndl")
+	if err := os.WriteFile(path, []byte(script), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	state := needle.New()
+	var out bytes.Buffer
+	state.SetOutput(&out)
+	state.SetSandbox([]string{inside})
+	if err := state.RunFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{`"a"`, "1", `"refused"`, `"refused"`, `"refused"`, `"refused"`}
+	if got := strings.Fields(out.String()); strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,23 @@
+package tests
+
+import (
+	"needle/internal/needle/tester"
+	"testing"
+)
+
+// TestScripts runs every script in this directory against its
+// '// expect' annotations.
+func TestScripts(t *testing.T) {
+	paths, err := tester.Scripts(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			t.Parallel()
+			if err := tester.RunFile(path); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}